@@ -103,6 +103,8 @@ func (h *InternalHandler) ProvisionDevice(c *gin.Context) {
 		c.Status(http.StatusAccepted)
 	case app.ErrDeviceAlreadyExists:
 		rest.RenderError(c, http.StatusConflict, cause)
+	case app.ErrTooManyTasks, app.ErrShuttingDown:
+		rest.RenderError(c, http.StatusServiceUnavailable, cause)
 	default:
 		rest.RenderError(c, http.StatusInternalServerError, err)
 	}
@@ -122,6 +124,8 @@ func (h *InternalHandler) DecommissionDevice(c *gin.Context) {
 		c.Status(http.StatusAccepted)
 	case app.ErrDeviceNotFound:
 		rest.RenderError(c, http.StatusNotFound, err)
+	case app.ErrTooManyTasks, app.ErrShuttingDown:
+		rest.RenderError(c, http.StatusServiceUnavailable, err)
 	default:
 		rest.RenderError(c, http.StatusInternalServerError, err)
 	}
@@ -160,10 +164,21 @@ func (h *InternalHandler) BulkSetDeviceStatus(c *gin.Context) {
 			Tenant: c.Param("tenant_id"),
 		},
 	)
-	for _, item := range schema {
-		_ = h.app.SetDeviceStatus(ctx, item.DeviceID, status)
+	deviceIDs := make([]string, len(schema))
+	for i, item := range schema {
+		deviceIDs[i] = item.DeviceID
+	}
+	err := h.app.BulkSetDeviceStatus(ctx, deviceIDs, status)
+	switch errors.Cause(err) {
+	case nil:
+		c.Status(http.StatusAccepted)
+	case app.ErrTooManyTasks, app.ErrShuttingDown:
+		// None of the status changes is queued: the whole request can
+		// be retried once the queue is drained.
+		rest.RenderError(c, http.StatusServiceUnavailable, err)
+	default:
+		rest.RenderError(c, http.StatusInternalServerError, err)
 	}
-	c.Status(http.StatusAccepted)
 }
 
 // POST /tenants/:tenant_id/auth
@@ -32,7 +32,6 @@ import (
 	"github.com/mendersoftware/go-lib-micro/rest.utils"
 	"github.com/mendersoftware/iot-manager/app"
 	mapp "github.com/mendersoftware/iot-manager/app/mocks"
-	"github.com/mendersoftware/iot-manager/client"
 	"github.com/mendersoftware/iot-manager/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -166,6 +165,25 @@ func TestProvisionDevice(t *testing.T) {
 
 		StatusCode: http.StatusInternalServerError,
 		Error:      errors.New("internal error"),
+	}, {
+		Name: "error/too many tasks",
+
+		TenantID: "123456789012345678901234",
+		Body: model.DeviceEvent{
+			ID: "b8ea97f2-1c2b-492c-84ce-7a90170291b9",
+		},
+		App: func(t *testing.T, self *testCase) *mapp.App {
+			mock := new(mapp.App)
+			device := self.Body.(model.DeviceEvent)
+			mock.On("ProvisionDevice",
+				validateTenantIDCtx(self.TenantID),
+				device).
+				Return(app.ErrTooManyTasks)
+			return mock
+		},
+
+		StatusCode: http.StatusServiceUnavailable,
+		Error:      app.ErrTooManyTasks,
 	}}
 
 	for i := range testCases {
@@ -282,6 +300,23 @@ func TestDecommissionDevice(t *testing.T) {
 
 		StatusCode: http.StatusInternalServerError,
 		Error:      errors.New("internal error"),
+	}, {
+		Name: "error/shutting down",
+
+		TenantID: "123456789012345678901234",
+		DeviceID: "a8d77d55-ebaa-4ace-b9d4-a2bb581d87f8",
+
+		App: func(t *testing.T, self *testCase) *mapp.App {
+			mock := new(mapp.App)
+			mock.On("DecommissionDevice",
+				validateTenantIDCtx(self.TenantID),
+				self.DeviceID).
+				Return(app.ErrShuttingDown)
+			return mock
+		},
+
+		StatusCode: http.StatusServiceUnavailable,
+		Error:      app.ErrShuttingDown,
 	}}
 
 	for i := range testCases {
@@ -345,14 +380,15 @@ func TestBulkSetDeviceStatus(t *testing.T) {
 
 		App: func(t *testing.T, self *testCase) *mapp.App {
 			mockApp := new(mapp.App)
-			req := self.ReqBody.([]map[string]interface{})
-			for _, id := range req {
-				mockApp.On("SetDeviceStatus",
-					contextMatcher,
-					id["id"],
-					model.StatusAccepted,
-				).Return(nil)
-			}
+			mockApp.On("BulkSetDeviceStatus",
+				contextMatcher,
+				[]string{
+					"960700f7-d563-4a31-94e6-a075fe6566bc",
+					"3fd916c1-6a5a-423c-b7da-739bf21c7779",
+					"1cb050b9-c20c-4807-bdbd-bc5650617198",
+				},
+				model.StatusAccepted,
+			).Return(nil).Once()
 			return mockApp
 		},
 		StatusCode: http.StatusAccepted,
@@ -365,44 +401,65 @@ func TestBulkSetDeviceStatus(t *testing.T) {
 
 		App: func(t *testing.T, self *testCase) *mapp.App {
 			mockApp := new(mapp.App)
+			mockApp.On("BulkSetDeviceStatus",
+				contextMatcher,
+				[]string{},
+				model.StatusPending,
+			).Return(nil).Once()
 			return mockApp
 		},
 		Response:   nil,
 		StatusCode: http.StatusAccepted,
 	}, {
-		Name: "error, partial result",
+		Name: "error, internal error",
 
 		TenantID: "123456789012345678901234",
 		ReqBody: []map[string]interface{}{{
 			"id": "960700f7-d563-4a31-94e6-a075fe6566bc",
-		}, {
-			"id": "3fd916c1-6a5a-423c-b7da-739bf21c7779",
-		}, {
-			"id": "1cb050b9-c20c-4807-bdbd-bc5650617198",
 		}},
 		Status: model.StatusPreauthorized,
 
 		App: func(t *testing.T, self *testCase) *mapp.App {
 			mockApp := new(mapp.App)
-			req := self.ReqBody.([]map[string]interface{})
-			mockApp.On("SetDeviceStatus",
-				contextMatcher,
-				req[0]["id"],
-				self.Status,
-			).Return(nil).Once()
-			mockApp.On("SetDeviceStatus",
+			mockApp.On("BulkSetDeviceStatus",
 				contextMatcher,
-				req[1]["id"],
+				[]string{"960700f7-d563-4a31-94e6-a075fe6566bc"},
 				self.Status,
 			).Return(errors.New("internal error")).Once()
-			mockApp.On("SetDeviceStatus",
+			return mockApp
+		},
+		StatusCode: http.StatusInternalServerError,
+		Response: regexp.MustCompile(
+			`{"error":\s?"internal error",\s?"request_id":\s?"test"}`,
+		),
+	}, {
+		Name: "error: too many tasks",
+
+		TenantID: "123456789012345678901234",
+		ReqBody: []map[string]interface{}{{
+			"id": "960700f7-d563-4a31-94e6-a075fe6566bc",
+		}, {
+			"id": "3fd916c1-6a5a-423c-b7da-739bf21c7779",
+		}},
+		Status: model.StatusAccepted,
+
+		App: func(t *testing.T, self *testCase) *mapp.App {
+			mockApp := new(mapp.App)
+			mockApp.On("BulkSetDeviceStatus",
 				contextMatcher,
-				req[2]["id"],
+				[]string{
+					"960700f7-d563-4a31-94e6-a075fe6566bc",
+					"3fd916c1-6a5a-423c-b7da-739bf21c7779",
+				},
 				self.Status,
-			).Return(client.NewHTTPError(http.StatusConflict)).Once()
+			).Return(app.ErrTooManyTasks).Once()
 			return mockApp
 		},
-		StatusCode: http.StatusAccepted,
+		StatusCode: http.StatusServiceUnavailable,
+		Response: regexp.MustCompile(
+			`{"error":\s?"too many pending device events, try again later",` +
+				`\s?"request_id":\s?"test"}`,
+		),
 	}, {
 		Name: "error: invalid request body",
 
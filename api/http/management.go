@@ -16,14 +16,21 @@ package http
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
 	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
 	"github.com/mendersoftware/go-lib-micro/rest.utils"
 
 	"github.com/mendersoftware/iot-manager/app"
@@ -35,9 +42,26 @@ var (
 		"user identity missing from authorization token",
 	)
 	ErrIntegrationNotFound = errors.New("integration not found")
+	ErrEventNotFound       = errors.New("event not found")
 )
 
-const hdrLocation = "Location"
+const (
+	hdrLocation = "Location"
+	hdrLink     = "Link"
+	hdrETag     = "ETag"
+	hdrIfMatch  = "If-Match"
+
+	queryIntegrationID = "integration_id"
+	queryPage          = "page"
+	queryCursor        = "cursor"
+	queryType          = "type"
+	querySuccess       = "success"
+	queryDeviceID      = "device_id"
+	queryFrom          = "from"
+	queryTo            = "to"
+	queryCleanup       = "cleanup"
+	queryForce         = "force"
+)
 
 func getContextAndIdentity(c *gin.Context) (context.Context, *identity.Identity, error) {
 	var (
@@ -89,15 +113,19 @@ func (h *ManagementHandler) CreateIntegration(c *gin.Context) {
 		return
 	}
 
-	// TODO verify that Azure connectionstring / AWS equivalent has correct permissions
-	//      - service
-	//      - registry read/write
-
 	inserted, err := h.app.CreateIntegration(ctx, integration)
 	if err != nil {
-		switch cause := errors.Cause(err); cause {
-		case app.ErrIntegrationExists:
-			// NOTE: temporary limitation
+		var (
+			credErr *app.CredentialsError
+			provErr *app.ProviderError
+		)
+		switch cause := errors.Cause(err); {
+		case errors.As(err, &credErr):
+			renderCredentialsError(c, credErr)
+		case errors.As(err, &provErr):
+			_ = c.Error(err)
+			rest.RenderError(c, http.StatusBadGateway, provErr)
+		case cause == app.ErrIntegrationExists, cause == app.ErrSelectorOverlap:
 			rest.RenderError(c, http.StatusConflict, cause)
 		default:
 			_ = c.Error(err)
@@ -144,6 +172,84 @@ func (h *ManagementHandler) GetIntegrationById(c *gin.Context) {
 		return
 	}
 
+	c.Header(hdrETag, integration.ETag())
+	c.JSON(http.StatusOK, integration)
+}
+
+// PATCH /integrations/{id}
+func (h *ManagementHandler) UpdateIntegration(c *gin.Context) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+	integrationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "integration ID must be a valid UUID"),
+		)
+		return
+	}
+
+	var patch map[string]interface{}
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "malformed request body"),
+		)
+		return
+	}
+
+	integration, err := h.app.GetIntegrationById(ctx, integrationID)
+	if err != nil {
+		switch cause := errors.Cause(err); cause {
+		case app.ErrIntegrationNotFound:
+			rest.RenderError(c, http.StatusNotFound, ErrIntegrationNotFound)
+		default:
+			rest.RenderError(c,
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return
+	}
+	if ifMatch := c.GetHeader(hdrIfMatch); ifMatch != "" &&
+		ifMatch != "*" && ifMatch != integration.ETag() {
+		rest.RenderError(c, http.StatusPreconditionFailed, app.ErrIntegrationConflict)
+		return
+	}
+
+	integration, err = integration.MergePatch(patch)
+	if err == nil {
+		err = integration.Validate()
+	}
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "invalid integration patch"),
+		)
+		return
+	}
+
+	integration, err = h.app.UpdateIntegration(ctx, *integration)
+	if err != nil {
+		switch cause := errors.Cause(err); cause {
+		case app.ErrIntegrationNotFound:
+			rest.RenderError(c, http.StatusNotFound, ErrIntegrationNotFound)
+		case app.ErrIntegrationConflict:
+			rest.RenderError(c, http.StatusPreconditionFailed, cause)
+		case app.ErrIntegrationExists, app.ErrSelectorOverlap:
+			rest.RenderError(c, http.StatusConflict, cause)
+		default:
+			rest.RenderError(c,
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return
+	}
+
+	c.Header(hdrETag, integration.ETag())
 	c.JSON(http.StatusOK, integration)
 }
 
@@ -172,10 +278,187 @@ func (h *ManagementHandler) SetIntegrationCredentials(c *gin.Context) {
 	}
 
 	err = h.app.SetIntegrationCredentials(ctx, integrationID, credentials)
+	if err != nil {
+		var (
+			credErr *app.CredentialsError
+			provErr *app.ProviderError
+		)
+		switch cause := errors.Cause(err); {
+		case errors.As(err, &credErr):
+			renderCredentialsError(c, credErr)
+		case errors.As(err, &provErr):
+			_ = c.Error(err)
+			rest.RenderError(c, http.StatusBadGateway, provErr)
+		case cause == app.ErrIntegrationNotFound:
+			rest.RenderError(c, http.StatusNotFound, ErrIntegrationNotFound)
+		default:
+			rest.RenderError(c,
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// secretRotationResponse is the response body of a webhook secret rotation.
+type secretRotationResponse struct {
+	// Secret is the hex encoded secret, only set if it was generated.
+	Secret                   string     `json:"secret,omitempty"`
+	SecondarySecretExpiresAt *time.Time `json:"secondary_secret_expires_at,omitempty"`
+}
+
+// POST /integrations/{id}/credentials/rotate
+func (h *ManagementHandler) RotateWebhookSecret(c *gin.Context) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+	integrationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "integration ID must be a valid UUID"),
+		)
+		return
+	}
+
+	// The request body is optional
+	var rotation model.SecretRotation
+	if err := c.ShouldBindJSON(&rotation); err != nil && err != io.EOF {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "malformed request body"),
+		)
+		return
+	}
+
+	creds, err := h.app.RotateWebhookSecret(ctx,
+		integrationID,
+		rotation.Secret,
+		rotation.GracePeriodDuration(),
+	)
+	if err != nil {
+		switch cause := errors.Cause(err); cause {
+		case app.ErrIntegrationNotFound:
+			rest.RenderError(c, http.StatusNotFound, ErrIntegrationNotFound)
+		case app.ErrNotWebhook, app.ErrIntegrationConflict:
+			rest.RenderError(c, http.StatusConflict, cause)
+		default:
+			rest.RenderError(c,
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return
+	}
+
+	rsp := secretRotationResponse{
+		SecondarySecretExpiresAt: creds.SecondarySecretExpiresAt,
+	}
+	if rotation.Secret == nil && creds.Secret != nil {
+		rsp.Secret = hex.EncodeToString([]byte(*creds.Secret))
+	}
+	c.JSON(http.StatusOK, rsp)
+}
+
+// POST /integrations/{id}/test
+func (h *ManagementHandler) VerifyIntegration(c *gin.Context) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+	integrationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "integration ID must be a valid UUID"),
+		)
+		return
+	}
+
+	err = h.app.VerifyIntegration(ctx, integrationID)
+	if err != nil {
+		var (
+			credErr *app.CredentialsError
+			provErr *app.ProviderError
+		)
+		switch cause := errors.Cause(err); {
+		case errors.As(err, &credErr):
+			renderCredentialsError(c, credErr)
+		case errors.As(err, &provErr):
+			_ = c.Error(err)
+			rest.RenderError(c, http.StatusBadGateway, provErr)
+		case cause == app.ErrIntegrationNotFound:
+			rest.RenderError(c, http.StatusNotFound, ErrIntegrationNotFound)
+		default:
+			rest.RenderError(c,
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GET /integrations/:id/health
+func (h *ManagementHandler) GetIntegrationHealth(c *gin.Context) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+	integrationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "integration ID must be a valid UUID"),
+		)
+		return
+	}
+
+	health, err := h.app.GetIntegrationHealth(ctx, integrationID)
+	if err != nil {
+		switch errors.Cause(err) {
+		case app.ErrIntegrationNotFound:
+			rest.RenderError(c, http.StatusNotFound, ErrIntegrationNotFound)
+		default:
+			rest.RenderError(c,
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, health)
+}
+
+// POST /integrations/:id/resume
+func (h *ManagementHandler) ResumeIntegration(c *gin.Context) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+	integrationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "integration ID must be a valid UUID"),
+		)
+		return
+	}
+
+	err = h.app.ResumeIntegration(ctx, integrationID)
 	if err != nil {
 		switch cause := errors.Cause(err); cause {
 		case app.ErrIntegrationNotFound:
 			rest.RenderError(c, http.StatusNotFound, ErrIntegrationNotFound)
+		case app.ErrNotWebhook:
+			rest.RenderError(c, http.StatusConflict, cause)
 		default:
 			rest.RenderError(c,
 				http.StatusInternalServerError,
@@ -188,6 +471,24 @@ func (h *ManagementHandler) SetIntegrationCredentials(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// credentialsError is the response body for credentials failing the
+// permission probe.
+type credentialsError struct {
+	rest.Error
+	MissingPermissions []string `json:"missing_permissions,omitempty"`
+}
+
+func renderCredentialsError(c *gin.Context, err *app.CredentialsError) {
+	_ = c.Error(err)
+	c.JSON(http.StatusBadRequest, credentialsError{
+		Error: rest.Error{
+			Err:       err.Error(),
+			RequestID: requestid.FromContext(c.Request.Context()),
+		},
+		MissingPermissions: err.MissingPermissions,
+	})
+}
+
 // DELETE /integrations/{id}
 func (h *ManagementHandler) RemoveIntegration(c *gin.Context) {
 	ctx, _, err := getContextAndIdentity(c)
@@ -244,9 +545,83 @@ func (h *ManagementHandler) GetEvents(c *gin.Context) {
 		return
 	}
 
+	if filter.Limit > 0 && int64(len(events)) == filter.Limit {
+		last := events[len(events)-1]
+		cursor := model.EventsCursor{
+			EventTS: last.EventTS,
+			ID:      last.ID,
+		}
+		next := url.URL{
+			Path:     c.Request.URL.Path,
+			RawQuery: c.Request.URL.RawQuery,
+		}
+		q := next.Query()
+		q.Del(queryPage)
+		q.Set(queryCursor, cursor.String())
+		next.RawQuery = q.Encode()
+		c.Header(hdrLink, fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+	}
+
 	c.JSON(http.StatusOK, events)
 }
 
+// POST /events/{id}/redeliver
+func (h *ManagementHandler) RedeliverEvent(c *gin.Context) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+	eventID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		rest.RenderError(c,
+			http.StatusBadRequest,
+			errors.Wrap(err, "event ID must be a valid UUID"),
+		)
+		return
+	}
+	var integrationID uuid.UUID
+	if q := c.Query(queryIntegrationID); q != "" {
+		integrationID, err = uuid.Parse(q)
+		if err != nil {
+			rest.RenderError(c,
+				http.StatusBadRequest,
+				errors.Wrap(err, "integration ID must be a valid UUID"),
+			)
+			return
+		}
+	}
+
+	var force bool
+	if q := c.Query(queryForce); q != "" {
+		force, err = strconv.ParseBool(q)
+		if err != nil {
+			rest.RenderError(c,
+				http.StatusBadRequest,
+				fmt.Errorf("invalid force query: %q", q),
+			)
+			return
+		}
+	}
+
+	event, err := h.app.RedeliverEvent(ctx, eventID, integrationID, force)
+	if err != nil {
+		switch cause := errors.Cause(err); cause {
+		case app.ErrEventNotFound:
+			rest.RenderError(c, http.StatusNotFound, ErrEventNotFound)
+		case app.ErrEventOutdated, app.ErrDeliveryInProgress:
+			rest.RenderError(c, http.StatusConflict, cause)
+		default:
+			rest.RenderError(c,
+				http.StatusInternalServerError,
+				err,
+			)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
 // get events filter from query params
 func getEventsFilterFromQuery(c *gin.Context) (*model.EventsFilter, error) {
 	filter := model.EventsFilter{}
@@ -254,7 +629,46 @@ func getEventsFilterFromQuery(c *gin.Context) (*model.EventsFilter, error) {
 	if err != nil {
 		return nil, err
 	}
-	filter.Skip = (page - 1) * perPage
+	q := c.Request.URL.Query()
+	if cursor := q.Get(queryCursor); cursor != "" {
+		if q.Get(queryPage) != "" {
+			return nil, errors.New("cursor cannot be combined with page")
+		}
+		filter.After, err = model.ParseEventsCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		filter.Skip = (page - 1) * perPage
+	}
 	filter.Limit = perPage
-	return &filter, err
+
+	filter.Type = model.EventType(q.Get(queryType))
+	filter.DeviceID = q.Get(queryDeviceID)
+	if id := q.Get(queryIntegrationID); id != "" {
+		filter.IntegrationID, err = uuid.Parse(id)
+		if err != nil {
+			return nil, errors.Wrap(err, "integration ID must be a valid UUID")
+		}
+	}
+	if success := q.Get(querySuccess); success != "" {
+		b, err := strconv.ParseBool(success)
+		if err != nil {
+			return nil, errors.Errorf("invalid success query: %q", success)
+		}
+		filter.Success = &b
+	}
+	if from := q.Get(queryFrom); from != "" {
+		filter.From, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, errors.Errorf("invalid from query: %q", from)
+		}
+	}
+	if to := q.Get(queryTo); to != "" {
+		filter.To, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, errors.Errorf("invalid to query: %q", to)
+		}
+	}
+	return &filter, filter.Validate()
 }
@@ -15,7 +15,10 @@
 package http
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -35,8 +38,175 @@ const (
 var (
 	ErrEmptyDeviceID        = errors.New("device ID is empty")
 	ErrInvalidIntegrationID = errors.New("integration ID is not a valid UUID")
+	ErrUnsupportedProvider  = errors.New(
+		"only IoT Hub and IoT Core integrations can be connected to devices",
+	)
 )
 
+// GET /devices
+func (h *ManagementHandler) GetDevices(c *gin.Context) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+
+	var integrationID uuid.UUID
+	if id := c.Query(queryIntegrationID); id != "" {
+		integrationID, err = uuid.Parse(id)
+		if err != nil {
+			rest.RenderError(c, http.StatusBadRequest, ErrInvalidIntegrationID)
+			return
+		}
+	}
+	h.renderDevices(ctx, c, integrationID)
+}
+
+// GET /integrations/:id/devices
+func (h *ManagementHandler) GetIntegrationDevices(c *gin.Context) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+
+	integrationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		rest.RenderError(c, http.StatusBadRequest, ErrInvalidIntegrationID)
+		return
+	}
+	_, err = h.app.GetIntegrationById(ctx, integrationID)
+	if err == app.ErrIntegrationNotFound {
+		rest.RenderError(c, http.StatusNotFound, ErrIntegrationNotFound)
+		return
+	} else if err != nil {
+		rest.RenderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	h.renderDevices(ctx, c, integrationID)
+}
+
+// renderDevices renders a page of the tenant's devices with the paging
+// Link headers, optionally restricted to the devices of an integration.
+func (h *ManagementHandler) renderDevices(
+	ctx context.Context,
+	c *gin.Context,
+	integrationID uuid.UUID,
+) {
+	page, perPage, err := rest.ParsePagingParameters(c.Request)
+	if err != nil {
+		rest.RenderError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Fetch an extra device to find out if there is a next page
+	devices, err := h.app.GetDevices(ctx, model.DeviceFilter{
+		Skip:          (page - 1) * perPage,
+		Limit:         perPage + 1,
+		IntegrationID: integrationID,
+	})
+	if err != nil {
+		rest.RenderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	hasNext := int64(len(devices)) > perPage
+	if hasNext {
+		devices = devices[:perPage]
+	}
+
+	links, err := rest.MakePagingHeaders(c.Request, rest.NewPagingHints().
+		SetPage(page).
+		SetPerPage(perPage).
+		SetHasNext(hasNext))
+	if err != nil {
+		rest.RenderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	for _, link := range links {
+		c.Writer.Header().Add(hdrLink, link)
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+// DELETE /devices/:id
+func (h *ManagementHandler) UnregisterDevice(c *gin.Context) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+
+	deviceID := c.Param(paramDeviceID)
+	if deviceID == "" {
+		rest.RenderError(c, http.StatusBadRequest, ErrEmptyDeviceID)
+		return
+	}
+
+	var cleanup bool
+	if q := c.Query(queryCleanup); q != "" {
+		cleanup, err = strconv.ParseBool(q)
+		if err != nil {
+			rest.RenderError(c,
+				http.StatusBadRequest,
+				fmt.Errorf("invalid cleanup query: %q", q),
+			)
+			return
+		}
+	}
+
+	err = h.app.UnregisterDevice(ctx, deviceID, cleanup)
+	if err == app.ErrDeviceNotFound {
+		rest.RenderError(c, http.StatusNotFound, app.ErrDeviceNotFound)
+		return
+	} else if err != nil {
+		rest.RenderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// PUT /devices/:id/integrations/:integrationId
+func (h *ManagementHandler) AttachDeviceIntegration(c *gin.Context) {
+	h.setDeviceIntegration(c, h.app.AttachDeviceIntegration)
+}
+
+// DELETE /devices/:id/integrations/:integrationId
+func (h *ManagementHandler) DetachDeviceIntegration(c *gin.Context) {
+	h.setDeviceIntegration(c, h.app.DetachDeviceIntegration)
+}
+
+func (h *ManagementHandler) setDeviceIntegration(
+	c *gin.Context,
+	apply func(ctx context.Context, deviceID string, integrationID uuid.UUID) error,
+) {
+	ctx, _, err := getContextAndIdentity(c)
+	if err != nil {
+		return
+	}
+
+	deviceID := c.Param(paramDeviceID)
+	if deviceID == "" {
+		rest.RenderError(c, http.StatusBadRequest, ErrEmptyDeviceID)
+		return
+	}
+	integrationID, err := uuid.Parse(c.Param(paramIntegrationID))
+	if err != nil {
+		rest.RenderError(c, http.StatusBadRequest, ErrInvalidIntegrationID)
+		return
+	}
+
+	err = apply(ctx, deviceID, integrationID)
+	switch errors.Cause(err) {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case app.ErrIntegrationNotFound, app.ErrDeviceNotFound:
+		rest.RenderError(c, http.StatusNotFound, err)
+	case app.ErrUnknownIntegration:
+		rest.RenderError(c, http.StatusBadRequest, ErrUnsupportedProvider)
+	case app.ErrDeviceAlreadyExists, app.ErrDeviceNotSelected:
+		rest.RenderError(c, http.StatusConflict, err)
+	default:
+		rest.RenderError(c, http.StatusInternalServerError, err)
+	}
+}
+
 // GET /devices/:id/state
 func (h *ManagementHandler) GetDeviceState(c *gin.Context) {
 	ctx, _, err := getContextAndIdentity(c)
@@ -37,6 +37,748 @@ import (
 	"github.com/mendersoftware/iot-manager/model"
 )
 
+func TestGetDevices(t *testing.T) {
+	t.Parallel()
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("digest"))
+	headers := http.Header{
+		textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{
+			"829cbefb-70e7-438f-9ac5-35fd131c2111",
+		},
+		"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+			IsUser:  true,
+			Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			Tenant:  "123456789012345678901234",
+		})},
+	}
+	testCases := []struct {
+		Name string
+
+		Headers http.Header
+		URL     string
+
+		App func(t *testing.T) *mapp.App
+
+		StatusCode int
+		Link       []string
+		Response   interface{}
+	}{
+		{
+			Name: "ok",
+
+			Headers: headers,
+			URL:     APIURLDevices,
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("GetDevices",
+					contextMatcher,
+					model.DeviceFilter{Limit: 21},
+				).Return([]model.Device{{
+					ID:             "1",
+					IntegrationIDs: []uuid.UUID{integrationID},
+				}}, nil)
+				return mapp
+			},
+
+			StatusCode: http.StatusOK,
+			Link: []string{
+				`<` + APIURLManagement + APIURLDevices +
+					`?page=1&per_page=20>; rel="first"`,
+			},
+			Response: []model.Device{{
+				ID:             "1",
+				IntegrationIDs: []uuid.UUID{integrationID},
+			}},
+		},
+		{
+			Name: "ok, filtered with next page",
+
+			Headers: headers,
+			URL: APIURLDevices + "?page=2&per_page=1&integration_id=" +
+				integrationID.String(),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("GetDevices",
+					contextMatcher,
+					model.DeviceFilter{
+						Skip:          1,
+						Limit:         2,
+						IntegrationID: integrationID,
+					},
+				).Return([]model.Device{{
+					ID:             "2",
+					IntegrationIDs: []uuid.UUID{integrationID},
+				}, {
+					ID:             "3",
+					IntegrationIDs: []uuid.UUID{integrationID},
+				}}, nil)
+				return mapp
+			},
+
+			StatusCode: http.StatusOK,
+			Link: []string{
+				`<` + APIURLManagement + APIURLDevices + `?integration_id=` +
+					integrationID.String() + `&page=1&per_page=1>; rel="first"`,
+				`<` + APIURLManagement + APIURLDevices + `?integration_id=` +
+					integrationID.String() + `&page=1&per_page=1>; rel="prev"`,
+				`<` + APIURLManagement + APIURLDevices + `?integration_id=` +
+					integrationID.String() + `&page=3&per_page=1>; rel="next"`,
+			},
+			Response: []model.Device{{
+				ID:             "2",
+				IntegrationIDs: []uuid.UUID{integrationID},
+			}},
+		},
+		{
+			Name: "error, invalid integration ID",
+
+			Headers: headers,
+			URL:     APIURLDevices + "?integration_id=foo",
+
+			StatusCode: http.StatusBadRequest,
+			Response: rest.Error{
+				Err:       ErrInvalidIntegrationID.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, invalid paging parameters",
+
+			Headers: headers,
+			URL:     APIURLDevices + "?page=zero",
+
+			StatusCode: http.StatusBadRequest,
+		},
+		{
+			Name: "error, internal error",
+
+			Headers: headers,
+			URL:     APIURLDevices,
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("GetDevices",
+					contextMatcher,
+					model.DeviceFilter{Limit: 21},
+				).Return(nil, errors.New("internal error"))
+				return mapp
+			},
+
+			StatusCode: http.StatusInternalServerError,
+			Response: rest.Error{
+				Err:       "internal error",
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "ok, integration devices",
+
+			Headers: headers,
+			URL: strings.Replace(APIURLIntegrationDevices,
+				":id", integrationID.String(), 1),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("GetIntegrationById",
+					contextMatcher,
+					integrationID,
+				).Return(&model.Integration{ID: integrationID}, nil)
+				mapp.On("GetDevices",
+					contextMatcher,
+					model.DeviceFilter{
+						Limit:         21,
+						IntegrationID: integrationID,
+					},
+				).Return([]model.Device{}, nil)
+				return mapp
+			},
+
+			StatusCode: http.StatusOK,
+			Link: []string{
+				`<` + APIURLManagement + strings.Replace(
+					APIURLIntegrationDevices, ":id", integrationID.String(), 1,
+				) + `?page=1&per_page=20>; rel="first"`,
+			},
+			Response: []model.Device{},
+		},
+		{
+			Name: "error, integration devices with invalid integration ID",
+
+			Headers: headers,
+			URL:     strings.Replace(APIURLIntegrationDevices, ":id", "foo", 1),
+
+			StatusCode: http.StatusBadRequest,
+			Response: rest.Error{
+				Err:       ErrInvalidIntegrationID.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, integration devices with integration not found",
+
+			Headers: headers,
+			URL: strings.Replace(APIURLIntegrationDevices,
+				":id", integrationID.String(), 1),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("GetIntegrationById",
+					contextMatcher,
+					integrationID,
+				).Return(nil, app.ErrIntegrationNotFound)
+				return mapp
+			},
+
+			StatusCode: http.StatusNotFound,
+			Response: rest.Error{
+				Err:       ErrIntegrationNotFound.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, integration devices with internal error",
+
+			Headers: headers,
+			URL: strings.Replace(APIURLIntegrationDevices,
+				":id", integrationID.String(), 1),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("GetIntegrationById",
+					contextMatcher,
+					integrationID,
+				).Return(nil, errors.New("internal error"))
+				return mapp
+			},
+
+			StatusCode: http.StatusInternalServerError,
+			Response: rest.Error{
+				Err:       "internal error",
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, invalid authorization header",
+
+			Headers: http.Header{
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{
+					"829cbefb-70e7-438f-9ac5-35fd131c2111",
+				},
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsDevice: true,
+					Subject:  "829cbefb-70e7-438f-9ac5-35fd131c2f76",
+					Tenant:   "123456789012345678901234",
+				})},
+			},
+			URL: APIURLDevices,
+
+			StatusCode: http.StatusForbidden,
+			Response: rest.Error{
+				Err:       ErrMissingUserAuthentication.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			var testApp *mapp.App
+			if tc.App == nil {
+				testApp = new(mapp.App)
+			} else {
+				testApp = tc.App(t)
+			}
+			defer testApp.AssertExpectations(t)
+			handler := NewRouter(testApp)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET",
+				"http://localhost"+
+					APIURLManagement+
+					tc.URL,
+				nil,
+			)
+			for key := range tc.Headers {
+				req.Header.Set(key, tc.Headers.Get(key))
+			}
+
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tc.StatusCode, w.Code, "invalid HTTP status code")
+			assert.Equal(t, tc.Link, w.Header().Values(hdrLink))
+			if tc.Response != nil {
+				b, _ := json.Marshal(tc.Response)
+				assert.JSONEq(t, string(b), w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUnregisterDevice(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name string
+
+		Headers  http.Header
+		DeviceID string
+		Query    string
+
+		App func(t *testing.T) *mapp.App
+
+		StatusCode int
+		Response   interface{}
+	}{
+		{
+			Name: "ok",
+
+			Headers: http.Header{
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{
+					"829cbefb-70e7-438f-9ac5-35fd131c2111",
+				},
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+			},
+			DeviceID: "1",
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("UnregisterDevice",
+					contextMatcher,
+					"1",
+					false,
+				).Return(nil)
+				return mapp
+			},
+
+			StatusCode: http.StatusNoContent,
+		},
+		{
+			Name: "ok, with cleanup",
+
+			Headers: http.Header{
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{
+					"829cbefb-70e7-438f-9ac5-35fd131c2111",
+				},
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+			},
+			DeviceID: "1",
+			Query:    "cleanup=true",
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("UnregisterDevice",
+					contextMatcher,
+					"1",
+					true,
+				).Return(nil)
+				return mapp
+			},
+
+			StatusCode: http.StatusNoContent,
+		},
+		{
+			Name: "error, invalid cleanup query",
+
+			Headers: http.Header{
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{
+					"829cbefb-70e7-438f-9ac5-35fd131c2111",
+				},
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+			},
+			DeviceID: "1",
+			Query:    "cleanup=maybe",
+
+			StatusCode: http.StatusBadRequest,
+			Response: rest.Error{
+				Err:       `invalid cleanup query: "maybe"`,
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, device not found",
+
+			Headers: http.Header{
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{
+					"829cbefb-70e7-438f-9ac5-35fd131c2111",
+				},
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+			},
+			DeviceID: "1",
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("UnregisterDevice",
+					contextMatcher,
+					"1",
+					false,
+				).Return(app.ErrDeviceNotFound)
+				return mapp
+			},
+
+			StatusCode: http.StatusNotFound,
+			Response: rest.Error{
+				Err:       app.ErrDeviceNotFound.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, internal error",
+
+			Headers: http.Header{
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{
+					"829cbefb-70e7-438f-9ac5-35fd131c2111",
+				},
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+			},
+			DeviceID: "1",
+			Query:    "cleanup=1",
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("UnregisterDevice",
+					contextMatcher,
+					"1",
+					true,
+				).Return(errors.New("internal error"))
+				return mapp
+			},
+
+			StatusCode: http.StatusInternalServerError,
+			Response: rest.Error{
+				Err:       "internal error",
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			var testApp *mapp.App
+			if tc.App == nil {
+				testApp = new(mapp.App)
+			} else {
+				testApp = tc.App(t)
+			}
+			defer testApp.AssertExpectations(t)
+			handler := NewRouter(testApp)
+			w := httptest.NewRecorder()
+			url := strings.Replace(APIURLDevice, ":id", tc.DeviceID, 1)
+			req, _ := http.NewRequest("DELETE",
+				"http://localhost"+
+					APIURLManagement+
+					url+"?"+tc.Query,
+				nil,
+			)
+			for key := range tc.Headers {
+				req.Header.Set(key, tc.Headers.Get(key))
+			}
+
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tc.StatusCode, w.Code, "invalid HTTP status code")
+			if tc.Response != nil {
+				b, _ := json.Marshal(tc.Response)
+				assert.JSONEq(t, string(b), w.Body.String())
+			} else {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSetDeviceIntegration(t *testing.T) {
+	t.Parallel()
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("digest"))
+	headers := http.Header{
+		textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{
+			"829cbefb-70e7-438f-9ac5-35fd131c2111",
+		},
+		"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+			IsUser:  true,
+			Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			Tenant:  "123456789012345678901234",
+		})},
+	}
+	testCases := []struct {
+		Name string
+
+		Method        string
+		Headers       http.Header
+		IntegrationID string
+
+		App func(t *testing.T) *mapp.App
+
+		StatusCode int
+		Response   interface{}
+	}{
+		{
+			Name: "ok, attach",
+
+			Method:        http.MethodPut,
+			Headers:       headers,
+			IntegrationID: integrationID.String(),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("AttachDeviceIntegration",
+					contextMatcher,
+					"1",
+					integrationID,
+				).Return(nil)
+				return mapp
+			},
+
+			StatusCode: http.StatusNoContent,
+		},
+		{
+			Name: "ok, detach",
+
+			Method:        http.MethodDelete,
+			Headers:       headers,
+			IntegrationID: integrationID.String(),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("DetachDeviceIntegration",
+					contextMatcher,
+					"1",
+					integrationID,
+				).Return(nil)
+				return mapp
+			},
+
+			StatusCode: http.StatusNoContent,
+		},
+		{
+			Name: "error, invalid integration ID",
+
+			Method:        http.MethodPut,
+			Headers:       headers,
+			IntegrationID: "foo",
+
+			StatusCode: http.StatusBadRequest,
+			Response: rest.Error{
+				Err:       ErrInvalidIntegrationID.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, attach integration not found",
+
+			Method:        http.MethodPut,
+			Headers:       headers,
+			IntegrationID: integrationID.String(),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("AttachDeviceIntegration",
+					contextMatcher,
+					"1",
+					integrationID,
+				).Return(app.ErrIntegrationNotFound)
+				return mapp
+			},
+
+			StatusCode: http.StatusNotFound,
+			Response: rest.Error{
+				Err:       app.ErrIntegrationNotFound.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, attach webhook integration",
+
+			Method:        http.MethodPut,
+			Headers:       headers,
+			IntegrationID: integrationID.String(),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("AttachDeviceIntegration",
+					contextMatcher,
+					"1",
+					integrationID,
+				).Return(app.ErrUnknownIntegration)
+				return mapp
+			},
+
+			StatusCode: http.StatusBadRequest,
+			Response: rest.Error{
+				Err:       ErrUnsupportedProvider.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, attach device already exists",
+
+			Method:        http.MethodPut,
+			Headers:       headers,
+			IntegrationID: integrationID.String(),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("AttachDeviceIntegration",
+					contextMatcher,
+					"1",
+					integrationID,
+				).Return(app.ErrDeviceAlreadyExists)
+				return mapp
+			},
+
+			StatusCode: http.StatusConflict,
+			Response: rest.Error{
+				Err:       app.ErrDeviceAlreadyExists.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, attach device not selected",
+
+			Method:        http.MethodPut,
+			Headers:       headers,
+			IntegrationID: integrationID.String(),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("AttachDeviceIntegration",
+					contextMatcher,
+					"1",
+					integrationID,
+				).Return(app.ErrDeviceNotSelected)
+				return mapp
+			},
+
+			StatusCode: http.StatusConflict,
+			Response: rest.Error{
+				Err:       app.ErrDeviceNotSelected.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, detach device not found",
+
+			Method:        http.MethodDelete,
+			Headers:       headers,
+			IntegrationID: integrationID.String(),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("DetachDeviceIntegration",
+					contextMatcher,
+					"1",
+					integrationID,
+				).Return(app.ErrDeviceNotFound)
+				return mapp
+			},
+
+			StatusCode: http.StatusNotFound,
+			Response: rest.Error{
+				Err:       app.ErrDeviceNotFound.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, detach internal error",
+
+			Method:        http.MethodDelete,
+			Headers:       headers,
+			IntegrationID: integrationID.String(),
+
+			App: func(t *testing.T) *mapp.App {
+				mapp := new(mapp.App)
+				mapp.On("DetachDeviceIntegration",
+					contextMatcher,
+					"1",
+					integrationID,
+				).Return(errors.New("internal error"))
+				return mapp
+			},
+
+			StatusCode: http.StatusInternalServerError,
+			Response: rest.Error{
+				Err:       "internal error",
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+		{
+			Name: "error, invalid authorization header",
+
+			Method: http.MethodPut,
+			Headers: http.Header{
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{
+					"829cbefb-70e7-438f-9ac5-35fd131c2111",
+				},
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsDevice: true,
+					Subject:  "829cbefb-70e7-438f-9ac5-35fd131c2f76",
+					Tenant:   "123456789012345678901234",
+				})},
+			},
+			IntegrationID: integrationID.String(),
+
+			StatusCode: http.StatusForbidden,
+			Response: rest.Error{
+				Err:       ErrMissingUserAuthentication.Error(),
+				RequestID: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+			},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			var testApp *mapp.App
+			if tc.App == nil {
+				testApp = new(mapp.App)
+			} else {
+				testApp = tc.App(t)
+			}
+			defer testApp.AssertExpectations(t)
+			handler := NewRouter(testApp)
+			w := httptest.NewRecorder()
+			url := strings.Replace(APIURLDeviceIntegration, ":id", "1", 1)
+			url = strings.Replace(url, ":integrationId", tc.IntegrationID, 1)
+			req, _ := http.NewRequest(tc.Method,
+				"http://localhost"+
+					APIURLManagement+
+					url,
+				nil,
+			)
+			for key := range tc.Headers {
+				req.Header.Set(key, tc.Headers.Get(key))
+			}
+
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tc.StatusCode, w.Code, "invalid HTTP status code")
+			if tc.Response != nil {
+				b, _ := json.Marshal(tc.Response)
+				assert.JSONEq(t, string(b), w.Body.String())
+			} else {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
+
 func TestGetDeviceState(t *testing.T) {
 	t.Parallel()
 	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("digest"))
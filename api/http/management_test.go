@@ -43,6 +43,7 @@ import (
 
 	"github.com/mendersoftware/iot-manager/app"
 	mapp "github.com/mendersoftware/iot-manager/app/mocks"
+	"github.com/mendersoftware/iot-manager/client/iothub"
 	"github.com/mendersoftware/iot-manager/crypto"
 	"github.com/mendersoftware/iot-manager/model"
 )
@@ -123,6 +124,7 @@ func TestGetIntegrations(t *testing.T) {
 			Response: []map[string]interface{}{{
 				"id":       uuid.Nil,
 				"provider": model.ProviderIoTHub,
+				"version":  0,
 				"credentials": map[string]interface{}{
 					"type":              model.CredentialTypeSAS,
 					"connection_string": string(validConnStringString),
@@ -305,6 +307,33 @@ func TestCreateIntegration(t *testing.T) {
 
 		RspCode: http.StatusConflict,
 		Error:   app.ErrIntegrationExists,
+	}, {
+		Name: "selector overlaps another integration",
+
+		RequestBody: map[string]interface{}{
+			"provider": model.ProviderIoTHub,
+			"credentials": map[string]interface{}{
+				"type":              model.CredentialTypeSAS,
+				"connection_string": validConnString.String(),
+			},
+		},
+		RequestHdrs: http.Header{
+			"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+				Subject: uuid.NewString(),
+				Tenant:  "123456789012345678901234",
+				IsUser:  true,
+			})},
+		},
+
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("CreateIntegration", contextMatcher, mock.AnythingOfType("model.Integration")).
+				Return(nil, app.ErrSelectorOverlap)
+			return a
+		},
+
+		RspCode: http.StatusConflict,
+		Error:   app.ErrSelectorOverlap,
 	}, {
 		Name: "internal error",
 
@@ -332,6 +361,63 @@ func TestCreateIntegration(t *testing.T) {
 
 		RspCode: http.StatusInternalServerError,
 		Error:   errors.New("internal error"),
+	}, {
+		Name: "credentials missing permissions",
+
+		RequestBody: map[string]interface{}{
+			"provider": model.ProviderIoTHub,
+			"credentials": map[string]interface{}{
+				"type":              model.CredentialTypeSAS,
+				"connection_string": validConnString.String(),
+			},
+		},
+		RequestHdrs: http.Header{
+			"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+				Subject: uuid.NewString(),
+				Tenant:  "123456789012345678901234",
+				IsUser:  true,
+			})},
+		},
+
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("CreateIntegration", contextMatcher, mock.AnythingOfType("model.Integration")).
+				Return(nil, &app.CredentialsError{
+					MissingPermissions: []string{iothub.PermissionRegistryWrite},
+				})
+			return a
+		},
+
+		RspCode: http.StatusBadRequest,
+		Error: errors.New("the credentials are missing required permissions: " +
+			"RegistryWrite"),
+	}, {
+		Name: "error, cloud provider unreachable",
+
+		RequestBody: map[string]interface{}{
+			"provider": model.ProviderIoTHub,
+			"credentials": map[string]interface{}{
+				"type":              model.CredentialTypeSAS,
+				"connection_string": validConnString.String(),
+			},
+		},
+		RequestHdrs: http.Header{
+			"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+				Subject: uuid.NewString(),
+				Tenant:  "123456789012345678901234",
+				IsUser:  true,
+			})},
+		},
+
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("CreateIntegration", contextMatcher, mock.AnythingOfType("model.Integration")).
+				Return(nil, &app.ProviderError{})
+			return a
+		},
+
+		RspCode: http.StatusBadGateway,
+		Error:   errors.New("failed to reach the cloud provider"),
 	}, {
 		Name: "malformed request body",
 
@@ -563,6 +649,9 @@ func TestGetIntegrationById(t *testing.T) {
 			handler.ServeHTTP(w, req)
 
 			assert.Equal(t, tc.Code, w.Code, "invalid HTTP status code")
+			if tc.Code == http.StatusOK {
+				assert.Equal(t, `"0"`, w.Header().Get(hdrETag))
+			}
 			switch expected := tc.Response.(type) {
 			case []byte:
 				assert.Equal(t, expected, w.Body.Bytes(),
@@ -781,235 +870,1532 @@ func TestSetIntegrationCredentials(t *testing.T) {
 	}
 }
 
-func TestRemoveIntegration(t *testing.T) {
+func TestUpdateIntegration(t *testing.T) {
 	t.Parallel()
 	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("integration"))
+	integration := &model.Integration{
+		ID:       integrationID,
+		Provider: model.ProviderIoTHub,
+		Name:     "hub",
+		Credentials: model.Credentials{
+			Type:             model.CredentialTypeSAS,
+			ConnectionString: validConnString,
+		},
+		Version: 3,
+	}
+	headers := http.Header{
+		"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+			Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+			Tenant:  "123456789012345678901234",
+			IsUser:  true,
+		})},
+	}
 
 	type testCase struct {
 		Name string
 
 		IntegrationID string
-		Header        http.Header
-		App           func(t *testing.T, self *testCase) *mapp.App
+		IfMatch       string
+		RequestBody   interface{}
+		App           func(t *testing.T) *mapp.App
 
-		Code     int
-		Response interface{}
-		Error    error
+		Code  int
+		ETag  string
+		Error error
 	}
 
-	testCases := []testCase{
-		{
-			Name:          "error/forbidden",
-			IntegrationID: integrationID.String(),
-			Header: http.Header{
-				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
-					Subject: uuid.NewString(),
-					Tenant:  "123456789012345678901234",
-				})},
-			},
-
-			App: func(t *testing.T, self *testCase) *mapp.App { return new(mapp.App) },
+	testCases := []testCase{{
+		Name: "ok",
 
-			Code:  http.StatusForbidden,
-			Error: ErrMissingUserAuthentication,
+		IntegrationID: integrationID.String(),
+		IfMatch:       `"3"`,
+		RequestBody: map[string]interface{}{
+			"name":        "gateways",
+			"description": "Azure IoT Hub for gateways",
+			"selector": []map[string]interface{}{{
+				"key":   "device_type",
+				"op":    model.SelectorOpEqual,
+				"value": "gateway",
+			}},
+		},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(integration, nil).
+				Once()
+			a.On("UpdateIntegration",
+				contextMatcher,
+				mock.MatchedBy(func(itg model.Integration) bool {
+					return itg.Name == "gateways" &&
+						itg.Description == "Azure IoT Hub for gateways" &&
+						len(itg.Selector) == 1 &&
+						itg.Version == 3
+				})).
+				Return(&model.Integration{
+					ID:          integrationID,
+					Provider:    model.ProviderIoTHub,
+					Name:        "gateways",
+					Description: "Azure IoT Hub for gateways",
+					Version:     4,
+				}, nil).
+				Once()
+			return a
 		},
-		{
-			Name: "ok",
 
-			IntegrationID: integrationID.String(),
-			Header: http.Header{
-				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
-					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
-					Tenant:  "123456789012345678901234",
-					IsUser:  true,
-				})},
-			},
-			App: func(t *testing.T, self *testCase) *mapp.App {
-				appie := new(mapp.App)
-				appie.On("RemoveIntegration", contextMatcher, integrationID).
-					Return(nil)
-				return appie
-			},
+		Code: http.StatusOK,
+		ETag: `"4"`,
+	}, {
+		Name: "error, integration ID not a UUID",
 
-			Code:     http.StatusNoContent,
-			Response: nil,
+		IntegrationID: "not-a-uuid",
+		RequestBody:   map[string]interface{}{"name": "gateways"},
+		App:           func(t *testing.T) *mapp.App { return new(mapp.App) },
+
+		Code:  http.StatusBadRequest,
+		Error: errors.New("integration ID must be a valid UUID"),
+	}, {
+		Name: "error, malformed request body",
+
+		IntegrationID: integrationID.String(),
+		RequestBody:   []string{"name"},
+		App:           func(t *testing.T) *mapp.App { return new(mapp.App) },
+
+		Code:  http.StatusBadRequest,
+		Error: errors.New("malformed request body"),
+	}, {
+		Name: "error, integration not found",
+
+		IntegrationID: integrationID.String(),
+		RequestBody:   map[string]interface{}{"name": "gateways"},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(nil, app.ErrIntegrationNotFound).
+				Once()
+			return a
 		},
-		{
-			Name: "error, cannot remove integration",
 
-			IntegrationID: integrationID.String(),
-			Header: http.Header{
-				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
-					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
-					Tenant:  "123456789012345678901234",
-					IsUser:  true,
-				})},
-				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
-			},
-			App: func(t *testing.T, self *testCase) *mapp.App {
-				appie := new(mapp.App)
-				appie.On("RemoveIntegration", contextMatcher, integrationID).
-					Return(app.ErrCannotRemoveIntegration)
-				return appie
-			},
+		Code:  http.StatusNotFound,
+		Error: ErrIntegrationNotFound,
+	}, {
+		Name: "error, failed to retrieve integration",
 
-			Code: http.StatusConflict,
-			Response: rest.Error{
-				Err:       app.ErrIntegrationNotFound.Error(),
-				RequestID: "test",
-			},
-			Error: app.ErrCannotRemoveIntegration,
+		IntegrationID: integrationID.String(),
+		RequestBody:   map[string]interface{}{"name": "gateways"},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return a
 		},
-		{
-			Name: "error, integration not found",
 
-			IntegrationID: integrationID.String(),
-			Header: http.Header{
-				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
-					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
-					Tenant:  "123456789012345678901234",
-					IsUser:  true,
-				})},
-				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
-			},
-			App: func(t *testing.T, self *testCase) *mapp.App {
-				appie := new(mapp.App)
-				appie.On("RemoveIntegration", contextMatcher, integrationID).
-					Return(app.ErrIntegrationNotFound)
-				return appie
-			},
+		Code:  http.StatusInternalServerError,
+		Error: errors.New("internal error"),
+	}, {
+		Name: "error, precondition failed",
 
-			Code: http.StatusNotFound,
-			Response: rest.Error{
-				Err:       app.ErrIntegrationNotFound.Error(),
-				RequestID: "test",
-			},
-			Error: app.ErrIntegrationNotFound,
+		IntegrationID: integrationID.String(),
+		IfMatch:       `"2"`,
+		RequestBody:   map[string]interface{}{"name": "gateways"},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(integration, nil).
+				Once()
+			return a
 		},
-		{
-			Name: "error, internal server error",
 
-			IntegrationID: integrationID.String(),
-			Header: http.Header{
-				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
-					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
-					Tenant:  "123456789012345678901234",
-					IsUser:  true,
-				})},
-				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
-			},
-			App: func(t *testing.T, self *testCase) *mapp.App {
-				appie := new(mapp.App)
-				appie.On("RemoveIntegration", contextMatcher, integrationID).
-					Return(errors.New("Internal Server Error"))
-				return appie
-			},
+		Code:  http.StatusPreconditionFailed,
+		Error: app.ErrIntegrationConflict,
+	}, {
+		Name: "error, immutable field",
 
-			Code: http.StatusInternalServerError,
-			Response: rest.Error{
-				Err:       app.ErrIntegrationNotFound.Error(),
-				RequestID: "test",
-			},
-			Error: errors.New("Internal Server Error"),
+		IntegrationID: integrationID.String(),
+		RequestBody:   map[string]interface{}{"provider": model.ProviderWebhook},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(integration, nil).
+				Once()
+			return a
 		},
-		{
-			Name: "error, cannot parse path param",
 
-			IntegrationID: "invalid_uuid",
-			Header: http.Header{
-				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
-					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
-					Tenant:  "123456789012345678901234",
-					IsUser:  true,
-				})},
-				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
-			},
-			App: func(t *testing.T, self *testCase) *mapp.App { return new(mapp.App) },
+		Code:  http.StatusBadRequest,
+		Error: errors.New("invalid integration patch: provider: cannot be modified"),
+	}, {
+		Name: "error, invalid integration",
 
-			Code: http.StatusBadRequest,
-			Response: rest.Error{
-				Err:       "integration ID must be a valid UUID: invalid UUID length: 12",
-				RequestID: "test",
-			},
-			Error: errors.New("integration ID must be a valid UUID"),
+		IntegrationID: integrationID.String(),
+		RequestBody: map[string]interface{}{
+			"events": []string{string(model.EventTypeDeviceProvisioned)},
+		},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(integration, nil).
+				Once()
+			return a
 		},
-	}
 
-	for i := range testCases {
-		tc := testCases[i]
-		t.Run(tc.Name, func(t *testing.T) {
-			t.Parallel()
-			app := tc.App(t, &tc)
-			defer app.AssertExpectations(t)
-			repl := strings.NewReplacer(":id", tc.IntegrationID)
+		Code:  http.StatusBadRequest,
+		Error: errors.New("invalid integration patch: events: "),
+	}, {
+		Name: "error, concurrent update",
+
+		IntegrationID: integrationID.String(),
+		RequestBody:   map[string]interface{}{"name": "gateways"},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(integration, nil).
+				Once()
+			a.On("UpdateIntegration",
+				contextMatcher,
+				mock.AnythingOfType("model.Integration")).
+				Return(nil, app.ErrIntegrationConflict).
+				Once()
+			return a
+		},
+
+		Code:  http.StatusPreconditionFailed,
+		Error: app.ErrIntegrationConflict,
+	}, {
+		Name: "error, duplicate integration",
+
+		IntegrationID: integrationID.String(),
+		RequestBody:   map[string]interface{}{"name": "gateways"},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(integration, nil).
+				Once()
+			a.On("UpdateIntegration",
+				contextMatcher,
+				mock.AnythingOfType("model.Integration")).
+				Return(nil, app.ErrIntegrationExists).
+				Once()
+			return a
+		},
+
+		Code:  http.StatusConflict,
+		Error: app.ErrIntegrationExists,
+	}, {
+		Name: "error, selector overlaps another integration",
+
+		IntegrationID: integrationID.String(),
+		RequestBody: map[string]interface{}{"selector": []map[string]interface{}{{
+			"key": "device_type", "op": "eq", "value": "gateway",
+		}}},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(integration, nil).
+				Once()
+			a.On("UpdateIntegration",
+				contextMatcher,
+				mock.AnythingOfType("model.Integration")).
+				Return(nil, app.ErrSelectorOverlap).
+				Once()
+			return a
+		},
+
+		Code:  http.StatusConflict,
+		Error: app.ErrSelectorOverlap,
+	}, {
+		Name: "error, integration removed",
+
+		IntegrationID: integrationID.String(),
+		RequestBody:   map[string]interface{}{"name": "gateways"},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(integration, nil).
+				Once()
+			a.On("UpdateIntegration",
+				contextMatcher,
+				mock.AnythingOfType("model.Integration")).
+				Return(nil, app.ErrIntegrationNotFound).
+				Once()
+			return a
+		},
+
+		Code:  http.StatusNotFound,
+		Error: ErrIntegrationNotFound,
+	}, {
+		Name: "error, internal error",
+
+		IntegrationID: integrationID.String(),
+		RequestBody:   map[string]interface{}{"name": "gateways"},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationById", contextMatcher, integrationID).
+				Return(integration, nil).
+				Once()
+			a.On("UpdateIntegration",
+				contextMatcher,
+				mock.AnythingOfType("model.Integration")).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return a
+		},
+
+		Code:  http.StatusInternalServerError,
+		Error: errors.New("internal error"),
+	}}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			testApp := tc.App(t)
+			defer testApp.AssertExpectations(t)
+			repl := strings.NewReplacer(":id", tc.IntegrationID)
+			b, _ := json.Marshal(tc.RequestBody)
 			req, _ := http.NewRequest(
-				http.MethodDelete,
+				http.MethodPatch,
 				"http://localhost"+APIURLManagement+
 					repl.Replace(APIURLIntegration),
-				nil,
+				bytes.NewReader(b),
 			)
-			for k, v := range tc.Header {
+			for k, v := range headers {
+				req.Header[k] = v
+			}
+			if tc.IfMatch != "" {
+				req.Header.Set(hdrIfMatch, tc.IfMatch)
+			}
+
+			w := httptest.NewRecorder()
+			handler := NewRouter(testApp)
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Code, w.Code, "invalid HTTP status code")
+			if tc.Error != nil {
+				var erro rest.Error
+				err := json.Unmarshal(w.Body.Bytes(), &erro)
+				require.NoError(t, err)
+				assert.Regexp(t, tc.Error.Error(), erro.Error())
+			} else {
+				assert.Equal(t, tc.ETag, w.Header().Get(hdrETag))
+				var result model.Integration
+				err := json.Unmarshal(w.Body.Bytes(), &result)
+				require.NoError(t, err)
+				assert.Equal(t, integrationID, result.ID)
+			}
+		})
+	}
+}
+
+func TestRotateWebhookSecret(t *testing.T) {
+	t.Parallel()
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("integration"))
+	expiresAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	newSecret := model.HexSecret([]byte{0xde, 0xad, 0xbe, 0xef})
+	oldSecret := model.HexSecret([]byte{0x12, 0x34})
+	headers := http.Header{
+		"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+			Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+			Tenant:  "123456789012345678901234",
+			IsUser:  true,
+		})},
+		textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+	}
+
+	testCases := []struct {
+		Name string
+
+		IntegrationID string
+		RequestBody   interface{}
+		App           func(t *testing.T) *mapp.App
+
+		Code     int
+		Response interface{}
+	}{{
+		Name: "ok",
+
+		IntegrationID: integrationID.String(),
+		RequestBody: map[string]interface{}{
+			"secret":       "deadbeef",
+			"grace_period": 3600,
+		},
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("RotateWebhookSecret",
+				contextMatcher,
+				integrationID,
+				&newSecret,
+				time.Hour).
+				Return(&model.HTTPCredentials{
+					URL:                      "http://localhost",
+					Secret:                   &newSecret,
+					SecondarySecret:          &oldSecret,
+					SecondarySecretExpiresAt: &expiresAt,
+				}, nil)
+			return a
+		},
+
+		Code: http.StatusOK,
+		Response: map[string]interface{}{
+			"secondary_secret_expires_at": expiresAt,
+		},
+	}, {
+		Name: "ok, generated secret",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("RotateWebhookSecret",
+				contextMatcher,
+				integrationID,
+				(*model.HexSecret)(nil),
+				model.DefaultSecretGracePeriod).
+				Return(&model.HTTPCredentials{
+					URL:                      "http://localhost",
+					Secret:                   &newSecret,
+					SecondarySecret:          &oldSecret,
+					SecondarySecretExpiresAt: &expiresAt,
+				}, nil)
+			return a
+		},
+
+		Code: http.StatusOK,
+		Response: map[string]interface{}{
+			"secret":                      "deadbeef",
+			"secondary_secret_expires_at": expiresAt,
+		},
+	}, {
+		Name: "error, integration ID not a UUID",
+
+		IntegrationID: "not-a-uuid",
+		App:           func(t *testing.T) *mapp.App { return new(mapp.App) },
+
+		Code: http.StatusBadRequest,
+		Response: rest.Error{
+			Err:       "integration ID must be a valid UUID: invalid UUID length: 10",
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, invalid grace period",
+
+		IntegrationID: integrationID.String(),
+		RequestBody: map[string]interface{}{
+			"grace_period": 31 * 24 * 3600,
+		},
+		App: func(t *testing.T) *mapp.App { return new(mapp.App) },
+
+		Code: http.StatusBadRequest,
+		Response: rest.Error{
+			Err: "malformed request body: " +
+				"grace_period: must be no greater than 2592000.",
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, not a webhook",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("RotateWebhookSecret",
+				contextMatcher,
+				integrationID,
+				(*model.HexSecret)(nil),
+				model.DefaultSecretGracePeriod).
+				Return(nil, app.ErrNotWebhook)
+			return a
+		},
+
+		Code: http.StatusConflict,
+		Response: rest.Error{
+			Err:       app.ErrNotWebhook.Error(),
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, modified concurrently",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("RotateWebhookSecret",
+				contextMatcher,
+				integrationID,
+				(*model.HexSecret)(nil),
+				model.DefaultSecretGracePeriod).
+				Return(nil, app.ErrIntegrationConflict)
+			return a
+		},
+
+		Code: http.StatusConflict,
+		Response: rest.Error{
+			Err:       app.ErrIntegrationConflict.Error(),
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, integration not found",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("RotateWebhookSecret",
+				contextMatcher,
+				integrationID,
+				(*model.HexSecret)(nil),
+				model.DefaultSecretGracePeriod).
+				Return(nil, app.ErrIntegrationNotFound)
+			return a
+		},
+
+		Code: http.StatusNotFound,
+		Response: rest.Error{
+			Err:       ErrIntegrationNotFound.Error(),
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, internal error",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("RotateWebhookSecret",
+				contextMatcher,
+				integrationID,
+				(*model.HexSecret)(nil),
+				model.DefaultSecretGracePeriod).
+				Return(nil, errors.New("internal error"))
+			return a
+		},
+
+		Code: http.StatusInternalServerError,
+		Response: rest.Error{
+			Err:       "internal error",
+			RequestID: "test",
+		},
+	}}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			testApp := tc.App(t)
+			defer testApp.AssertExpectations(t)
+			repl := strings.NewReplacer(":id", tc.IntegrationID)
+			var body []byte
+			if tc.RequestBody != nil {
+				body, _ = json.Marshal(tc.RequestBody)
+			}
+			req, _ := http.NewRequest(
+				http.MethodPost,
+				"http://localhost"+APIURLManagement+
+					repl.Replace(APIURLIntegrationRotation),
+				bytes.NewReader(body),
+			)
+			for k, v := range headers {
 				req.Header[k] = v
 			}
 
-			w := httptest.NewRecorder()
-			handler := NewRouter(app)
-			handler.ServeHTTP(w, req)
+			w := httptest.NewRecorder()
+			handler := NewRouter(testApp)
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Code, w.Code, "invalid HTTP status code")
+			b, _ := json.Marshal(tc.Response)
+			assert.JSONEq(t, string(b), w.Body.String())
+		})
+	}
+}
+
+func TestVerifyIntegration(t *testing.T) {
+	t.Parallel()
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("integration"))
+	headers := http.Header{
+		"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+			Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+			Tenant:  "123456789012345678901234",
+			IsUser:  true,
+		})},
+		textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+	}
+
+	testCases := []struct {
+		Name string
+
+		IntegrationID string
+		App           func(t *testing.T) *mapp.App
+
+		Code     int
+		Response interface{}
+	}{{
+		Name: "ok",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("VerifyIntegration", contextMatcher, integrationID).
+				Return(nil)
+			return a
+		},
+
+		Code: http.StatusNoContent,
+	}, {
+		Name: "error, permissions missing",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("VerifyIntegration", contextMatcher, integrationID).
+				Return(&app.CredentialsError{
+					MissingPermissions: []string{
+						iothub.PermissionRegistryRead,
+						iothub.PermissionRegistryWrite,
+					},
+				})
+			return a
+		},
+
+		Code: http.StatusBadRequest,
+		Response: map[string]interface{}{
+			"error": "the credentials are missing required permissions: " +
+				"RegistryRead, RegistryWrite",
+			"missing_permissions": []string{"RegistryRead", "RegistryWrite"},
+			"request_id":          "test",
+		},
+	}, {
+		Name: "error, cloud provider unreachable",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("VerifyIntegration", contextMatcher, integrationID).
+				Return(&app.ProviderError{})
+			return a
+		},
+
+		Code: http.StatusBadGateway,
+		Response: rest.Error{
+			Err:       "failed to reach the cloud provider",
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, integration ID not a UUID",
+
+		IntegrationID: "not-a-uuid",
+		App:           func(t *testing.T) *mapp.App { return new(mapp.App) },
+
+		Code: http.StatusBadRequest,
+		Response: rest.Error{
+			Err:       "integration ID must be a valid UUID: invalid UUID length: 10",
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, integration not found",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("VerifyIntegration", contextMatcher, integrationID).
+				Return(app.ErrIntegrationNotFound)
+			return a
+		},
+
+		Code: http.StatusNotFound,
+		Response: rest.Error{
+			Err:       ErrIntegrationNotFound.Error(),
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, internal error",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("VerifyIntegration", contextMatcher, integrationID).
+				Return(errors.New("internal error"))
+			return a
+		},
+
+		Code: http.StatusInternalServerError,
+		Response: rest.Error{
+			Err:       "internal error",
+			RequestID: "test",
+		},
+	}}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			testApp := tc.App(t)
+			defer testApp.AssertExpectations(t)
+			repl := strings.NewReplacer(":id", tc.IntegrationID)
+			req, _ := http.NewRequest(
+				http.MethodPost,
+				"http://localhost"+APIURLManagement+
+					repl.Replace(APIURLIntegrationTest),
+				nil,
+			)
+			for k, v := range headers {
+				req.Header[k] = v
+			}
+
+			w := httptest.NewRecorder()
+			handler := NewRouter(testApp)
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Code, w.Code, "invalid HTTP status code")
+			if tc.Response != nil {
+				b, _ := json.Marshal(tc.Response)
+				assert.JSONEq(t, string(b), w.Body.String())
+			} else {
+				assert.Empty(t, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestGetIntegrationHealth(t *testing.T) {
+	t.Parallel()
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("integration"))
+	headers := http.Header{
+		"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+			Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+			Tenant:  "123456789012345678901234",
+			IsUser:  true,
+		})},
+		textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+	}
+	statusCode := http.StatusServiceUnavailable
+	averageDuration := 12.5
+	health := &model.IntegrationHealth{
+		LastHour: model.NewDeliveryStats(0, 0),
+		LastDay:  model.NewDeliveryStats(4, 3),
+		LastWeek: model.NewDeliveryStats(8, 6),
+		LastSuccess: &model.DeliveryOutcome{
+			EventID:   uuid.NewSHA1(uuid.NameSpaceOID, []byte("success")),
+			Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		LastFailure: &model.DeliveryOutcome{
+			EventID:    uuid.NewSHA1(uuid.NameSpaceOID, []byte("failure")),
+			Timestamp:  time.Date(2024, 1, 1, 3, 4, 5, 0, time.UTC),
+			StatusCode: &statusCode,
+			Error:      "503 Service Unavailable",
+		},
+		StatusCodes:     map[int]int64{200: 6, 503: 2},
+		AverageDuration: &averageDuration,
+	}
+
+	testCases := []struct {
+		Name string
+
+		IntegrationID string
+		App           func(t *testing.T) *mapp.App
+
+		Code     int
+		Response interface{}
+	}{{
+		Name: "ok",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationHealth", contextMatcher, integrationID).
+				Return(health, nil)
+			return a
+		},
+
+		Code: http.StatusOK,
+		Response: map[string]interface{}{
+			"last_hour": map[string]interface{}{
+				"total": 0, "succeeded": 0, "success_rate": nil,
+			},
+			"last_day": map[string]interface{}{
+				"total": 4, "succeeded": 3, "success_rate": 0.75,
+			},
+			"last_week": map[string]interface{}{
+				"total": 8, "succeeded": 6, "success_rate": 0.75,
+			},
+			"last_success": map[string]interface{}{
+				"event_id": health.LastSuccess.EventID,
+				"time":     "2024-01-02T03:04:05Z",
+			},
+			"last_failure": map[string]interface{}{
+				"event_id":    health.LastFailure.EventID,
+				"time":        "2024-01-01T03:04:05Z",
+				"status_code": 503,
+				"error":       "503 Service Unavailable",
+			},
+			"status_codes":        map[string]interface{}{"200": 6, "503": 2},
+			"average_duration_ms": 12.5,
+		},
+	}, {
+		Name: "error, integration ID not a UUID",
+
+		IntegrationID: "not-a-uuid",
+		App:           func(t *testing.T) *mapp.App { return new(mapp.App) },
+
+		Code: http.StatusBadRequest,
+		Response: rest.Error{
+			Err:       "integration ID must be a valid UUID: invalid UUID length: 10",
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, integration not found",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationHealth", contextMatcher, integrationID).
+				Return(nil, app.ErrIntegrationNotFound)
+			return a
+		},
+
+		Code: http.StatusNotFound,
+		Response: rest.Error{
+			Err:       ErrIntegrationNotFound.Error(),
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, internal error",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("GetIntegrationHealth", contextMatcher, integrationID).
+				Return(nil, errors.New("internal error"))
+			return a
+		},
+
+		Code: http.StatusInternalServerError,
+		Response: rest.Error{
+			Err:       "internal error",
+			RequestID: "test",
+		},
+	}}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			testApp := tc.App(t)
+			defer testApp.AssertExpectations(t)
+			repl := strings.NewReplacer(":id", tc.IntegrationID)
+			req, _ := http.NewRequest(
+				http.MethodGet,
+				"http://localhost"+APIURLManagement+
+					repl.Replace(APIURLIntegrationHealth),
+				nil,
+			)
+			for k, v := range headers {
+				req.Header[k] = v
+			}
+
+			w := httptest.NewRecorder()
+			handler := NewRouter(testApp)
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Code, w.Code, "invalid HTTP status code")
+			b, _ := json.Marshal(tc.Response)
+			assert.JSONEq(t, string(b), w.Body.String())
+		})
+	}
+}
+
+func TestResumeIntegration(t *testing.T) {
+	t.Parallel()
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("integration"))
+	headers := http.Header{
+		"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+			Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+			Tenant:  "123456789012345678901234",
+			IsUser:  true,
+		})},
+		textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+	}
+
+	testCases := []struct {
+		Name string
+
+		IntegrationID string
+		App           func(t *testing.T) *mapp.App
+
+		Code     int
+		Response interface{}
+	}{{
+		Name: "ok",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("ResumeIntegration", contextMatcher, integrationID).
+				Return(nil)
+			return a
+		},
+
+		Code: http.StatusNoContent,
+	}, {
+		Name: "error, integration ID not a UUID",
+
+		IntegrationID: "not-a-uuid",
+		App:           func(t *testing.T) *mapp.App { return new(mapp.App) },
+
+		Code: http.StatusBadRequest,
+		Response: rest.Error{
+			Err:       "integration ID must be a valid UUID: invalid UUID length: 10",
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, not a webhook integration",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("ResumeIntegration", contextMatcher, integrationID).
+				Return(app.ErrNotWebhook)
+			return a
+		},
+
+		Code: http.StatusConflict,
+		Response: rest.Error{
+			Err:       app.ErrNotWebhook.Error(),
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, integration not found",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("ResumeIntegration", contextMatcher, integrationID).
+				Return(app.ErrIntegrationNotFound)
+			return a
+		},
+
+		Code: http.StatusNotFound,
+		Response: rest.Error{
+			Err:       ErrIntegrationNotFound.Error(),
+			RequestID: "test",
+		},
+	}, {
+		Name: "error, internal error",
+
+		IntegrationID: integrationID.String(),
+		App: func(t *testing.T) *mapp.App {
+			a := new(mapp.App)
+			a.On("ResumeIntegration", contextMatcher, integrationID).
+				Return(errors.New("internal error"))
+			return a
+		},
+
+		Code: http.StatusInternalServerError,
+		Response: rest.Error{
+			Err:       "internal error",
+			RequestID: "test",
+		},
+	}}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			testApp := tc.App(t)
+			defer testApp.AssertExpectations(t)
+			repl := strings.NewReplacer(":id", tc.IntegrationID)
+			req, _ := http.NewRequest(
+				http.MethodPost,
+				"http://localhost"+APIURLManagement+
+					repl.Replace(APIURLIntegrationResume),
+				nil,
+			)
+			for k, v := range headers {
+				req.Header[k] = v
+			}
+
+			w := httptest.NewRecorder()
+			handler := NewRouter(testApp)
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Code, w.Code, "invalid HTTP status code")
+			if tc.Response != nil {
+				b, _ := json.Marshal(tc.Response)
+				assert.JSONEq(t, string(b), w.Body.String())
+			} else {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRemoveIntegration(t *testing.T) {
+	t.Parallel()
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("integration"))
+
+	type testCase struct {
+		Name string
+
+		IntegrationID string
+		Header        http.Header
+		App           func(t *testing.T, self *testCase) *mapp.App
+
+		Code     int
+		Response interface{}
+		Error    error
+	}
+
+	testCases := []testCase{
+		{
+			Name:          "error/forbidden",
+			IntegrationID: integrationID.String(),
+			Header: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					Subject: uuid.NewString(),
+					Tenant:  "123456789012345678901234",
+				})},
+			},
+
+			App: func(t *testing.T, self *testCase) *mapp.App { return new(mapp.App) },
+
+			Code:  http.StatusForbidden,
+			Error: ErrMissingUserAuthentication,
+		},
+		{
+			Name: "ok",
+
+			IntegrationID: integrationID.String(),
+			Header: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+					Tenant:  "123456789012345678901234",
+					IsUser:  true,
+				})},
+			},
+			App: func(t *testing.T, self *testCase) *mapp.App {
+				appie := new(mapp.App)
+				appie.On("RemoveIntegration", contextMatcher, integrationID).
+					Return(nil)
+				return appie
+			},
+
+			Code:     http.StatusNoContent,
+			Response: nil,
+		},
+		{
+			Name: "error, cannot remove integration",
+
+			IntegrationID: integrationID.String(),
+			Header: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+					Tenant:  "123456789012345678901234",
+					IsUser:  true,
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+			App: func(t *testing.T, self *testCase) *mapp.App {
+				appie := new(mapp.App)
+				appie.On("RemoveIntegration", contextMatcher, integrationID).
+					Return(app.ErrCannotRemoveIntegration)
+				return appie
+			},
+
+			Code: http.StatusConflict,
+			Response: rest.Error{
+				Err:       app.ErrIntegrationNotFound.Error(),
+				RequestID: "test",
+			},
+			Error: app.ErrCannotRemoveIntegration,
+		},
+		{
+			Name: "error, integration not found",
+
+			IntegrationID: integrationID.String(),
+			Header: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+					Tenant:  "123456789012345678901234",
+					IsUser:  true,
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+			App: func(t *testing.T, self *testCase) *mapp.App {
+				appie := new(mapp.App)
+				appie.On("RemoveIntegration", contextMatcher, integrationID).
+					Return(app.ErrIntegrationNotFound)
+				return appie
+			},
+
+			Code: http.StatusNotFound,
+			Response: rest.Error{
+				Err:       app.ErrIntegrationNotFound.Error(),
+				RequestID: "test",
+			},
+			Error: app.ErrIntegrationNotFound,
+		},
+		{
+			Name: "error, internal server error",
+
+			IntegrationID: integrationID.String(),
+			Header: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+					Tenant:  "123456789012345678901234",
+					IsUser:  true,
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+			App: func(t *testing.T, self *testCase) *mapp.App {
+				appie := new(mapp.App)
+				appie.On("RemoveIntegration", contextMatcher, integrationID).
+					Return(errors.New("Internal Server Error"))
+				return appie
+			},
+
+			Code: http.StatusInternalServerError,
+			Response: rest.Error{
+				Err:       app.ErrIntegrationNotFound.Error(),
+				RequestID: "test",
+			},
+			Error: errors.New("Internal Server Error"),
+		},
+		{
+			Name: "error, cannot parse path param",
+
+			IntegrationID: "invalid_uuid",
+			Header: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					Subject: uuid.NewSHA1(uuid.NameSpaceOID, []byte{'2'}).String(),
+					Tenant:  "123456789012345678901234",
+					IsUser:  true,
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+			App: func(t *testing.T, self *testCase) *mapp.App { return new(mapp.App) },
+
+			Code: http.StatusBadRequest,
+			Response: rest.Error{
+				Err:       "integration ID must be a valid UUID: invalid UUID length: 12",
+				RequestID: "test",
+			},
+			Error: errors.New("integration ID must be a valid UUID"),
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			app := tc.App(t, &tc)
+			defer app.AssertExpectations(t)
+			repl := strings.NewReplacer(":id", tc.IntegrationID)
+			req, _ := http.NewRequest(
+				http.MethodDelete,
+				"http://localhost"+APIURLManagement+
+					repl.Replace(APIURLIntegration),
+				nil,
+			)
+			for k, v := range tc.Header {
+				req.Header[k] = v
+			}
+
+			w := httptest.NewRecorder()
+			handler := NewRouter(app)
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Code, w.Code, "invalid HTTP status code")
+
+			if tc.Error != nil {
+				var erro rest.Error
+				if assert.NotNil(t, w.Body) {
+					err := json.Unmarshal(w.Body.Bytes(), &erro)
+					require.NoError(t, err)
+					assert.Regexp(t, tc.Error.Error(), erro.Error())
+				}
+			} else {
+				assert.Empty(t, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func validateAuthz(t *testing.T, key []byte, hdr string) bool {
+	if !assert.True(t, strings.HasPrefix(hdr, "SharedAccessSignature")) {
+		return false
+	}
+	hdr = strings.TrimPrefix(hdr, "SharedAccessSignature")
+	hdr = strings.TrimLeft(hdr, " ")
+	q, err := url.ParseQuery(hdr)
+	if !assert.NoError(t, err) {
+		return false
+	}
+	for _, key := range []string{"sr", "se", "sig"} {
+		if !assert.Contains(t, q, key, "missing signature parameters") {
+			return false
+		}
+	}
+	msg := fmt.Sprintf("%s\n%s", url.QueryEscape(q.Get("sr")), q.Get("se"))
+	digest := hmac.New(sha256.New, key)
+	digest.Write([]byte(msg))
+	expected := digest.Sum(nil)
+	return assert.Equal(t, base64.StdEncoding.EncodeToString(expected), q.Get("sig"))
+}
+
+type neverExpireContext struct {
+	context.Context
+}
+
+func (neverExpireContext) Deadline() (time.Time, bool) {
+	return time.Now().Add(time.Hour), true
+}
+
+func TestGetEvents(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name string
+
+		Headers http.Header
+
+		Url string
+
+		App func(t *testing.T) *mapp.App
+
+		StatusCode int
+		Response   interface{}
+		Link       string
+	}{
+		{
+			Name: "ok",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+			},
+
+			Url: "http://localhost" + APIURLManagement + APIURLEvents,
+
+			App: func(t *testing.T) *mapp.App {
+				app := new(mapp.App)
+				app.On("GetEvents", contextMatcher, model.EventsFilter{Limit: 20}).
+					Return([]model.Event{{
+						WebhookEvent: model.WebhookEvent{
+							ID:      uuid.Nil,
+							Type:    model.EventTypeDeviceProvisioned,
+							Data:    model.DeviceEvent{ID: uuid.Nil.String()},
+							EventTS: time.Time{},
+						},
+						DeliveryStatus: []model.DeliveryStatus{{
+							IntegrationID: uuid.Nil,
+							Success:       true,
+							StatusCode: func() *int {
+								i := 200
+								return &i
+							}(),
+						}},
+					}}, nil)
+				return app
+			},
+
+			StatusCode: http.StatusOK,
+			Response: []map[string]interface{}{{
+				"id":   uuid.Nil,
+				"data": map[string]interface{}{"id": "00000000-0000-0000-0000-000000000000"},
+				"delivery_statuses": []map[string]interface{}{{
+					"integration_id": uuid.Nil,
+					"success":        true,
+					"status_code":    200,
+				}},
+				"time": "0001-01-01T00:00:00Z",
+				"type": "device-provisioned",
+			}},
+		},
+		{
+			Name: "ok, with query params",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+			},
+
+			Url: "http://localhost" + APIURLManagement + APIURLEvents + "?page=3&per_page=500",
+
+			App: func(t *testing.T) *mapp.App {
+				app := new(mapp.App)
+				app.On("GetEvents", contextMatcher, model.EventsFilter{Skip: 1000, Limit: 500}).
+					Return([]model.Event{{
+						WebhookEvent: model.WebhookEvent{
+							ID:      uuid.Nil,
+							Type:    model.EventTypeDeviceProvisioned,
+							Data:    model.DeviceEvent{ID: uuid.Nil.String()},
+							EventTS: time.Time{},
+						},
+						DeliveryStatus: []model.DeliveryStatus{{
+							IntegrationID: uuid.Nil,
+							Success:       true,
+							StatusCode: func() *int {
+								i := 200
+								return &i
+							}(),
+						}},
+					}}, nil)
+				return app
+			},
+
+			StatusCode: http.StatusOK,
+			Response: []map[string]interface{}{{
+				"id":   uuid.Nil,
+				"data": map[string]interface{}{"id": "00000000-0000-0000-0000-000000000000"},
+				"delivery_statuses": []map[string]interface{}{{
+					"integration_id": uuid.Nil,
+					"success":        true,
+					"status_code":    200,
+				}},
+				"time": "0001-01-01T00:00:00Z",
+				"type": "device-provisioned",
+			}},
+		},
+		{
+			Name: "bad request",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement + APIURLEvents + "?page=foo",
+
+			StatusCode: http.StatusBadRequest,
+			Response: map[string]interface{}{
+				"error":      "invalid page query: \"foo\"",
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "ok, with filters and cursor",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+			},
+
+			Url: "http://localhost" + APIURLManagement + APIURLEvents + "?" + url.Values{
+				"per_page":       []string{"1"},
+				"type":           []string{"device-provisioned"},
+				"integration_id": []string{"6a0a8d6c-7a9d-4bb4-9f34-5d2b6a9c2f0e"},
+				"success":        []string{"false"},
+				"device_id":      []string{"foo"},
+				"from":           []string{"2024-01-01T00:00:00Z"},
+				"to":             []string{"2024-01-02T00:00:00Z"},
+				"cursor": []string{model.EventsCursor{
+					EventTS: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+					ID:      uuid.Nil,
+				}.String()},
+			}.Encode(),
+
+			App: func(t *testing.T) *mapp.App {
+				app := new(mapp.App)
+				success := false
+				app.On("GetEvents", contextMatcher,
+					mock.MatchedBy(func(fltr model.EventsFilter) bool {
+						return assert.Equal(t, model.EventsFilter{
+							Limit: 1,
+							After: &model.EventsCursor{
+								EventTS: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).Local(),
+								ID:      uuid.Nil,
+							},
+							Type: model.EventTypeDeviceProvisioned,
+							IntegrationID: uuid.MustParse(
+								"6a0a8d6c-7a9d-4bb4-9f34-5d2b6a9c2f0e",
+							),
+							Success:  &success,
+							DeviceID: "foo",
+							From:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+							To:       time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+						}, fltr)
+					})).
+					Return([]model.Event{{
+						WebhookEvent: model.WebhookEvent{
+							ID:      uuid.Nil,
+							Type:    model.EventTypeDeviceProvisioned,
+							Data:    model.DeviceEvent{ID: "foo"},
+							EventTS: time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+						},
+					}}, nil)
+				return app
+			},
+
+			StatusCode: http.StatusOK,
+			Response: []map[string]interface{}{{
+				"id":   uuid.Nil,
+				"data": map[string]interface{}{"id": "foo"},
+				"time": "2024-01-01T06:00:00Z",
+				"type": "device-provisioned",
+			}},
+			Link: "<" + APIURLManagement + APIURLEvents + "?" + url.Values{
+				"per_page":       []string{"1"},
+				"type":           []string{"device-provisioned"},
+				"integration_id": []string{"6a0a8d6c-7a9d-4bb4-9f34-5d2b6a9c2f0e"},
+				"success":        []string{"false"},
+				"device_id":      []string{"foo"},
+				"from":           []string{"2024-01-01T00:00:00Z"},
+				"to":             []string{"2024-01-02T00:00:00Z"},
+				"cursor": []string{model.EventsCursor{
+					EventTS: time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+					ID:      uuid.Nil,
+				}.String()},
+			}.Encode() + ">; rel=\"next\"",
+		},
+		{
+			Name: "bad request, invalid cursor",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement + APIURLEvents + "?cursor=foo",
+
+			StatusCode: http.StatusBadRequest,
+			Response: map[string]interface{}{
+				"error":      model.ErrInvalidEventsCursor.Error(),
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "bad request, cursor with page",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement + APIURLEvents + "?page=2&cursor=" +
+				model.EventsCursor{}.String(),
+
+			StatusCode: http.StatusBadRequest,
+			Response: map[string]interface{}{
+				"error":      "cursor cannot be combined with page",
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "bad request, invalid type",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement + APIURLEvents + "?type=foo",
+
+			StatusCode: http.StatusBadRequest,
+			Response: map[string]interface{}{
+				"error":      "Type: must be a valid value.",
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "bad request, invalid time range",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement + APIURLEvents +
+				"?from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z",
+
+			StatusCode: http.StatusBadRequest,
+			Response: map[string]interface{}{
+				"error":      "To: must be no less than from.",
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "bad request, invalid success",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
 
-			assert.Equal(t, tc.Code, w.Code, "invalid HTTP status code")
+			Url: "http://localhost" + APIURLManagement + APIURLEvents + "?success=maybe",
 
-			if tc.Error != nil {
-				var erro rest.Error
-				if assert.NotNil(t, w.Body) {
-					err := json.Unmarshal(w.Body.Bytes(), &erro)
-					require.NoError(t, err)
-					assert.Regexp(t, tc.Error.Error(), erro.Error())
-				}
+			StatusCode: http.StatusBadRequest,
+			Response: map[string]interface{}{
+				"error":      "invalid success query: \"maybe\"",
+				"request_id": "test",
+			},
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			var testApp *mapp.App
+			if tc.App == nil {
+				testApp = new(mapp.App)
 			} else {
-				assert.Empty(t, w.Body.Bytes())
+				testApp = tc.App(t)
+			}
+			defer testApp.AssertExpectations(t)
+			handler := NewRouter(testApp)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET",
+				tc.Url,
+				nil,
+			)
+			for key := range tc.Headers {
+				req.Header.Set(key, tc.Headers.Get(key))
 			}
-		})
-	}
-}
-
-type roundTripperFunc func(*http.Request) (*http.Response, error)
-
-func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
-	return f(r)
-}
 
-func validateAuthz(t *testing.T, key []byte, hdr string) bool {
-	if !assert.True(t, strings.HasPrefix(hdr, "SharedAccessSignature")) {
-		return false
-	}
-	hdr = strings.TrimPrefix(hdr, "SharedAccessSignature")
-	hdr = strings.TrimLeft(hdr, " ")
-	q, err := url.ParseQuery(hdr)
-	if !assert.NoError(t, err) {
-		return false
-	}
-	for _, key := range []string{"sr", "se", "sig"} {
-		if !assert.Contains(t, q, key, "missing signature parameters") {
-			return false
-		}
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tc.StatusCode, w.Code, "invalid HTTP status code")
+			b, _ := json.Marshal(tc.Response)
+			assert.JSONEq(t, string(b), w.Body.String())
+			assert.Equal(t, tc.Link, w.Header().Get("Link"))
+		})
 	}
-	msg := fmt.Sprintf("%s\n%s", url.QueryEscape(q.Get("sr")), q.Get("se"))
-	digest := hmac.New(sha256.New, key)
-	digest.Write([]byte(msg))
-	expected := digest.Sum(nil)
-	return assert.Equal(t, base64.StdEncoding.EncodeToString(expected), q.Get("sig"))
-}
-
-type neverExpireContext struct {
-	context.Context
-}
-
-func (neverExpireContext) Deadline() (time.Time, bool) {
-	return time.Now().Add(time.Hour), true
 }
 
-func TestGetEvents(t *testing.T) {
+func TestRedeliverEvent(t *testing.T) {
 	t.Parallel()
+	eventID := uuid.MustParse("0b1e4f8e-3c2b-4b7a-9a6f-7f3c1c4f0c11")
+	integrationID := uuid.MustParse("9a1d9c5e-3d1b-4cd5-bd65-8a2f5d9f7e21")
 	testCases := []struct {
 		Name string
 
@@ -1033,45 +2419,40 @@ func TestGetEvents(t *testing.T) {
 				})},
 			},
 
-			Url: "http://localhost" + APIURLManagement + APIURLEvents,
+			Url: "http://localhost" + APIURLManagement +
+				strings.ReplaceAll(APIURLEventRedelivery, ":id", eventID.String()),
 
 			App: func(t *testing.T) *mapp.App {
 				app := new(mapp.App)
-				app.On("GetEvents", contextMatcher, model.EventsFilter{Limit: 20}).
-					Return([]model.Event{{
+				app.On("RedeliverEvent", contextMatcher, eventID, uuid.Nil, false).
+					Return(&model.Event{
 						WebhookEvent: model.WebhookEvent{
-							ID:      uuid.Nil,
-							Type:    model.EventTypeDeviceProvisioned,
-							Data:    model.DeviceEvent{ID: uuid.Nil.String()},
-							EventTS: time.Time{},
+							ID:   eventID,
+							Type: model.EventTypeDeviceDecommissioned,
+							Data: model.DeviceEvent{ID: uuid.Nil.String()},
 						},
 						DeliveryStatus: []model.DeliveryStatus{{
-							IntegrationID: uuid.Nil,
+							IntegrationID: integrationID,
 							Success:       true,
-							StatusCode: func() *int {
-								i := 200
-								return &i
-							}(),
 						}},
-					}}, nil)
+					}, nil)
 				return app
 			},
 
 			StatusCode: http.StatusOK,
-			Response: []map[string]interface{}{{
-				"id":   uuid.Nil,
+			Response: map[string]interface{}{
+				"id":   eventID,
 				"data": map[string]interface{}{"id": "00000000-0000-0000-0000-000000000000"},
 				"delivery_statuses": []map[string]interface{}{{
-					"integration_id": uuid.Nil,
+					"integration_id": integrationID,
 					"success":        true,
-					"status_code":    200,
 				}},
 				"time": "0001-01-01T00:00:00Z",
-				"type": "device-provisioned",
-			}},
+				"type": "device-decommissioned",
+			},
 		},
 		{
-			Name: "ok, with query params",
+			Name: "ok, forced with integration filter",
 
 			Headers: http.Header{
 				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
@@ -1081,45 +2462,32 @@ func TestGetEvents(t *testing.T) {
 				})},
 			},
 
-			Url: "http://localhost" + APIURLManagement + APIURLEvents + "?page=3&per_page=500",
+			Url: "http://localhost" + APIURLManagement +
+				strings.ReplaceAll(APIURLEventRedelivery, ":id", eventID.String()) +
+				"?integration_id=" + integrationID.String() + "&force=true",
 
 			App: func(t *testing.T) *mapp.App {
 				app := new(mapp.App)
-				app.On("GetEvents", contextMatcher, model.EventsFilter{Skip: 1000, Limit: 500}).
-					Return([]model.Event{{
+				app.On("RedeliverEvent", contextMatcher, eventID, integrationID, true).
+					Return(&model.Event{
 						WebhookEvent: model.WebhookEvent{
-							ID:      uuid.Nil,
-							Type:    model.EventTypeDeviceProvisioned,
-							Data:    model.DeviceEvent{ID: uuid.Nil.String()},
-							EventTS: time.Time{},
+							ID:   eventID,
+							Type: model.EventTypeDeviceDecommissioned,
 						},
-						DeliveryStatus: []model.DeliveryStatus{{
-							IntegrationID: uuid.Nil,
-							Success:       true,
-							StatusCode: func() *int {
-								i := 200
-								return &i
-							}(),
-						}},
-					}}, nil)
+					}, nil)
 				return app
 			},
 
 			StatusCode: http.StatusOK,
-			Response: []map[string]interface{}{{
-				"id":   uuid.Nil,
-				"data": map[string]interface{}{"id": "00000000-0000-0000-0000-000000000000"},
-				"delivery_statuses": []map[string]interface{}{{
-					"integration_id": uuid.Nil,
-					"success":        true,
-					"status_code":    200,
-				}},
+			Response: map[string]interface{}{
+				"id":   eventID,
+				"data": nil,
 				"time": "0001-01-01T00:00:00Z",
-				"type": "device-provisioned",
-			}},
+				"type": "device-decommissioned",
+			},
 		},
 		{
-			Name: "bad request",
+			Name: "error, invalid event ID",
 
 			Headers: http.Header{
 				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
@@ -1130,11 +2498,168 @@ func TestGetEvents(t *testing.T) {
 				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
 			},
 
-			Url: "http://localhost" + APIURLManagement + APIURLEvents + "?page=foo",
+			Url: "http://localhost" + APIURLManagement +
+				strings.ReplaceAll(APIURLEventRedelivery, ":id", "foo"),
 
 			StatusCode: http.StatusBadRequest,
 			Response: map[string]interface{}{
-				"error":      "invalid page query: \"foo\"",
+				"error":      "event ID must be a valid UUID: invalid UUID length: 3",
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "error, invalid integration ID",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement +
+				strings.ReplaceAll(APIURLEventRedelivery, ":id", eventID.String()) +
+				"?integration_id=bar",
+
+			StatusCode: http.StatusBadRequest,
+			Response: map[string]interface{}{
+				"error":      "integration ID must be a valid UUID: invalid UUID length: 3",
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "error, invalid force",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement +
+				strings.ReplaceAll(APIURLEventRedelivery, ":id", eventID.String()) +
+				"?force=maybe",
+
+			StatusCode: http.StatusBadRequest,
+			Response: map[string]interface{}{
+				"error":      `invalid force query: "maybe"`,
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "error, newer event",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement +
+				strings.ReplaceAll(APIURLEventRedelivery, ":id", eventID.String()),
+
+			App: func(t *testing.T) *mapp.App {
+				testApp := new(mapp.App)
+				testApp.On("RedeliverEvent", contextMatcher, eventID, uuid.Nil, false).
+					Return(nil, app.ErrEventOutdated)
+				return testApp
+			},
+
+			StatusCode: http.StatusConflict,
+			Response: map[string]interface{}{
+				"error":      app.ErrEventOutdated.Error(),
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "error, delivery in progress",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement +
+				strings.ReplaceAll(APIURLEventRedelivery, ":id", eventID.String()),
+
+			App: func(t *testing.T) *mapp.App {
+				testApp := new(mapp.App)
+				testApp.On("RedeliverEvent", contextMatcher, eventID, uuid.Nil, false).
+					Return(nil, app.ErrDeliveryInProgress)
+				return testApp
+			},
+
+			StatusCode: http.StatusConflict,
+			Response: map[string]interface{}{
+				"error":      app.ErrDeliveryInProgress.Error(),
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "error, event not found",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement +
+				strings.ReplaceAll(APIURLEventRedelivery, ":id", eventID.String()),
+
+			App: func(t *testing.T) *mapp.App {
+				testApp := new(mapp.App)
+				testApp.On("RedeliverEvent", contextMatcher, eventID, uuid.Nil, false).
+					Return(nil, app.ErrEventNotFound)
+				return testApp
+			},
+
+			StatusCode: http.StatusNotFound,
+			Response: map[string]interface{}{
+				"error":      ErrEventNotFound.Error(),
+				"request_id": "test",
+			},
+		},
+		{
+			Name: "error, internal error",
+
+			Headers: http.Header{
+				"Authorization": []string{"Bearer " + GenerateJWT(identity.Identity{
+					IsUser:  true,
+					Subject: "829cbefb-70e7-438f-9ac5-35fd131c2111",
+					Tenant:  "123456789012345678901234",
+				})},
+				textproto.CanonicalMIMEHeaderKey(requestid.RequestIdHeader): []string{"test"},
+			},
+
+			Url: "http://localhost" + APIURLManagement +
+				strings.ReplaceAll(APIURLEventRedelivery, ":id", eventID.String()),
+
+			App: func(t *testing.T) *mapp.App {
+				app := new(mapp.App)
+				app.On("RedeliverEvent", contextMatcher, eventID, uuid.Nil, false).
+					Return(nil, errors.New("internal error"))
+				return app
+			},
+
+			StatusCode: http.StatusInternalServerError,
+			Response: map[string]interface{}{
+				"error":      "internal error",
 				"request_id": "test",
 			},
 		},
@@ -1152,7 +2677,7 @@ func TestGetEvents(t *testing.T) {
 			defer testApp.AssertExpectations(t)
 			handler := NewRouter(testApp)
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET",
+			req, _ := http.NewRequest(http.MethodPost,
 				tc.Url,
 				nil,
 			)
@@ -30,6 +30,8 @@ import (
 	"github.com/mendersoftware/go-lib-micro/rest.utils"
 
 	"github.com/mendersoftware/iot-manager/app"
+	"github.com/mendersoftware/iot-manager/metrics"
+	"github.com/mendersoftware/iot-manager/tracing"
 )
 
 // API URL used by the HTTP router
@@ -38,6 +40,7 @@ const (
 
 	APIURLAlive             = "/alive"
 	APIURLHealth            = "/health"
+	APIURLMetrics           = "/metrics"
 	APIURLTenants           = "/tenants"
 	APIURLTenant            = APIURLTenants + "/:tenant_id"
 	APIURLTenantAuth        = APIURLTenant + "/auth"
@@ -51,12 +54,21 @@ const (
 	APIURLIntegrations           = "/integrations"
 	APIURLIntegration            = "/integrations/:id"
 	APIURLIntegrationCredentials = APIURLIntegration + "/credentials"
+	APIURLIntegrationRotation    = APIURLIntegrationCredentials + "/rotate"
+	APIURLIntegrationDevices     = APIURLIntegration + "/devices"
+	APIURLIntegrationTest        = APIURLIntegration + "/test"
+	APIURLIntegrationHealth      = APIURLIntegration + "/health"
+	APIURLIntegrationResume      = APIURLIntegration + "/resume"
 
+	APIURLDevices                = "/devices"
 	APIURLDevice                 = "/devices/:id"
 	APIURLDeviceState            = APIURLDevice + "/state"
 	APIURLDeviceStateIntegration = APIURLDevice + "/state/:integrationId"
+	APIURLDeviceIntegration      = APIURLDevice + "/integrations/:integrationId"
 
-	APIURLEvents = "/events"
+	APIURLEvents          = "/events"
+	APIURLEvent           = APIURLEvents + "/:id"
+	APIURLEventRedelivery = APIURLEvent + "/redeliver"
 )
 
 const (
@@ -102,12 +114,15 @@ func NewRouter(
 	router := gin.New()
 	router.Use(accesslog.Middleware())
 	router.Use(requestid.Middleware())
+	router.Use(tracing.Middleware())
+	router.Use(metrics.Middleware())
 
 	router.NoRoute(handler.NoRoute)
 
 	internalAPI := router.Group(APIURLInternal)
 	internalAPI.GET(APIURLAlive, handler.Alive)
 	internalAPI.GET(APIURLHealth, handler.Health)
+	internalAPI.GET(APIURLMetrics, gin.WrapH(metrics.Handler()))
 
 	internalAPI.DELETE(APIURLTenant, internal.DeleteTenant)
 	internalAPI.POST(APIURLTenantDevices, internal.ProvisionDevice)
@@ -120,14 +135,25 @@ func NewRouter(
 	managementAPI.GET(APIURLIntegrations, management.GetIntegrations)
 	managementAPI.GET(APIURLIntegration, management.GetIntegrationById)
 	managementAPI.POST(APIURLIntegrations, management.CreateIntegration)
+	managementAPI.PATCH(APIURLIntegration, management.UpdateIntegration)
 	managementAPI.PUT(APIURLIntegrationCredentials, management.SetIntegrationCredentials)
+	managementAPI.POST(APIURLIntegrationRotation, management.RotateWebhookSecret)
+	managementAPI.POST(APIURLIntegrationTest, management.VerifyIntegration)
+	managementAPI.GET(APIURLIntegrationHealth, management.GetIntegrationHealth)
+	managementAPI.POST(APIURLIntegrationResume, management.ResumeIntegration)
 	managementAPI.DELETE(APIURLIntegration, management.RemoveIntegration)
+	managementAPI.GET(APIURLIntegrationDevices, management.GetIntegrationDevices)
 
+	managementAPI.GET(APIURLDevices, management.GetDevices)
+	managementAPI.DELETE(APIURLDevice, management.UnregisterDevice)
+	managementAPI.PUT(APIURLDeviceIntegration, management.AttachDeviceIntegration)
+	managementAPI.DELETE(APIURLDeviceIntegration, management.DetachDeviceIntegration)
 	managementAPI.GET(APIURLDeviceState, management.GetDeviceState)
 	managementAPI.GET(APIURLDeviceStateIntegration, management.GetDeviceStateIntegration)
 	managementAPI.PUT(APIURLDeviceStateIntegration, management.SetDeviceStateIntegration)
 
 	managementAPI.GET(APIURLEvents, management.GetEvents)
+	managementAPI.POST(APIURLEventRedelivery, management.RedeliverEvent)
 
 	return router
 }
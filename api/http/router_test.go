@@ -43,6 +43,23 @@ func TestAlive(t *testing.T) {
 	azureIotManagerApp.AssertExpectations(t)
 }
 
+func TestMetrics(t *testing.T) {
+	router := NewRouter(&app_mocks.App{})
+
+	// Count a request before scraping the metrics
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", APIURLInternal+APIURLAlive, nil)
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", APIURLInternal+APIURLMetrics, nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `iot_manager_http_requests_total{`+
+		`method="GET",route="`+APIURLInternal+APIURLAlive+`",status="204"}`)
+}
+
 func TestHealth(t *testing.T) {
 	testCases := []struct {
 		Name           string
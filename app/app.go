@@ -17,6 +17,7 @@ package app
 import (
 	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -30,15 +31,21 @@ import (
 	"github.com/mendersoftware/iot-manager/client/iotcore"
 	"github.com/mendersoftware/iot-manager/client/iothub"
 	"github.com/mendersoftware/iot-manager/client/workflows"
+	"github.com/mendersoftware/iot-manager/metrics"
 	"github.com/mendersoftware/iot-manager/model"
 	"github.com/mendersoftware/iot-manager/store"
+	"github.com/mendersoftware/iot-manager/tracing"
 )
 
 var (
 	ErrIntegrationNotFound = errors.New("integration not found")
 	ErrIntegrationExists   = errors.New("integration already exists")
-	ErrUnknownIntegration  = errors.New("unknown integration provider")
-	ErrNoCredentials       = errors.New("no connection string or credentials " +
+	ErrIntegrationConflict = errors.New("integration was modified concurrently")
+	ErrNotWebhook          = errors.New("operation is only supported by webhooks")
+	ErrSelectorOverlap     = errors.New("the selector overlaps the selector of " +
+		"another integration of the same provider")
+	ErrUnknownIntegration = errors.New("unknown integration provider")
+	ErrNoCredentials      = errors.New("no connection string or credentials " +
 		"configured for the tenant")
 	ErrNoDeviceConnectionString = errors.New("device has no connection string")
 
@@ -46,6 +53,13 @@ var (
 	ErrDeviceNotFound          = errors.New("device not found")
 	ErrDeviceStateConflict     = errors.New("conflict when updating the device state")
 	ErrCannotRemoveIntegration = errors.New("cannot remove integration in use by devices")
+	ErrDeviceNotSelected       = errors.New("device does not match the integration selector")
+
+	ErrEventNotFound = errors.New("event not found")
+	ErrEventOutdated = errors.New("a newer status change of the device targets the " +
+		"integration, force the redelivery to replay the event anyway")
+	ErrDeliveryInProgress = errors.New("the delivery of the event to the " +
+		"integration is in progress")
 )
 
 const (
@@ -63,15 +77,32 @@ type App interface {
 	WithIoTCore(client iotcore.Client) App
 	WithIoTHub(client iothub.Client) App
 	WithWebhooksTimeout(timeout uint) App
+	WithWebhooksRetry(maxAttempts, backoff, maxBackoff uint) App
+	WithWebhooksCircuitBreaker(failures, failureRate, window, cooldown uint) App
+	WithAsyncWorkers(workers, queueSize, tenantQueueSize, batchSize uint) App
 	HealthCheck(context.Context) error
 	GetDeviceIntegrations(context.Context, string) ([]model.Integration, error)
 	GetIntegrations(context.Context) ([]model.Integration, error)
 	GetIntegrationById(context.Context, uuid.UUID) (*model.Integration, error)
 	CreateIntegration(context.Context, model.Integration) (*model.Integration, error)
 	SetDeviceStatus(context.Context, string, model.Status) error
+	BulkSetDeviceStatus(context.Context, []string, model.Status) error
 	SetIntegrationCredentials(context.Context, uuid.UUID, model.Credentials) error
+	UpdateIntegration(context.Context, model.Integration) (*model.Integration, error)
+	VerifyIntegration(context.Context, uuid.UUID) error
+	ResumeIntegration(context.Context, uuid.UUID) error
+	RotateWebhookSecret(
+		context.Context,
+		uuid.UUID,
+		*model.HexSecret,
+		time.Duration,
+	) (*model.HTTPCredentials, error)
 	RemoveIntegration(context.Context, uuid.UUID) error
 	GetDevice(context.Context, string) (*model.Device, error)
+	GetDevices(context.Context, model.DeviceFilter) ([]model.Device, error)
+	UnregisterDevice(ctx context.Context, deviceID string, cleanup bool) error
+	AttachDeviceIntegration(ctx context.Context, deviceID string, integrationID uuid.UUID) error
+	DetachDeviceIntegration(ctx context.Context, deviceID string, integrationID uuid.UUID) error
 	GetDeviceStateIntegration(context.Context, string, uuid.UUID) (*model.DeviceState, error)
 	SetDeviceStateIntegration(context.Context, string, uuid.UUID, *model.DeviceState) (*model.DeviceState, error)
 	GetDeviceStateIoTHub(context.Context, string, *model.Integration) (*model.DeviceState, error)
@@ -85,7 +116,15 @@ type App interface {
 	SyncDevices(context.Context, int, bool) error
 
 	GetEvents(ctx context.Context, filter model.EventsFilter) ([]model.Event, error)
+	GetIntegrationHealth(
+		ctx context.Context,
+		integrationID uuid.UUID,
+	) (*model.IntegrationHealth, error)
+	RedeliverEvent(ctx context.Context, eventID, integrationID uuid.UUID, force bool) (*model.Event, error)
 	VerifyDeviceTwin(ctx context.Context, req model.PreauthRequest) error
+
+	RunDeliveryWorker(ctx context.Context, interval time.Duration) error
+	DrainTasks(ctx context.Context) error
 }
 
 // app is an app object
@@ -97,20 +136,39 @@ type app struct {
 	devauth         devauth.Client
 	httpClient      *http.Client
 	webhooksTimeout time.Duration
+	// tlsClients caches the HTTP clients of webhooks with a TLS
+	// configuration by integration ID.
+	tlsClients   map[uuid.UUID]*tlsClient
+	tlsClientsMu sync.Mutex
+
+	webhooksMaxAttempts int
+	webhooksBackoff     time.Duration
+	webhooksMaxBackoff  time.Duration
+	webhooksBreaker     circuitBreaker
+
+	tasks *taskPool
+
+	// exportPollInterval is the interval between the status checks of the
+	// IoT Hub export jobs.
+	exportPollInterval time.Duration
 }
 
 // NewApp initialize a new iot-manager App
 func New(ds store.DataStore, wf workflows.Client, da devauth.Client) App {
 	c := client.New()
-	hubClient := iothub.NewClient(
-		iothub.NewOptions().SetClient(c),
-	)
+	hubClient := iothub.NewClient(iothub.NewOptions().SetClient(
+		metrics.InstrumentClient(metrics.ProviderIoTHub, tracing.InstrumentClient(c)),
+	))
 	return &app{
 		store:        ds,
 		wf:           wf,
 		devauth:      da,
 		iothubClient: hubClient,
-		httpClient:   c,
+		httpClient: metrics.InstrumentClient(
+			metrics.ProviderWebhook, tracing.InstrumentExternalClient(c),
+		),
+
+		exportPollInterval: defaultExportPollInterval,
 	}
 }
 
@@ -158,6 +216,18 @@ func (a *app) CreateIntegration(
 	ctx context.Context,
 	integration model.Integration,
 ) (*model.Integration, error) {
+	if err := a.verifyCredentials(ctx, integration.Credentials); err != nil {
+		return nil, err
+	}
+	if err := a.checkSelectorOverlap(ctx, integration); err != nil {
+		return nil, err
+	}
+	// The delivery state is maintained by the circuit breaker.
+	integration.State = ""
+	integration.CircuitBreaker = nil
+	if integration.Provider == model.ProviderWebhook {
+		integration.State = model.IntegrationStateActive
+	}
 	result, err := a.store.CreateIntegration(ctx, integration)
 	if err == store.ErrObjectExists {
 		return nil, ErrIntegrationExists
@@ -170,7 +240,11 @@ func (a *app) SetIntegrationCredentials(
 	integrationID uuid.UUID,
 	credentials model.Credentials,
 ) error {
-	err := a.store.SetIntegrationCredentials(ctx, integrationID, credentials)
+	err := a.verifyCredentials(ctx, credentials)
+	if err != nil {
+		return err
+	}
+	err = a.store.SetIntegrationCredentials(ctx, integrationID, credentials)
 	if err != nil {
 		switch cause := errors.Cause(err); cause {
 		case store.ErrObjectNotFound:
@@ -179,7 +253,35 @@ func (a *app) SetIntegrationCredentials(
 			return err
 		}
 	}
-	return err
+	return nil
+}
+
+// UpdateIntegration updates the integration settings provided that the
+// integration version has not changed since it was retrieved.
+func (a *app) UpdateIntegration(
+	ctx context.Context,
+	integration model.Integration,
+) (*model.Integration, error) {
+	if err := a.checkSelectorOverlap(ctx, integration); err != nil {
+		return nil, err
+	}
+	result, err := a.store.UpdateIntegration(ctx, integration)
+	switch err {
+	case nil:
+		return result, nil
+	case store.ErrObjectExists:
+		return nil, ErrIntegrationExists
+	case store.ErrObjectNotFound:
+		_, err = a.store.GetIntegrationById(ctx, integration.ID)
+		if err == store.ErrObjectNotFound {
+			return nil, ErrIntegrationNotFound
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to retrieve the integration")
+		}
+		return nil, ErrIntegrationConflict
+	default:
+		return nil, err
+	}
 }
 
 func (a *app) RemoveIntegration(
@@ -200,6 +302,9 @@ func (a *app) RemoveIntegration(
 			}
 		}
 		err = a.store.RemoveIntegration(ctx, integrationID)
+		if err == nil {
+			a.evictWebhookClient(integrationID)
+		}
 	}
 	if errors.Is(err, store.ErrObjectNotFound) {
 		return ErrIntegrationNotFound
@@ -228,18 +333,104 @@ func (a *app) GetDeviceIntegrations(
 }
 
 func (a *app) SetDeviceStatus(ctx context.Context, deviceID string, status model.Status) error {
-	go func() {
-		ctxWithTimeout, cancel := context.WithTimeout(context.Background(), a.webhooksTimeout)
-		ctxWithTimeout = identity.WithContext(ctxWithTimeout, identity.FromContext(ctx))
-		defer cancel()
-		runAndLogError(ctxWithTimeout, func() error {
-			return a.setDeviceStatus(ctxWithTimeout, deviceID, status)
-		})
-	}()
-	return nil
+	batch, err := a.batchStatusTasks(ctx)
+	if err != nil {
+		return err
+	}
+	seq, err := a.reserveEventSequence(ctx, 1)
+	if err != nil {
+		return err
+	}
+	return a.runAsync(ctx, a.deviceStatusTask(deviceID, status, seq, batch))
 }
 
-func (a *app) setDeviceStatus(ctx context.Context, deviceID string, status model.Status) error {
+// BulkSetDeviceStatus sets the status of the devices in the background. The
+// status changes are queued all at once: none is queued if the queue
+// cannot hold them all.
+func (a *app) BulkSetDeviceStatus(
+	ctx context.Context,
+	deviceIDs []string,
+	status model.Status,
+) error {
+	batch, err := a.batchStatusTasks(ctx)
+	if err != nil {
+		return err
+	}
+	seq, err := a.reserveEventSequence(ctx, len(deviceIDs))
+	if err != nil {
+		return err
+	}
+	tasks := make([]asyncTask, len(deviceIDs))
+	for i, deviceID := range deviceIDs {
+		tasks[i] = a.deviceStatusTask(deviceID, status, seq+int64(i), batch)
+	}
+	return a.runAsync(ctx, tasks...)
+}
+
+// batchStatusTasks returns whether the status changes of the tenant should
+// be processed in batches. Only the IoT Hub integrations update the devices
+// in bulk: the status changes of the other tenants run one device at a time
+// so that they spread over the workers.
+func (a *app) batchStatusTasks(ctx context.Context) (bool, error) {
+	if a.tasks == nil || a.tasks.batchSize <= 1 {
+		return false, nil
+	}
+	integrations, err := a.store.GetIntegrations(ctx, model.IntegrationFilter{
+		Provider: model.ProviderIoTHub,
+		Limit:    1,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrObjectNotFound) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "app: failed to retrieve integrations")
+	}
+	return len(integrations) > 0, nil
+}
+
+func (a *app) deviceStatusTask(
+	deviceID string,
+	status model.Status,
+	seq int64,
+	batch bool,
+) asyncTask {
+	task := asyncTask{
+		name:       "app.SetDeviceStatus",
+		metric:     metrics.TaskSetDeviceStatus,
+		deviceID:   deviceID,
+		seq:        seq,
+		supersedes: true,
+		run: func(ctx context.Context) error {
+			return a.setDeviceStatus(ctx, deviceID, seq, status)
+		},
+	}
+	if batch {
+		task.batch = "status/" + string(status)
+		task.runBatch = func(ctx context.Context, events []deviceEvent) error {
+			return a.setDevicesStatus(ctx, events, status)
+		}
+	}
+	return task
+}
+
+func (a *app) setDeviceStatus(
+	ctx context.Context,
+	deviceID string,
+	seq int64,
+	status model.Status,
+) error {
+	return a.setDevicesStatus(ctx, []deviceEvent{{deviceID: deviceID, seq: seq}}, status)
+}
+
+// setDevicesStatus sets the status of the devices in the integrations and
+// records an event for every device. The devices of the IoT Hub
+// integrations are updated in bulk. Every call gets its own timeout, so
+// that the batches are not bounded by the number of their devices.
+func (a *app) setDevicesStatus(
+	ctx context.Context,
+	events []deviceEvent,
+	status model.Status,
+) error {
 	integrations, err := a.store.GetIntegrations(ctx, model.IntegrationFilter{})
 	if err != nil {
 		if errors.Is(err, store.ErrObjectNotFound) {
@@ -247,6 +438,64 @@ func (a *app) setDeviceStatus(ctx context.Context, deviceID string, status model
 		}
 		return errors.Wrap(err, "failed to retrieve integrations")
 	}
+	devices := make([]*device, len(events))
+	for i, event := range events {
+		devices[i] = newDevice(event.deviceID, a.store)
+	}
+	// hubResults holds the outcome of the IoT Hub updates by integration
+	// and device; the devices not in the integration are left out.
+	hubResults := make(map[uuid.UUID]map[string]error)
+	for _, integration := range integrations {
+		if integration.Provider != model.ProviderIoTHub {
+			continue
+		}
+		results := make(map[string]error, len(devices))
+		hubDeviceIDs := make([]string, 0, len(devices))
+		for _, device := range devices {
+			callCtx, cancel := a.callContext(ctx)
+			ok, err := device.HasIntegration(callCtx, integration.ID)
+			cancel()
+			if err != nil {
+				results[device.DeviceID] = err
+			} else if ok {
+				hubDeviceIDs = append(hubDeviceIDs, device.DeviceID)
+			}
+		}
+		for deviceID, err := range a.setDevicesStatusIoTHub(
+			ctx, hubDeviceIDs, status, integration,
+		) {
+			results[deviceID] = err
+		}
+		hubResults[integration.ID] = results
+	}
+	var errs []error
+	for i, device := range devices {
+		callCtx, cancel := a.callContext(ctx)
+		err := a.recordDeviceStatus(callCtx,
+			device, events[i].seq, status, integrations, hubResults)
+		cancel()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Wrapf(errs[0], "failed to record %d of %d device events",
+			len(errs), len(devices))
+	}
+	return nil
+}
+
+// recordDeviceStatus sets the status of the device in the integrations
+// other than IoT Hub and records the event with the delivery statuses.
+func (a *app) recordDeviceStatus(
+	ctx context.Context,
+	device *device,
+	seq int64,
+	status model.Status,
+	integrations []model.Integration,
+	hubResults map[uuid.UUID]map[string]error,
+) error {
+	deviceID := device.DeviceID
 	event := model.Event{
 		WebhookEvent: model.WebhookEvent{
 			ID:   uuid.New(),
@@ -255,14 +504,16 @@ func (a *app) setDeviceStatus(ctx context.Context, deviceID string, status model
 				ID:     deviceID,
 				Status: status,
 			},
-			EventTS: time.Now(),
+			EventTS:  time.Now(),
+			Sequence: seq,
 		},
 		DeliveryStatus: make([]model.DeliveryStatus, 0, len(integrations)),
 	}
 
 	var (
-		ok     bool
-		device = newDevice(deviceID, a.store)
+		err      error
+		ok       bool
+		webhooks []model.Integration
 	)
 	for _, integration := range integrations {
 		deliver := model.DeliveryStatus{
@@ -271,13 +522,10 @@ func (a *app) setDeviceStatus(ctx context.Context, deviceID string, status model
 		}
 		switch integration.Provider {
 		case model.ProviderIoTHub:
-			ok, err = device.HasIntegration(ctx, integration.ID)
-			if err != nil {
-				break // switch
-			} else if !ok {
+			err, ok = hubResults[integration.ID][deviceID]
+			if !ok {
 				continue // loop
 			}
-			err = a.setDeviceStatusIoTHub(ctx, deviceID, status, integration)
 
 		case model.ProviderIoTCore:
 			ok, err = device.HasIntegration(ctx, integration.ID)
@@ -289,25 +537,13 @@ func (a *app) setDeviceStatus(ctx context.Context, deviceID string, status model
 			err = a.setDeviceStatusIoTCore(ctx, deviceID, status, integration)
 
 		case model.ProviderWebhook:
-			var (
-				req *http.Request
-				rsp *http.Response
-			)
-			req, err = client.NewWebhookRequest(ctx,
-				&integration.Credentials,
-				event.WebhookEvent)
-			if err != nil {
-				break // switch
-			}
-			rsp, err = a.httpClient.Do(req)
-			if err != nil {
-				break // switch
-			}
-			deliver.StatusCode = &rsp.StatusCode
-			if rsp.StatusCode >= 300 {
-				err = client.NewHTTPError(rsp.StatusCode)
+			if !integration.SubscribedTo(event.Type) {
+				continue
 			}
-			_ = rsp.Body.Close()
+			webhooks = append(webhooks, integration)
+			event.DeliveryStatus = append(event.DeliveryStatus,
+				pendingDelivery(integration.ID))
+			continue
 
 		default:
 			continue
@@ -323,8 +559,7 @@ func (a *app) setDeviceStatus(ctx context.Context, deviceID string, status model
 		}
 		event.DeliveryStatus = append(event.DeliveryStatus, deliver)
 	}
-	err = a.store.SaveEvent(ctx, event)
-	return err
+	return a.saveEvent(ctx, event, webhooks)
 }
 
 func (a *app) DeleteTenant(
@@ -337,20 +572,25 @@ func (a *app) ProvisionDevice(
 	ctx context.Context,
 	device model.DeviceEvent,
 ) error {
-	go func() {
-		ctxWithTimeout, cancel := context.WithTimeout(context.Background(), a.webhooksTimeout)
-		ctxWithTimeout = identity.WithContext(ctxWithTimeout, identity.FromContext(ctx))
-		defer cancel()
-		runAndLogError(ctxWithTimeout, func() error {
-			return a.provisionDevice(ctxWithTimeout, device)
-		})
-	}()
-	return nil
+	seq, err := a.reserveEventSequence(ctx, 1)
+	if err != nil {
+		return err
+	}
+	return a.runAsync(ctx, asyncTask{
+		name:     "app.ProvisionDevice",
+		metric:   metrics.TaskProvisionDevice,
+		deviceID: device.ID,
+		seq:      seq,
+		run: func(ctx context.Context) error {
+			return a.provisionDevice(ctx, device, seq)
+		},
+	})
 }
 
 func (a *app) provisionDevice(
 	ctx context.Context,
 	device model.DeviceEvent,
+	seq int64,
 ) error {
 	integrations, err := a.GetIntegrations(ctx)
 	if err != nil {
@@ -361,19 +601,27 @@ func (a *app) provisionDevice(
 	}
 	event := model.Event{
 		WebhookEvent: model.WebhookEvent{
-			ID:      uuid.New(),
-			Type:    model.EventTypeDeviceProvisioned,
-			Data:    device,
-			EventTS: time.Now(),
+			ID:       uuid.New(),
+			Type:     model.EventTypeDeviceProvisioned,
+			Data:     device,
+			EventTS:  time.Now(),
+			Sequence: seq,
 		},
 		DeliveryStatus: make([]model.DeliveryStatus, 0, len(integrations)),
 	}
 	integrationIDs := make([]uuid.UUID, 0, len(integrations))
+	identityData := device.IdentityData()
+	var webhooks []model.Integration
 	for _, integration := range integrations {
 		deliver := model.DeliveryStatus{
 			IntegrationID: integration.ID,
 			Success:       true,
 		}
+		if !integration.Selector.Match(identityData) {
+			deliver.Skipped = true
+			event.DeliveryStatus = append(event.DeliveryStatus, deliver)
+			continue
+		}
 		switch integration.Provider {
 		case model.ProviderIoTHub:
 			err = a.provisionIoTHubDevice(ctx, device.ID, integration)
@@ -384,25 +632,13 @@ func (a *app) provisionDevice(
 			})
 			integrationIDs = append(integrationIDs, integration.ID)
 		case model.ProviderWebhook:
-			var (
-				req *http.Request
-				rsp *http.Response
-			)
-			req, err = client.NewWebhookRequest(ctx,
-				&integration.Credentials,
-				event.WebhookEvent)
-			if err != nil {
-				break // switch
-			}
-			rsp, err = a.httpClient.Do(req)
-			if err != nil {
-				break // switch
-			}
-			deliver.StatusCode = &rsp.StatusCode
-			if rsp.StatusCode >= 300 {
-				err = client.NewHTTPError(rsp.StatusCode)
+			if !integration.SubscribedTo(event.Type) {
+				continue
 			}
-			_ = rsp.Body.Close()
+			webhooks = append(webhooks, integration)
+			event.DeliveryStatus = append(event.DeliveryStatus,
+				pendingDelivery(integration.ID))
+			continue
 
 		default:
 			continue
@@ -423,6 +659,9 @@ func (a *app) provisionDevice(
 		var statusCodeInternal = 1500
 		for i := range event.DeliveryStatus {
 			stat := &event.DeliveryStatus[i]
+			if stat.Pending {
+				continue
+			}
 			if stat.Error == "" {
 				stat.Error = "failed to connect device to integration"
 				stat.StatusCode = &statusCodeInternal
@@ -434,14 +673,14 @@ func (a *app) provisionDevice(
 			WithField("panic", err.Error()).
 			Error("failed to connect device integration")
 	}
-	err = a.store.SaveEvent(ctx, event)
-	return err
+	return a.saveEvent(ctx, event, webhooks)
 }
 
 func (a *app) syncBatch(
 	ctx context.Context,
 	devices []model.Device,
 	integCache map[uuid.UUID]*model.Integration,
+	exports map[uuid.UUID]map[string]iothub.Status,
 	failEarly bool,
 ) error {
 	var err error
@@ -490,7 +729,20 @@ func (a *app) syncBatch(
 
 		switch integration.Provider {
 		case model.ProviderIoTHub:
-			err := a.syncIoTHubDevices(ctx, deviceIDs, *integration, failEarly)
+			exported, ok := exports[integID]
+			if !ok && integration.Credentials.ExportContainerURL != nil {
+				// Export the IoT Hub devices once per tenant, the
+				// following batches are compared to the same export.
+				exported, err = a.exportIoTHubDevices(ctx, *integration)
+				if err != nil {
+					if failEarly {
+						return err
+					}
+					l.Errorf("%s: querying the devices instead", err)
+				}
+				exports[integID] = exported
+			}
+			err := a.syncIoTHubDevices(ctx, deviceIDs, *integration, exported, failEarly)
 			if err != nil {
 				if failEarly {
 					return err
@@ -512,21 +764,25 @@ func (a *app) syncBatch(
 	return nil
 }
 
-func (a app) syncCacheIntegrations(ctx context.Context) (map[uuid.UUID]*model.Integration, error) {
-	// NOTE At the time of writing this, we don't allow more than one
-	//      integration per tenant so this const doesn't matter.
-	// TODO Will we need a more sophisticated cache data structure?
-	const MaxIntegrationsToCache = 20
-	// Cache integrations for the given tenant
-	integrations, err := a.store.GetIntegrations(
-		ctx, model.IntegrationFilter{Limit: MaxIntegrationsToCache},
-	)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get integrations for tenant")
-	}
-	integCache := make(map[uuid.UUID]*model.Integration, len(integrations))
-	for i := range integrations {
-		integCache[integrations[i].ID] = &integrations[i]
+func (a *app) syncCacheIntegrations(ctx context.Context) (map[uuid.UUID]*model.Integration, error) {
+	// Page size for fetching the tenant's integrations. All integrations
+	// are cached, the number of integrations per tenant stays small
+	// compared to the number of devices.
+	const integrationsPageSize = 20
+	integCache := make(map[uuid.UUID]*model.Integration)
+	fltr := model.IntegrationFilter{Limit: integrationsPageSize}
+	for {
+		integrations, err := a.store.GetIntegrations(ctx, fltr)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get integrations for tenant")
+		}
+		for i := range integrations {
+			integCache[integrations[i].ID] = &integrations[i]
+		}
+		if int64(len(integrations)) < fltr.Limit {
+			break
+		}
+		fltr.Skip += fltr.Limit
 	}
 	return integCache, nil
 }
@@ -540,6 +796,7 @@ func (a *app) SyncDevices(
 		model.Device `bson:",inline"`
 		TenantID     string `bson:"tenant_id"`
 	}
+	metrics.SyncDevicesRun()
 	iter, err := a.store.GetAllDevices(ctx)
 	if err != nil {
 		return err
@@ -550,6 +807,7 @@ func (a *app) SyncDevices(
 		deviceBatch        = make([]model.Device, 0, batchSize)
 		tenantID    string = ""
 		integCache  map[uuid.UUID]*model.Integration
+		exports     = make(map[uuid.UUID]map[string]iothub.Status)
 	)
 	tCtx := identity.WithContext(ctx, &identity.Identity{
 		Tenant: tenantID,
@@ -566,7 +824,7 @@ func (a *app) SyncDevices(
 		}
 		if len(deviceBatch) == cap(deviceBatch) ||
 			(tenantID != dev.TenantID && len(deviceBatch) > 0) {
-			err := a.syncBatch(tCtx, deviceBatch, integCache, failEarly)
+			err := a.syncBatch(tCtx, deviceBatch, integCache, exports, failEarly)
 			if err != nil {
 				return err
 			}
@@ -582,12 +840,12 @@ func (a *app) SyncDevices(
 			if err != nil {
 				return err
 			}
-
+			exports = make(map[uuid.UUID]map[string]iothub.Status)
 		}
 		deviceBatch = append(deviceBatch, dev.Device)
 	}
 	if len(deviceBatch) > 0 {
-		err := a.syncBatch(tCtx, deviceBatch, integCache, failEarly)
+		err := a.syncBatch(tCtx, deviceBatch, integCache, exports, failEarly)
 		if err != nil {
 			return err
 		}
@@ -596,24 +854,29 @@ func (a *app) SyncDevices(
 }
 
 func (a *app) DecommissionDevice(ctx context.Context, deviceID string) error {
-	go func() {
-		ctxWithTimeout, cancel := context.WithTimeout(context.Background(), a.webhooksTimeout)
-		ctxWithTimeout = identity.WithContext(ctxWithTimeout, identity.FromContext(ctx))
-		defer cancel()
-		runAndLogError(ctxWithTimeout, func() error {
-			return a.decommissionDevice(ctxWithTimeout, deviceID)
-		})
-	}()
-	return nil
+	seq, err := a.reserveEventSequence(ctx, 1)
+	if err != nil {
+		return err
+	}
+	return a.runAsync(ctx, asyncTask{
+		name:     "app.DecommissionDevice",
+		metric:   metrics.TaskDecommissionDevice,
+		deviceID: deviceID,
+		seq:      seq,
+		run: func(ctx context.Context) error {
+			return a.decommissionDevice(ctx, deviceID, seq)
+		},
+	})
 }
 
-func (a *app) decommissionDevice(ctx context.Context, deviceID string) error {
+func (a *app) decommissionDevice(ctx context.Context, deviceID string, seq int64) error {
 	integrations, err := a.GetIntegrations(ctx)
 	if err != nil {
 		return err
 	}
 	var (
-		device = newDevice(deviceID, a.store)
+		device   = newDevice(deviceID, a.store)
+		webhooks []model.Integration
 	)
 	event := model.Event{
 		WebhookEvent: model.WebhookEvent{
@@ -622,7 +885,8 @@ func (a *app) decommissionDevice(ctx context.Context, deviceID string) error {
 			Data: model.DeviceEvent{
 				ID: deviceID,
 			},
-			EventTS: time.Now(),
+			EventTS:  time.Now(),
+			Sequence: seq,
 		},
 		DeliveryStatus: make([]model.DeliveryStatus, 0, len(integrations)),
 	}
@@ -653,25 +917,13 @@ func (a *app) decommissionDevice(ctx context.Context, deviceID string) error {
 			}
 			err = a.decommissionIoTCoreDevice(ctx, deviceID, integration)
 		case model.ProviderWebhook:
-			var (
-				req *http.Request
-				rsp *http.Response
-			)
-			req, err = client.NewWebhookRequest(ctx,
-				&integration.Credentials,
-				event.WebhookEvent)
-			if err != nil {
-				break // switch
-			}
-			rsp, err = a.httpClient.Do(req)
-			if err != nil {
-				break // switch
-			}
-			deliver.StatusCode = &rsp.StatusCode
-			if rsp.StatusCode >= 300 {
-				err = client.NewHTTPError(rsp.StatusCode)
+			if !integration.SubscribedTo(event.Type) {
+				continue
 			}
-			_ = rsp.Body.Close()
+			webhooks = append(webhooks, integration)
+			event.DeliveryStatus = append(event.DeliveryStatus,
+				pendingDelivery(integration.ID))
+			continue
 
 		default:
 			continue
@@ -697,8 +949,7 @@ func (a *app) decommissionDevice(ctx context.Context, deviceID string) error {
 			WithField("panic", err.Error()).
 			Errorf("failed to remove device from database: %s", err.Error())
 	}
-	err = a.store.SaveEvent(ctx, event)
-	return err
+	return a.saveEvent(ctx, event, webhooks)
 }
 
 func (a *app) GetDevice(ctx context.Context, deviceID string) (*model.Device, error) {
@@ -709,6 +960,149 @@ func (a *app) GetDevice(ctx context.Context, deviceID string) (*model.Device, er
 	return device, err
 }
 
+func (a *app) GetDevices(
+	ctx context.Context,
+	fltr model.DeviceFilter,
+) ([]model.Device, error) {
+	return a.store.GetDevices(ctx, fltr)
+}
+
+// UnregisterDevice removes the device and its integrations from the
+// database. If cleanup is set, the device is also removed from the IoT Hub
+// and IoT Core integrations first.
+func (a *app) UnregisterDevice(ctx context.Context, deviceID string, cleanup bool) error {
+	device, err := a.store.GetDevice(ctx, deviceID)
+	if err == store.ErrObjectNotFound {
+		return ErrDeviceNotFound
+	} else if err != nil {
+		return errors.Wrap(err, "failed to retrieve the device")
+	}
+	if cleanup {
+		for _, integrationID := range device.IntegrationIDs {
+			integration, err := a.store.GetIntegrationById(ctx, integrationID)
+			if err == store.ErrObjectNotFound {
+				continue
+			} else if err != nil {
+				return errors.Wrap(err, "failed to retrieve the integration")
+			}
+			switch integration.Provider {
+			case model.ProviderIoTHub:
+				err = a.decommissionIoTHubDevice(ctx, deviceID, *integration)
+			case model.ProviderIoTCore:
+				err = a.decommissionIoTCoreDevice(ctx, deviceID, *integration)
+			}
+			if err != nil {
+				return errors.Wrapf(err,
+					"failed to remove the device from integration %s",
+					integrationID)
+			}
+		}
+	}
+	err = a.store.DeleteDevice(ctx, deviceID)
+	if err == store.ErrObjectNotFound {
+		return ErrDeviceNotFound
+	}
+	return err
+}
+
+// AttachDeviceIntegration provisions the device in the IoT Hub or IoT Core
+// integration with its current authentication status and connects it to
+// the integration.
+func (a *app) AttachDeviceIntegration(
+	ctx context.Context,
+	deviceID string,
+	integrationID uuid.UUID,
+) error {
+	integration, err := a.store.GetIntegrationById(ctx, integrationID)
+	if err == store.ErrObjectNotFound {
+		return ErrIntegrationNotFound
+	} else if err != nil {
+		return errors.Wrap(err, "failed to retrieve the integration")
+	}
+	switch integration.Provider {
+	case model.ProviderIoTHub, model.ProviderIoTCore:
+	default:
+		return ErrUnknownIntegration
+	}
+
+	auths, err := a.devauth.GetDevices(ctx, []string{deviceID})
+	if err != nil {
+		return errors.Wrap(err, "failed to lookup device authentication")
+	} else if len(auths) == 0 {
+		return ErrDeviceNotFound
+	} else if !integration.Selector.Match(auths[0].IdentityData) {
+		return ErrDeviceNotSelected
+	}
+	status := auths[0].Status
+
+	if integration.Provider == model.ProviderIoTHub {
+		err = a.provisionIoTHubDevice(ctx, deviceID, *integration, &iothub.Device{
+			DeviceID: deviceID,
+			Status:   iothub.NewStatusFromMenderStatus(status),
+		})
+	} else {
+		err = a.provisionIoTCoreDevice(ctx, deviceID, *integration, &iotcore.Device{
+			Status: iotcore.NewStatusFromMenderStatus(status),
+		})
+	}
+	if err != nil {
+		return err
+	}
+	_, err = a.store.UpsertDeviceIntegrations(ctx, deviceID, []uuid.UUID{integrationID})
+	return errors.Wrap(err, "failed to connect the device to the integration")
+}
+
+// DetachDeviceIntegration decommissions the device from the IoT Hub or
+// IoT Core integration and disconnects it from the integration.
+func (a *app) DetachDeviceIntegration(
+	ctx context.Context,
+	deviceID string,
+	integrationID uuid.UUID,
+) error {
+	_, err := a.store.GetDeviceByIntegrationID(ctx, deviceID, integrationID)
+	if err == store.ErrObjectNotFound {
+		return ErrDeviceNotFound
+	} else if err != nil {
+		return errors.Wrap(err, "failed to retrieve the device")
+	}
+	integration, err := a.store.GetIntegrationById(ctx, integrationID)
+	switch err {
+	case nil:
+		err = a.detachDevice(ctx, deviceID, *integration)
+	case store.ErrObjectNotFound:
+		// The integration is gone: only the reference needs cleaning up.
+		err = a.store.RemoveDeviceIntegration(ctx, deviceID, integrationID)
+		err = errors.Wrap(err, "failed to disconnect the device from the integration")
+	default:
+		return errors.Wrap(err, "failed to retrieve the integration")
+	}
+	if errors.Is(err, store.ErrObjectNotFound) {
+		return ErrDeviceNotFound
+	}
+	return err
+}
+
+// detachDevice decommissions the device from the IoT Hub or IoT Core
+// integration and disconnects it from the integration.
+func (a *app) detachDevice(
+	ctx context.Context,
+	deviceID string,
+	integration model.Integration,
+) error {
+	var err error
+	switch integration.Provider {
+	case model.ProviderIoTHub:
+		err = a.decommissionIoTHubDevice(ctx, deviceID, integration)
+	case model.ProviderIoTCore:
+		err = a.decommissionIoTCoreDevice(ctx, deviceID, integration)
+	}
+	if err != nil {
+		return err
+	}
+	err = a.store.RemoveDeviceIntegration(ctx, deviceID, integration.ID)
+	return errors.Wrap(err, "failed to disconnect the device from the integration")
+}
+
 func (a *app) GetDeviceStateIntegration(
 	ctx context.Context,
 	deviceID string,
@@ -769,6 +1163,19 @@ func (a *app) GetEvents(ctx context.Context, filter model.EventsFilter) ([]model
 	return a.store.GetEvents(ctx, filter)
 }
 
+// GetIntegrationHealth summarizes the deliveries of the last week to the
+// integration.
+func (a *app) GetIntegrationHealth(
+	ctx context.Context,
+	integrationID uuid.UUID,
+) (*model.IntegrationHealth, error) {
+	_, err := a.GetIntegrationById(ctx, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	return a.store.GetIntegrationHealth(ctx, integrationID, time.Now())
+}
+
 func runAndLogError(ctx context.Context, f func() error) {
 	var err error
 	logger := log.FromContext(ctx)
@@ -21,6 +21,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/mendersoftware/iot-manager/client/iotcore"
+	"github.com/mendersoftware/iot-manager/metrics"
 	"github.com/mendersoftware/iot-manager/model"
 )
 
@@ -116,6 +117,13 @@ func (a *app) syncIoTCoreDevices(
 	if err != nil {
 		return errors.Wrap(err, "app: failed to lookup device authentication")
 	}
+	deviceIDs, devAuths, err = a.selectDevices(
+		ctx, integration, deviceIDs, devAuths, failEarly,
+	)
+	if err != nil {
+		return err
+	}
+	metrics.AddSyncDevices(metrics.SyncDevicesChecked, len(deviceIDs))
 
 	statuses := make(map[string]model.Status, len(deviceIDs))
 	for _, auth := range devAuths {
@@ -131,8 +139,13 @@ func (a *app) syncIoTCoreDevices(
 		id := deviceIDs[i]
 		if _, ok := statuses[id]; !ok {
 			l.Warnf("Device '%s' does not have an auth set: deleting device", id)
-			err := a.decommissionDevice(ctx, id)
-			if err != nil && !errors.Is(err, ErrDeviceNotFound) {
+			seq, err := a.reserveEventSequence(ctx, 1)
+			if err == nil {
+				err = a.decommissionDevice(ctx, id, seq)
+			}
+			if err == nil {
+				metrics.AddSyncDevices(metrics.SyncDevicesDeleted, 1)
+			} else if !errors.Is(err, ErrDeviceNotFound) {
 				err = errors.Wrap(err, "app: failed to decommission device")
 				if failEarly {
 					return err
@@ -169,6 +182,8 @@ func (a *app) syncIoTCoreDevices(
 						return err
 					}
 					l.Warn(err)
+				} else {
+					metrics.AddSyncDevices(metrics.SyncDevicesProvisioned, 1)
 				}
 			}
 		} else if err != nil {
@@ -187,6 +202,8 @@ func (a *app) syncIoTCoreDevices(
 					return err
 				}
 				l.Warn(err)
+			} else {
+				metrics.AddSyncDevices(metrics.SyncDevicesStatusFixed, 1)
 			}
 		}
 	}
@@ -1105,6 +1105,9 @@ func TestSyncIoTCoreDevices(t *testing.T) {
 			ctx := log.WithContext(context.Background(), noLogger)
 
 			ds := new(storeMocks.DataStore)
+			ds.On("ReserveEventSequence", contextMatcher, 1).
+				Return(int64(1), nil).
+				Maybe()
 			da := new(mdevauth.Client)
 			wf := new(wfMocks.Client)
 			core := new(coreMocks.Client)
@@ -20,7 +20,10 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -29,12 +32,19 @@ import (
 	"github.com/mendersoftware/iot-manager/client"
 	"github.com/mendersoftware/iot-manager/client/iothub"
 	"github.com/mendersoftware/iot-manager/crypto"
+	"github.com/mendersoftware/iot-manager/metrics"
 	"github.com/mendersoftware/iot-manager/model"
 )
 
 const (
 	iotHubMetadata = "$metadata"
 	iotHubVersion  = "$version"
+
+	defaultExportPollInterval = 5 * time.Second
+
+	// maxConcurrentDeviceFetches is the maximum number of IoT Hub device
+	// identities fetched concurrently.
+	maxConcurrentDeviceFetches = 10
 )
 
 func removeIoTHubMetadata(values map[string]interface{}) map[string]interface{} {
@@ -113,6 +123,149 @@ func (a *app) setDeviceStatusIoTHub(ctx context.Context, deviceID string, status
 	return err
 }
 
+// setDevicesStatusIoTHub sets the status of the devices in the IoT Hub and
+// returns the outcome for every device. The devices with a different
+// status are updated with a single bulk request.
+func (a *app) setDevicesStatusIoTHub(
+	ctx context.Context,
+	deviceIDs []string,
+	status model.Status,
+	integration model.Integration,
+) map[string]error {
+	results := make(map[string]error, len(deviceIDs))
+	cs := integration.Credentials.ConnectionString
+	if cs == nil {
+		for _, deviceID := range deviceIDs {
+			results[deviceID] = ErrNoCredentials
+		}
+		return results
+	}
+	if len(deviceIDs) == 1 {
+		deviceID := deviceIDs[0]
+		callCtx, cancel := a.callContext(ctx)
+		defer cancel()
+		results[deviceID] = a.setDeviceStatusIoTHub(callCtx, deviceID, status, integration)
+		return results
+	} else if len(deviceIDs) == 0 {
+		return results
+	}
+	callCtx, cancel := a.callContext(ctx)
+	twins, err := a.iothubClient.GetDeviceTwins(callCtx, cs, deviceIDs)
+	cancel()
+	if err != nil {
+		err = errors.Wrap(err, "failed to retrieve devices from IoT Hub")
+		for _, deviceID := range deviceIDs {
+			results[deviceID] = err
+		}
+		return results
+	}
+	errNotFound := errors.Wrap(
+		client.NewHTTPError(http.StatusNotFound),
+		"failed to retrieve device from IoT Hub",
+	)
+	for _, deviceID := range deviceIDs {
+		results[deviceID] = errNotFound
+	}
+	azureStatus := iothub.NewStatusFromMenderStatus(status)
+	statuses := make(map[string]iothub.Status, len(twins))
+	for _, twin := range twins {
+		if _, ok := results[twin.DeviceID]; !ok {
+			continue
+		} else if twin.Status == azureStatus {
+			results[twin.DeviceID] = nil
+		} else {
+			statuses[twin.DeviceID] = azureStatus
+		}
+	}
+	for deviceID, err := range a.updateIoTHubDevicesStatus(ctx, cs, statuses) {
+		results[deviceID] = err
+	}
+	return results
+}
+
+// updateIoTHubDevicesStatus sets the status of the IoT Hub devices using
+// bulk requests and returns the outcome for every device. The bulk
+// requests overwrite the device identities, so the identities must be
+// fetched first to preserve the device keys.
+func (a *app) updateIoTHubDevicesStatus(
+	ctx context.Context,
+	cs *model.ConnectionString,
+	statuses map[string]iothub.Status,
+) map[string]error {
+	results := make(map[string]error, len(statuses))
+	deviceIDs := make([]string, 0, len(statuses))
+	for deviceID := range statuses {
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	sort.Strings(deviceIDs)
+	fetched, errs := a.getIoTHubDevices(ctx, cs, deviceIDs)
+	devices := make([]*iothub.Device, 0, len(deviceIDs))
+	for i, deviceID := range deviceIDs {
+		if errs[i] != nil {
+			results[deviceID] = errors.Wrap(errs[i],
+				"failed to retrieve IoT Hub device identity")
+			continue
+		}
+		fetched[i].Status = statuses[deviceID]
+		devices = append(devices, fetched[i])
+	}
+	for len(devices) > 0 {
+		batch := devices
+		if len(batch) > iothub.MaxBulkDevices {
+			batch = batch[:iothub.MaxBulkDevices]
+		}
+		devices = devices[len(batch):]
+
+		callCtx, cancel := a.callContext(ctx)
+		result, err := a.iothubClient.BulkUpdateDevices(callCtx, cs, batch)
+		cancel()
+		if err != nil {
+			err = errors.Wrap(err, "failed to update IoT Hub device identities")
+		}
+		for _, dev := range batch {
+			results[dev.DeviceID] = err
+		}
+		if result != nil {
+			for _, devErr := range result.Errors {
+				if _, ok := results[devErr.DeviceID]; ok {
+					results[devErr.DeviceID] = devErr
+				}
+			}
+		}
+	}
+	return results
+}
+
+// getIoTHubDevices fetches the identities of the IoT Hub devices, up to
+// maxConcurrentDeviceFetches at a time: the registry has no bulk read of
+// the identities with their keys, so a batch of 100 devices costs about 10
+// round trips instead of 100. The results are in the order of deviceIDs.
+func (a *app) getIoTHubDevices(
+	ctx context.Context,
+	cs *model.ConnectionString,
+	deviceIDs []string,
+) ([]*iothub.Device, []error) {
+	devices := make([]*iothub.Device, len(deviceIDs))
+	errs := make([]error, len(deviceIDs))
+	sem := make(chan struct{}, maxConcurrentDeviceFetches)
+	var wg sync.WaitGroup
+	for i, deviceID := range deviceIDs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, deviceID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			callCtx, cancel := a.callContext(ctx)
+			defer cancel()
+			devices[i], errs[i] = a.iothubClient.GetDevice(callCtx, cs, deviceID)
+		}(i, deviceID)
+	}
+	wg.Wait()
+	return devices, errs
+}
+
 func (a *app) decommissionIoTHubDevice(ctx context.Context, deviceID string,
 	integration model.Integration) error {
 	cs := integration.Credentials.ConnectionString
@@ -130,10 +283,73 @@ func (a *app) decommissionIoTHubDevice(ctx context.Context, deviceID string,
 	return nil
 }
 
+// exportIoTHubDevices exports the devices of the IoT Hub to the storage
+// container of the integration and returns the statuses of the devices.
+// The exported blob is deleted once read.
+func (a *app) exportIoTHubDevices(
+	ctx context.Context,
+	integration model.Integration,
+) (map[string]iothub.Status, error) {
+	cs := integration.Credentials.ConnectionString
+	containerURL := string(*integration.Credentials.ExportContainerURL)
+	// Integrations may share the container: each one has its own blob.
+	blobName := "iot-manager-" + integration.ID.String() + ".txt"
+
+	job, err := a.iothubClient.ExportDevices(ctx, cs, containerURL, blobName)
+	if err != nil {
+		return nil, errors.Wrap(err, "app: failed to export devices from IoT Hub")
+	}
+	ticker := time.NewTicker(a.exportPollInterval)
+	defer ticker.Stop()
+	for !job.Status.Done() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			// Do not leave the job running: the IoT Hub only runs one
+			// export job at a time.
+			cancelCtx, cancel := context.WithTimeout(
+				context.Background(), defaultExportPollInterval,
+			)
+			_ = a.iothubClient.CancelJob(cancelCtx, cs, job.JobID)
+			cancel()
+			return nil, ctx.Err()
+		}
+		job, err = a.iothubClient.GetJob(ctx, cs, job.JobID)
+		if err != nil {
+			return nil, errors.Wrap(err, "app: failed to get IoT Hub export job")
+		}
+	}
+	if job.Status != iothub.JobStatusCompleted {
+		return nil, errors.Errorf("app: IoT Hub export job %s: %s",
+			job.Status, job.FailureReason)
+	}
+	devices, err := a.iothubClient.GetExportedDevices(ctx, containerURL, blobName)
+	// The blob holds the identities of all the IoT Hub devices: do not
+	// leave it in the container once read.
+	if delErr := a.iothubClient.DeleteExportedDevices(
+		ctx, containerURL, blobName,
+	); delErr != nil {
+		log.FromContext(ctx).Warnf("failed to delete the IoT Hub export blob %q: %s",
+			blobName, delErr.Error())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "app: failed to read devices exported from IoT Hub")
+	}
+	statuses := make(map[string]iothub.Status, len(devices))
+	for _, dev := range devices {
+		statuses[dev.DeviceID] = dev.Status
+	}
+	return statuses, nil
+}
+
+// syncIoTHubDevices brings the IoT Hub devices in sync with the Mender
+// devices. The statuses of the IoT Hub devices are looked up in the
+// exported devices if not nil, instead of querying the IoT Hub.
 func (a *app) syncIoTHubDevices(
 	ctx context.Context,
 	deviceIDs []string,
 	integration model.Integration,
+	exported map[string]iothub.Status,
 	failEarly bool,
 ) error {
 	l := log.FromContext(ctx)
@@ -144,6 +360,13 @@ func (a *app) syncIoTHubDevices(
 	if err != nil {
 		return errors.Wrap(err, "app: failed to lookup device authentication")
 	}
+	deviceIDs, devAuths, err = a.selectDevices(
+		ctx, integration, deviceIDs, devAuths, failEarly,
+	)
+	if err != nil {
+		return err
+	}
+	metrics.AddSyncDevices(metrics.SyncDevicesChecked, len(deviceIDs))
 
 	statuses := make(map[string]iothub.Status, len(deviceIDs))
 	for _, auth := range devAuths {
@@ -158,8 +381,13 @@ func (a *app) syncIoTHubDevices(
 		id := deviceIDs[i]
 		if _, ok := statuses[id]; !ok {
 			l.Warnf("Device '%s' does not have an auth set: deleting device", id)
-			err := a.decommissionDevice(ctx, id)
-			if err != nil && err != ErrDeviceNotFound {
+			seq, err := a.reserveEventSequence(ctx, 1)
+			if err == nil {
+				err = a.decommissionDevice(ctx, id, seq)
+			}
+			if err == nil {
+				metrics.AddSyncDevices(metrics.SyncDevicesDeleted, 1)
+			} else if err != ErrDeviceNotFound {
 				err = errors.Wrap(err, "app: failed to decommission device")
 				if failEarly {
 					return err
@@ -177,7 +405,7 @@ func (a *app) syncIoTHubDevices(
 	}
 
 	// Fetch IoT Hub device twins
-	hubDevs, err := a.iothubClient.GetDeviceTwins(ctx, cs, deviceIDs[:j])
+	hubDevs, err := a.getIoTHubDeviceTwins(ctx, cs, deviceIDs[:j], exported)
 	if err != nil {
 		return errors.Wrap(err, "app: failed to get devices from IoT Hub")
 	}
@@ -186,6 +414,7 @@ func (a *app) syncIoTHubDevices(
 	devicesInHub := make(map[string]struct{}, len(hubDevs))
 
 	// Check if devices (statuses) are in sync
+	updates := make(map[string]iothub.Status)
 	for _, twin := range hubDevs {
 		devicesInHub[twin.DeviceID] = struct{}{}
 		if stat, ok := statuses[twin.DeviceID]; ok {
@@ -194,27 +423,21 @@ func (a *app) syncIoTHubDevices(
 			}
 			l.Warnf("Device '%s' status does not match Mender auth status, updating status",
 				twin.DeviceID)
-			// Update the device's status
-			// NOTE need to fetch device identity first
-			dev, err := a.iothubClient.GetDevice(ctx, cs, twin.DeviceID)
-			if err != nil {
-				err = errors.Wrap(err, "failed to retrieve IoT Hub device identity")
-				if failEarly {
-					return err
-				}
-				l.Error(err)
-				continue
-			}
-			dev.Status = stat
-			_, err = a.iothubClient.UpsertDevice(ctx, cs, twin.DeviceID, dev)
-			if err != nil {
-				err = errors.Wrap(err, "failed to update IoT Hub device identity")
-				if failEarly {
-					return err
-				}
-				l.Error(err)
+			updates[twin.DeviceID] = stat
+		}
+	}
+	// Update the devices' statuses
+	for deviceID, err := range a.updateIoTHubDevicesStatus(ctx, cs, updates) {
+		if err != nil {
+			err = errors.Wrapf(err, "failed to update status of IoT Hub device '%s'",
+				deviceID)
+			if failEarly {
+				return err
 			}
+			l.Error(err)
+			continue
 		}
+		metrics.AddSyncDevices(metrics.SyncDevicesStatusFixed, 1)
 	}
 
 	// Find devices not present in IoT Hub
@@ -234,11 +457,41 @@ func (a *app) syncIoTHubDevices(
 				l.Error(err)
 				continue
 			}
+			metrics.AddSyncDevices(metrics.SyncDevicesProvisioned, 1)
 		}
 	}
 	return nil
 }
 
+// getIoTHubDeviceTwins returns the statuses of the IoT Hub devices from
+// the exported devices, if any, and queries the device twins otherwise.
+func (a *app) getIoTHubDeviceTwins(
+	ctx context.Context,
+	cs *model.ConnectionString,
+	deviceIDs []string,
+	exported map[string]iothub.Status,
+) ([]iothub.DeviceTwin, error) {
+	if exported == nil {
+		return a.iothubClient.GetDeviceTwins(ctx, cs, deviceIDs)
+	}
+	twins := make([]iothub.DeviceTwin, 0, len(deviceIDs))
+	var missing []string
+	for _, id := range deviceIDs {
+		if status, ok := exported[id]; ok {
+			twins = append(twins, iothub.DeviceTwin{DeviceID: id, Status: status})
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	// The devices provisioned after the export are not part of it:
+	// confirm the missing devices before they get provisioned again.
+	missingTwins, err := a.iothubClient.GetDeviceTwins(ctx, cs, missing)
+	if err != nil {
+		return nil, err
+	}
+	return append(twins, missingTwins...), nil
+}
+
 func (a *app) GetDeviceStateIoTHub(
 	ctx context.Context,
 	deviceID string,
@@ -294,17 +547,32 @@ func (app *app) VerifyDeviceTwin(ctx context.Context, req model.PreauthRequest)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve integration: %w", err)
 	}
-	var integration model.Integration
-	for _, integration = range integrations {
-		if integration.Provider == model.ProviderIoTHub {
-			break
-		}
-	}
 	deviceModule := strings.SplitN(req.DeviceID, "/", 2)
 	for i := range deviceModule {
 		deviceModule[i] = url.PathEscape(deviceModule[i])
 	}
 	id := strings.Join(deviceModule, "/modules/")
+	// The device may belong to any of the tenant's IoT Hub integrations:
+	// accept the request if the twin matches in one of them.
+	err = ErrIntegrationNotFound
+	for _, integration := range integrations {
+		if integration.Provider != model.ProviderIoTHub {
+			continue
+		}
+		err = app.verifyDeviceTwin(ctx, integration, id, req)
+		if err == nil {
+			break
+		}
+	}
+	return err
+}
+
+func (app *app) verifyDeviceTwin(
+	ctx context.Context,
+	integration model.Integration,
+	id string,
+	req model.PreauthRequest,
+) error {
 	log.FromContext(ctx).Debugf("getting twin: %s", id)
 	twin, err := app.iothubClient.GetDeviceTwin(
 		ctx, integration.Credentials.ConnectionString, id,
@@ -16,9 +16,13 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mendersoftware/go-lib-micro/log"
@@ -460,6 +464,185 @@ func TestSetDeviceStatusIoTHub(t *testing.T) {
 	}
 }
 
+func TestSetDevicesStatus(t *testing.T) {
+	t.Parallel()
+	hubIntegration := model.Integration{
+		ID:       uuid.New(),
+		Provider: model.ProviderIoTHub,
+		Credentials: model.Credentials{
+			Type:             model.CredentialTypeSAS,
+			ConnectionString: validConnString,
+		},
+	}
+	const (
+		devInSync    = "06b39a09-7cf7-4bd6-b52a-e48a6e0fec2b"
+		devUpdated   = "35ad0a1d-4b0d-4f16-9c46-a7ab0fd5ad3b"
+		devFailed    = "5d7d5bb5-5ab2-4ed2-9fc3-9a4cd6c3d6d6"
+		devMissing   = "9a5ac0a1-8c21-4f8a-9b1b-2f1e2f0a58b8"
+		devNotInHub  = "c0b1bf1c-d7f3-4c9b-a2a2-5b0d6f6c1c8e"
+		devNoRecord  = "f3c0b6a1-2b4e-4b55-8a2e-1c7f5f4b9f0d"
+		errRecordMsg = "device record not found"
+	)
+	deviceIDs := []string{
+		devInSync, devUpdated, devFailed, devMissing, devNotInHub, devNoRecord,
+	}
+	hubDeviceIDs := []string{devInSync, devUpdated, devFailed, devMissing}
+
+	ds := new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	ds.On("GetIntegrations", contextMatcher, model.IntegrationFilter{}).
+		Return([]model.Integration{hubIntegration}, nil).
+		Once()
+	for _, deviceID := range hubDeviceIDs {
+		ds.On("GetDevice", contextMatcher, deviceID).
+			Return(&model.Device{
+				ID:             deviceID,
+				IntegrationIDs: []uuid.UUID{hubIntegration.ID},
+			}, nil).
+			Once()
+	}
+	ds.On("GetDevice", contextMatcher, devNotInHub).
+		Return(&model.Device{ID: devNotInHub}, nil).
+		Once().
+		On("GetDevice", contextMatcher, devNoRecord).
+		Return(nil, errors.New(errRecordMsg)).
+		Once()
+	statuses := make(map[string]model.DeliveryStatus)
+	ds.On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+		Run(func(args mock.Arguments) {
+			event := args.Get(1).(model.Event)
+			deviceID := event.Data.(model.DeviceEvent).ID
+			if len(event.DeliveryStatus) > 0 {
+				statuses[deviceID] = event.DeliveryStatus[0]
+			}
+		}).
+		Return(nil).
+		Times(len(deviceIDs))
+
+	hub := new(hubMocks.Client)
+	defer hub.AssertExpectations(t)
+	cs := validConnString
+	hub.On("GetDeviceTwins", contextMatcher, cs, hubDeviceIDs).
+		Return([]iothub.DeviceTwin{
+			{DeviceID: devInSync, Status: iothub.StatusEnabled},
+			{DeviceID: devUpdated, Status: iothub.StatusDisabled},
+			{DeviceID: devFailed, Status: iothub.StatusDisabled},
+		}, nil).
+		Once()
+	identity := func(deviceID string, status iothub.Status) *iothub.Device {
+		return &iothub.Device{
+			DeviceID: deviceID,
+			ETag:     "etag",
+			Status:   status,
+			Auth: &iothub.Auth{
+				Type: iothub.AuthTypeSymmetric,
+				SymmetricKey: &iothub.SymmetricKey{
+					Primary:   iothub.Key("secret"),
+					Secondary: iothub.Key("key"),
+				},
+			},
+		}
+	}
+	hub.On("GetDevice", contextMatcher, cs, devUpdated).
+		Return(identity(devUpdated, iothub.StatusDisabled), nil).
+		Once().
+		On("GetDevice", contextMatcher, cs, devFailed).
+		Return(identity(devFailed, iothub.StatusDisabled), nil).
+		Once().
+		On("BulkUpdateDevices", contextMatcher, cs, []*iothub.Device{
+			identity(devUpdated, iothub.StatusEnabled),
+			identity(devFailed, iothub.StatusEnabled),
+		}).
+		Return(&iothub.BulkRegistryOperationResult{
+			Errors: []iothub.DeviceRegistryOperationError{{
+				DeviceID:    devFailed,
+				ErrorCode:   "PreconditionFailed",
+				ErrorStatus: "Precondition failed",
+			}},
+		}, nil).
+		Once()
+
+	a := New(ds, nil, nil).WithIoTHub(hub).(*app)
+	events := make([]deviceEvent, len(deviceIDs))
+	for i, deviceID := range deviceIDs {
+		events[i] = deviceEvent{deviceID: deviceID, seq: int64(i + 1)}
+	}
+	err := a.setDevicesStatus(context.Background(), events, model.StatusAccepted)
+	assert.NoError(t, err)
+
+	assert.True(t, statuses[devInSync].Success)
+	assert.True(t, statuses[devUpdated].Success)
+	if assert.False(t, statuses[devFailed].Success) {
+		assert.Contains(t, statuses[devFailed].Error, "PreconditionFailed")
+	}
+	if assert.False(t, statuses[devMissing].Success) &&
+		assert.NotNil(t, statuses[devMissing].StatusCode) {
+		assert.Equal(t, http.StatusNotFound, *statuses[devMissing].StatusCode)
+	}
+	assert.NotContains(t, statuses, devNotInHub)
+	if assert.False(t, statuses[devNoRecord].Success) {
+		assert.Equal(t, errRecordMsg, statuses[devNoRecord].Error)
+	}
+	for _, status := range statuses {
+		assert.Equal(t, hubIntegration.ID, status.IntegrationID)
+	}
+}
+
+func TestGetIoTHubDevices(t *testing.T) {
+	t.Parallel()
+	cs := &model.ConnectionString{
+		HostName: "localhost",
+		Key:      crypto.String("secret"),
+		Name:     "foobar",
+	}
+	deviceIDs := make([]string, 3*maxConcurrentDeviceFetches)
+	for i := range deviceIDs {
+		deviceIDs[i] = fmt.Sprintf("dev%02d", i)
+	}
+	const devFailed = "dev07"
+
+	var (
+		mu                  sync.Mutex
+		running, maxRunning int
+	)
+	hub := new(hubMocks.Client)
+	defer hub.AssertExpectations(t)
+	for _, deviceID := range deviceIDs {
+		call := hub.On("GetDevice", contextMatcher, cs, deviceID).
+			Run(func(mock.Arguments) {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+			}).
+			Once()
+		if deviceID == devFailed {
+			call.Return(nil, errors.New("internal error"))
+		} else {
+			call.Return(&iothub.Device{DeviceID: deviceID}, nil)
+		}
+	}
+
+	a := &app{iothubClient: hub}
+	devices, errs := a.getIoTHubDevices(context.Background(), cs, deviceIDs)
+	for i, deviceID := range deviceIDs {
+		if deviceID == devFailed {
+			assert.EqualError(t, errs[i], "internal error")
+			assert.Nil(t, devices[i])
+		} else if assert.NoError(t, errs[i]) {
+			assert.Equal(t, deviceID, devices[i].DeviceID)
+		}
+	}
+	assert.LessOrEqual(t, maxRunning, maxConcurrentDeviceFetches)
+	assert.Greater(t, maxRunning, 1, "the devices must be fetched concurrently")
+}
+
 func TestRemoveIoTHubMetadata(t *testing.T) {
 	testCases := []struct {
 		Name string
@@ -845,6 +1028,197 @@ func TestSetDeviceStateIoTHub(t *testing.T) {
 	}
 }
 
+func TestExportIoTHubDevices(t *testing.T) {
+	t.Parallel()
+	const containerURL = "https://mender.blob.core.windows.net/devices?sig=secret"
+	containerURLSecret := crypto.String(containerURL)
+	integration := model.Integration{
+		ID:       uuid.New(),
+		Provider: model.ProviderIoTHub,
+		Credentials: model.Credentials{
+			Type:               model.CredentialTypeSAS,
+			ConnectionString:   validConnString,
+			ExportContainerURL: &containerURLSecret,
+		},
+	}
+	cs := integration.Credentials.ConnectionString
+	blobName := "iot-manager-" + integration.ID.String() + ".txt"
+	job := func(status iothub.JobStatus) *iothub.Job {
+		return &iothub.Job{
+			JobID:  "job",
+			Type:   iothub.JobTypeExport,
+			Status: status,
+		}
+	}
+
+	testCases := []struct {
+		Name string
+
+		Cancel bool
+		Hub    func(t *testing.T) *hubMocks.Client
+
+		Statuses map[string]iothub.Status
+		Error    error
+	}{{
+		Name: "ok",
+
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("ExportDevices", contextMatcher, cs, containerURL, blobName).
+				Return(job(iothub.JobStatusEnqueued), nil).
+				Once()
+			hub.On("GetJob", contextMatcher, cs, "job").
+				Return(job(iothub.JobStatusRunning), nil).
+				Once()
+			hub.On("GetJob", contextMatcher, cs, "job").
+				Return(job(iothub.JobStatusCompleted), nil).
+				Once()
+			hub.On("GetExportedDevices", contextMatcher, containerURL, blobName).
+				Return([]iothub.Device{{
+					DeviceID: "dev1",
+					Status:   iothub.StatusEnabled,
+				}, {
+					DeviceID: "dev2",
+					Status:   iothub.StatusDisabled,
+				}}, nil).
+				Once()
+			hub.On("DeleteExportedDevices", contextMatcher, containerURL, blobName).
+				Return(nil).
+				Once()
+			return hub
+		},
+
+		Statuses: map[string]iothub.Status{
+			"dev1": iothub.StatusEnabled,
+			"dev2": iothub.StatusDisabled,
+		},
+	}, {
+		Name: "ok/export blob not deleted",
+
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("ExportDevices", contextMatcher, cs, containerURL, blobName).
+				Return(job(iothub.JobStatusCompleted), nil).
+				Once()
+			hub.On("GetExportedDevices", contextMatcher, containerURL, blobName).
+				Return([]iothub.Device{{
+					DeviceID: "dev1",
+					Status:   iothub.StatusEnabled,
+				}}, nil).
+				Once()
+			hub.On("DeleteExportedDevices", contextMatcher, containerURL, blobName).
+				Return(client.NewHTTPError(http.StatusForbidden)).
+				Once()
+			return hub
+		},
+
+		Statuses: map[string]iothub.Status{
+			"dev1": iothub.StatusEnabled,
+		},
+	}, {
+		Name: "error/export devices",
+
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("ExportDevices", contextMatcher, cs, containerURL, blobName).
+				Return(nil, client.NewHTTPError(http.StatusForbidden)).
+				Once()
+			return hub
+		},
+		Error: errors.New("app: failed to export devices from IoT Hub"),
+	}, {
+		Name: "error/get job",
+
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("ExportDevices", contextMatcher, cs, containerURL, blobName).
+				Return(job(iothub.JobStatusEnqueued), nil).
+				Once()
+			hub.On("GetJob", contextMatcher, cs, "job").
+				Return(nil, client.NewHTTPError(http.StatusInternalServerError)).
+				Once()
+			return hub
+		},
+		Error: errors.New("app: failed to get IoT Hub export job"),
+	}, {
+		Name: "error/job failed",
+
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			failed := job(iothub.JobStatusFailed)
+			failed.FailureReason = "storage account unreachable"
+			hub.On("ExportDevices", contextMatcher, cs, containerURL, blobName).
+				Return(job(iothub.JobStatusEnqueued), nil).
+				Once()
+			hub.On("GetJob", contextMatcher, cs, "job").
+				Return(failed, nil).
+				Once()
+			return hub
+		},
+		Error: errors.New("app: IoT Hub export job failed: storage account unreachable"),
+	}, {
+		Name: "error/read exported devices",
+
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("ExportDevices", contextMatcher, cs, containerURL, blobName).
+				Return(job(iothub.JobStatusCompleted), nil).
+				Once()
+			hub.On("GetExportedDevices", contextMatcher, containerURL, blobName).
+				Return(nil, client.NewHTTPError(http.StatusNotFound)).
+				Once()
+			hub.On("DeleteExportedDevices", contextMatcher, containerURL, blobName).
+				Return(nil).
+				Once()
+			return hub
+		},
+		Error: errors.New("app: failed to read devices exported from IoT Hub"),
+	}, {
+		Name: "error/context canceled",
+
+		Cancel: true,
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("ExportDevices", contextMatcher, cs, containerURL, blobName).
+				Return(job(iothub.JobStatusEnqueued), nil).
+				Once()
+			hub.On("GetJob", contextMatcher, cs, "job").
+				Return(job(iothub.JobStatusRunning), nil).
+				Maybe()
+			hub.On("CancelJob", contextMatcher, cs, "job").
+				Return(nil).
+				Once()
+			return hub
+		},
+		Error: context.Canceled,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.Cancel {
+				cancel()
+			}
+			hub := tc.Hub(t)
+			defer hub.AssertExpectations(t)
+
+			app := New(nil, nil, nil).WithIoTHub(hub).(*app)
+			app.exportPollInterval = time.Millisecond
+			statuses, err := app.exportIoTHubDevices(ctx, integration)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Statuses, statuses)
+			}
+		})
+	}
+}
+
 func TestSyncIoTHubDevices(t *testing.T) {
 	// FIXME(alf) this should be covered by an acceptance test
 	t.Parallel()
@@ -855,6 +1229,7 @@ func TestSyncIoTHubDevices(t *testing.T) {
 
 		DeviceIDs   []string
 		Integration model.Integration
+		Exported    map[string]iothub.Status
 		FailEarly   bool
 
 		DataStore func(t *testing.T, self *testCase) *storeMocks.DataStore
@@ -968,6 +1343,7 @@ func TestSyncIoTHubDevices(t *testing.T) {
 				Once()
 
 			twins := make([]iothub.DeviceTwin, len(self.DeviceIDs)-3)
+			var devUpdates []*iothub.Device
 			for i, id := range self.DeviceIDs[1:8] {
 				twin := iothub.DeviceTwin{
 					DeviceID: id,
@@ -994,15 +1370,18 @@ func TestSyncIoTHubDevices(t *testing.T) {
 						Once()
 					devUpdate := dev
 					devUpdate.Status = iothub.StatusDisabled
-					hub.On("UpsertDevice",
-						contextMatcher,
-						self.Integration.Credentials.ConnectionString,
-						id,
-						&devUpdate).
-						Return(&devUpdate, nil).
-						Once()
+					devUpdates = append(devUpdates, &devUpdate)
 				}
 			}
+			sort.Slice(devUpdates, func(i, j int) bool {
+				return devUpdates[i].DeviceID < devUpdates[j].DeviceID
+			})
+			hub.On("BulkUpdateDevices",
+				contextMatcher,
+				self.Integration.Credentials.ConnectionString,
+				devUpdates).
+				Return(&iothub.BulkRegistryOperationResult{IsSuccessful: true}, nil).
+				Once()
 			hub.On("GetDeviceTwins",
 				contextMatcher,
 				self.Integration.Credentials.ConnectionString,
@@ -1057,7 +1436,7 @@ func TestSyncIoTHubDevices(t *testing.T) {
 		DeviceIDs: []string{
 			"38e5ebfb-963d-4ac2-8f5e-d51b2df1fa6e", // fail decommission
 			"e7f14597-6a9a-44fa-84ea-cda8e221e207", // fail hub.GetDevice
-			"e4297565-ea38-4031-8287-664d52878890", // fail hub.UpsertDevice
+			"e4297565-ea38-4031-8287-664d52878890", // fail hub.BulkUpdateDevices
 			"8de57bea-be8a-45d5-9147-a148cddf4f09", // fail provisionDevice
 		},
 		Integration: model.Integration{
@@ -1138,22 +1517,27 @@ func TestSyncIoTHubDevices(t *testing.T) {
 				Return(&devUpdated, nil).
 				Once()
 
+			hub.On("BulkUpdateDevices",
+				contextMatcher,
+				self.Integration.Credentials.ConnectionString,
+				[]*iothub.Device{&devUpdated}).
+				Return(&iothub.BulkRegistryOperationResult{
+					Errors: []iothub.DeviceRegistryOperationError{{
+						DeviceID:    "e4297565-ea38-4031-8287-664d52878890",
+						ErrorCode:   "PreconditionFailed",
+						ErrorStatus: "Precondition failed",
+					}},
+				}, nil).
+				Once()
 			hub.On("UpsertDevice",
 				contextMatcher,
 				self.Integration.Credentials.ConnectionString,
-				"e4297565-ea38-4031-8287-664d52878890",
-				&devUpdated).
-				Return(nil, errors.New("internal error")).
-				Once().
-				On("UpsertDevice",
-					contextMatcher,
-					self.Integration.Credentials.ConnectionString,
-					"8de57bea-be8a-45d5-9147-a148cddf4f09",
-					&iothub.Device{
-						DeviceID: "8de57bea-be8a-45d5-9147-a148cddf4f09",
-						Status:   iothub.StatusEnabled,
-					},
-				).
+				"8de57bea-be8a-45d5-9147-a148cddf4f09",
+				&iothub.Device{
+					DeviceID: "8de57bea-be8a-45d5-9147-a148cddf4f09",
+					Status:   iothub.StatusEnabled,
+				},
+			).
 				Return(nil, errors.New("internal error"))
 
 			return hub
@@ -1256,6 +1640,77 @@ func TestSyncIoTHubDevices(t *testing.T) {
 		},
 		FailEarly: true,
 		Error:     errors.New("app: failed to get devices from IoT Hub"),
+	}, {
+		Name: "ok/exported devices",
+
+		DeviceIDs: []string{
+			"2ad6b1d1-8a38-4a67-9e43-3ea4e1d1a8c5", // Exported
+			"d4e4c5c8-6c2b-4d0e-a1e3-2b7e4e0e8f5a", // Provisioned after the export
+			"0f7a4c8e-0b1e-4e5c-9a7e-6f3c1b2d4e5f", // Rejected after the export
+		},
+		Integration: model.Integration{
+			ID:       uuid.New(),
+			Provider: model.ProviderIoTHub,
+			Credentials: model.Credentials{
+				Type:             model.CredentialTypeSAS,
+				ConnectionString: validConnString,
+			},
+		},
+		Exported: map[string]iothub.Status{
+			"2ad6b1d1-8a38-4a67-9e43-3ea4e1d1a8c5": iothub.StatusEnabled,
+			"0f7a4c8e-0b1e-4e5c-9a7e-6f3c1b2d4e5f": iothub.StatusEnabled,
+			"1d0c7b6a-5e4f-4a3b-8c2d-1e0f9a8b7c6d": iothub.StatusEnabled,
+		},
+
+		DataStore: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			return new(storeMocks.DataStore)
+		},
+		Devauth: func(t *testing.T, self *testCase) *mdevauth.Client {
+			da := new(mdevauth.Client)
+			da.On("GetDevices", contextMatcher, self.DeviceIDs).
+				Return([]devauth.Device{{
+					ID:     self.DeviceIDs[0],
+					Status: model.StatusAccepted,
+				}, {
+					ID:     self.DeviceIDs[1],
+					Status: model.StatusAccepted,
+				}, {
+					ID:     self.DeviceIDs[2],
+					Status: model.StatusRejected,
+				}}, nil)
+			return da
+		},
+		Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+			cs := self.Integration.Credentials.ConnectionString
+			hub := new(hubMocks.Client)
+			hub.On("GetDeviceTwins", contextMatcher, cs, self.DeviceIDs[1:2]).
+				Return([]iothub.DeviceTwin{{
+					DeviceID: self.DeviceIDs[1],
+					Status:   iothub.StatusEnabled,
+				}}, nil).
+				Once()
+
+			dev := &iothub.Device{
+				DeviceID: self.DeviceIDs[2],
+				Status:   iothub.StatusEnabled,
+				ETag:     "qwerty",
+			}
+			hub.On("GetDevice", contextMatcher, cs, self.DeviceIDs[2]).
+				Return(dev, nil).
+				Once()
+			hub.On("BulkUpdateDevices", contextMatcher, cs,
+				mock.MatchedBy(func(devices []*iothub.Device) bool {
+					return len(devices) == 1 &&
+						devices[0].DeviceID == self.DeviceIDs[2] &&
+						devices[0].Status == iothub.StatusDisabled
+				})).
+				Return(&iothub.BulkRegistryOperationResult{IsSuccessful: true}, nil).
+				Once()
+			return hub
+		},
+		Wf: func(t *testing.T, self *testCase) *wfMocks.Client {
+			return new(wfMocks.Client)
+		},
 	}}
 	for i := range testCases {
 		tc := testCases[i]
@@ -1264,6 +1719,9 @@ func TestSyncIoTHubDevices(t *testing.T) {
 			ctx := log.WithContext(context.Background(), noLogger)
 
 			ds := tc.DataStore(t, &tc)
+			ds.On("ReserveEventSequence", contextMatcher, 1).
+				Return(int64(1), nil).
+				Maybe()
 			da := tc.Devauth(t, &tc)
 			hub := tc.Hub(t, &tc)
 			wf := tc.Wf(t, &tc)
@@ -1273,7 +1731,7 @@ func TestSyncIoTHubDevices(t *testing.T) {
 			defer wf.AssertExpectations(t)
 
 			app := New(ds, wf, da).WithIoTHub(hub).(*app)
-			err := app.syncIoTHubDevices(ctx, tc.DeviceIDs, tc.Integration, tc.FailEarly)
+			err := app.syncIoTHubDevices(ctx, tc.DeviceIDs, tc.Integration, tc.Exported, tc.FailEarly)
 			if tc.Error != nil {
 				if assert.Error(t, err) {
 					assert.Regexp(t, tc.Error.Error(), err.Error())
@@ -1740,6 +2198,107 @@ UwIDAQAC
 			},
 			Error: errors.New("key does not match"),
 		},
+		{
+			Name: "ok, device in second IoT Hub integration",
+
+			Integration: model.Integration{
+				ID:       uuid.New(),
+				Provider: model.ProviderIoTHub,
+				Credentials: model.Credentials{
+					Type:             model.CredentialTypeSAS,
+					ConnectionString: validConnString,
+				},
+			},
+
+			Req: model.PreauthRequest{
+				DeviceID: "foo",
+				IdentityData: map[string]interface{}{
+					"foo": "bar",
+				},
+				PublicKey: pubkey,
+			},
+			DataStore: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+
+				ds.On("GetIntegrations",
+					contextMatcher,
+					model.IntegrationFilter{}).
+					Return([]model.Integration{{
+						ID:       uuid.New(),
+						Provider: model.ProviderIoTHub,
+						Name:     "other",
+						Credentials: model.Credentials{
+							Type: model.CredentialTypeSAS,
+							ConnectionString: &model.ConnectionString{
+								HostName: "other.localhost:8080",
+								Key:      crypto.String("not-so-secret-key"),
+								Name:     "foobar",
+							},
+						},
+					}, {
+						ID:       uuid.New(),
+						Provider: model.ProviderWebhook,
+					}, self.Integration}, nil).
+					Once()
+
+				return ds
+			},
+			Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+				hub := new(hubMocks.Client)
+				hub.On("GetDeviceTwin",
+					contextMatcher,
+					mock.MatchedBy(func(cs *model.ConnectionString) bool {
+						return cs.HostName == "other.localhost:8080"
+					}),
+					self.Req.DeviceID).
+					Return(nil, client.NewHTTPError(http.StatusNotFound)).Once()
+				hub.On("GetDeviceTwin",
+					contextMatcher,
+					self.Integration.Credentials.ConnectionString,
+					self.Req.DeviceID).
+					Return(&iothub.DeviceTwin{
+						Properties: iothub.TwinProperties{
+							Reported: map[string]interface{}{
+								"id_data": map[string]interface{}{"foo": "bar"},
+								"pubkey":  pubkeyStr,
+							},
+						},
+					}, nil).Once()
+
+				return hub
+			},
+		},
+		{
+			Name: "error, no IoT Hub integration",
+
+			Integration: model.Integration{
+				ID:       uuid.New(),
+				Provider: model.ProviderWebhook,
+			},
+
+			Req: model.PreauthRequest{
+				DeviceID: "foo",
+				IdentityData: map[string]interface{}{
+					"foo": "bar",
+				},
+				PublicKey: pubkey,
+			},
+			DataStore: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+
+				ds.On("GetIntegrations",
+					contextMatcher,
+					model.IntegrationFilter{}).
+					Return([]model.Integration{self.Integration}, nil).
+					Once()
+
+				return ds
+			},
+			Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+				return new(hubMocks.Client)
+			},
+			Error: ErrIntegrationNotFound,
+		},
 	}
 	for i := range testCases {
 		tc := testCases[i]
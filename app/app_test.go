@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -32,6 +33,8 @@ import (
 
 	"github.com/mendersoftware/go-lib-micro/log"
 	"github.com/mendersoftware/iot-manager/client"
+	"github.com/mendersoftware/iot-manager/client/devauth"
+	mdevauth "github.com/mendersoftware/iot-manager/client/devauth/mocks"
 	"github.com/mendersoftware/iot-manager/client/iotcore"
 	coreMocks "github.com/mendersoftware/iot-manager/client/iotcore/mocks"
 	"github.com/mendersoftware/iot-manager/client/iothub"
@@ -49,6 +52,39 @@ var (
 		Key:      crypto.String("not-so-secret-key"),
 		Name:     "foobar",
 	}
+	testHubIntegration = model.Integration{
+		ID:       uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Provider: model.ProviderIoTHub,
+		Credentials: model.Credentials{
+			Type:             model.CredentialTypeSAS,
+			ConnectionString: validConnString,
+		},
+	}
+	testCoreIntegration = model.Integration{
+		ID:       uuid.MustParse("00000000-0000-0000-0000-000000000002"),
+		Provider: model.ProviderIoTCore,
+		Credentials: model.Credentials{
+			Type: model.CredentialTypeAWS,
+			AWSCredentials: &model.AWSCredentials{
+				AccessKeyID: func() *string {
+					s := "1234567890"
+					return &s
+				}(),
+				SecretAccessKey: func() *crypto.String {
+					var s crypto.String = "1234567890"
+					return &s
+				}(),
+				Region: func() *string {
+					s := "eu-north-south-1"
+					return &s
+				}(),
+				DevicePolicyName: func() *string {
+					s := "gibAccess"
+					return &s
+				}(),
+			},
+		},
+	}
 )
 
 type JSONIterator json.Decoder
@@ -270,6 +306,8 @@ func TestCreateIntegration(t *testing.T) {
 	type testCase struct {
 		Name                  string
 		Store                 func(t *testing.T, self *testCase) *storeMocks.DataStore
+		Hub                   func(t *testing.T, self *testCase) *hubMocks.Client
+		Core                  func(t *testing.T, self *testCase) *coreMocks.Client
 		CreateIntegrationData model.Integration
 		Error                 error
 	}
@@ -280,10 +318,21 @@ func TestCreateIntegration(t *testing.T) {
 
 			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
 				ds := new(storeMocks.DataStore)
+				ds.On("GetIntegrations", contextMatcher,
+					model.IntegrationFilter{Provider: model.ProviderIoTHub}).
+					Return([]model.Integration{}, nil)
 				ds.On("CreateIntegration", contextMatcher, mock.AnythingOfType("model.Integration")).
 					Return(&self.CreateIntegrationData, nil)
 				return ds
 			},
+			Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+				hub := new(hubMocks.Client)
+				hub.On("CheckPermissions",
+					contextMatcher,
+					self.CreateIntegrationData.Credentials.ConnectionString).
+					Return(nil, nil)
+				return hub
+			},
 			CreateIntegrationData: model.Integration{
 				Provider: model.ProviderIoTHub,
 				Credentials: model.Credentials{
@@ -296,6 +345,100 @@ func TestCreateIntegration(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "integration created, disjoint selectors",
+
+			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+				other := testHubIntegration
+				other.Selector = model.DeviceSelector{{
+					Key: "device_type", Op: model.SelectorOpEqual, Value: "sensor",
+				}}
+				ds.On("GetIntegrations", contextMatcher,
+					model.IntegrationFilter{Provider: model.ProviderIoTHub}).
+					Return([]model.Integration{other}, nil)
+				ds.On("CreateIntegration", contextMatcher, mock.AnythingOfType("model.Integration")).
+					Return(&self.CreateIntegrationData, nil)
+				return ds
+			},
+			Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+				hub := new(hubMocks.Client)
+				hub.On("CheckPermissions",
+					contextMatcher,
+					self.CreateIntegrationData.Credentials.ConnectionString).
+					Return(nil, nil)
+				return hub
+			},
+			CreateIntegrationData: model.Integration{
+				Provider: model.ProviderIoTHub,
+				Credentials: model.Credentials{
+					Type:             model.CredentialTypeSAS,
+					ConnectionString: validConnString,
+				},
+				Selector: model.DeviceSelector{{
+					Key: "device_type", Op: model.SelectorOpEqual, Value: "gateway",
+				}},
+			},
+		},
+		{
+			Name: "error: two IoT Hubs would provision the same devices",
+
+			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+				other := testHubIntegration
+				other.Selector = model.DeviceSelector{{
+					Key: "mac", Op: model.SelectorOpPrefix, Value: "00:11",
+				}}
+				ds.On("GetIntegrations", contextMatcher,
+					model.IntegrationFilter{Provider: model.ProviderIoTHub}).
+					Return([]model.Integration{other}, nil)
+				return ds
+			},
+			Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+				hub := new(hubMocks.Client)
+				hub.On("CheckPermissions",
+					contextMatcher,
+					self.CreateIntegrationData.Credentials.ConnectionString).
+					Return(nil, nil)
+				return hub
+			},
+			CreateIntegrationData: model.Integration{
+				Provider: model.ProviderIoTHub,
+				Credentials: model.Credentials{
+					Type:             model.CredentialTypeSAS,
+					ConnectionString: validConnString,
+				},
+				Selector: model.DeviceSelector{{
+					Key: "device_type", Op: model.SelectorOpEqual, Value: "gateway",
+				}},
+			},
+			Error: ErrSelectorOverlap,
+		},
+		{
+			Name: "webhook integration created active",
+
+			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+				ds.On("CreateIntegration", contextMatcher,
+					mock.MatchedBy(func(integration model.Integration) bool {
+						return integration.State == model.IntegrationStateActive &&
+							integration.CircuitBreaker == nil
+					})).
+					Return(&self.CreateIntegrationData, nil)
+				return ds
+			},
+			CreateIntegrationData: model.Integration{
+				Provider: model.ProviderWebhook,
+				Credentials: model.Credentials{
+					Type: model.CredentialTypeHTTP,
+					HTTP: &model.HTTPCredentials{
+						URL: "http://localhost",
+					},
+				},
+				State:          model.IntegrationStateSuspended,
+				CircuitBreaker: &model.CircuitBreaker{SuspendedTS: new(time.Time)},
+			},
+		},
 		{
 			Name: "create integration error",
 			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
@@ -316,6 +459,66 @@ func TestCreateIntegration(t *testing.T) {
 			},
 			Error: ErrIntegrationExists,
 		},
+		{
+			Name: "error: IoT Hub permissions missing",
+			Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+				hub := new(hubMocks.Client)
+				hub.On("CheckPermissions",
+					contextMatcher,
+					self.CreateIntegrationData.Credentials.ConnectionString).
+					Return([]string{iothub.PermissionRegistryWrite}, nil)
+				return hub
+			},
+			CreateIntegrationData: testHubIntegration,
+			Error: &CredentialsError{
+				MissingPermissions: []string{iothub.PermissionRegistryWrite},
+			},
+		},
+		{
+			Name: "error: IoT Hub unreachable",
+			Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+				hub := new(hubMocks.Client)
+				hub.On("CheckPermissions",
+					contextMatcher,
+					self.CreateIntegrationData.Credentials.ConnectionString).
+					Return(nil, errors.New("no such host"))
+				return hub
+			},
+			CreateIntegrationData: testHubIntegration,
+			Error:                 errors.New("failed to reach the cloud provider: no such host"),
+		},
+		{
+			Name: "error: IoT Hub throttled",
+			Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+				hub := new(hubMocks.Client)
+				hub.On("CheckPermissions",
+					contextMatcher,
+					self.CreateIntegrationData.Credentials.ConnectionString).
+					Return(nil, client.NewHTTPError(http.StatusForbidden))
+				return hub
+			},
+			CreateIntegrationData: testHubIntegration,
+			Error: &ProviderError{
+				err: client.NewHTTPError(http.StatusForbidden),
+			},
+		},
+		{
+			Name: "error: IoT Core permissions missing",
+			Core: func(t *testing.T, self *testCase) *coreMocks.Client {
+				core := new(coreMocks.Client)
+				core.On("CheckPermissions",
+					contextMatcher,
+					*self.CreateIntegrationData.Credentials.AWSCredentials).
+					Return([]string{
+						iotcore.PermissionDescribeEndpoint,
+						iotcore.PermissionGetPolicy,
+					}, nil)
+				return core
+			},
+			CreateIntegrationData: testCoreIntegration,
+			Error: errors.New("the credentials are missing required permissions: " +
+				"iot:DescribeEndpoint, iot:GetPolicy"),
+		},
 	}
 
 	for i := range testCases {
@@ -328,7 +531,21 @@ func TestCreateIntegration(t *testing.T) {
 				}),
 				mock.AnythingOfType("model.Integration"),
 			).Return(nil, tc.Error)
-			app := New(store, nil, nil)
+			if tc.Store != nil {
+				store = tc.Store(t, &tc)
+				defer store.AssertExpectations(t)
+			}
+			hub := new(hubMocks.Client)
+			if tc.Hub != nil {
+				hub = tc.Hub(t, &tc)
+			}
+			defer hub.AssertExpectations(t)
+			core := new(coreMocks.Client)
+			if tc.Core != nil {
+				core = tc.Core(t, &tc)
+			}
+			defer core.AssertExpectations(t)
+			app := New(store, nil, nil).WithIoTHub(hub).WithIoTCore(core)
 
 			ctx := context.Background()
 			_, err := app.CreateIntegration(ctx, tc.CreateIntegrationData)
@@ -347,6 +564,7 @@ func TestSetIntegrationCredentials(t *testing.T) {
 	type testCase struct {
 		Name        string
 		Store       func(t *testing.T, self *testCase) *storeMocks.DataStore
+		Hub         func(t *testing.T, self *testCase) *hubMocks.Client
 		Credentials model.Credentials
 		Error       error
 	}
@@ -383,12 +601,36 @@ func TestSetIntegrationCredentials(t *testing.T) {
 			},
 			Error: errors.New("unexpected error"),
 		},
+		{
+			Name: "error: permissions missing",
+			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				return new(storeMocks.DataStore)
+			},
+			Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+				hub := new(hubMocks.Client)
+				hub.On("CheckPermissions",
+					contextMatcher,
+					self.Credentials.ConnectionString).
+					Return([]string{iothub.PermissionRegistryRead}, nil)
+				return hub
+			},
+			Credentials: testHubIntegration.Credentials,
+			Error: errors.New("the credentials are missing required permissions: " +
+				"RegistryRead"),
+		},
 	}
 
 	for i := range testCases {
 		tc := testCases[i]
 		t.Run(tc.Name, func(t *testing.T) {
-			app := New(tc.Store(t, &tc), nil, nil)
+			ds := tc.Store(t, &tc)
+			defer ds.AssertExpectations(t)
+			hub := new(hubMocks.Client)
+			if tc.Hub != nil {
+				hub = tc.Hub(t, &tc)
+			}
+			defer hub.AssertExpectations(t)
+			app := New(ds, nil, nil).WithIoTHub(hub)
 
 			ctx := context.Background()
 			err := app.SetIntegrationCredentials(ctx, integrationID, tc.Credentials)
@@ -401,138 +643,1051 @@ func TestSetIntegrationCredentials(t *testing.T) {
 	}
 }
 
-func TestRemoveIntegration(t *testing.T) {
+func TestUpdateIntegration(t *testing.T) {
 	t.Parallel()
-	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("integration"))
+	integration := testHubIntegration
+	integration.Name = "gateways"
+	hubFilter := model.IntegrationFilter{Provider: model.ProviderIoTHub}
 	type testCase struct {
-		Name  string
-		Store func(t *testing.T, self *testCase) *storeMocks.DataStore
-		Error error
+		Name   string
+		Store  func(t *testing.T) *storeMocks.DataStore
+		Result *model.Integration
+		Error  error
 	}
 
-	testCases := []testCase{
-		{
-			Name: "ok",
+	testCases := []testCase{{
+		Name: "ok",
 
-			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-				ds := new(storeMocks.DataStore)
-				ds.On("GetIntegrationById", contextMatcher, integrationID).
-					Return(&model.Integration{
-						ID:       uuid.Nil,
-						Provider: model.ProviderIoTHub,
-					}, nil).
-					Once()
-				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
-					Return(false, nil).
-					Once()
-				ds.On("RemoveIntegration", contextMatcher, integrationID).
-					Return(nil).
-					Once()
-				return ds
-			},
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return([]model.Integration{integration}, nil).
+				Once()
+			result := integration
+			result.Version++
+			ds.On("UpdateIntegration", contextMatcher, integration).
+				Return(&result, nil).
+				Once()
+			return ds
 		},
-		{
-			Name: "error: get devices by integration ID issue",
-			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-				ds := new(storeMocks.DataStore)
-				ds.On("GetIntegrationById", contextMatcher, integrationID).
-					Return(&model.Integration{
-						ID:       uuid.Nil,
-						Provider: model.ProviderIoTHub,
-					}, nil).
-					Once()
-				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
-					Return(false, errors.New("some error: error retrieving integration collection results"))
-				return ds
-			},
-			Error: errors.New("some error: error retrieving integration collection results"),
+		Result: func() *model.Integration {
+			result := integration
+			result.Version++
+			return &result
+		}(),
+	}, {
+		Name: "error, duplicate integration",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return([]model.Integration{integration}, nil).
+				Once()
+			ds.On("UpdateIntegration", contextMatcher, integration).
+				Return(nil, store.ErrObjectExists).
+				Once()
+			return ds
 		},
-		{
-			Name: "error: devices with given integration ID exist",
-			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-				ds := new(storeMocks.DataStore)
-				ds.On("GetIntegrationById", contextMatcher, integrationID).
-					Return(&model.Integration{
-						ID:       uuid.Nil,
-						Provider: model.ProviderIoTHub,
-					}, nil).
-					Once()
-				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
-					Return(true, nil)
-				return ds
-			},
-			Error: ErrCannotRemoveIntegration,
+		Error: ErrIntegrationExists,
+	}, {
+		Name: "error, integration not found",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return([]model.Integration{integration}, nil).
+				Once()
+			ds.On("UpdateIntegration", contextMatcher, integration).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, integration.ID).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			return ds
 		},
-		{
-			Name: "error: integration not found",
+		Error: ErrIntegrationNotFound,
+	}, {
+		Name: "error, integration modified concurrently",
 
-			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-				ds := new(storeMocks.DataStore)
-				ds.On("GetIntegrationById", contextMatcher, integrationID).
-					Return(nil, store.ErrObjectNotFound).
-					Once()
-				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
-					Return(false, nil).
-					Once()
-				ds.On("RemoveIntegration", contextMatcher, integrationID).
-					Return(store.ErrObjectNotFound).
-					Once()
-				return ds
-			},
-			Error: ErrIntegrationNotFound,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return([]model.Integration{integration}, nil).
+				Once()
+			ds.On("UpdateIntegration", contextMatcher, integration).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, integration.ID).
+				Return(&testHubIntegration, nil).
+				Once()
+			return ds
 		},
-		{
-			Name: "error: unexpected error",
+		Error: ErrIntegrationConflict,
+	}, {
+		Name: "error, failed to retrieve integration",
 
-			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-				ds := new(storeMocks.DataStore)
-				ds.On("GetIntegrationById", contextMatcher, integrationID).
-					Return(&model.Integration{
-						ID:       uuid.Nil,
-						Provider: model.ProviderIoTHub,
-					}, nil).
-					Once()
-				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
-					Return(false, nil)
-				ds.On("RemoveIntegration", contextMatcher, integrationID).
-					Return(errors.New("unexpected mongo error"))
-				return ds
-			},
-			Error: errors.New("unexpected mongo error"),
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return([]model.Integration{integration}, nil).
+				Once()
+			ds.On("UpdateIntegration", contextMatcher, integration).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, integration.ID).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
 		},
-	}
+		Error: errors.New("failed to retrieve the integration: internal error"),
+	}, {
+		Name: "error, unexpected error",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return([]model.Integration{integration}, nil).
+				Once()
+			ds.On("UpdateIntegration", contextMatcher, integration).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Error: errors.New("internal error"),
+	}, {
+		Name: "error, selector overlaps another IoT Hub",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			other := testHubIntegration
+			other.ID = uuid.NewSHA1(uuid.NameSpaceOID, []byte("other hub"))
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return([]model.Integration{integration, other}, nil).
+				Once()
+			return ds
+		},
+		Error: ErrSelectorOverlap,
+	}, {
+		Name: "error, failed to check the selectors",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Error: errors.New("app: failed to retrieve integrations: internal error"),
+	}}
 
 	for i := range testCases {
 		tc := testCases[i]
 		t.Run(tc.Name, func(t *testing.T) {
-			app := New(tc.Store(t, &tc), nil, nil)
+			t.Parallel()
+			ds := tc.Store(t)
+			defer ds.AssertExpectations(t)
+			app := New(ds, nil, nil)
 
-			ctx := context.Background()
-			err := app.RemoveIntegration(ctx, integrationID)
+			result, err := app.UpdateIntegration(context.Background(), integration)
 			if tc.Error != nil {
 				assert.EqualError(t, err, tc.Error.Error())
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, tc.Result, result)
 			}
 		})
 	}
 }
 
-func TestProvisionDevice(t *testing.T) {
+func TestVerifyIntegration(t *testing.T) {
 	t.Parallel()
-	testIntegrations := map[model.Provider]model.Integration{
-		model.ProviderWebhook: {
-			Provider: model.ProviderWebhook,
-			ID:       uuid.MustParse("00000000-0000-0000-0000-000000000000"),
-			Credentials: model.Credentials{
-				Type: model.CredentialTypeHTTP,
-				HTTP: &model.HTTPCredentials{
-					URL: "http://localhost",
-					Secret: func() *model.HexSecret {
-						sec := model.HexSecret([]byte{'1', '2', '3'})
-						return &sec
-					}(),
-				},
+	testCases := []struct {
+		Name string
+
+		Store func(t *testing.T) *storeMocks.DataStore
+		Hub   func(t *testing.T) *hubMocks.Client
+		Core  func(t *testing.T) *coreMocks.Client
+
+		Error error
+	}{{
+		Name: "ok, IoT Hub",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testHubIntegration, nil).
+				Once()
+			return ds
+		},
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("CheckPermissions", contextMatcher, validConnString).
+				Return(nil, nil).
+				Once()
+			return hub
+		},
+	}, {
+		Name: "error, IoT Core permissions missing",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testCoreIntegration, nil).
+				Once()
+			return ds
+		},
+		Core: func(t *testing.T) *coreMocks.Client {
+			core := new(coreMocks.Client)
+			core.On("CheckPermissions",
+				contextMatcher,
+				*testCoreIntegration.Credentials.AWSCredentials).
+				Return([]string{iotcore.PermissionGetPolicy}, nil).
+				Once()
+			return core
+		},
+		Error: &CredentialsError{
+			MissingPermissions: []string{iotcore.PermissionGetPolicy},
+		},
+	}, {
+		Name: "error, IoT Core policy not found",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testCoreIntegration, nil).
+				Once()
+			return ds
+		},
+		Core: func(t *testing.T) *coreMocks.Client {
+			core := new(coreMocks.Client)
+			core.On("CheckPermissions",
+				contextMatcher,
+				*testCoreIntegration.Credentials.AWSCredentials).
+				Return(nil, iotcore.ErrPolicyNotFound).
+				Once()
+			return core
+		},
+		Error: &CredentialsError{err: iotcore.ErrPolicyNotFound},
+	}, {
+		Name: "error, IoT Core unavailable",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testCoreIntegration, nil).
+				Once()
+			return ds
+		},
+		Core: func(t *testing.T) *coreMocks.Client {
+			core := new(coreMocks.Client)
+			core.On("CheckPermissions",
+				contextMatcher,
+				*testCoreIntegration.Credentials.AWSCredentials).
+				Return(nil, client.NewHTTPError(http.StatusServiceUnavailable)).
+				Once()
+			return core
+		},
+		Error: &ProviderError{
+			err: client.NewHTTPError(http.StatusServiceUnavailable),
+		},
+	}, {
+		Name: "error, integration not found",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			return ds
+		},
+		Error: ErrIntegrationNotFound,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ds := tc.Store(t)
+			defer ds.AssertExpectations(t)
+			hub := new(hubMocks.Client)
+			if tc.Hub != nil {
+				hub = tc.Hub(t)
+			}
+			defer hub.AssertExpectations(t)
+			core := new(coreMocks.Client)
+			if tc.Core != nil {
+				core = tc.Core(t)
+			}
+			defer core.AssertExpectations(t)
+			app := New(ds, nil, nil).WithIoTHub(hub).WithIoTCore(core)
+
+			err := app.VerifyIntegration(context.Background(), testHubIntegration.ID)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+				var credErr *CredentialsError
+				if errors.As(tc.Error, &credErr) {
+					assert.ErrorAs(t, err, &credErr)
+					assert.Equal(t, tc.Error, credErr)
+				}
+				var provErr *ProviderError
+				if errors.As(tc.Error, &provErr) {
+					assert.ErrorAs(t, err, &provErr)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGetIntegrationHealth(t *testing.T) {
+	t.Parallel()
+	health := &model.IntegrationHealth{
+		LastHour:    model.NewDeliveryStats(1, 1),
+		LastDay:     model.NewDeliveryStats(2, 1),
+		LastWeek:    model.NewDeliveryStats(2, 1),
+		StatusCodes: map[int]int64{200: 1, 503: 1},
+	}
+	testCases := []struct {
+		Name string
+
+		Store func(t *testing.T) *storeMocks.DataStore
+
+		Health *model.IntegrationHealth
+		Error  error
+	}{{
+		Name: "ok",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testHubIntegration, nil).
+				Once()
+			ds.On("GetIntegrationHealth",
+				contextMatcher,
+				testHubIntegration.ID,
+				mock.MatchedBy(func(now time.Time) bool {
+					return time.Since(now) < time.Minute
+				})).
+				Return(health, nil).
+				Once()
+			return ds
+		},
+		Health: health,
+	}, {
+		Name: "error, integration not found",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			return ds
+		},
+		Error: ErrIntegrationNotFound,
+	}, {
+		Name: "error, store",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testHubIntegration, nil).
+				Once()
+			ds.On("GetIntegrationHealth",
+				contextMatcher,
+				testHubIntegration.ID,
+				mock.AnythingOfType("time.Time")).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Error: errors.New("internal error"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ds := tc.Store(t)
+			defer ds.AssertExpectations(t)
+			app := New(ds, nil, nil)
+
+			health, err := app.GetIntegrationHealth(context.Background(), testHubIntegration.ID)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.Health, health)
+			}
+		})
+	}
+}
+
+func TestRemoveIntegration(t *testing.T) {
+	t.Parallel()
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("integration"))
+	type testCase struct {
+		Name  string
+		Store func(t *testing.T, self *testCase) *storeMocks.DataStore
+		Error error
+	}
+
+	testCases := []testCase{
+		{
+			Name: "ok",
+
+			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+				ds.On("GetIntegrationById", contextMatcher, integrationID).
+					Return(&model.Integration{
+						ID:       uuid.Nil,
+						Provider: model.ProviderIoTHub,
+					}, nil).
+					Once()
+				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
+					Return(false, nil).
+					Once()
+				ds.On("RemoveIntegration", contextMatcher, integrationID).
+					Return(nil).
+					Once()
+				return ds
+			},
+		},
+		{
+			Name: "error: get devices by integration ID issue",
+			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+				ds.On("GetIntegrationById", contextMatcher, integrationID).
+					Return(&model.Integration{
+						ID:       uuid.Nil,
+						Provider: model.ProviderIoTHub,
+					}, nil).
+					Once()
+				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
+					Return(false, errors.New("some error: error retrieving integration collection results"))
+				return ds
+			},
+			Error: errors.New("some error: error retrieving integration collection results"),
+		},
+		{
+			Name: "error: devices with given integration ID exist",
+			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+				ds.On("GetIntegrationById", contextMatcher, integrationID).
+					Return(&model.Integration{
+						ID:       uuid.Nil,
+						Provider: model.ProviderIoTHub,
+					}, nil).
+					Once()
+				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
+					Return(true, nil)
+				return ds
+			},
+			Error: ErrCannotRemoveIntegration,
+		},
+		{
+			Name: "error: integration not found",
+
+			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+				ds.On("GetIntegrationById", contextMatcher, integrationID).
+					Return(nil, store.ErrObjectNotFound).
+					Once()
+				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
+					Return(false, nil).
+					Once()
+				ds.On("RemoveIntegration", contextMatcher, integrationID).
+					Return(store.ErrObjectNotFound).
+					Once()
+				return ds
+			},
+			Error: ErrIntegrationNotFound,
+		},
+		{
+			Name: "error: unexpected error",
+
+			Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+				ds := new(storeMocks.DataStore)
+				ds.On("GetIntegrationById", contextMatcher, integrationID).
+					Return(&model.Integration{
+						ID:       uuid.Nil,
+						Provider: model.ProviderIoTHub,
+					}, nil).
+					Once()
+				ds.On("DoDevicesExistByIntegrationID", contextMatcher, integrationID).
+					Return(false, nil)
+				ds.On("RemoveIntegration", contextMatcher, integrationID).
+					Return(errors.New("unexpected mongo error"))
+				return ds
+			},
+			Error: errors.New("unexpected mongo error"),
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			app := New(tc.Store(t, &tc), nil, nil)
+
+			ctx := context.Background()
+			err := app.RemoveIntegration(ctx, integrationID)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestProvisionDevice(t *testing.T) {
+	t.Parallel()
+	testIntegrations := map[model.Provider]model.Integration{
+		model.ProviderWebhook: {
+			Provider: model.ProviderWebhook,
+			ID:       uuid.MustParse("00000000-0000-0000-0000-000000000000"),
+			Credentials: model.Credentials{
+				Type: model.CredentialTypeHTTP,
+				HTTP: &model.HTTPCredentials{
+					URL: "http://localhost",
+					Secret: func() *model.HexSecret {
+						sec := model.HexSecret([]byte{'1', '2', '3'})
+						return &sec
+					}(),
+				},
+			},
+		},
+		model.ProviderIoTHub: {
+			ID:       uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+			Provider: model.ProviderIoTHub,
+			Credentials: model.Credentials{
+				Type:             model.CredentialTypeSAS,
+				ConnectionString: validConnString,
+			},
+		},
+		model.ProviderIoTCore: {
+			ID:       uuid.MustParse("00000000-0000-0000-0000-000000000002"),
+			Provider: model.ProviderIoTCore,
+			Credentials: model.Credentials{
+				Type: model.CredentialTypeAWS,
+				AWSCredentials: &model.AWSCredentials{
+					AccessKeyID: func() *string {
+						s := "1234567890"
+						return &s
+					}(),
+					SecretAccessKey: func() *crypto.String {
+						var s crypto.String = "1234567890"
+						return &s
+					}(),
+					Region: func() *string {
+						s := "eu-north-south-1"
+						return &s
+					}(),
+					DevicePolicyName: func() *string {
+						s := "gibAccess"
+						return &s
+					}(),
+				},
+			},
+		},
+	}
+
+	type testCase struct {
+		Name   string
+		Device model.DeviceEvent
+		Status model.Status
+
+		Store        func(t *testing.T, self *testCase) *storeMocks.DataStore
+		Core         func(t *testing.T, self *testCase) *coreMocks.Client
+		Hub          func(t *testing.T, self *testCase) *hubMocks.Client
+		RoundTripper func(t *testing.T, req *http.Request) (*http.Response, error)
+	}
+	testCases := []testCase{{
+		Name: "ok, webhook integration",
+		Device: model.DeviceEvent{
+			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		},
+		Status: model.StatusAccepted,
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return([]model.Integration{
+					testIntegrations[model.ProviderWebhook],
+					// Add an empty (ignored) provider
+					{Provider: model.ProviderEmpty},
+				}, nil).
+				Once().
+				On("UpsertDeviceIntegrations",
+					contextMatcher,
+					self.Device.ID,
+					[]uuid.UUID{}).
+				Return(new(model.Device), nil).
+				Once().
+				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+				Run(func(args mock.Arguments) {
+					event := args.Get(1).(model.Event)
+					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
+						assert.Equal(t,
+							self.Device.ID,
+							event.Data.(model.DeviceEvent).ID)
+					}
+					assert.Len(t, event.DeliveryStatus, 1)
+					for _, stat := range event.DeliveryStatus {
+						assert.True(t, stat.Pending)
+					}
+				}).
+				Return(nil).
+				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.True(t, stat.Success)
+				})
+			return mockedStore
+		},
+		Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+			return new(hubMocks.Client)
+		},
+		Core: func(t *testing.T, self *testCase) *coreMocks.Client {
+			return new(coreMocks.Client)
+		},
+		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
+			b, _ := io.ReadAll(req.Body)
+			var event model.WebhookEvent
+			err := json.Unmarshal(b, &event)
+			assert.NoError(t, err)
+			assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+			w := httptest.NewRecorder()
+			w.WriteHeader(http.StatusOK)
+			return w.Result(), nil
+		},
+	}, {
+		Name: "ok, webhook not subscribed to event",
+		Device: model.DeviceEvent{
+			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		},
+		Status: model.StatusAccepted,
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			webhook := testIntegrations[model.ProviderWebhook]
+			webhook.Events = []model.EventType{
+				model.EventTypeDeviceDecommissioned,
+			}
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return([]model.Integration{webhook}, nil).
+				Once().
+				On("UpsertDeviceIntegrations",
+					contextMatcher,
+					self.Device.ID,
+					[]uuid.UUID{}).
+				Return(new(model.Device), nil).
+				Once().
+				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+				Run(func(args mock.Arguments) {
+					event := args.Get(1).(model.Event)
+					assert.Len(t, event.DeliveryStatus, 0)
+				}).
+				Return(nil).
+				Once()
+			return mockedStore
+		},
+		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
+			assert.Fail(t, "unexpected webhook request")
+			return nil, errors.New("unexpected webhook request")
+		},
+	}, {
+		Name: "ok, device skipped by integration selector",
+		Device: model.DeviceEvent{
+			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+			AuthSets: []model.AuthSet{{
+				IdentityData: map[string]interface{}{
+					"device_type": "sensor",
+					"mac":         "00:11:22:33:44:55",
+				},
+			}},
+		},
+		Status: model.StatusAccepted,
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			hub := testIntegrations[model.ProviderIoTHub]
+			hub.Selector = model.DeviceSelector{{
+				Key:   "device_type",
+				Op:    model.SelectorOpEqual,
+				Value: "gateway",
+			}}
+			core := testIntegrations[model.ProviderIoTCore]
+			core.Selector = model.DeviceSelector{{
+				Key:   "mac",
+				Op:    model.SelectorOpPrefix,
+				Value: "00:11:22",
+			}}
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return([]model.Integration{hub, core}, nil).
+				Once().
+				On("UpsertDeviceIntegrations",
+					contextMatcher,
+					self.Device.ID,
+					[]uuid.UUID{core.ID}).
+				Return(new(model.Device), nil).
+				Once().
+				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+				Run(func(args mock.Arguments) {
+					event := args.Get(1).(model.Event)
+					assert.Equal(t, []model.DeliveryStatus{{
+						IntegrationID: hub.ID,
+						Success:       true,
+						Skipped:       true,
+					}, {
+						IntegrationID: core.ID,
+						Success:       true,
+					}}, event.DeliveryStatus)
+				}).
+				Return(nil).
+				Once()
+			return mockedStore
+		},
+		Core: func(t *testing.T, self *testCase) *coreMocks.Client {
+			core := new(coreMocks.Client)
+			core.On("UpsertDevice",
+				contextMatcher,
+				*testIntegrations[model.ProviderIoTCore].
+					Credentials.AWSCredentials,
+				self.Device.ID,
+				&iotcore.Device{Status: iotcore.StatusEnabled},
+				*testIntegrations[model.ProviderIoTCore].
+					Credentials.AWSCredentials.DevicePolicyName).
+				Return(&iotcore.Device{}, nil).
+				Once()
+			return core
+		},
+	}, {
+		Name: "error/webhook returns error code",
+		Device: model.DeviceEvent{
+			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		},
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return([]model.Integration{
+					testIntegrations[model.ProviderWebhook],
+				}, nil).
+				Once().
+				On("UpsertDeviceIntegrations",
+					contextMatcher,
+					self.Device.ID,
+					[]uuid.UUID{}).
+				Return(new(model.Device), nil).
+				Once().
+				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+				Run(func(args mock.Arguments) {
+					event := args.Get(1).(model.Event)
+					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
+						assert.Equal(t,
+							self.Device.ID,
+							event.Data.(model.DeviceEvent).ID)
+					}
+					assert.Len(t, event.DeliveryStatus, 1)
+					for _, stat := range event.DeliveryStatus {
+						assert.True(t, stat.Pending)
+					}
+				}).
+				Return(nil).
+				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+					if assert.NotNil(t, stat.StatusCode) {
+						assert.Equal(t, http.StatusInternalServerError, *stat.StatusCode)
+					}
+				})
+			return mockedStore
+		},
+		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
+			b, _ := io.ReadAll(req.Body)
+			var event model.WebhookEvent
+			err := json.Unmarshal(b, &event)
+			assert.NoError(t, err)
+			assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+			assert.Contains(t, req.Header, client.ParamSignature)
+			assert.Contains(t, req.Header, client.ParamAlgorithmType)
+			w := httptest.NewRecorder()
+			w.WriteHeader(http.StatusInternalServerError)
+			return w.Result(), nil
+		},
+	}, {
+		Name: "error/webhook fails to send request",
+		Device: model.DeviceEvent{
+			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		},
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return([]model.Integration{
+					testIntegrations[model.ProviderWebhook],
+				}, nil).
+				Once().
+				On("UpsertDeviceIntegrations",
+					contextMatcher,
+					self.Device.ID,
+					[]uuid.UUID{}).
+				Return(new(model.Device), nil).
+				Once().
+				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+				Run(func(args mock.Arguments) {
+					event := args.Get(1).(model.Event)
+					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
+						assert.Equal(t,
+							self.Device.ID,
+							event.Data.(model.DeviceEvent).ID)
+					}
+					assert.Len(t, event.DeliveryStatus, 1)
+					for _, stat := range event.DeliveryStatus {
+						assert.True(t, stat.Pending)
+					}
+				}).
+				Return(nil).
+				Once()
+
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+				})
+			return mockedStore
+		},
+		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
+			b, _ := io.ReadAll(req.Body)
+			var event model.WebhookEvent
+			err := json.Unmarshal(b, &event)
+			assert.NoError(t, err)
+			assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+			assert.Contains(t, req.Header, client.ParamSignature)
+			assert.Contains(t, req.Header, client.ParamAlgorithmType)
+			return nil, errors.New("internal error")
+		},
+	}, {
+		Name: "error/webhook fails to create request",
+		Device: model.DeviceEvent{
+			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		},
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return([]model.Integration{{
+					// Fails to validate
+					Provider: model.ProviderWebhook,
+				}}, nil).
+				Once().
+				On("UpsertDeviceIntegrations",
+					contextMatcher,
+					self.Device.ID,
+					[]uuid.UUID{}).
+				Return(new(model.Device), nil).
+				Once().
+				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+				Run(func(args mock.Arguments) {
+					event := args.Get(1).(model.Event)
+					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
+						assert.Equal(t,
+							self.Device.ID,
+							event.Data.(model.DeviceEvent).ID)
+					}
+					assert.Len(t, event.DeliveryStatus, 1)
+					for _, stat := range event.DeliveryStatus {
+						assert.True(t, stat.Pending)
+					}
+				}).
+				Return(nil).
+				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+				})
+			return mockedStore
+		},
+	}, {
+		Name: "error/UpsertDeviceIntegrations with error stack",
+		Device: model.DeviceEvent{
+			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		},
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return([]model.Integration(nil), nil).
+				Once().
+				On("UpsertDeviceIntegrations",
+					contextMatcher,
+					self.Device.ID,
+					[]uuid.UUID{}).
+				Return(new(model.Device), errors.New("internal error")).
+				Once().
+				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+				Run(func(args mock.Arguments) {
+					event := args.Get(1).(model.Event)
+					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
+						assert.Equal(t,
+							self.Device.ID,
+							event.Data.(model.DeviceEvent).ID)
+					}
+					assert.Len(t, event.DeliveryStatus, 0)
+				}).
+				Return(nil).
+				Once()
+			return mockedStore
+		},
+		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
+			return nil, errors.New("internal error")
+		},
+	}, {
+		Name: "error/GetIntegrations/internal error",
+		Device: model.DeviceEvent{
+			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		},
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return(nil, errors.New("internal error"))
+			return mockedStore
+		},
+	}, {
+		Name: "ok/GetIntegrations/not found",
+		Device: model.DeviceEvent{
+			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		},
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return(nil, store.ErrObjectNotFound)
+			return mockedStore
+		},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			ds := tc.Store(t, &tc)
+			ds.On("ReserveEventSequence", contextMatcher, 1).
+				Return(int64(1), nil).
+				Once()
+			defer ds.AssertExpectations(t)
+			core := new(coreMocks.Client)
+			if tc.Core != nil {
+				core = tc.Core(t, &tc)
+			}
+			defer core.AssertExpectations(t)
+			hub := new(hubMocks.Client)
+			if tc.Hub != nil {
+				hub = tc.Hub(t, &tc)
+			}
+			defer hub.AssertExpectations(t)
+			client := &http.Client{
+				Transport: roundTripperFunc(
+					func(req *http.Request) (*http.Response, error) {
+						return tc.RoundTripper(t, req)
+					},
+				),
+			}
+
+			a := &app{
+				store:         ds,
+				iothubClient:  hub,
+				iotcoreClient: core,
+				httpClient:    client,
+			}
+
+			err := a.ProvisionDevice(ctx, tc.Device)
+			assert.NoError(t, err)
+
+			// wait for the completion of the async go routine
+			time.Sleep(500 * time.Millisecond)
+		})
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (tRT roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return tRT(req)
+}
+
+// expectWebhookDeliveries sets up the outbox calls for count webhook
+// deliveries attempted once, checking the outcome of each attempt.
+func expectWebhookDeliveries(
+	t *testing.T,
+	ds *storeMocks.DataStore,
+	count int,
+	check func(t *testing.T, stat model.DeliveryStatus),
+) {
+	ds.On("EnqueueDeliveries", contextMatcher, mock.AnythingOfType("[]model.Delivery")).
+		Run(func(args mock.Arguments) {
+			deliveries := args.Get(1).([]model.Delivery)
+			assert.Len(t, deliveries, count)
+			for _, delivery := range deliveries {
+				assert.Zero(t, delivery.Attempts)
+				assert.True(t, delivery.NextTS.After(time.Now()))
+			}
+		}).
+		Return(nil).
+		Once().
+		On("UpdateEventDeliveryStatus",
+			contextMatcher,
+			mock.AnythingOfType("uuid.UUID"),
+			mock.AnythingOfType("model.DeliveryStatus")).
+		Run(func(args mock.Arguments) {
+			stat := args.Get(2).(model.DeliveryStatus)
+			assert.False(t, stat.Pending)
+			check(t, stat)
+		}).
+		Return(nil).
+		Times(count).
+		On("DeleteDelivery", contextMatcher, mock.AnythingOfType("uuid.UUID")).
+		Return(nil).
+		Times(count)
+}
+
+func TestDecommissionDevice(t *testing.T) {
+	t.Parallel()
+	testIntegrations := map[model.Provider]model.Integration{
+		model.ProviderWebhook: {
+			ID:       uuid.MustParse("00000000-0000-0000-0000-000000000000"),
+			Provider: model.ProviderWebhook,
+			Credentials: model.Credentials{
+				Type: model.CredentialTypeHTTP,
+				HTTP: &model.HTTPCredentials{
+					URL: "http://localhost",
+					Secret: func() *model.HexSecret {
+						sec := model.HexSecret([]byte{'1', '2', '3'})
+						return &sec
+					}(),
+				},
 			},
 		},
 		model.ProviderIoTHub: {
@@ -570,79 +1725,106 @@ func TestProvisionDevice(t *testing.T) {
 		},
 	}
 
-	type testCase struct {
-		Name   string
-		Device model.DeviceEvent
-		Status model.Status
-
+	type testCase struct {
+		Name     string
+		DeviceID string
+
 		Store        func(t *testing.T, self *testCase) *storeMocks.DataStore
 		Core         func(t *testing.T, self *testCase) *coreMocks.Client
 		Hub          func(t *testing.T, self *testCase) *hubMocks.Client
 		RoundTripper func(t *testing.T, req *http.Request) (*http.Response, error)
 	}
 	testCases := []testCase{{
-		Name: "ok, webhook integration",
-		Device: model.DeviceEvent{
-			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-		},
-		Status: model.StatusAccepted,
+		Name:     "ok/all the integrations",
+		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
 
 		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
 			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations",
-				contextMatcher,
-				model.IntegrationFilter{}).
+			mockedStore.On("GetDevice", contextMatcher, self.DeviceID).
+				Return(&model.Device{
+					ID: self.DeviceID,
+					IntegrationIDs: []uuid.UUID{
+						testIntegrations[model.ProviderWebhook].ID,
+						testIntegrations[model.ProviderIoTHub].ID,
+						testIntegrations[model.ProviderIoTCore].ID,
+					},
+				}, nil).
+				Once().
+				On("GetIntegrations",
+					contextMatcher,
+					model.IntegrationFilter{}).
 				Return([]model.Integration{
 					testIntegrations[model.ProviderWebhook],
+					testIntegrations[model.ProviderIoTHub],
+					testIntegrations[model.ProviderIoTCore],
 					// Add an empty (ignored) provider
 					{Provider: model.ProviderEmpty},
 				}, nil).
 				Once().
-				On("UpsertDeviceIntegrations",
-					contextMatcher,
-					self.Device.ID,
-					[]uuid.UUID{}).
-				Return(new(model.Device), nil).
+				On("DeleteDevice", contextMatcher, self.DeviceID).
+				Return(nil).
 				Once().
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
-							self.Device.ID,
+							self.DeviceID,
 							event.Data.(model.DeviceEvent).ID)
 					}
-					assert.Len(t, event.DeliveryStatus, 1)
+					assert.Len(t, event.DeliveryStatus, 3)
 					for _, stat := range event.DeliveryStatus {
-						assert.True(t, stat.Success)
+						if stat.IntegrationID == testIntegrations[model.ProviderWebhook].ID {
+							assert.True(t, stat.Pending)
+						} else {
+							assert.True(t, stat.Success)
+						}
 					}
 				}).
 				Return(nil).
 				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.True(t, stat.Success)
+				})
 			return mockedStore
 		},
 		Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
-			return new(hubMocks.Client)
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice",
+				contextMatcher,
+				testIntegrations[model.ProviderIoTHub].
+					Credentials.ConnectionString,
+				self.DeviceID).
+				Return(nil).
+				Once()
+			return hub
 		},
 		Core: func(t *testing.T, self *testCase) *coreMocks.Client {
-			return new(coreMocks.Client)
+			core := new(coreMocks.Client)
+			core.On("DeleteDevice",
+				contextMatcher,
+				*testIntegrations[model.ProviderIoTCore].
+					Credentials.AWSCredentials,
+				self.DeviceID).
+				Return(nil).
+				Once()
+			return core
 		},
 		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
 			b, _ := io.ReadAll(req.Body)
 			var event model.WebhookEvent
 			err := json.Unmarshal(b, &event)
 			assert.NoError(t, err)
-			assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+			assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
 			w := httptest.NewRecorder()
 			w.WriteHeader(http.StatusOK)
 			return w.Result(), nil
 		},
 	}, {
-		Name: "error/webhook returns error code",
-		Device: model.DeviceEvent{
-			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-		},
+		Name:     "error/webhook returns error code",
+		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
 
 		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
 			mockedStore := new(storeMocks.DataStore)
@@ -653,31 +1835,31 @@ func TestProvisionDevice(t *testing.T) {
 					testIntegrations[model.ProviderWebhook],
 				}, nil).
 				Once().
-				On("UpsertDeviceIntegrations",
-					contextMatcher,
-					self.Device.ID,
-					[]uuid.UUID{}).
-				Return(new(model.Device), nil).
-				Once().
+				On("DeleteDevice", contextMatcher, self.DeviceID).
+				Return(nil).
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
-							self.Device.ID,
+							self.DeviceID,
 							event.Data.(model.DeviceEvent).ID)
 					}
 					assert.Len(t, event.DeliveryStatus, 1)
 					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
-						if assert.NotNil(t, stat.StatusCode) {
-							assert.Equal(t, http.StatusInternalServerError, *stat.StatusCode)
-						}
+						assert.True(t, stat.Pending)
 					}
 				}).
 				Return(nil).
 				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+					if assert.NotNil(t, stat.StatusCode) {
+						assert.Equal(t, *stat.StatusCode, http.StatusInternalServerError)
+					}
+				})
 			return mockedStore
 		},
 		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
@@ -685,7 +1867,7 @@ func TestProvisionDevice(t *testing.T) {
 			var event model.WebhookEvent
 			err := json.Unmarshal(b, &event)
 			assert.NoError(t, err)
-			assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+			assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
 			assert.Contains(t, req.Header, client.ParamSignature)
 			assert.Contains(t, req.Header, client.ParamAlgorithmType)
 			w := httptest.NewRecorder()
@@ -693,10 +1875,8 @@ func TestProvisionDevice(t *testing.T) {
 			return w.Result(), nil
 		},
 	}, {
-		Name: "error/webhook fails to send request",
-		Device: model.DeviceEvent{
-			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-		},
+		Name:     "error/webhook fails to send request",
+		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
 
 		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
 			mockedStore := new(storeMocks.DataStore)
@@ -707,29 +1887,29 @@ func TestProvisionDevice(t *testing.T) {
 					testIntegrations[model.ProviderWebhook],
 				}, nil).
 				Once().
-				On("UpsertDeviceIntegrations",
-					contextMatcher,
-					self.Device.ID,
-					[]uuid.UUID{}).
-				Return(new(model.Device), nil).
-				Once().
+				On("DeleteDevice", contextMatcher, self.DeviceID).
+				Return(nil).
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
-							self.Device.ID,
+							self.DeviceID,
 							event.Data.(model.DeviceEvent).ID)
 					}
 					assert.Len(t, event.DeliveryStatus, 1)
 					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
+						assert.True(t, stat.Pending)
 					}
 				}).
 				Return(nil).
 				Once()
 
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+				})
 			return mockedStore
 		},
 		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
@@ -737,16 +1917,14 @@ func TestProvisionDevice(t *testing.T) {
 			var event model.WebhookEvent
 			err := json.Unmarshal(b, &event)
 			assert.NoError(t, err)
-			assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+			assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
 			assert.Contains(t, req.Header, client.ParamSignature)
 			assert.Contains(t, req.Header, client.ParamAlgorithmType)
 			return nil, errors.New("internal error")
 		},
 	}, {
-		Name: "error/webhook fails to create request",
-		Device: model.DeviceEvent{
-			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-		},
+		Name:     "error/webhook fails to create request",
+		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
 
 		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
 			mockedStore := new(storeMocks.DataStore)
@@ -758,92 +1936,77 @@ func TestProvisionDevice(t *testing.T) {
 					Provider: model.ProviderWebhook,
 				}}, nil).
 				Once().
-				On("UpsertDeviceIntegrations",
-					contextMatcher,
-					self.Device.ID,
-					[]uuid.UUID{}).
-				Return(new(model.Device), nil).
-				Once().
+				On("DeleteDevice", contextMatcher, self.DeviceID).
+				Return(nil).
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
-							self.Device.ID,
+							self.DeviceID,
 							event.Data.(model.DeviceEvent).ID)
 					}
 					assert.Len(t, event.DeliveryStatus, 1)
 					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
+						assert.True(t, stat.Pending)
 					}
 				}).
 				Return(nil).
 				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+				})
 			return mockedStore
 		},
 	}, {
-		Name: "error/UpsertDeviceIntegrations with error stack",
-		Device: model.DeviceEvent{
-			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-		},
+		Name:     "error/device not found (DeleteDevice) with error stack",
+		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
 
 		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
 			mockedStore := new(storeMocks.DataStore)
 			mockedStore.On("GetIntegrations",
 				contextMatcher,
 				model.IntegrationFilter{}).
-				Return([]model.Integration(nil), nil).
-				Once().
-				On("UpsertDeviceIntegrations",
-					contextMatcher,
-					self.Device.ID,
-					[]uuid.UUID{}).
-				Return(new(model.Device), errors.New("internal error")).
+				Return([]model.Integration{
+					testIntegrations[model.ProviderWebhook],
+				}, nil).
 				Once().
+				On("DeleteDevice", contextMatcher, self.DeviceID).
+				Return(store.ErrObjectNotFound).
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceProvisioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
-							self.Device.ID,
+							self.DeviceID,
 							event.Data.(model.DeviceEvent).ID)
 					}
-					assert.Len(t, event.DeliveryStatus, 0)
+					assert.Len(t, event.DeliveryStatus, 1)
+					for _, stat := range event.DeliveryStatus {
+						assert.True(t, stat.Pending)
+					}
 				}).
 				Return(nil).
 				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+				})
 			return mockedStore
 		},
 		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
 			return nil, errors.New("internal error")
 		},
 	}, {
-		Name: "error/GetIntegrations/internal error",
-		Device: model.DeviceEvent{
-			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-		},
-
-		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations",
-				contextMatcher,
-				model.IntegrationFilter{}).
-				Return(nil, errors.New("internal error"))
-			return mockedStore
-		},
-	}, {
-		Name: "ok/GetIntegrations/not found",
-		Device: model.DeviceEvent{
-			ID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-		},
+		Name:     "error: device not found in db in GetDeviceIntegrations",
+		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
 
 		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
 			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations",
-				contextMatcher,
-				model.IntegrationFilter{}).
+			mockedStore.On("GetIntegrations", contextMatcher, model.IntegrationFilter{}).
 				Return(nil, store.ErrObjectNotFound)
 			return mockedStore
 		},
@@ -852,8 +2015,12 @@ func TestProvisionDevice(t *testing.T) {
 		tc := testCases[i]
 		t.Run(tc.Name, func(t *testing.T) {
 			t.Parallel()
+			defer recover()
 			ctx := context.Background()
 			ds := tc.Store(t, &tc)
+			ds.On("ReserveEventSequence", contextMatcher, 1).
+				Return(int64(1), nil).
+				Once()
 			defer ds.AssertExpectations(t)
 			core := new(coreMocks.Client)
 			if tc.Core != nil {
@@ -880,7 +2047,7 @@ func TestProvisionDevice(t *testing.T) {
 				httpClient:    client,
 			}
 
-			err := a.ProvisionDevice(ctx, tc.Device)
+			err := a.DecommissionDevice(ctx, tc.DeviceID)
 			assert.NoError(t, err)
 
 			// wait for the completion of the async go routine
@@ -889,13 +2056,7 @@ func TestProvisionDevice(t *testing.T) {
 	}
 }
 
-type roundTripperFunc func(req *http.Request) (*http.Response, error)
-
-func (tRT roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
-	return tRT(req)
-}
-
-func TestDecommissionDevice(t *testing.T) {
+func TestSetDeviceStatus(t *testing.T) {
 	t.Parallel()
 	testIntegrations := map[model.Provider]model.Integration{
 		model.ProviderWebhook: {
@@ -950,6 +2111,7 @@ func TestDecommissionDevice(t *testing.T) {
 	type testCase struct {
 		Name     string
 		DeviceID string
+		Status   model.Status
 
 		Store        func(t *testing.T, self *testCase) *storeMocks.DataStore
 		Core         func(t *testing.T, self *testCase) *coreMocks.Client
@@ -957,24 +2119,15 @@ func TestDecommissionDevice(t *testing.T) {
 		RoundTripper func(t *testing.T, req *http.Request) (*http.Response, error)
 	}
 	testCases := []testCase{{
-		Name:     "ok/all the integrations",
+		Name:     "ok, all the integrations",
 		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		Status:   model.StatusAccepted,
 
 		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
 			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetDevice", contextMatcher, self.DeviceID).
-				Return(&model.Device{
-					ID: self.DeviceID,
-					IntegrationIDs: []uuid.UUID{
-						testIntegrations[model.ProviderWebhook].ID,
-						testIntegrations[model.ProviderIoTHub].ID,
-						testIntegrations[model.ProviderIoTCore].ID,
-					},
-				}, nil).
-				Once().
-				On("GetIntegrations",
-					contextMatcher,
-					model.IntegrationFilter{}).
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
 				Return([]model.Integration{
 					testIntegrations[model.ProviderWebhook],
 					testIntegrations[model.ProviderIoTHub],
@@ -983,13 +2136,20 @@ func TestDecommissionDevice(t *testing.T) {
 					{Provider: model.ProviderEmpty},
 				}, nil).
 				Once().
-				On("DeleteDevice", contextMatcher, self.DeviceID).
-				Return(nil).
+				On("GetDevice", contextMatcher, self.DeviceID).
+				Return(&model.Device{
+					ID: self.DeviceID,
+					IntegrationIDs: []uuid.UUID{
+						testIntegrations[model.ProviderWebhook].ID,
+						testIntegrations[model.ProviderIoTHub].ID,
+						testIntegrations[model.ProviderIoTCore].ID,
+					},
+				}, nil).
 				Once().
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
 							self.DeviceID,
@@ -997,32 +2157,62 @@ func TestDecommissionDevice(t *testing.T) {
 					}
 					assert.Len(t, event.DeliveryStatus, 3)
 					for _, stat := range event.DeliveryStatus {
-						assert.True(t, stat.Success)
+						if stat.IntegrationID == testIntegrations[model.ProviderWebhook].ID {
+							assert.True(t, stat.Pending)
+						} else {
+							assert.True(t, stat.Success)
+						}
 					}
 				}).
 				Return(nil).
 				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.True(t, stat.Success)
+				})
 			return mockedStore
 		},
 		Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
 			hub := new(hubMocks.Client)
-			hub.On("DeleteDevice",
+			hubDev := &iothub.Device{
+				DeviceID: self.DeviceID,
+				Status:   iothub.StatusDisabled,
+			}
+			hub.On("GetDevice",
 				contextMatcher,
 				testIntegrations[model.ProviderIoTHub].
 					Credentials.ConnectionString,
 				self.DeviceID).
-				Return(nil).
-				Once()
+				Return(hubDev, nil).
+				Once().
+				On("UpsertDevice",
+					contextMatcher,
+					testIntegrations[model.ProviderIoTHub].
+						Credentials.ConnectionString,
+					self.DeviceID,
+					mock.MatchedBy(func(actual *iothub.Device) bool {
+						return actual.Status == iothub.StatusEnabled &&
+							actual.DeviceID == self.DeviceID
+					})).
+				Run(func(args mock.Arguments) {
+					hubDev.Status = iothub.StatusEnabled
+				}).
+				Return(hubDev, nil)
 			return hub
 		},
 		Core: func(t *testing.T, self *testCase) *coreMocks.Client {
 			core := new(coreMocks.Client)
-			core.On("DeleteDevice",
+			core.On("UpsertDevice",
 				contextMatcher,
 				*testIntegrations[model.ProviderIoTCore].
 					Credentials.AWSCredentials,
-				self.DeviceID).
-				Return(nil).
+				self.DeviceID,
+				mock.MatchedBy(func(actual *iotcore.Device) bool {
+					return actual.Status == iotcore.StatusEnabled
+				}),
+				*testIntegrations[model.ProviderIoTCore].
+					Credentials.AWSCredentials.DevicePolicyName).
+				Return(new(iotcore.Device), nil).
 				Once()
 			return core
 		},
@@ -1031,7 +2221,7 @@ func TestDecommissionDevice(t *testing.T) {
 			var event model.WebhookEvent
 			err := json.Unmarshal(b, &event)
 			assert.NoError(t, err)
-			assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
+			assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
 			w := httptest.NewRecorder()
 			w.WriteHeader(http.StatusOK)
 			return w.Result(), nil
@@ -1049,12 +2239,10 @@ func TestDecommissionDevice(t *testing.T) {
 					testIntegrations[model.ProviderWebhook],
 				}, nil).
 				Once().
-				On("DeleteDevice", contextMatcher, self.DeviceID).
-				Return(nil).
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
 							self.DeviceID,
@@ -1062,14 +2250,18 @@ func TestDecommissionDevice(t *testing.T) {
 					}
 					assert.Len(t, event.DeliveryStatus, 1)
 					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
-						if assert.NotNil(t, stat.StatusCode) {
-							assert.Equal(t, *stat.StatusCode, http.StatusInternalServerError)
-						}
+						assert.True(t, stat.Pending)
 					}
 				}).
 				Return(nil).
 				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+					if assert.NotNil(t, stat.StatusCode) {
+						assert.Equal(t, *stat.StatusCode, http.StatusInternalServerError)
+					}
+				})
 			return mockedStore
 		},
 		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
@@ -1077,7 +2269,7 @@ func TestDecommissionDevice(t *testing.T) {
 			var event model.WebhookEvent
 			err := json.Unmarshal(b, &event)
 			assert.NoError(t, err)
-			assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
+			assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
 			assert.Contains(t, req.Header, client.ParamSignature)
 			assert.Contains(t, req.Header, client.ParamAlgorithmType)
 			w := httptest.NewRecorder()
@@ -1097,12 +2289,10 @@ func TestDecommissionDevice(t *testing.T) {
 					testIntegrations[model.ProviderWebhook],
 				}, nil).
 				Once().
-				On("DeleteDevice", contextMatcher, self.DeviceID).
-				Return(nil).
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
 							self.DeviceID,
@@ -1110,12 +2300,16 @@ func TestDecommissionDevice(t *testing.T) {
 					}
 					assert.Len(t, event.DeliveryStatus, 1)
 					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
+						assert.True(t, stat.Pending)
 					}
 				}).
 				Return(nil).
 				Once()
 
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+				})
 			return mockedStore
 		},
 		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
@@ -1123,10 +2317,10 @@ func TestDecommissionDevice(t *testing.T) {
 			var event model.WebhookEvent
 			err := json.Unmarshal(b, &event)
 			assert.NoError(t, err)
-			assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
+			assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
 			assert.Contains(t, req.Header, client.ParamSignature)
 			assert.Contains(t, req.Header, client.ParamAlgorithmType)
-			return nil, errors.New("internal error")
+			return nil, &net.DNSError{Err: "unknown", Name: "localhost"}
 		},
 	}, {
 		Name:     "error/webhook fails to create request",
@@ -1142,12 +2336,10 @@ func TestDecommissionDevice(t *testing.T) {
 					Provider: model.ProviderWebhook,
 				}}, nil).
 				Once().
-				On("DeleteDevice", contextMatcher, self.DeviceID).
-				Return(nil).
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
 							self.DeviceID,
@@ -1155,15 +2347,19 @@ func TestDecommissionDevice(t *testing.T) {
 					}
 					assert.Len(t, event.DeliveryStatus, 1)
 					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
+						assert.True(t, stat.Pending)
 					}
 				}).
 				Return(nil).
 				Once()
+			expectWebhookDeliveries(t, mockedStore, 1,
+				func(t *testing.T, stat model.DeliveryStatus) {
+					assert.False(t, stat.Success)
+				})
 			return mockedStore
 		},
 	}, {
-		Name:     "error/device not found (DeleteDevice) with error stack",
+		Name:     "error/SaveEvent internal error",
 		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
 
 		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
@@ -1175,12 +2371,10 @@ func TestDecommissionDevice(t *testing.T) {
 					testIntegrations[model.ProviderWebhook],
 				}, nil).
 				Once().
-				On("DeleteDevice", contextMatcher, self.DeviceID).
-				Return(store.ErrObjectNotFound).
 				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
 				Run(func(args mock.Arguments) {
 					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceDecommissioned, event.Type)
+					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
 					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
 						assert.Equal(t,
 							self.DeviceID,
@@ -1191,7 +2385,7 @@ func TestDecommissionDevice(t *testing.T) {
 						assert.False(t, stat.Success)
 					}
 				}).
-				Return(nil).
+				Return(errors.New("internal error")).
 				Once()
 			return mockedStore
 		},
@@ -1199,7 +2393,7 @@ func TestDecommissionDevice(t *testing.T) {
 			return nil, errors.New("internal error")
 		},
 	}, {
-		Name:     "error: device not found in db in GetDeviceIntegrations",
+		Name:     "ok: integration does not exist",
 		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
 
 		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
@@ -1208,478 +2402,751 @@ func TestDecommissionDevice(t *testing.T) {
 				Return(nil, store.ErrObjectNotFound)
 			return mockedStore
 		},
+	}, {
+		Name:     "ok, webhook not subscribed to event",
+		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		Status:   model.StatusAccepted,
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			webhook := testIntegrations[model.ProviderWebhook]
+			webhook.Events = []model.EventType{
+				model.EventTypeDeviceProvisioned,
+				model.EventTypeDeviceDecommissioned,
+			}
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations",
+				contextMatcher,
+				model.IntegrationFilter{}).
+				Return([]model.Integration{webhook}, nil).
+				Once().
+				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+				Run(func(args mock.Arguments) {
+					event := args.Get(1).(model.Event)
+					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
+					assert.Len(t, event.DeliveryStatus, 0)
+				}).
+				Return(nil).
+				Once()
+			return mockedStore
+		},
+		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
+			assert.Fail(t, "unexpected webhook request")
+			return nil, errors.New("unexpected webhook request")
+		},
+	}, {
+		Name:     "error: error getting integrations",
+		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			mockedStore := new(storeMocks.DataStore)
+			mockedStore.On("GetIntegrations", contextMatcher, model.IntegrationFilter{}).
+				Return(nil, io.ErrClosedPipe)
+			return mockedStore
+		},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			ds := tc.Store(t, &tc)
+			ds.On("ReserveEventSequence", contextMatcher, 1).
+				Return(int64(1), nil).
+				Once()
+			defer ds.AssertExpectations(t)
+			core := new(coreMocks.Client)
+			if tc.Core != nil {
+				core = tc.Core(t, &tc)
+			}
+			defer core.AssertExpectations(t)
+			hub := new(hubMocks.Client)
+			if tc.Hub != nil {
+				hub = tc.Hub(t, &tc)
+			}
+			defer hub.AssertExpectations(t)
+			client := &http.Client{
+				Transport: roundTripperFunc(
+					func(req *http.Request) (*http.Response, error) {
+						return tc.RoundTripper(t, req)
+					},
+				),
+			}
+
+			a := &app{
+				store:         ds,
+				iothubClient:  hub,
+				iotcoreClient: core,
+				httpClient:    client,
+			}
+
+			err := a.SetDeviceStatus(ctx, tc.DeviceID, tc.Status)
+			assert.NoError(t, err)
+
+			// wait for the completion of the async go routine
+			time.Sleep(500 * time.Millisecond)
+		})
+	}
+}
+
+func TestGetDevice(t *testing.T) {
+	testCases := []struct {
+		Name string
+
+		DeviceID       string
+		GetDevice      *model.Device
+		GetDeviceError error
+		Error          error
+	}{
+		{
+			Name: "ok",
+
+			DeviceID: "1",
+			GetDevice: &model.Device{
+				ID: "1",
+			},
+		},
+		{
+			Name: "ok, device doesn't exist",
+
+			DeviceID:       "1",
+			GetDeviceError: store.ErrObjectNotFound,
+			Error:          ErrDeviceNotFound,
+		},
+		{
+			Name: "ko, device retrieval error",
+
+			DeviceID:       "1",
+			GetDeviceError: errors.New("error getting the device"),
+			Error:          errors.New("error getting the device"),
+		},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			store := &storeMocks.DataStore{}
+			store.On("GetDevice",
+				mock.MatchedBy(func(ctx context.Context) bool {
+					return true
+				}),
+				tc.DeviceID,
+			).Return(tc.GetDevice, tc.GetDeviceError)
+			app := New(store, nil, nil)
+
+			ctx := context.Background()
+			device, err := app.GetDevice(ctx, tc.DeviceID)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.GetDevice, device)
+			}
+		})
+	}
+}
+
+func TestGetDevices(t *testing.T) {
+	t.Parallel()
+	fltr := model.DeviceFilter{
+		Limit:         10,
+		IntegrationID: uuid.NewSHA1(uuid.NameSpaceOID, []byte("digest")),
+	}
+	ds := new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	ds.On("GetDevices", contextMatcher, fltr).
+		Return([]model.Device{{ID: "1"}}, nil)
+	app := New(ds, nil, nil)
+	devices, err := app.GetDevices(context.Background(), fltr)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Device{{ID: "1"}}, devices)
+}
+
+func TestUnregisterDevice(t *testing.T) {
+	t.Parallel()
+	hubIntegration := testHubIntegration
+	coreIntegration := testCoreIntegration
+	missingIntegrationID := uuid.MustParse("00000000-0000-0000-0000-000000000003")
+	device := &model.Device{
+		ID: "1",
+		IntegrationIDs: []uuid.UUID{
+			hubIntegration.ID,
+			coreIntegration.ID,
+			missingIntegrationID,
+		},
+	}
+	testCases := []struct {
+		Name string
+
+		DeviceID string
+		Cleanup  bool
+
+		Store func(t *testing.T) *storeMocks.DataStore
+		Hub   func(t *testing.T) *hubMocks.Client
+		Core  func(t *testing.T) *coreMocks.Client
+
+		Error error
+	}{{
+		Name: "ok",
+
+		DeviceID: "1",
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDevice", contextMatcher, "1").
+				Return(device, nil).
+				Once()
+			ds.On("DeleteDevice", contextMatcher, "1").
+				Return(nil).
+				Once()
+			return ds
+		},
+	}, {
+		Name: "ok, with cleanup",
+
+		DeviceID: "1",
+		Cleanup:  true,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDevice", contextMatcher, "1").
+				Return(device, nil).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, hubIntegration.ID).
+				Return(&hubIntegration, nil).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, coreIntegration.ID).
+				Return(&coreIntegration, nil).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, missingIntegrationID).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			ds.On("DeleteDevice", contextMatcher, "1").
+				Return(nil).
+				Once()
+			return ds
+		},
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice", contextMatcher, validConnString, "1").
+				Return(nil).
+				Once()
+			return hub
+		},
+		Core: func(t *testing.T) *coreMocks.Client {
+			core := new(coreMocks.Client)
+			core.On("DeleteDevice",
+				contextMatcher,
+				*coreIntegration.Credentials.AWSCredentials,
+				"1").
+				Return(iotcore.ErrDeviceNotFound).
+				Once()
+			return core
+		},
+	}, {
+		Name: "error, device not found",
+
+		DeviceID: "1",
+		Cleanup:  true,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDevice", contextMatcher, "1").
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			return ds
+		},
+		Error: ErrDeviceNotFound,
+	}, {
+		Name: "error, get device",
+
+		DeviceID: "1",
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDevice", contextMatcher, "1").
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Error: errors.New("failed to retrieve the device: internal error"),
+	}, {
+		Name: "error, get integration",
+
+		DeviceID: "1",
+		Cleanup:  true,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDevice", contextMatcher, "1").
+				Return(device, nil).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, hubIntegration.ID).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Error: errors.New("failed to retrieve the integration: internal error"),
+	}, {
+		Name: "error, cleanup failed",
+
+		DeviceID: "1",
+		Cleanup:  true,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDevice", contextMatcher, "1").
+				Return(device, nil).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, hubIntegration.ID).
+				Return(&hubIntegration, nil).
+				Once()
+			return ds
+		},
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice", contextMatcher, validConnString, "1").
+				Return(errors.New("internal error")).
+				Once()
+			return hub
+		},
+		Error: errors.New("failed to remove the device from integration " +
+			hubIntegration.ID.String() +
+			": failed to delete IoT Hub device: internal error"),
+	}, {
+		Name: "error, device deleted concurrently",
+
+		DeviceID: "1",
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDevice", contextMatcher, "1").
+				Return(device, nil).
+				Once()
+			ds.On("DeleteDevice", contextMatcher, "1").
+				Return(store.ErrObjectNotFound).
+				Once()
+			return ds
+		},
+		Error: ErrDeviceNotFound,
 	}}
 	for i := range testCases {
 		tc := testCases[i]
 		t.Run(tc.Name, func(t *testing.T) {
 			t.Parallel()
-			defer recover()
-			ctx := context.Background()
-			ds := tc.Store(t, &tc)
+			ds := tc.Store(t)
 			defer ds.AssertExpectations(t)
-			core := new(coreMocks.Client)
-			if tc.Core != nil {
-				core = tc.Core(t, &tc)
-			}
-			defer core.AssertExpectations(t)
 			hub := new(hubMocks.Client)
 			if tc.Hub != nil {
-				hub = tc.Hub(t, &tc)
+				hub = tc.Hub(t)
 			}
 			defer hub.AssertExpectations(t)
-			client := &http.Client{
-				Transport: roundTripperFunc(
-					func(req *http.Request) (*http.Response, error) {
-						return tc.RoundTripper(t, req)
-					},
-				),
+			core := new(coreMocks.Client)
+			if tc.Core != nil {
+				core = tc.Core(t)
 			}
+			defer core.AssertExpectations(t)
 
-			a := &app{
-				store:         ds,
-				iothubClient:  hub,
-				iotcoreClient: core,
-				httpClient:    client,
+			a := New(ds, nil, nil).
+				WithIoTHub(hub).
+				WithIoTCore(core)
+			err := a.UnregisterDevice(context.Background(), tc.DeviceID, tc.Cleanup)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else {
+				assert.NoError(t, err)
 			}
-
-			err := a.DecommissionDevice(ctx, tc.DeviceID)
-			assert.NoError(t, err)
-
-			// wait for the completion of the async go routine
-			time.Sleep(500 * time.Millisecond)
 		})
 	}
 }
 
-func TestSetDeviceStatus(t *testing.T) {
+func TestAttachDeviceIntegration(t *testing.T) {
 	t.Parallel()
-	testIntegrations := map[model.Provider]model.Integration{
-		model.ProviderWebhook: {
-			ID:       uuid.MustParse("00000000-0000-0000-0000-000000000000"),
-			Provider: model.ProviderWebhook,
-			Credentials: model.Credentials{
-				Type: model.CredentialTypeHTTP,
-				HTTP: &model.HTTPCredentials{
-					URL: "http://localhost",
-					Secret: func() *model.HexSecret {
-						sec := model.HexSecret([]byte{'1', '2', '3'})
-						return &sec
-					}(),
-				},
-			},
-		},
-		model.ProviderIoTHub: {
-			ID:       uuid.MustParse("00000000-0000-0000-0000-000000000001"),
-			Provider: model.ProviderIoTHub,
-			Credentials: model.Credentials{
-				Type:             model.CredentialTypeSAS,
-				ConnectionString: validConnString,
-			},
-		},
-		model.ProviderIoTCore: {
-			ID:       uuid.MustParse("00000000-0000-0000-0000-000000000002"),
-			Provider: model.ProviderIoTCore,
-			Credentials: model.Credentials{
-				Type: model.CredentialTypeAWS,
-				AWSCredentials: &model.AWSCredentials{
-					AccessKeyID: func() *string {
-						s := "1234567890"
-						return &s
-					}(),
-					SecretAccessKey: func() *crypto.String {
-						var s crypto.String = "1234567890"
-						return &s
-					}(),
-					Region: func() *string {
-						s := "eu-north-south-1"
-						return &s
-					}(),
-					DevicePolicyName: func() *string {
-						s := "gibAccess"
-						return &s
-					}(),
-				},
-			},
-		},
+	webhookIntegration := model.Integration{
+		ID:       uuid.MustParse("00000000-0000-0000-0000-000000000003"),
+		Provider: model.ProviderWebhook,
 	}
+	testCases := []struct {
+		Name string
 
-	type testCase struct {
-		Name     string
-		DeviceID string
-		Status   model.Status
+		IntegrationID uuid.UUID
 
-		Store        func(t *testing.T, self *testCase) *storeMocks.DataStore
-		Core         func(t *testing.T, self *testCase) *coreMocks.Client
-		Hub          func(t *testing.T, self *testCase) *hubMocks.Client
-		RoundTripper func(t *testing.T, req *http.Request) (*http.Response, error)
-	}
-	testCases := []testCase{{
-		Name:     "ok, all the integrations",
-		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-		Status:   model.StatusAccepted,
+		Store   func(t *testing.T) *storeMocks.DataStore
+		Devauth func(t *testing.T) *mdevauth.Client
+		Hub     func(t *testing.T) *hubMocks.Client
+		Core    func(t *testing.T) *coreMocks.Client
 
-		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations",
+		Error error
+	}{{
+		Name: "ok, IoT Core",
+
+		IntegrationID: testCoreIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testCoreIntegration.ID).
+				Return(&testCoreIntegration, nil).
+				Once()
+			ds.On("UpsertDeviceIntegrations",
 				contextMatcher,
-				model.IntegrationFilter{}).
-				Return([]model.Integration{
-					testIntegrations[model.ProviderWebhook],
-					testIntegrations[model.ProviderIoTHub],
-					testIntegrations[model.ProviderIoTCore],
-					// Add an empty (ignored) provider
-					{Provider: model.ProviderEmpty},
-				}, nil).
-				Once().
-				On("GetDevice", contextMatcher, self.DeviceID).
+				"1",
+				[]uuid.UUID{testCoreIntegration.ID}).
 				Return(&model.Device{
-					ID: self.DeviceID,
-					IntegrationIDs: []uuid.UUID{
-						testIntegrations[model.ProviderWebhook].ID,
-						testIntegrations[model.ProviderIoTHub].ID,
-						testIntegrations[model.ProviderIoTCore].ID,
-					},
+					ID:             "1",
+					IntegrationIDs: []uuid.UUID{testCoreIntegration.ID},
 				}, nil).
-				Once().
-				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
-				Run(func(args mock.Arguments) {
-					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
-					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
-						assert.Equal(t,
-							self.DeviceID,
-							event.Data.(model.DeviceEvent).ID)
-					}
-					assert.Len(t, event.DeliveryStatus, 3)
-					for _, stat := range event.DeliveryStatus {
-						assert.True(t, stat.Success)
-					}
-				}).
-				Return(nil).
 				Once()
-			return mockedStore
+			return ds
 		},
-		Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
-			hub := new(hubMocks.Client)
-			hubDev := &iothub.Device{
-				DeviceID: self.DeviceID,
-				Status:   iothub.StatusDisabled,
-			}
-			hub.On("GetDevice",
-				contextMatcher,
-				testIntegrations[model.ProviderIoTHub].
-					Credentials.ConnectionString,
-				self.DeviceID).
-				Return(hubDev, nil).
-				Once().
-				On("UpsertDevice",
-					contextMatcher,
-					testIntegrations[model.ProviderIoTHub].
-						Credentials.ConnectionString,
-					self.DeviceID,
-					mock.MatchedBy(func(actual *iothub.Device) bool {
-						return actual.Status == iothub.StatusEnabled &&
-							actual.DeviceID == self.DeviceID
-					})).
-				Run(func(args mock.Arguments) {
-					hubDev.Status = iothub.StatusEnabled
-				}).
-				Return(hubDev, nil)
-			return hub
+		Devauth: func(t *testing.T) *mdevauth.Client {
+			da := new(mdevauth.Client)
+			da.On("GetDevices", contextMatcher, []string{"1"}).
+				Return([]devauth.Device{{
+					ID:     "1",
+					Status: model.StatusRejected,
+				}}, nil).
+				Once()
+			return da
 		},
-		Core: func(t *testing.T, self *testCase) *coreMocks.Client {
+		Core: func(t *testing.T) *coreMocks.Client {
 			core := new(coreMocks.Client)
 			core.On("UpsertDevice",
 				contextMatcher,
-				*testIntegrations[model.ProviderIoTCore].
-					Credentials.AWSCredentials,
-				self.DeviceID,
-				mock.MatchedBy(func(actual *iotcore.Device) bool {
-					return actual.Status == iotcore.StatusEnabled
-				}),
-				*testIntegrations[model.ProviderIoTCore].
-					Credentials.AWSCredentials.DevicePolicyName).
-				Return(new(iotcore.Device), nil).
+				*testCoreIntegration.Credentials.AWSCredentials,
+				"1",
+				&iotcore.Device{Status: iotcore.StatusDisabled},
+				*testCoreIntegration.Credentials.AWSCredentials.DevicePolicyName).
+				Return(&iotcore.Device{}, nil).
 				Once()
 			return core
 		},
-		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
-			b, _ := io.ReadAll(req.Body)
-			var event model.WebhookEvent
-			err := json.Unmarshal(b, &event)
-			assert.NoError(t, err)
-			assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
-			w := httptest.NewRecorder()
-			w.WriteHeader(http.StatusOK)
-			return w.Result(), nil
-		},
 	}, {
-		Name:     "error/webhook returns error code",
-		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		Name: "error, integration not found",
 
-		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations",
-				contextMatcher,
-				model.IntegrationFilter{}).
-				Return([]model.Integration{
-					testIntegrations[model.ProviderWebhook],
-				}, nil).
-				Once().
-				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
-				Run(func(args mock.Arguments) {
-					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
-					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
-						assert.Equal(t,
-							self.DeviceID,
-							event.Data.(model.DeviceEvent).ID)
-					}
-					assert.Len(t, event.DeliveryStatus, 1)
-					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
-						if assert.NotNil(t, stat.StatusCode) {
-							assert.Equal(t, *stat.StatusCode, http.StatusInternalServerError)
-						}
-					}
-				}).
-				Return(nil).
+		IntegrationID: testHubIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(nil, store.ErrObjectNotFound).
 				Once()
-			return mockedStore
-		},
-		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
-			b, _ := io.ReadAll(req.Body)
-			var event model.WebhookEvent
-			err := json.Unmarshal(b, &event)
-			assert.NoError(t, err)
-			assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
-			assert.Contains(t, req.Header, client.ParamSignature)
-			assert.Contains(t, req.Header, client.ParamAlgorithmType)
-			w := httptest.NewRecorder()
-			w.WriteHeader(http.StatusInternalServerError)
-			return w.Result(), nil
+			return ds
 		},
+		Error: ErrIntegrationNotFound,
 	}, {
-		Name:     "error/webhook fails to send request",
-		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		Name: "error, webhook integration",
 
-		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations",
-				contextMatcher,
-				model.IntegrationFilter{}).
-				Return([]model.Integration{
-					testIntegrations[model.ProviderWebhook],
-				}, nil).
-				Once().
-				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
-				Run(func(args mock.Arguments) {
-					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
-					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
-						assert.Equal(t,
-							self.DeviceID,
-							event.Data.(model.DeviceEvent).ID)
-					}
-					assert.Len(t, event.DeliveryStatus, 1)
-					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
-					}
-				}).
-				Return(nil).
+		IntegrationID: webhookIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, webhookIntegration.ID).
+				Return(&webhookIntegration, nil).
 				Once()
+			return ds
+		},
+		Error: ErrUnknownIntegration,
+	}, {
+		Name: "error, device not found",
 
-			return mockedStore
+		IntegrationID: testHubIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testHubIntegration, nil).
+				Once()
+			return ds
 		},
-		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
-			b, _ := io.ReadAll(req.Body)
-			var event model.WebhookEvent
-			err := json.Unmarshal(b, &event)
-			assert.NoError(t, err)
-			assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
-			assert.Contains(t, req.Header, client.ParamSignature)
-			assert.Contains(t, req.Header, client.ParamAlgorithmType)
-			return nil, &net.DNSError{Err: "unknown", Name: "localhost"}
+		Devauth: func(t *testing.T) *mdevauth.Client {
+			da := new(mdevauth.Client)
+			da.On("GetDevices", contextMatcher, []string{"1"}).
+				Return([]devauth.Device{}, nil).
+				Once()
+			return da
 		},
+		Error: ErrDeviceNotFound,
 	}, {
-		Name:     "error/webhook fails to create request",
-		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-
-		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations",
-				contextMatcher,
-				model.IntegrationFilter{}).
-				Return([]model.Integration{{
-					// Fails to validate
-					Provider: model.ProviderWebhook,
+		Name: "error, device not selected",
+
+		IntegrationID: testHubIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			hub := testHubIntegration
+			hub.Selector = model.DeviceSelector{{
+				Key:   "device_type",
+				Op:    model.SelectorOpEqual,
+				Value: "gateway",
+			}}
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&hub, nil).
+				Once()
+			return ds
+		},
+		Devauth: func(t *testing.T) *mdevauth.Client {
+			da := new(mdevauth.Client)
+			da.On("GetDevices", contextMatcher, []string{"1"}).
+				Return([]devauth.Device{{
+					ID:     "1",
+					Status: model.StatusAccepted,
+					IdentityData: map[string]interface{}{
+						"device_type": "sensor",
+					},
 				}}, nil).
-				Once().
-				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
-				Run(func(args mock.Arguments) {
-					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
-					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
-						assert.Equal(t,
-							self.DeviceID,
-							event.Data.(model.DeviceEvent).ID)
-					}
-					assert.Len(t, event.DeliveryStatus, 1)
-					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
-					}
-				}).
-				Return(nil).
 				Once()
-			return mockedStore
+			return da
 		},
+		Error: ErrDeviceNotSelected,
 	}, {
-		Name:     "error/SaveEvent internal error",
-		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		Name: "error, provisioning failed",
 
-		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations",
+		IntegrationID: testHubIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testHubIntegration, nil).
+				Once()
+			return ds
+		},
+		Devauth: func(t *testing.T) *mdevauth.Client {
+			da := new(mdevauth.Client)
+			da.On("GetDevices", contextMatcher, []string{"1"}).
+				Return([]devauth.Device{{
+					ID:     "1",
+					Status: model.StatusAccepted,
+				}}, nil).
+				Once()
+			return da
+		},
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("UpsertDevice",
 				contextMatcher,
-				model.IntegrationFilter{}).
-				Return([]model.Integration{
-					testIntegrations[model.ProviderWebhook],
-				}, nil).
-				Once().
-				On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
-				Run(func(args mock.Arguments) {
-					event := args.Get(1).(model.Event)
-					assert.Equal(t, model.EventTypeDeviceStatusChanged, event.Type)
-					if assert.IsType(t, model.DeviceEvent{}, event.Data) {
-						assert.Equal(t,
-							self.DeviceID,
-							event.Data.(model.DeviceEvent).ID)
-					}
-					assert.Len(t, event.DeliveryStatus, 1)
-					for _, stat := range event.DeliveryStatus {
-						assert.False(t, stat.Success)
-					}
+				validConnString,
+				"1",
+				&iothub.Device{
+					DeviceID: "1",
+					Status:   iothub.StatusEnabled,
 				}).
-				Return(errors.New("internal error")).
+				Return(nil, errors.New("internal error")).
 				Once()
-			return mockedStore
-		},
-		RoundTripper: func(t *testing.T, req *http.Request) (*http.Response, error) {
-			return nil, errors.New("internal error")
+			return hub
 		},
+		Error: errors.New("failed to update iothub devices: internal error"),
 	}, {
-		Name:     "ok: integration does not exist",
-		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
+		Name: "error, connecting the device",
 
-		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations", contextMatcher, model.IntegrationFilter{}).
-				Return(nil, store.ErrObjectNotFound)
-			return mockedStore
+		IntegrationID: testCoreIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, testCoreIntegration.ID).
+				Return(&testCoreIntegration, nil).
+				Once()
+			ds.On("UpsertDeviceIntegrations",
+				contextMatcher,
+				"1",
+				[]uuid.UUID{testCoreIntegration.ID}).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
 		},
-	}, {
-		Name:     "error: error getting integrations",
-		DeviceID: "68ac6f41-c2e7-429f-a4bd-852fac9a5045",
-
-		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
-			mockedStore := new(storeMocks.DataStore)
-			mockedStore.On("GetIntegrations", contextMatcher, model.IntegrationFilter{}).
-				Return(nil, io.ErrClosedPipe)
-			return mockedStore
+		Devauth: func(t *testing.T) *mdevauth.Client {
+			da := new(mdevauth.Client)
+			da.On("GetDevices", contextMatcher, []string{"1"}).
+				Return([]devauth.Device{{
+					ID:     "1",
+					Status: model.StatusAccepted,
+				}}, nil).
+				Once()
+			return da
+		},
+		Core: func(t *testing.T) *coreMocks.Client {
+			core := new(coreMocks.Client)
+			core.On("UpsertDevice",
+				contextMatcher,
+				*testCoreIntegration.Credentials.AWSCredentials,
+				"1",
+				&iotcore.Device{Status: iotcore.StatusEnabled},
+				*testCoreIntegration.Credentials.AWSCredentials.DevicePolicyName).
+				Return(&iotcore.Device{}, nil).
+				Once()
+			return core
 		},
+		Error: errors.New(
+			"failed to connect the device to the integration: internal error",
+		),
 	}}
 	for i := range testCases {
 		tc := testCases[i]
 		t.Run(tc.Name, func(t *testing.T) {
 			t.Parallel()
-			ctx := context.Background()
-			ds := tc.Store(t, &tc)
+			ds := tc.Store(t)
 			defer ds.AssertExpectations(t)
-			core := new(coreMocks.Client)
-			if tc.Core != nil {
-				core = tc.Core(t, &tc)
+			da := new(mdevauth.Client)
+			if tc.Devauth != nil {
+				da = tc.Devauth(t)
 			}
-			defer core.AssertExpectations(t)
+			defer da.AssertExpectations(t)
 			hub := new(hubMocks.Client)
 			if tc.Hub != nil {
-				hub = tc.Hub(t, &tc)
+				hub = tc.Hub(t)
 			}
 			defer hub.AssertExpectations(t)
-			client := &http.Client{
-				Transport: roundTripperFunc(
-					func(req *http.Request) (*http.Response, error) {
-						return tc.RoundTripper(t, req)
-					},
-				),
+			core := new(coreMocks.Client)
+			if tc.Core != nil {
+				core = tc.Core(t)
 			}
+			defer core.AssertExpectations(t)
 
-			a := &app{
-				store:         ds,
-				iothubClient:  hub,
-				iotcoreClient: core,
-				httpClient:    client,
+			a := New(ds, nil, da).
+				WithIoTHub(hub).
+				WithIoTCore(core)
+			err := a.AttachDeviceIntegration(context.Background(), "1", tc.IntegrationID)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else {
+				assert.NoError(t, err)
 			}
-
-			err := a.SetDeviceStatus(ctx, tc.DeviceID, tc.Status)
-			assert.NoError(t, err)
-
-			// wait for the completion of the async go routine
-			time.Sleep(500 * time.Millisecond)
 		})
 	}
 }
 
-func TestGetDevice(t *testing.T) {
+func TestDetachDeviceIntegration(t *testing.T) {
+	t.Parallel()
 	testCases := []struct {
 		Name string
 
-		DeviceID       string
-		GetDevice      *model.Device
-		GetDeviceError error
-		Error          error
-	}{
-		{
-			Name: "ok",
+		IntegrationID uuid.UUID
 
-			DeviceID: "1",
-			GetDevice: &model.Device{
-				ID: "1",
-			},
+		Store func(t *testing.T) *storeMocks.DataStore
+		Hub   func(t *testing.T) *hubMocks.Client
+
+		Error error
+	}{{
+		Name: "ok",
+
+		IntegrationID: testHubIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDeviceByIntegrationID",
+				contextMatcher,
+				"1",
+				testHubIntegration.ID).
+				Return(&model.Device{ID: "1"}, nil).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testHubIntegration, nil).
+				Once()
+			ds.On("RemoveDeviceIntegration",
+				contextMatcher,
+				"1",
+				testHubIntegration.ID).
+				Return(nil).
+				Once()
+			return ds
 		},
-		{
-			Name: "ok, device doesn't exist",
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice", contextMatcher, validConnString, "1").
+				Return(nil).
+				Once()
+			return hub
+		},
+	}, {
+		Name: "ok, integration removed",
 
-			DeviceID:       "1",
-			GetDeviceError: store.ErrObjectNotFound,
-			Error:          ErrDeviceNotFound,
+		IntegrationID: testHubIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDeviceByIntegrationID",
+				contextMatcher,
+				"1",
+				testHubIntegration.ID).
+				Return(&model.Device{ID: "1"}, nil).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			ds.On("RemoveDeviceIntegration",
+				contextMatcher,
+				"1",
+				testHubIntegration.ID).
+				Return(nil).
+				Once()
+			return ds
 		},
-		{
-			Name: "ko, device retrieval error",
+	}, {
+		Name: "error, device not connected",
 
-			DeviceID:       "1",
-			GetDeviceError: errors.New("error getting the device"),
-			Error:          errors.New("error getting the device"),
+		IntegrationID: testHubIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDeviceByIntegrationID",
+				contextMatcher,
+				"1",
+				testHubIntegration.ID).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			return ds
 		},
-	}
+		Error: ErrDeviceNotFound,
+	}, {
+		Name: "error, decommissioning failed",
+
+		IntegrationID: testHubIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDeviceByIntegrationID",
+				contextMatcher,
+				"1",
+				testHubIntegration.ID).
+				Return(&model.Device{ID: "1"}, nil).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(&testHubIntegration, nil).
+				Once()
+			return ds
+		},
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice", contextMatcher, validConnString, "1").
+				Return(errors.New("internal error")).
+				Once()
+			return hub
+		},
+		Error: errors.New("failed to delete IoT Hub device: internal error"),
+	}, {
+		Name: "error, disconnecting the device",
+
+		IntegrationID: testHubIntegration.ID,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetDeviceByIntegrationID",
+				contextMatcher,
+				"1",
+				testHubIntegration.ID).
+				Return(&model.Device{ID: "1"}, nil).
+				Once()
+			ds.On("GetIntegrationById", contextMatcher, testHubIntegration.ID).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			ds.On("RemoveDeviceIntegration",
+				contextMatcher,
+				"1",
+				testHubIntegration.ID).
+				Return(errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Error: errors.New(
+			"failed to disconnect the device from the integration: internal error",
+		),
+	}}
 	for i := range testCases {
 		tc := testCases[i]
 		t.Run(tc.Name, func(t *testing.T) {
-			store := &storeMocks.DataStore{}
-			store.On("GetDevice",
-				mock.MatchedBy(func(ctx context.Context) bool {
-					return true
-				}),
-				tc.DeviceID,
-			).Return(tc.GetDevice, tc.GetDeviceError)
-			app := New(store, nil, nil)
+			t.Parallel()
+			ds := tc.Store(t)
+			defer ds.AssertExpectations(t)
+			hub := new(hubMocks.Client)
+			if tc.Hub != nil {
+				hub = tc.Hub(t)
+			}
+			defer hub.AssertExpectations(t)
 
-			ctx := context.Background()
-			device, err := app.GetDevice(ctx, tc.DeviceID)
+			a := New(ds, nil, nil).WithIoTHub(hub)
+			err := a.DetachDeviceIntegration(context.Background(), "1", tc.IntegrationID)
 			if tc.Error != nil {
 				assert.EqualError(t, err, tc.Error.Error())
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.GetDevice, device)
 			}
 		})
 	}
@@ -1972,3 +3439,42 @@ func TestDeleteTenant(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncCacheIntegrations(t *testing.T) {
+	t.Parallel()
+	integrations := make([]model.Integration, 25)
+	for i := range integrations {
+		integrations[i] = model.Integration{
+			ID:       uuid.New(),
+			Provider: model.ProviderIoTHub,
+			Name:     fmt.Sprintf("hub-%d", i),
+		}
+	}
+	ds := new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	ds.On("GetIntegrations", contextMatcher, model.IntegrationFilter{
+		Limit: 20,
+	}).Return(integrations[:20], nil).Once()
+	ds.On("GetIntegrations", contextMatcher, model.IntegrationFilter{
+		Skip:  20,
+		Limit: 20,
+	}).Return(integrations[20:], nil).Once()
+
+	a := New(ds, nil, nil).(*app)
+	cache, err := a.syncCacheIntegrations(context.Background())
+	if assert.NoError(t, err) {
+		assert.Len(t, cache, len(integrations))
+		for i := range integrations {
+			assert.Equal(t, &integrations[i], cache[integrations[i].ID])
+		}
+	}
+
+	ds = new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	ds.On("GetIntegrations", contextMatcher, model.IntegrationFilter{
+		Limit: 20,
+	}).Return(nil, errors.New("internal error")).Once()
+	a = New(ds, nil, nil).(*app)
+	_, err = a.syncCacheIntegrations(context.Background())
+	assert.EqualError(t, err, "failed to get integrations for tenant: internal error")
+}
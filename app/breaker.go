@@ -0,0 +1,183 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+)
+
+// circuitBreaker is the policy suspending webhook integrations after
+// repeated delivery failures.
+type circuitBreaker struct {
+	// failures is the number of consecutive failures tripping the
+	// breaker, zero disables the breaker.
+	failures int
+	// failureRate is the ratio of failures among the latest window
+	// deliveries tripping the breaker, zero disables the check.
+	failureRate float64
+	window      int
+	// cooldown is the delay between two probes of a suspended
+	// integration.
+	cooldown time.Duration
+}
+
+func (cb circuitBreaker) enabled() bool {
+	return cb.failures > 0 || (cb.failureRate > 0 && cb.window > 0)
+}
+
+// trips returns true if the delivery outcomes exceed the thresholds.
+func (cb circuitBreaker) trips(outcomes *model.CircuitBreaker) bool {
+	if outcomes == nil {
+		return false
+	}
+	if cb.failures > 0 && outcomes.ConsecutiveFailures >= cb.failures {
+		return true
+	}
+	return cb.failureRate > 0 && cb.window > 0 &&
+		len(outcomes.Outcomes) >= cb.window &&
+		outcomes.FailureRate() >= cb.failureRate
+}
+
+// WithWebhooksCircuitBreaker sets the policy suspending failing webhook
+// integrations: the integration is suspended after the given number of
+// consecutive failures, or if the percentage of failures among the latest
+// window deliveries reaches failureRate. A suspended integration is probed
+// with a delivery every cooldown seconds and resumed on success.
+func (a *app) WithWebhooksCircuitBreaker(
+	failures, failureRate, window, cooldown uint,
+) App {
+	a.webhooksBreaker = circuitBreaker{
+		failures:    int(failures),
+		failureRate: float64(failureRate) / 100,
+		window:      int(window),
+		cooldown:    time.Duration(cooldown * uint(time.Second)),
+	}
+	return a
+}
+
+// suspendedUntil returns the end of the cool-down of a suspended
+// integration, until when its deliveries are deferred. It returns the zero
+// time if the integration is active or if the delivery is claimed as the
+// probe of the integration.
+func (a *app) suspendedUntil(
+	ctx context.Context,
+	integration model.Integration,
+) time.Time {
+	if integration.State != model.IntegrationStateSuspended {
+		return time.Time{}
+	}
+	now := time.Now()
+	next := now.Add(a.webhooksBreaker.cooldown)
+	probe, err := a.store.ClaimIntegrationProbe(ctx, integration.ID, now, next)
+	if err != nil {
+		log.FromContext(ctx).
+			Errorf("failed to claim probe of integration %s: %s",
+				integration.ID, err.Error())
+	} else if probe {
+		return time.Time{}
+	}
+	if cb := integration.CircuitBreaker; cb != nil &&
+		cb.ProbeTS != nil && cb.ProbeTS.After(now) {
+		return *cb.ProbeTS
+	}
+	return next
+}
+
+// deliverWebhookEvent delivers the event to the webhook integration and
+// feeds the outcome to the circuit breaker. The delivery to a suspended
+// integration is the probe claimed with suspendedUntil: the integration
+// is resumed if it succeeds.
+func (a *app) deliverWebhookEvent(
+	ctx context.Context,
+	integration model.Integration,
+	event model.WebhookEvent,
+) (deliver model.DeliveryStatus, retry bool) {
+	l := log.FromContext(ctx)
+	deliver, retry = a.deliverWebhook(ctx, integration, event)
+
+	if integration.State == model.IntegrationStateSuspended {
+		if deliver.Success {
+			l.Infof("resuming integration %s after a successful probe",
+				integration.ID)
+			if err := a.store.ResumeIntegration(ctx, integration.ID); err != nil {
+				l.Errorf("failed to resume integration %s: %s",
+					integration.ID, err.Error())
+			}
+		}
+		return deliver, retry
+	} else if !a.webhooksBreaker.enabled() {
+		return deliver, retry
+	}
+	// The outcomes are counted in the integration, shared by all the
+	// instances of the service.
+	result, err := a.store.RecordIntegrationDelivery(ctx,
+		integration.ID, deliver.Success, a.webhooksBreaker.window)
+	if err != nil {
+		if !errors.Is(err, store.ErrObjectNotFound) {
+			l.Errorf("failed to record delivery to integration %s: %s",
+				integration.ID, err.Error())
+		}
+		return deliver, retry
+	}
+	if !deliver.Success && a.webhooksBreaker.trips(result.CircuitBreaker) {
+		l.Warnf("suspending integration %s after repeated delivery failures",
+			integration.ID)
+		err = a.store.SuspendIntegration(ctx,
+			integration.ID, time.Now().Add(a.webhooksBreaker.cooldown))
+		if err != nil {
+			l.Errorf("failed to suspend integration %s: %s",
+				integration.ID, err.Error())
+		}
+	}
+	return deliver, retry
+}
+
+// deferDelivery postpones the delivery to a suspended integration until
+// the end of its cool-down without counting an attempt: the delivery
+// status of the event stays pending.
+func (a *app) deferDelivery(
+	ctx context.Context,
+	delivery *model.Delivery,
+	until time.Time,
+) error {
+	delivery.NextTS = until
+	err := a.store.RescheduleDelivery(ctx, *delivery)
+	return errors.Wrap(err, "failed to defer delivery")
+}
+
+// ResumeIntegration resumes the deliveries to a suspended webhook
+// integration.
+func (a *app) ResumeIntegration(ctx context.Context, integrationID uuid.UUID) error {
+	integration, err := a.GetIntegrationById(ctx, integrationID)
+	if err != nil {
+		return err
+	} else if integration.Provider != model.ProviderWebhook {
+		return ErrNotWebhook
+	}
+	err = a.store.ResumeIntegration(ctx, integrationID)
+	if errors.Is(err, store.ErrObjectNotFound) {
+		return ErrIntegrationNotFound
+	}
+	return err
+}
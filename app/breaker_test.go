@@ -0,0 +1,366 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+	storeMocks "github.com/mendersoftware/iot-manager/store/mocks"
+)
+
+func TestCircuitBreakerTrips(t *testing.T) {
+	t.Parallel()
+	cb := circuitBreaker{failures: 3, failureRate: 0.5, window: 4}
+	assert.True(t, cb.enabled())
+	assert.False(t, cb.trips(nil))
+	assert.False(t, cb.trips(&model.CircuitBreaker{
+		ConsecutiveFailures: 2,
+		Outcomes:            []bool{true, false, false},
+	}), "window not filled")
+	assert.True(t, cb.trips(&model.CircuitBreaker{
+		ConsecutiveFailures: 3,
+	}), "consecutive failures")
+	assert.True(t, cb.trips(&model.CircuitBreaker{
+		ConsecutiveFailures: 1,
+		Outcomes:            []bool{false, true, true, false},
+	}), "failure rate")
+	assert.False(t, cb.trips(&model.CircuitBreaker{
+		ConsecutiveFailures: 1,
+		Outcomes:            []bool{true, true, true, false},
+	}))
+	assert.False(t, circuitBreaker{}.enabled())
+}
+
+func TestSuspendedUntil(t *testing.T) {
+	t.Parallel()
+	breaker := circuitBreaker{failures: 3, cooldown: time.Minute}
+	inCooldown := mock.MatchedBy(func(ts time.Time) bool {
+		delay := time.Until(ts)
+		return delay > 0 && delay <= time.Minute
+	})
+	probeTS := time.Now().Add(30 * time.Second)
+
+	testCases := []struct {
+		Name string
+
+		State   model.IntegrationState
+		ProbeTS *time.Time
+		Claimed bool
+		Error   error
+
+		Suspended bool
+		Until     *time.Time
+	}{{
+		Name: "active",
+	}, {
+		Name: "suspended, probe claimed",
+
+		State:   model.IntegrationStateSuspended,
+		Claimed: true,
+	}, {
+		Name: "suspended, deferred until the probe",
+
+		State:     model.IntegrationStateSuspended,
+		ProbeTS:   &probeTS,
+		Suspended: true,
+		Until:     &probeTS,
+	}, {
+		Name: "suspended, probe claimed by another delivery",
+
+		State:     model.IntegrationStateSuspended,
+		ProbeTS:   func() *time.Time { ts := time.Now().Add(-time.Second); return &ts }(),
+		Suspended: true,
+	}, {
+		Name: "suspended, error claiming the probe",
+
+		State:     model.IntegrationStateSuspended,
+		Error:     errors.New("internal error"),
+		Suspended: true,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			integration := newWebhookIntegration(uuid.New())
+			integration.State = tc.State
+			if tc.ProbeTS != nil {
+				integration.CircuitBreaker = &model.CircuitBreaker{ProbeTS: tc.ProbeTS}
+			}
+			ds := new(storeMocks.DataStore)
+			defer ds.AssertExpectations(t)
+			if tc.State == model.IntegrationStateSuspended {
+				ds.On("ClaimIntegrationProbe",
+					contextMatcher, integration.ID,
+					mock.AnythingOfType("time.Time"), inCooldown).
+					Return(tc.Claimed, tc.Error).
+					Once()
+			}
+			a := &app{store: ds, webhooksBreaker: breaker}
+
+			until := a.suspendedUntil(context.Background(), *integration)
+			if !tc.Suspended {
+				assert.True(t, until.IsZero())
+			} else if tc.Until != nil {
+				assert.Equal(t, *tc.Until, until)
+			} else {
+				assert.WithinDuration(t, time.Now().Add(time.Minute), until, time.Second)
+			}
+		})
+	}
+}
+
+func TestDeliverWebhookEvent(t *testing.T) {
+	t.Parallel()
+	event := model.WebhookEvent{
+		ID:   uuid.New(),
+		Type: model.EventTypeDeviceDecommissioned,
+		Data: model.DeviceEvent{ID: "foo"},
+	}
+	breaker := circuitBreaker{
+		failures:    3,
+		failureRate: 0.5,
+		window:      10,
+		cooldown:    time.Minute,
+	}
+	inCooldown := mock.MatchedBy(func(ts time.Time) bool {
+		delay := time.Until(ts)
+		return delay > 0 && delay <= time.Minute
+	})
+
+	testCases := []struct {
+		Name string
+
+		State      model.IntegrationState
+		Breaker    circuitBreaker
+		StatusCode int
+		Store      func(t *testing.T, integrationID uuid.UUID) *storeMocks.DataStore
+
+		Success bool
+		Retry   bool
+	}{{
+		Name: "ok",
+
+		Breaker:    breaker,
+		StatusCode: http.StatusNoContent,
+		Store: func(t *testing.T, integrationID uuid.UUID) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("RecordIntegrationDelivery",
+				contextMatcher, integrationID, true, breaker.window).
+				Return(&model.Integration{
+					ID:             integrationID,
+					CircuitBreaker: &model.CircuitBreaker{Outcomes: []bool{true}},
+				}, nil).
+				Once()
+			return ds
+		},
+		Success: true,
+	}, {
+		Name: "ok, breaker disabled",
+
+		StatusCode: http.StatusServiceUnavailable,
+		Retry:      true,
+	}, {
+		Name: "failure below thresholds",
+
+		Breaker:    breaker,
+		StatusCode: http.StatusServiceUnavailable,
+		Store: func(t *testing.T, integrationID uuid.UUID) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("RecordIntegrationDelivery",
+				contextMatcher, integrationID, false, breaker.window).
+				Return(&model.Integration{
+					ID: integrationID,
+					CircuitBreaker: &model.CircuitBreaker{
+						ConsecutiveFailures: 2,
+						Outcomes:            []bool{true, false, false},
+					},
+				}, nil).
+				Once()
+			return ds
+		},
+		Retry: true,
+	}, {
+		Name: "failure trips the breaker",
+
+		Breaker:    breaker,
+		StatusCode: http.StatusServiceUnavailable,
+		Store: func(t *testing.T, integrationID uuid.UUID) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("RecordIntegrationDelivery",
+				contextMatcher, integrationID, false, breaker.window).
+				Return(&model.Integration{
+					ID: integrationID,
+					CircuitBreaker: &model.CircuitBreaker{
+						ConsecutiveFailures: 3,
+						Outcomes:            []bool{false, false, false},
+					},
+				}, nil).
+				Once()
+			ds.On("SuspendIntegration", contextMatcher, integrationID, inCooldown).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Retry: true,
+	}, {
+		Name: "failure, error recording the delivery",
+
+		Breaker:    breaker,
+		StatusCode: http.StatusServiceUnavailable,
+		Store: func(t *testing.T, integrationID uuid.UUID) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("RecordIntegrationDelivery",
+				contextMatcher, integrationID, false, breaker.window).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Retry: true,
+	}, {
+		Name: "suspended, probe succeeds",
+
+		State:      model.IntegrationStateSuspended,
+		Breaker:    breaker,
+		StatusCode: http.StatusNoContent,
+		Store: func(t *testing.T, integrationID uuid.UUID) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("ResumeIntegration", contextMatcher, integrationID).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Success: true,
+	}, {
+		Name: "suspended, probe fails",
+
+		State:      model.IntegrationStateSuspended,
+		Breaker:    breaker,
+		StatusCode: http.StatusServiceUnavailable,
+		Retry:      true,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			integration := newWebhookIntegration(uuid.New())
+			integration.State = tc.State
+			ds := new(storeMocks.DataStore)
+			if tc.Store != nil {
+				ds = tc.Store(t, integration.ID)
+			}
+			defer ds.AssertExpectations(t)
+			a := &app{
+				store:           ds,
+				httpClient:      newStatusRoundTripper(tc.StatusCode),
+				webhooksBreaker: tc.Breaker,
+			}
+
+			deliver, retry := a.deliverWebhookEvent(context.Background(), *integration, event)
+			assert.Equal(t, tc.Success, deliver.Success)
+			assert.False(t, deliver.Skipped)
+			assert.Equal(t, tc.Retry, retry)
+		})
+	}
+}
+
+func TestResumeIntegration(t *testing.T) {
+	t.Parallel()
+	webhook := newWebhookIntegration(uuid.New())
+	testCases := []struct {
+		Name string
+
+		Store func(t *testing.T) *storeMocks.DataStore
+
+		Error error
+	}{{
+		Name: "ok",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, webhook.ID).
+				Return(webhook, nil).
+				Once()
+			ds.On("ResumeIntegration", contextMatcher, webhook.ID).
+				Return(nil).
+				Once()
+			return ds
+		},
+	}, {
+		Name: "error, not a webhook",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, webhook.ID).
+				Return(&testHubIntegration, nil).
+				Once()
+			return ds
+		},
+		Error: ErrNotWebhook,
+	}, {
+		Name: "error, integration not found",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, webhook.ID).
+				Return(webhook, nil).
+				Once()
+			ds.On("ResumeIntegration", contextMatcher, webhook.ID).
+				Return(store.ErrObjectNotFound).
+				Once()
+			return ds
+		},
+		Error: ErrIntegrationNotFound,
+	}, {
+		Name: "error, store",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrationById", contextMatcher, webhook.ID).
+				Return(webhook, nil).
+				Once()
+			ds.On("ResumeIntegration", contextMatcher, webhook.ID).
+				Return(errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Error: errors.New("internal error"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ds := tc.Store(t)
+			defer ds.AssertExpectations(t)
+			app := New(ds, nil, nil)
+
+			err := app.ResumeIntegration(context.Background(), webhook.ID)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/iot-manager/client/iotcore"
+	"github.com/mendersoftware/iot-manager/client/iothub"
+	"github.com/mendersoftware/iot-manager/model"
+)
+
+// CredentialsError is returned when the integration credentials fail the
+// permission probe.
+type CredentialsError struct {
+	// MissingPermissions lists the permissions not granted to the
+	// credentials.
+	MissingPermissions []string
+
+	err error
+}
+
+func (err *CredentialsError) Error() string {
+	if err.err != nil {
+		return "failed to verify the credentials: " + err.err.Error()
+	}
+	return "the credentials are missing required permissions: " +
+		strings.Join(err.MissingPermissions, ", ")
+}
+
+func (err *CredentialsError) Unwrap() error {
+	return err.err
+}
+
+// ProviderError is returned when the cloud provider could not be reached or
+// failed to process the permission probe, leaving the credentials unverified.
+type ProviderError struct {
+	err error
+}
+
+func (err *ProviderError) Error() string {
+	if err.err != nil {
+		return "failed to reach the cloud provider: " + err.err.Error()
+	}
+	return "failed to reach the cloud provider"
+}
+
+func (err *ProviderError) Unwrap() error {
+	return err.err
+}
+
+// verifyCredentials probes the cloud provider with the credentials and
+// returns a CredentialsError if the credentials are not usable by the
+// integration, or a ProviderError if the probe did not reach a verdict.
+func (a *app) verifyCredentials(
+	ctx context.Context,
+	credentials model.Credentials,
+) error {
+	var (
+		missing []string
+		err     error
+	)
+	switch credentials.Type {
+	case model.CredentialTypeSAS:
+		missing, err = a.iothubClient.CheckPermissions(ctx,
+			credentials.ConnectionString)
+	case model.CredentialTypeAWS:
+		if credentials.AWSCredentials == nil {
+			return &CredentialsError{err: ErrNoCredentials}
+		}
+		missing, err = a.iotcoreClient.CheckPermissions(ctx,
+			*credentials.AWSCredentials)
+	default:
+		return nil
+	}
+	switch errors.Cause(err) {
+	case nil:
+		if len(missing) > 0 {
+			return &CredentialsError{MissingPermissions: missing}
+		}
+		return nil
+	case iothub.ErrNoCredentials,
+		iotcore.ErrInvalidCredentials,
+		iotcore.ErrPolicyNotFound:
+		return &CredentialsError{err: err}
+	}
+	return &ProviderError{err: err}
+}
+
+// VerifyIntegration probes the cloud provider with the credentials of an
+// existing integration.
+func (a *app) VerifyIntegration(ctx context.Context, integrationID uuid.UUID) error {
+	integration, err := a.GetIntegrationById(ctx, integrationID)
+	if err != nil {
+		return err
+	}
+	return a.verifyCredentials(ctx, integration.Credentials)
+}
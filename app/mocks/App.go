@@ -29,6 +29,8 @@ import (
 
 	model "github.com/mendersoftware/iot-manager/model"
 
+	time "time"
+
 	uuid "github.com/google/uuid"
 )
 
@@ -37,6 +39,34 @@ type App struct {
 	mock.Mock
 }
 
+// AttachDeviceIntegration provides a mock function with given fields: ctx, deviceID, integrationID
+func (_m *App) AttachDeviceIntegration(ctx context.Context, deviceID string, integrationID uuid.UUID) error {
+	ret := _m.Called(ctx, deviceID, integrationID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, uuid.UUID) error); ok {
+		r0 = rf(ctx, deviceID, integrationID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// BulkSetDeviceStatus provides a mock function with given fields: _a0, _a1, _a2
+func (_m *App) BulkSetDeviceStatus(_a0 context.Context, _a1 []string, _a2 model.Status) error {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string, model.Status) error); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreateIntegration provides a mock function with given fields: _a0, _a1
 func (_m *App) CreateIntegration(_a0 context.Context, _a1 model.Integration) (*model.Integration, error) {
 	ret := _m.Called(_a0, _a1)
@@ -92,6 +122,34 @@ func (_m *App) DeleteTenant(_a0 context.Context) error {
 	return r0
 }
 
+// DetachDeviceIntegration provides a mock function with given fields: ctx, deviceID, integrationID
+func (_m *App) DetachDeviceIntegration(ctx context.Context, deviceID string, integrationID uuid.UUID) error {
+	ret := _m.Called(ctx, deviceID, integrationID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, uuid.UUID) error); ok {
+		r0 = rf(ctx, deviceID, integrationID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DrainTasks provides a mock function with given fields: ctx
+func (_m *App) DrainTasks(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetDevice provides a mock function with given fields: _a0, _a1
 func (_m *App) GetDevice(_a0 context.Context, _a1 string) (*model.Device, error) {
 	ret := _m.Called(_a0, _a1)
@@ -207,6 +265,29 @@ func (_m *App) GetDeviceStateIoTHub(_a0 context.Context, _a1 string, _a2 *model.
 	return r0, r1
 }
 
+// GetDevices provides a mock function with given fields: _a0, _a1
+func (_m *App) GetDevices(_a0 context.Context, _a1 model.DeviceFilter) ([]model.Device, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceFilter) []model.Device); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceFilter) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetEvents provides a mock function with given fields: ctx, filter
 func (_m *App) GetEvents(ctx context.Context, filter model.EventsFilter) ([]model.Event, error) {
 	ret := _m.Called(ctx, filter)
@@ -253,6 +334,29 @@ func (_m *App) GetIntegrationById(_a0 context.Context, _a1 uuid.UUID) (*model.In
 	return r0, r1
 }
 
+// GetIntegrationHealth provides a mock function with given fields: ctx, integrationID
+func (_m *App) GetIntegrationHealth(ctx context.Context, integrationID uuid.UUID) (*model.IntegrationHealth, error) {
+	ret := _m.Called(ctx, integrationID)
+
+	var r0 *model.IntegrationHealth
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *model.IntegrationHealth); ok {
+		r0 = rf(ctx, integrationID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.IntegrationHealth)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, integrationID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetIntegrations provides a mock function with given fields: _a0
 func (_m *App) GetIntegrations(_a0 context.Context) ([]model.Integration, error) {
 	ret := _m.Called(_a0)
@@ -304,6 +408,29 @@ func (_m *App) ProvisionDevice(_a0 context.Context, _a1 model.DeviceEvent) error
 	return r0
 }
 
+// RedeliverEvent provides a mock function with given fields: ctx, eventID, integrationID, force
+func (_m *App) RedeliverEvent(ctx context.Context, eventID uuid.UUID, integrationID uuid.UUID, force bool) (*model.Event, error) {
+	ret := _m.Called(ctx, eventID, integrationID, force)
+
+	var r0 *model.Event
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, uuid.UUID, bool) *model.Event); ok {
+		r0 = rf(ctx, eventID, integrationID, force)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Event)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, uuid.UUID, bool) error); ok {
+		r1 = rf(ctx, eventID, integrationID, force)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // RemoveIntegration provides a mock function with given fields: _a0, _a1
 func (_m *App) RemoveIntegration(_a0 context.Context, _a1 uuid.UUID) error {
 	ret := _m.Called(_a0, _a1)
@@ -318,6 +445,57 @@ func (_m *App) RemoveIntegration(_a0 context.Context, _a1 uuid.UUID) error {
 	return r0
 }
 
+// ResumeIntegration provides a mock function with given fields: _a0, _a1
+func (_m *App) ResumeIntegration(_a0 context.Context, _a1 uuid.UUID) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RotateWebhookSecret provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *App) RotateWebhookSecret(_a0 context.Context, _a1 uuid.UUID, _a2 *model.HexSecret, _a3 time.Duration) (*model.HTTPCredentials, error) {
+	ret := _m.Called(_a0, _a1, _a2, _a3)
+
+	var r0 *model.HTTPCredentials
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, *model.HexSecret, time.Duration) *model.HTTPCredentials); ok {
+		r0 = rf(_a0, _a1, _a2, _a3)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.HTTPCredentials)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, *model.HexSecret, time.Duration) error); ok {
+		r1 = rf(_a0, _a1, _a2, _a3)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RunDeliveryWorker provides a mock function with given fields: ctx, interval
+func (_m *App) RunDeliveryWorker(ctx context.Context, interval time.Duration) error {
+	ret := _m.Called(ctx, interval)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration) error); ok {
+		r0 = rf(ctx, interval)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SetDeviceStateIntegration provides a mock function with given fields: _a0, _a1, _a2, _a3
 func (_m *App) SetDeviceStateIntegration(_a0 context.Context, _a1 string, _a2 uuid.UUID, _a3 *model.DeviceState) (*model.DeviceState, error) {
 	ret := _m.Called(_a0, _a1, _a2, _a3)
@@ -429,6 +607,43 @@ func (_m *App) SyncDevices(_a0 context.Context, _a1 int, _a2 bool) error {
 	return r0
 }
 
+// UnregisterDevice provides a mock function with given fields: ctx, deviceID, cleanup
+func (_m *App) UnregisterDevice(ctx context.Context, deviceID string, cleanup bool) error {
+	ret := _m.Called(ctx, deviceID, cleanup)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool) error); ok {
+		r0 = rf(ctx, deviceID, cleanup)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateIntegration provides a mock function with given fields: _a0, _a1
+func (_m *App) UpdateIntegration(_a0 context.Context, _a1 model.Integration) (*model.Integration, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *model.Integration
+	if rf, ok := ret.Get(0).(func(context.Context, model.Integration) *model.Integration); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Integration)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.Integration) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // VerifyDeviceTwin provides a mock function with given fields: ctx, req
 func (_m *App) VerifyDeviceTwin(ctx context.Context, req model.PreauthRequest) error {
 	ret := _m.Called(ctx, req)
@@ -443,6 +658,36 @@ func (_m *App) VerifyDeviceTwin(ctx context.Context, req model.PreauthRequest) e
 	return r0
 }
 
+// VerifyIntegration provides a mock function with given fields: _a0, _a1
+func (_m *App) VerifyIntegration(_a0 context.Context, _a1 uuid.UUID) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WithAsyncWorkers provides a mock function with given fields: workers, queueSize, tenantQueueSize, batchSize
+func (_m *App) WithAsyncWorkers(workers uint, queueSize uint, tenantQueueSize uint, batchSize uint) app.App {
+	ret := _m.Called(workers, queueSize, tenantQueueSize, batchSize)
+
+	var r0 app.App
+	if rf, ok := ret.Get(0).(func(uint, uint, uint, uint) app.App); ok {
+		r0 = rf(workers, queueSize, tenantQueueSize, batchSize)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(app.App)
+		}
+	}
+
+	return r0
+}
+
 // WithIoTCore provides a mock function with given fields: client
 func (_m *App) WithIoTCore(client iotcore.Client) app.App {
 	ret := _m.Called(client)
@@ -475,6 +720,38 @@ func (_m *App) WithIoTHub(client iothub.Client) app.App {
 	return r0
 }
 
+// WithWebhooksCircuitBreaker provides a mock function with given fields: failures, failureRate, window, cooldown
+func (_m *App) WithWebhooksCircuitBreaker(failures uint, failureRate uint, window uint, cooldown uint) app.App {
+	ret := _m.Called(failures, failureRate, window, cooldown)
+
+	var r0 app.App
+	if rf, ok := ret.Get(0).(func(uint, uint, uint, uint) app.App); ok {
+		r0 = rf(failures, failureRate, window, cooldown)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(app.App)
+		}
+	}
+
+	return r0
+}
+
+// WithWebhooksRetry provides a mock function with given fields: maxAttempts, backoff, maxBackoff
+func (_m *App) WithWebhooksRetry(maxAttempts uint, backoff uint, maxBackoff uint) app.App {
+	ret := _m.Called(maxAttempts, backoff, maxBackoff)
+
+	var r0 app.App
+	if rf, ok := ret.Get(0).(func(uint, uint, uint) app.App); ok {
+		r0 = rf(maxAttempts, backoff, maxBackoff)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(app.App)
+		}
+	}
+
+	return r0
+}
+
 // WithWebhooksTimeout provides a mock function with given fields: timeout
 func (_m *App) WithWebhooksTimeout(timeout uint) app.App {
 	ret := _m.Called(timeout)
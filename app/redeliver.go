@@ -0,0 +1,203 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/iot-manager/client"
+	"github.com/mendersoftware/iot-manager/client/iotcore"
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+)
+
+// RedeliverEvent replays the event to the integrations which failed to
+// process it and appends the outcome to the delivery status of the event.
+// If integrationID is not uuid.Nil, only that integration is considered.
+// Unless force is set, a status change is not replayed if a newer status
+// change of the device targets one of the integrations, since the replay
+// would roll the integration back to an outdated status of the device.
+func (a *app) RedeliverEvent(
+	ctx context.Context,
+	eventID uuid.UUID,
+	integrationID uuid.UUID,
+	force bool,
+) (*model.Event, error) {
+	event, err := a.store.GetEvent(ctx, eventID)
+	if err != nil {
+		if errors.Is(err, store.ErrObjectNotFound) {
+			return nil, ErrEventNotFound
+		}
+		return nil, errors.Wrap(err, "failed to retrieve the event")
+	}
+	var redeliveries []int
+	for i, status := range event.DeliveryStatus {
+		if status.Success || status.Pending {
+			continue
+		} else if integrationID != uuid.Nil && status.IntegrationID != integrationID {
+			continue
+		}
+		if !force {
+			superseded, err := a.eventSuperseded(ctx, event, status.IntegrationID)
+			if err != nil {
+				return nil, err
+			} else if superseded {
+				return nil, ErrEventOutdated
+			}
+		}
+		redeliveries = append(redeliveries, i)
+	}
+	for _, i := range redeliveries {
+		status := event.DeliveryStatus[i]
+		deliver, err := a.redeliverEvent(ctx, event, status.IntegrationID)
+		if err != nil {
+			return nil, err
+		}
+		deliver.Attempts = append(status.Attempts, deliver.Attempts...)
+		event.DeliveryStatus[i] = deliver
+	}
+	return event, nil
+}
+
+// redeliverEvent replays the event to the integration and records the
+// outcome in the delivery status of the event.
+func (a *app) redeliverEvent(
+	ctx context.Context,
+	event *model.Event,
+	integrationID uuid.UUID,
+) (model.DeliveryStatus, error) {
+	ts := time.Now()
+	integration, err := a.store.GetIntegrationById(ctx, integrationID)
+	if err == nil && integration.Provider == model.ProviderWebhook {
+		return a.redeliverWebhook(ctx, event, *integration)
+	} else if errors.Is(err, store.ErrObjectNotFound) {
+		err = ErrIntegrationNotFound
+	} else if err == nil {
+		err = a.replayDeviceEvent(ctx, event, *integration)
+	}
+
+	deliver := model.DeliveryStatus{
+		IntegrationID: integrationID,
+		Success:       true,
+	}
+	if err != nil {
+		var httpError client.HTTPError
+		if errors.As(err, &httpError) {
+			errCode := httpError.Code()
+			deliver.StatusCode = &errCode
+		}
+		deliver.Success = false
+		deliver.Error = err.Error()
+	}
+	deliver.Attempts = []model.DeliveryAttempt{{
+		Success:    deliver.Success,
+		Error:      deliver.Error,
+		StatusCode: deliver.StatusCode,
+		Timestamp:  ts,
+	}}
+	err = a.store.UpdateEventDeliveryStatus(ctx, event.ID, deliver)
+	return deliver, errors.Wrap(err, "failed to update event delivery status")
+}
+
+// redeliverWebhook delivers the event to the webhook again. The pending
+// retry of the delivery in the outbox, if any, is claimed first so that the
+// delivery worker does not deliver the event at the same time; the retry
+// is then rescheduled or removed according to the outcome. It returns
+// ErrDeliveryInProgress if an attempt of the delivery is in progress.
+func (a *app) redeliverWebhook(
+	ctx context.Context,
+	event *model.Event,
+	integration model.Integration,
+) (model.DeliveryStatus, error) {
+	delivery, err := a.store.ClaimEventDelivery(ctx,
+		event.ID, integration.ID, a.webhooksTimeout+deliveryLeaseMargin)
+	if errors.Is(err, store.ErrObjectLeased) {
+		return model.DeliveryStatus{}, ErrDeliveryInProgress
+	} else if err != nil && !errors.Is(err, store.ErrObjectNotFound) {
+		return model.DeliveryStatus{}, errors.Wrap(err, "failed to claim pending delivery")
+	}
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, a.webhooksTimeout)
+	deliver, retry := a.deliverWebhook(ctxWithTimeout, integration, event.WebhookEvent)
+	cancel()
+	if delivery != nil {
+		return deliver, a.completeDelivery(ctx, delivery, deliver, retry)
+	}
+	err = a.store.UpdateEventDeliveryStatus(ctx, event.ID, deliver)
+	return deliver, errors.Wrap(err, "failed to update event delivery status")
+}
+
+// replayDeviceEvent re-runs the IoT Hub or IoT Core operation for the event.
+func (a *app) replayDeviceEvent(
+	ctx context.Context,
+	event *model.Event,
+	integration model.Integration,
+) error {
+	device, err := decodeDeviceEvent(event)
+	if err != nil {
+		return err
+	}
+
+	switch integration.Provider {
+	case model.ProviderIoTHub:
+		switch event.Type {
+		case model.EventTypeDeviceProvisioned:
+			err = a.provisionIoTHubDevice(ctx, device.ID, integration)
+		case model.EventTypeDeviceStatusChanged:
+			err = a.setDeviceStatusIoTHub(ctx, device.ID, device.Status, integration)
+		case model.EventTypeDeviceDecommissioned:
+			err = a.decommissionIoTHubDevice(ctx, device.ID, integration)
+		}
+	case model.ProviderIoTCore:
+		switch event.Type {
+		case model.EventTypeDeviceProvisioned:
+			err = a.provisionIoTCoreDevice(ctx, device.ID, integration, &iotcore.Device{
+				Status: iotcore.StatusEnabled,
+			})
+		case model.EventTypeDeviceStatusChanged:
+			err = a.setDeviceStatusIoTCore(ctx, device.ID, device.Status, integration)
+		case model.EventTypeDeviceDecommissioned:
+			err = a.decommissionIoTCoreDevice(ctx, device.ID, integration)
+		}
+	default:
+		return ErrUnknownIntegration
+	}
+	if err == nil && event.Type == model.EventTypeDeviceProvisioned {
+		_, err = a.store.UpsertDeviceIntegrations(ctx,
+			device.ID,
+			[]uuid.UUID{integration.ID},
+		)
+		err = errors.Wrap(err, "failed to connect device to integration")
+	}
+	return err
+}
+
+// decodeDeviceEvent returns the device payload of the event.
+func decodeDeviceEvent(event *model.Event) (model.DeviceEvent, error) {
+	if device, ok := event.Data.(model.DeviceEvent); ok {
+		return device, nil
+	}
+	// Stored events decode the payload as a generic document
+	var device model.DeviceEvent
+	b, err := json.Marshal(event.Data)
+	if err == nil {
+		err = json.Unmarshal(b, &device)
+	}
+	return device, errors.Wrap(err, "failed to decode event payload")
+}
@@ -0,0 +1,480 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/iot-manager/client/iotcore"
+	coreMocks "github.com/mendersoftware/iot-manager/client/iotcore/mocks"
+	"github.com/mendersoftware/iot-manager/client/iothub"
+	hubMocks "github.com/mendersoftware/iot-manager/client/iothub/mocks"
+	"github.com/mendersoftware/iot-manager/crypto"
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+	storeMocks "github.com/mendersoftware/iot-manager/store/mocks"
+)
+
+func TestRedeliverEvent(t *testing.T) {
+	t.Parallel()
+	const deviceID = "68ac6f41-c2e7-429f-a4bd-852fac9a5045"
+	webhookID := uuid.New()
+	hubID := uuid.New()
+	coreID := uuid.New()
+	hubIntegration := &model.Integration{
+		ID:       hubID,
+		Provider: model.ProviderIoTHub,
+		Credentials: model.Credentials{
+			Type:             model.CredentialTypeSAS,
+			ConnectionString: validConnString,
+		},
+	}
+	coreIntegration := &model.Integration{
+		ID:       coreID,
+		Provider: model.ProviderIoTCore,
+		Credentials: model.Credentials{
+			Type: model.CredentialTypeAWS,
+			AWSCredentials: &model.AWSCredentials{
+				AccessKeyID: func() *string {
+					s := "1234567890"
+					return &s
+				}(),
+				SecretAccessKey: func() *crypto.String {
+					var s crypto.String = "1234567890"
+					return &s
+				}(),
+				Region: func() *string {
+					s := "eu-north-south-1"
+					return &s
+				}(),
+				DevicePolicyName: func() *string {
+					s := "gibAccess"
+					return &s
+				}(),
+			},
+		},
+	}
+	newEvent := func(typ model.EventType) *model.Event {
+		statusCode := http.StatusBadGateway
+		return &model.Event{
+			WebhookEvent: model.WebhookEvent{
+				ID:   uuid.New(),
+				Type: typ,
+				// Stored events decode the payload as a generic document
+				Data: map[string]interface{}{
+					"id":     deviceID,
+					"status": "accepted",
+				},
+			},
+			DeliveryStatus: []model.DeliveryStatus{{
+				IntegrationID: webhookID,
+				Error:         "502 Bad Gateway",
+				StatusCode:    &statusCode,
+				Attempts: []model.DeliveryAttempt{{
+					Error:      "502 Bad Gateway",
+					StatusCode: &statusCode,
+					Timestamp:  time.Now().Add(-time.Hour),
+				}},
+			}, {
+				IntegrationID: hubID,
+				Error:         "internal error",
+			}, {
+				IntegrationID: coreID,
+				Success:       true,
+			}},
+		}
+	}
+
+	type testCase struct {
+		Name string
+
+		Event         *model.Event
+		IntegrationID uuid.UUID
+		Force         bool
+
+		Store func(t *testing.T, self *testCase) *storeMocks.DataStore
+		Hub   func(t *testing.T, self *testCase) *hubMocks.Client
+		Core  func(t *testing.T, self *testCase) *coreMocks.Client
+
+		Result func(t *testing.T, event *model.Event)
+		Error  error
+	}
+	testCases := []testCase{{
+		Name: "ok, decommissioned",
+
+		Event: newEvent(model.EventTypeDeviceDecommissioned),
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(self.Event, nil).
+				Once().
+				On("GetIntegrationById", contextMatcher, webhookID).
+				Return(newWebhookIntegration(webhookID), nil).
+				Once().
+				On("ClaimEventDelivery", contextMatcher, self.Event.ID, webhookID,
+					mock.AnythingOfType("time.Duration")).
+				Return(nil, store.ErrObjectNotFound).
+				Once().
+				On("GetIntegrationById", contextMatcher, hubID).
+				Return(hubIntegration, nil).
+				Once().
+				On("UpdateEventDeliveryStatus", contextMatcher, self.Event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return status.IntegrationID == webhookID &&
+							status.Success &&
+							len(status.Attempts) == 1
+					})).
+				Return(nil).
+				Once().
+				On("UpdateEventDeliveryStatus", contextMatcher, self.Event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return status.IntegrationID == hubID &&
+							status.Success &&
+							len(status.Attempts) == 1
+					})).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice", contextMatcher, validConnString, deviceID).
+				Return(nil).
+				Once()
+			return hub
+		},
+		Result: func(t *testing.T, event *model.Event) {
+			if assert.Len(t, event.DeliveryStatus, 3) {
+				for _, status := range event.DeliveryStatus {
+					assert.True(t, status.Success)
+					assert.Empty(t, status.Error)
+				}
+				assert.Len(t, event.DeliveryStatus[0].Attempts, 2)
+				assert.Len(t, event.DeliveryStatus[1].Attempts, 1)
+				assert.Len(t, event.DeliveryStatus[2].Attempts, 0)
+			}
+		},
+	}, {
+		Name: "ok, provisioned with integration filter",
+
+		Event: func() *model.Event {
+			event := newEvent(model.EventTypeDeviceProvisioned)
+			event.DeliveryStatus[2].Success = false
+			return event
+		}(),
+		IntegrationID: coreID,
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(self.Event, nil).
+				Once().
+				On("GetIntegrationById", contextMatcher, coreID).
+				Return(coreIntegration, nil).
+				Once().
+				On("UpsertDeviceIntegrations", contextMatcher, deviceID,
+					[]uuid.UUID{coreID}).
+				Return(new(model.Device), nil).
+				Once().
+				On("UpdateEventDeliveryStatus", contextMatcher, self.Event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return status.IntegrationID == coreID && status.Success
+					})).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Core: func(t *testing.T, self *testCase) *coreMocks.Client {
+			core := new(coreMocks.Client)
+			core.On("UpsertDevice", contextMatcher,
+				*coreIntegration.Credentials.AWSCredentials,
+				deviceID,
+				&iotcore.Device{Status: iotcore.StatusEnabled},
+				"gibAccess").
+				Return(&iotcore.Device{}, nil).
+				Once()
+			return core
+		},
+		Result: func(t *testing.T, event *model.Event) {
+			if assert.Len(t, event.DeliveryStatus, 3) {
+				assert.False(t, event.DeliveryStatus[0].Success)
+				assert.False(t, event.DeliveryStatus[1].Success)
+				assert.True(t, event.DeliveryStatus[2].Success)
+			}
+		},
+	}, {
+		Name: "ok, integrations removed",
+
+		Event: newEvent(model.EventTypeDeviceStatusChanged),
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(self.Event, nil).
+				Once().
+				On("GetIntegrationById", contextMatcher, mock.AnythingOfType("uuid.UUID")).
+				Return(nil, store.ErrObjectNotFound).
+				Twice().
+				On("UpdateEventDeliveryStatus", contextMatcher, self.Event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return !status.Success &&
+							status.Error == ErrIntegrationNotFound.Error()
+					})).
+				Return(nil).
+				Twice()
+			return ds
+		},
+		Result: func(t *testing.T, event *model.Event) {
+			if assert.Len(t, event.DeliveryStatus, 3) {
+				assert.False(t, event.DeliveryStatus[0].Success)
+				assert.False(t, event.DeliveryStatus[1].Success)
+			}
+		},
+	}, {
+		Name: "ok, pending retry claimed",
+
+		Event:         newEvent(model.EventTypeDeviceStatusChanged),
+		IntegrationID: webhookID,
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			delivery := &model.Delivery{
+				ID:            uuid.New(),
+				EventID:       self.Event.ID,
+				IntegrationID: webhookID,
+				Attempts:      2,
+			}
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(self.Event, nil).
+				Once().
+				On("GetIntegrationById", contextMatcher, webhookID).
+				Return(newWebhookIntegration(webhookID), nil).
+				Once().
+				On("ClaimEventDelivery", contextMatcher, self.Event.ID, webhookID,
+					mock.AnythingOfType("time.Duration")).
+				Return(delivery, nil).
+				Once().
+				On("UpdateEventDeliveryStatus", contextMatcher, self.Event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return status.IntegrationID == webhookID && status.Success
+					})).
+				Return(nil).
+				Once().
+				On("DeleteDelivery", contextMatcher, delivery.ID).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Result: func(t *testing.T, event *model.Event) {
+			if assert.Len(t, event.DeliveryStatus, 3) {
+				assert.True(t, event.DeliveryStatus[0].Success)
+				assert.False(t, event.DeliveryStatus[1].Success)
+			}
+		},
+	}, {
+		Name: "ok, first attempt in progress",
+
+		Event: func() *model.Event {
+			event := newEvent(model.EventTypeDeviceStatusChanged)
+			event.DeliveryStatus[0] = pendingDelivery(webhookID)
+			return event
+		}(),
+		IntegrationID: webhookID,
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(self.Event, nil).
+				Once()
+			return ds
+		},
+		Result: func(t *testing.T, event *model.Event) {
+			if assert.Len(t, event.DeliveryStatus, 3) {
+				assert.True(t, event.DeliveryStatus[0].Pending)
+			}
+		},
+	}, {
+		Name: "error, retry in progress",
+
+		Event:         newEvent(model.EventTypeDeviceDecommissioned),
+		IntegrationID: webhookID,
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(self.Event, nil).
+				Once().
+				On("GetIntegrationById", contextMatcher, webhookID).
+				Return(newWebhookIntegration(webhookID), nil).
+				Once().
+				On("ClaimEventDelivery", contextMatcher, self.Event.ID, webhookID,
+					mock.AnythingOfType("time.Duration")).
+				Return(nil, store.ErrObjectLeased).
+				Once()
+			return ds
+		},
+		Error: ErrDeliveryInProgress,
+	}, {
+		Name: "ok, forced despite a newer event",
+
+		Event: func() *model.Event {
+			event := newEvent(model.EventTypeDeviceStatusChanged)
+			event.Sequence = 42
+			return event
+		}(),
+		IntegrationID: hubID,
+		Force:         true,
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(self.Event, nil).
+				Once().
+				On("GetIntegrationById", contextMatcher, hubID).
+				Return(hubIntegration, nil).
+				Once().
+				On("UpdateEventDeliveryStatus", contextMatcher, self.Event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return status.IntegrationID == hubID && status.Success
+					})).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("GetDevice", contextMatcher, validConnString, deviceID).
+				Return(&iothub.Device{
+					DeviceID: deviceID,
+					Status:   iothub.StatusEnabled,
+				}, nil).
+				Once()
+			return hub
+		},
+		Result: func(t *testing.T, event *model.Event) {
+			if assert.Len(t, event.DeliveryStatus, 3) {
+				assert.True(t, event.DeliveryStatus[1].Success)
+			}
+		},
+	}, {
+		Name: "error, newer event",
+
+		Event: func() *model.Event {
+			event := newEvent(model.EventTypeDeviceStatusChanged)
+			event.Sequence = 42
+			return event
+		}(),
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(self.Event, nil).
+				Once().
+				On("GetEvents", contextMatcher, model.EventsFilter{
+					Limit:         1,
+					Type:          model.EventTypeDeviceStatusChanged,
+					DeviceID:      deviceID,
+					IntegrationID: webhookID,
+					SequenceAfter: self.Event.Sequence,
+				}).
+				Return([]model.Event{}, nil).
+				Once().
+				On("GetEvents", contextMatcher, model.EventsFilter{
+					Limit:         1,
+					Type:          model.EventTypeDeviceStatusChanged,
+					DeviceID:      deviceID,
+					IntegrationID: hubID,
+					SequenceAfter: self.Event.Sequence,
+				}).
+				Return([]model.Event{{}}, nil).
+				Once()
+			return ds
+		},
+		Error: ErrEventOutdated,
+	}, {
+		Name: "error, event not found",
+
+		Event: newEvent(model.EventTypeDeviceDecommissioned),
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			return ds
+		},
+		Error: ErrEventNotFound,
+	}, {
+		Name: "error, updating delivery status",
+
+		Event:         newEvent(model.EventTypeDeviceDecommissioned),
+		IntegrationID: hubID,
+		Store: func(t *testing.T, self *testCase) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetEvent", contextMatcher, self.Event.ID).
+				Return(self.Event, nil).
+				Once().
+				On("GetIntegrationById", contextMatcher, hubID).
+				Return(hubIntegration, nil).
+				Once().
+				On("UpdateEventDeliveryStatus", contextMatcher, self.Event.ID,
+					mock.AnythingOfType("model.DeliveryStatus")).
+				Return(errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Hub: func(t *testing.T, self *testCase) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice", contextMatcher, validConnString, deviceID).
+				Return(errors.New("internal error")).
+				Once()
+			return hub
+		},
+		Error: errors.New("failed to update event delivery status: internal error"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ds := tc.Store(t, &tc)
+			defer ds.AssertExpectations(t)
+			hub := new(hubMocks.Client)
+			if tc.Hub != nil {
+				hub = tc.Hub(t, &tc)
+			}
+			defer hub.AssertExpectations(t)
+			core := new(coreMocks.Client)
+			if tc.Core != nil {
+				core = tc.Core(t, &tc)
+			}
+			defer core.AssertExpectations(t)
+
+			a := &app{
+				store:           ds,
+				iothubClient:    hub,
+				iotcoreClient:   core,
+				httpClient:      newStatusRoundTripper(http.StatusOK),
+				webhooksTimeout: time.Second,
+			}
+			event, err := a.RedeliverEvent(context.Background(),
+				tc.Event.ID, tc.IntegrationID, tc.Force)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else if assert.NoError(t, err) {
+				tc.Result(t, event)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/iot-manager/client/devauth"
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+)
+
+// selectDevices detaches the devices not matching the integration selector
+// from the integration and returns the remaining device IDs and device
+// authentications.
+func (a *app) selectDevices(
+	ctx context.Context,
+	integration model.Integration,
+	deviceIDs []string,
+	devAuths []devauth.Device,
+	failEarly bool,
+) ([]string, []devauth.Device, error) {
+	if len(integration.Selector) == 0 {
+		return deviceIDs, devAuths, nil
+	}
+	l := log.FromContext(ctx)
+
+	deselected := make(map[string]struct{})
+	selected := make([]devauth.Device, 0, len(devAuths))
+	for _, auth := range devAuths {
+		if integration.Selector.Match(auth.IdentityData) {
+			selected = append(selected, auth)
+			continue
+		}
+		deselected[auth.ID] = struct{}{}
+		l.Warnf("Device '%s' does not match the integration selector: "+
+			"removing device from integration", auth.ID)
+		err := a.detachDevice(ctx, auth.ID, integration)
+		if err != nil && !errors.Is(err, store.ErrObjectNotFound) {
+			err = errors.Wrap(err, "app: failed to detach device")
+			if failEarly {
+				return nil, nil, err
+			}
+			l.Error(err)
+		}
+	}
+	if len(deselected) == 0 {
+		return deviceIDs, devAuths, nil
+	}
+	ids := make([]string, 0, len(selected))
+	for _, id := range deviceIDs {
+		if _, ok := deselected[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, selected, nil
+}
+
+// checkSelectorOverlap returns ErrSelectorOverlap if a device may match the
+// selectors of both the integration and another IoT Hub or IoT Core
+// integration of the same provider: the credentials of the device are
+// stored in the device configuration under the same keys, so the device
+// would only keep the credentials of the last integration provisioning it.
+func (a *app) checkSelectorOverlap(
+	ctx context.Context,
+	integration model.Integration,
+) error {
+	switch integration.Provider {
+	case model.ProviderIoTHub, model.ProviderIoTCore:
+	default:
+		return nil
+	}
+	integrations, err := a.store.GetIntegrations(ctx, model.IntegrationFilter{
+		Provider: integration.Provider,
+	})
+	if err != nil && !errors.Is(err, store.ErrObjectNotFound) {
+		return errors.Wrap(err, "app: failed to retrieve integrations")
+	}
+	for _, other := range integrations {
+		if other.ID != integration.ID && other.Selector.Overlaps(integration.Selector) {
+			return ErrSelectorOverlap
+		}
+	}
+	return nil
+}
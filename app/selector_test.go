@@ -0,0 +1,183 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/iot-manager/client/devauth"
+	hubMocks "github.com/mendersoftware/iot-manager/client/iothub/mocks"
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+	storeMocks "github.com/mendersoftware/iot-manager/store/mocks"
+)
+
+func TestSelectDevices(t *testing.T) {
+	t.Parallel()
+	selector := model.DeviceSelector{{
+		Key:   "device_type",
+		Op:    model.SelectorOpEqual,
+		Value: "gateway",
+	}}
+	gateway := devauth.Device{
+		ID:     "1",
+		Status: model.StatusAccepted,
+		IdentityData: map[string]interface{}{
+			"device_type": "gateway",
+		},
+	}
+	sensor := devauth.Device{
+		ID:     "2",
+		Status: model.StatusAccepted,
+		IdentityData: map[string]interface{}{
+			"device_type": "sensor",
+		},
+	}
+	testCases := []struct {
+		Name string
+
+		Selector  model.DeviceSelector
+		DeviceIDs []string
+		DevAuths  []devauth.Device
+		FailEarly bool
+
+		Store func(t *testing.T) *storeMocks.DataStore
+		Hub   func(t *testing.T) *hubMocks.Client
+
+		ResultIDs      []string
+		ResultDevAuths []devauth.Device
+		Error          error
+	}{{
+		Name: "ok, no selector",
+
+		DeviceIDs: []string{"1", "2", "3"},
+		DevAuths:  []devauth.Device{gateway, sensor},
+
+		ResultIDs:      []string{"1", "2", "3"},
+		ResultDevAuths: []devauth.Device{gateway, sensor},
+	}, {
+		Name: "ok, all devices match",
+
+		Selector:  selector,
+		DeviceIDs: []string{"1", "3"},
+		DevAuths:  []devauth.Device{gateway},
+
+		ResultIDs:      []string{"1", "3"},
+		ResultDevAuths: []devauth.Device{gateway},
+	}, {
+		Name: "ok, device detached",
+
+		Selector:  selector,
+		DeviceIDs: []string{"1", "2", "3"},
+		DevAuths:  []devauth.Device{gateway, sensor},
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("RemoveDeviceIntegration",
+				contextMatcher,
+				"2",
+				testHubIntegration.ID).
+				Return(store.ErrObjectNotFound).
+				Once()
+			return ds
+		},
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice", contextMatcher, validConnString, "2").
+				Return(nil).
+				Once()
+			return hub
+		},
+
+		ResultIDs:      []string{"1", "3"},
+		ResultDevAuths: []devauth.Device{gateway},
+	}, {
+		Name: "ok, failed to detach device",
+
+		Selector:  selector,
+		DeviceIDs: []string{"1", "2"},
+		DevAuths:  []devauth.Device{gateway, sensor},
+
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice", contextMatcher, validConnString, "2").
+				Return(errors.New("internal error")).
+				Once()
+			return hub
+		},
+
+		ResultIDs:      []string{"1"},
+		ResultDevAuths: []devauth.Device{gateway},
+	}, {
+		Name: "error, failed to detach device",
+
+		Selector:  selector,
+		DeviceIDs: []string{"1", "2"},
+		DevAuths:  []devauth.Device{gateway, sensor},
+		FailEarly: true,
+
+		Hub: func(t *testing.T) *hubMocks.Client {
+			hub := new(hubMocks.Client)
+			hub.On("DeleteDevice", contextMatcher, validConnString, "2").
+				Return(errors.New("internal error")).
+				Once()
+			return hub
+		},
+
+		Error: errors.New("app: failed to detach device: " +
+			"failed to delete IoT Hub device: internal error"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ds := new(storeMocks.DataStore)
+			if tc.Store != nil {
+				ds = tc.Store(t)
+			}
+			defer ds.AssertExpectations(t)
+			hub := new(hubMocks.Client)
+			if tc.Hub != nil {
+				hub = tc.Hub(t)
+			}
+			defer hub.AssertExpectations(t)
+
+			a := &app{
+				store:        ds,
+				iothubClient: hub,
+			}
+			integration := testHubIntegration
+			integration.Selector = tc.Selector
+			ids, auths, err := a.selectDevices(
+				context.Background(),
+				integration,
+				tc.DeviceIDs,
+				tc.DevAuths,
+				tc.FailEarly,
+			)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.ResultIDs, ids)
+				assert.Equal(t, tc.ResultDevAuths, auths)
+			}
+		})
+	}
+}
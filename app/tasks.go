@@ -0,0 +1,433 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/iot-manager/metrics"
+	"github.com/mendersoftware/iot-manager/tracing"
+)
+
+var (
+	ErrTooManyTasks = errors.New("too many pending device events, try again later")
+	ErrShuttingDown = errors.New("the service is shutting down")
+)
+
+// queuedTask is a task waiting in the pool.
+type queuedTask struct {
+	run func()
+	// supersedes is set if the task replaces the latest pending task of
+	// the device when that task has it set as well, e.g. a status change
+	// superseding an older status change.
+	supersedes bool
+	// batch is set if the task can be processed together with the ready
+	// tasks of other devices of the tenant with the same batch: the tasks
+	// are then passed to runBatch of the first task instead of run.
+	batch    string
+	runBatch func(tasks []*queuedTask)
+	// done is called once the task completes or is superseded.
+	done func()
+
+	deviceID string
+	seq      int64
+}
+
+// deviceQueue holds the pending tasks of a device; the tasks of a device
+// run one at a time in the order they were submitted.
+type deviceQueue struct {
+	tasks   []*queuedTask
+	running bool
+}
+
+type tenantQueue struct {
+	devices map[string]*deviceQueue
+	// ready holds the devices with pending tasks and no running task.
+	ready  []string
+	queued int
+}
+
+// taskPool runs the asynchronous tasks on a fixed number of workers. The
+// tasks are queued per tenant and device: the workers take turns between
+// the tenants so that a tenant with many pending tasks does not delay the
+// tasks of the others, and never run two tasks of the same device
+// concurrently so that the events of a device are processed in order.
+type taskPool struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	queues map[string]*tenantQueue
+	// tenants holds the tenants with ready devices in round-robin order.
+	tenants []string
+	queued  int
+	closed  bool
+
+	queueSize       int
+	tenantQueueSize int
+	batchSize       int
+
+	workers sync.WaitGroup
+}
+
+func newTaskPool(workers, queueSize, tenantQueueSize, batchSize int) *taskPool {
+	pool := &taskPool{
+		queues:          make(map[string]*tenantQueue),
+		queueSize:       queueSize,
+		tenantQueueSize: tenantQueueSize,
+		batchSize:       batchSize,
+	}
+	pool.cond = sync.NewCond(&pool.mu)
+	pool.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+// submit queues the task of the device, it returns ErrTooManyTasks if
+// either the pool or the tenant queue is full.
+func (p *taskPool) submit(tenantID, deviceID string, task *queuedTask) error {
+	task.deviceID = deviceID
+	return p.submitAll(tenantID, []*queuedTask{task})
+}
+
+// submitAll queues the tasks of the tenant, with their device ID set, all
+// at once: it returns ErrTooManyTasks without queuing any task if either
+// the pool or the tenant queue cannot hold them all.
+func (p *taskPool) submitAll(tenantID string, tasks []*queuedTask) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrShuttingDown
+	}
+	tq := p.queues[tenantID]
+	if tq == nil {
+		tq = &tenantQueue{devices: make(map[string]*deviceQueue)}
+	}
+	// Reserve the slots of the tasks not superseding a pending task,
+	// including the tasks submitted together.
+	var slots int
+	lastSupersedes := make(map[string]bool)
+	for _, task := range tasks {
+		last, ok := lastSupersedes[task.deviceID]
+		if dq := tq.devices[task.deviceID]; !ok && dq != nil && len(dq.tasks) > 0 {
+			last = dq.tasks[len(dq.tasks)-1].supersedes
+		}
+		if !task.supersedes || !last {
+			slots++
+		}
+		lastSupersedes[task.deviceID] = task.supersedes
+	}
+	if p.queued+slots > p.queueSize || tq.queued+slots > p.tenantQueueSize {
+		return ErrTooManyTasks
+	}
+	p.queues[tenantID] = tq
+	for _, task := range tasks {
+		p.enqueue(tenantID, tq, task)
+	}
+	return nil
+}
+
+// enqueue adds the task to the queue of its device, or replaces the latest
+// pending task of the device if the task supersedes it.
+func (p *taskPool) enqueue(tenantID string, tq *tenantQueue, task *queuedTask) {
+	dq := tq.devices[task.deviceID]
+	if dq == nil {
+		dq = new(deviceQueue)
+		tq.devices[task.deviceID] = dq
+	}
+	if task.supersedes && len(dq.tasks) > 0 {
+		if last := dq.tasks[len(dq.tasks)-1]; last.supersedes {
+			dq.tasks[len(dq.tasks)-1] = task
+			last.done()
+			return
+		}
+	}
+	dq.tasks = append(dq.tasks, task)
+	tq.queued++
+	p.queued++
+	if !dq.running && len(dq.tasks) == 1 {
+		p.setReady(tenantID, tq, task.deviceID)
+	}
+}
+
+// setReady schedules the next task of the device.
+func (p *taskPool) setReady(tenantID string, tq *tenantQueue, deviceID string) {
+	tq.ready = append(tq.ready, deviceID)
+	if len(tq.ready) == 1 {
+		p.tenants = append(p.tenants, tenantID)
+	}
+	p.cond.Signal()
+}
+
+// next blocks until a task is ready and returns the task of the next
+// tenant in turn, together with the ready tasks of the same batch. It
+// returns false once the pool is drained.
+func (p *taskPool) next() (tenantID string, tasks []*queuedTask, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.tenants) == 0 {
+		if p.closed && p.queued == 0 {
+			return "", nil, false
+		}
+		p.cond.Wait()
+	}
+	tenantID = p.tenants[0]
+	p.tenants = p.tenants[1:]
+	tq := p.queues[tenantID]
+	task := p.take(tq, tq.ready[0])
+	tq.ready = tq.ready[1:]
+	tasks = []*queuedTask{task}
+	if task.batch != "" {
+		ready := tq.ready[:0]
+		for _, deviceID := range tq.ready {
+			next := tq.devices[deviceID].tasks[0]
+			if len(tasks) < p.batchSize && next.batch == task.batch {
+				tasks = append(tasks, p.take(tq, deviceID))
+			} else {
+				ready = append(ready, deviceID)
+			}
+		}
+		tq.ready = ready
+	}
+	if len(tq.ready) > 0 {
+		p.tenants = append(p.tenants, tenantID)
+	}
+	return tenantID, tasks, true
+}
+
+// take dequeues the next task of the ready device.
+func (p *taskPool) take(tq *tenantQueue, deviceID string) *queuedTask {
+	dq := tq.devices[deviceID]
+	task := dq.tasks[0]
+	dq.tasks[0] = nil
+	dq.tasks = dq.tasks[1:]
+	dq.running = true
+	tq.queued--
+	p.queued--
+	return task
+}
+
+// complete schedules the next task of the device after a task completed.
+func (p *taskPool) complete(tenantID, deviceID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tq := p.queues[tenantID]
+	dq := tq.devices[deviceID]
+	dq.running = false
+	if len(dq.tasks) > 0 {
+		p.setReady(tenantID, tq, deviceID)
+	} else {
+		delete(tq.devices, deviceID)
+		if len(tq.devices) == 0 {
+			delete(p.queues, tenantID)
+		}
+	}
+	if p.closed {
+		// Wake up the idle workers to exit if this was the last task.
+		p.cond.Broadcast()
+	}
+}
+
+func (p *taskPool) work() {
+	defer p.workers.Done()
+	for {
+		tenantID, tasks, ok := p.next()
+		if !ok {
+			return
+		}
+		if len(tasks) > 1 {
+			tasks[0].runBatch(tasks)
+		} else {
+			tasks[0].run()
+		}
+		for _, task := range tasks {
+			task.done()
+			p.complete(tenantID, task.deviceID)
+		}
+	}
+}
+
+// drain stops accepting tasks and waits until the queued tasks complete
+// or the context is done.
+func (p *taskPool) drain(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *app) WithAsyncWorkers(workers, queueSize, tenantQueueSize, batchSize uint) App {
+	if workers > 0 {
+		if batchSize < 1 {
+			batchSize = 1
+		}
+		a.tasks = newTaskPool(
+			int(workers), int(queueSize), int(tenantQueueSize), int(batchSize),
+		)
+	}
+	return a
+}
+
+func (a *app) DrainTasks(ctx context.Context) error {
+	if a.tasks == nil {
+		return nil
+	}
+	return a.tasks.drain(ctx)
+}
+
+// asyncTask is a device event processed in the background.
+type asyncTask struct {
+	// name is the name of the span of the task.
+	name string
+	// metric is the task label of the metrics.
+	metric   string
+	deviceID string
+	// seq is the sequence number of the event, assigned when the task is
+	// submitted so that it follows the order of the requests.
+	seq int64
+	// supersedes is set if the task makes a pending task of the device
+	// with the flag set obsolete, e.g. a newer status change.
+	supersedes bool
+	run        func(ctx context.Context) error
+	// batch is set if the pending tasks of the devices with the same
+	// batch can be processed together by runBatch.
+	batch    string
+	runBatch func(ctx context.Context, events []deviceEvent) error
+}
+
+// deviceEvent identifies the event of a device in a batch of tasks.
+type deviceEvent struct {
+	deviceID string
+	seq      int64
+}
+
+// runAsync runs the tasks in the background with the identity of the
+// request and a timeout starting when the task is executed; the batches of
+// tasks bound each of their calls with callContext instead. The span of
+// the task is linked to the span of the request. The tasks are queued all
+// at once: none is queued if the pool cannot hold them all.
+func (a *app) runAsync(ctx context.Context, tasks ...asyncTask) error {
+	id := identity.FromContext(ctx)
+	exec := func(name string, timeout time.Duration, f func(ctx context.Context) error) {
+		var (
+			ctxWithTimeout context.Context
+			cancel         context.CancelFunc
+		)
+		if timeout > 0 {
+			ctxWithTimeout, cancel = context.WithTimeout(context.Background(), timeout)
+		} else {
+			ctxWithTimeout, cancel = context.WithCancel(context.Background())
+		}
+		ctxWithTimeout = identity.WithContext(ctxWithTimeout, id)
+		defer cancel()
+		ctxWithTimeout, span := tracing.StartLinkedSpan(ctxWithTimeout, ctx, name)
+		defer span.End()
+		runAndLogError(ctxWithTimeout, func() error {
+			return f(ctxWithTimeout)
+		})
+	}
+	if a.tasks == nil {
+		for i := range tasks {
+			task := tasks[i]
+			done := metrics.TrackAsyncTask(task.metric)
+			go func() {
+				defer done()
+				exec(task.name, a.webhooksTimeout, task.run)
+			}()
+		}
+		return nil
+	}
+	var tenantID string
+	if id != nil {
+		tenantID = id.Tenant
+	}
+	queued := make([]*queuedTask, len(tasks))
+	for i := range tasks {
+		task := tasks[i]
+		queued[i] = &queuedTask{
+			run: func() {
+				exec(task.name, a.webhooksTimeout, task.run)
+			},
+			supersedes: task.supersedes,
+			done:       metrics.TrackAsyncTask(task.metric),
+			deviceID:   task.deviceID,
+			seq:        task.seq,
+		}
+		if task.runBatch != nil {
+			queued[i].batch = task.batch
+			queued[i].runBatch = func(tasks []*queuedTask) {
+				events := make([]deviceEvent, len(tasks))
+				for i, t := range tasks {
+					events[i] = deviceEvent{deviceID: t.deviceID, seq: t.seq}
+				}
+				exec(task.name, 0, func(ctx context.Context) error {
+					return task.runBatch(ctx, events)
+				})
+			}
+		}
+	}
+	err := a.tasks.submitAll(tenantID, queued)
+	if err != nil {
+		for _, task := range queued {
+			task.done()
+		}
+	}
+	return err
+}
+
+// callContext returns the context of a call made by a task, with the time
+// budget of a task: the bulk requests of a batch get the same timeout
+// whatever the number of devices in the batch.
+func (a *app) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.webhooksTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, a.webhooksTimeout)
+}
+
+// reserveEventSequence reserves n consecutive sequence numbers for the
+// events of the tenant and returns the first one. The numbers are taken
+// from the store when the events are submitted, not when their tasks run,
+// so that they follow the order of the requests across all the instances
+// of the service.
+func (a *app) reserveEventSequence(ctx context.Context, n int) (int64, error) {
+	seq, err := a.store.ReserveEventSequence(ctx, n)
+	if err != nil {
+		return 0, errors.Wrap(err, "app: failed to reserve event sequence")
+	}
+	return seq, nil
+}
@@ -0,0 +1,512 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/iot-manager/model"
+	storeMocks "github.com/mendersoftware/iot-manager/store/mocks"
+)
+
+// newQueuedTask returns a task appending the name to the order.
+func newQueuedTask(order *[]string, name string) *queuedTask {
+	return &queuedTask{
+		run:  func() { *order = append(*order, name) },
+		done: func() {},
+	}
+}
+
+// runNext runs the next task of the pool.
+func runNext(t *testing.T, pool *taskPool) {
+	tenantID, tasks, ok := pool.next()
+	require.True(t, ok)
+	require.Len(t, tasks, 1)
+	tasks[0].run()
+	tasks[0].done()
+	pool.complete(tenantID, tasks[0].deviceID)
+}
+
+func TestTaskPoolFairness(t *testing.T) {
+	t.Parallel()
+	pool := newTaskPool(0, 10, 10, 1)
+
+	var order []string
+	require.NoError(t, pool.submit("big", "dev1", newQueuedTask(&order, "big-1")))
+	require.NoError(t, pool.submit("big", "dev2", newQueuedTask(&order, "big-2")))
+	require.NoError(t, pool.submit("big", "dev3", newQueuedTask(&order, "big-3")))
+	require.NoError(t, pool.submit("small", "dev1", newQueuedTask(&order, "small-1")))
+	require.NoError(t, pool.submit("other", "dev1", newQueuedTask(&order, "other-1")))
+	require.NoError(t, pool.submit("small", "dev2", newQueuedTask(&order, "small-2")))
+
+	for i := 0; i < 6; i++ {
+		runNext(t, pool)
+	}
+	assert.Equal(t, []string{
+		"big-1", "small-1", "other-1", "big-2", "small-2", "big-3",
+	}, order)
+	assert.Empty(t, pool.queues)
+}
+
+func TestTaskPoolDeviceOrder(t *testing.T) {
+	t.Parallel()
+	pool := newTaskPool(0, 10, 10, 1)
+
+	var order []string
+	require.NoError(t, pool.submit("tenant", "dev1", newQueuedTask(&order, "dev1-1")))
+	require.NoError(t, pool.submit("tenant", "dev1", newQueuedTask(&order, "dev1-2")))
+	require.NoError(t, pool.submit("tenant", "dev2", newQueuedTask(&order, "dev2-1")))
+
+	tenantID, tasks, ok := pool.next()
+	require.True(t, ok)
+	assert.Equal(t, "dev1", tasks[0].deviceID)
+	// The second task of dev1 must wait for the first one to complete.
+	runNext(t, pool)
+	assert.Empty(t, pool.tenants, "no task must be ready while dev1 is busy")
+
+	tasks[0].run()
+	pool.complete(tenantID, tasks[0].deviceID)
+	runNext(t, pool)
+	assert.Equal(t, []string{"dev2-1", "dev1-1", "dev1-2"}, order)
+}
+
+func TestTaskPoolSupersede(t *testing.T) {
+	t.Parallel()
+	pool := newTaskPool(0, 10, 10, 1)
+
+	var (
+		order      []string
+		superseded []string
+	)
+	status := func(name string) *queuedTask {
+		task := newQueuedTask(&order, name)
+		task.supersedes = true
+		task.done = func() { superseded = append(superseded, name) }
+		return task
+	}
+	require.NoError(t, pool.submit("tenant", "dev1", status("accepted")))
+	tenantID, running, ok := pool.next()
+	require.True(t, ok)
+
+	require.NoError(t, pool.submit("tenant", "dev1", status("rejected")))
+	require.NoError(t, pool.submit("tenant", "dev1", status("accepted-again")))
+	require.NoError(t, pool.submit("tenant", "dev1", newQueuedTask(&order, "decommission")))
+	require.NoError(t, pool.submit("tenant", "dev1", status("noauth")))
+	assert.Equal(t, []string{"rejected"}, superseded,
+		"the running task must not be superseded")
+	assert.Equal(t, 3, pool.queued)
+
+	running[0].run()
+	pool.complete(tenantID, running[0].deviceID)
+	for i := 0; i < 3; i++ {
+		runNext(t, pool)
+	}
+	assert.Equal(t, []string{
+		"accepted", "accepted-again", "decommission", "noauth",
+	}, order)
+}
+
+func TestTaskPoolBatch(t *testing.T) {
+	t.Parallel()
+	pool := newTaskPool(0, 10, 10, 3)
+
+	var order []string
+	status := func(name, batch string) *queuedTask {
+		task := newQueuedTask(&order, name)
+		task.batch = batch
+		task.runBatch = func(tasks []*queuedTask) {
+			var deviceIDs []string
+			for _, task := range tasks {
+				deviceIDs = append(deviceIDs, task.deviceID)
+			}
+			order = append(order, fmt.Sprint(deviceIDs))
+		}
+		return task
+	}
+	require.NoError(t, pool.submit("tenant", "dev1", status("dev1-accepted", "accepted")))
+	require.NoError(t, pool.submit("tenant", "dev2", status("dev2-accepted", "accepted")))
+	require.NoError(t, pool.submit("tenant", "dev3", newQueuedTask(&order, "dev3-provision")))
+	require.NoError(t, pool.submit("tenant", "dev3", status("dev3-accepted", "accepted")))
+	require.NoError(t, pool.submit("tenant", "dev4", status("dev4-rejected", "rejected")))
+	require.NoError(t, pool.submit("tenant", "dev5", status("dev5-accepted", "accepted")))
+	require.NoError(t, pool.submit("tenant", "dev6", status("dev6-accepted", "accepted")))
+	require.NoError(t, pool.submit("other", "dev1", status("other-accepted", "accepted")))
+
+	// The batch is limited to three devices and skips the devices whose
+	// next task belongs to another batch.
+	tenantID, tasks, ok := pool.next()
+	require.True(t, ok)
+	assert.Equal(t, "tenant", tenantID)
+	if assert.Len(t, tasks, 3) {
+		tasks[0].runBatch(tasks)
+	}
+	assert.Equal(t, []string{"[dev1 dev2 dev5]"}, order)
+	for _, task := range tasks {
+		pool.complete(tenantID, task.deviceID)
+	}
+
+	order = nil
+	for pool.queued > 0 {
+		tenantID, tasks, ok := pool.next()
+		require.True(t, ok)
+		if len(tasks) > 1 {
+			tasks[0].runBatch(tasks)
+		} else {
+			tasks[0].run()
+		}
+		for _, task := range tasks {
+			pool.complete(tenantID, task.deviceID)
+		}
+	}
+	assert.Equal(t, []string{
+		"other-accepted", "dev3-provision", "dev4-rejected", "[dev6 dev3]",
+	}, order)
+}
+
+func TestTaskPoolLimits(t *testing.T) {
+	t.Parallel()
+	pool := newTaskPool(0, 3, 2, 1)
+	noop := func() *queuedTask {
+		return &queuedTask{run: func() {}, done: func() {}}
+	}
+
+	require.NoError(t, pool.submit("tenant1", "dev1", noop()))
+	require.NoError(t, pool.submit("tenant1", "dev2", noop()))
+	assert.ErrorIs(t, pool.submit("tenant1", "dev3", noop()), ErrTooManyTasks)
+
+	require.NoError(t, pool.submit("tenant2", "dev1", noop()))
+	assert.ErrorIs(t, pool.submit("tenant3", "dev1", noop()), ErrTooManyTasks)
+	assert.NotContains(t, pool.queues, "tenant3")
+
+	runNext(t, pool)
+	assert.NoError(t, pool.submit("tenant3", "dev1", noop()))
+}
+
+func TestTaskPoolSubmitAll(t *testing.T) {
+	t.Parallel()
+	pool := newTaskPool(0, 4, 3, 1)
+	var superseded int
+	task := func(deviceID string, supersedes bool) *queuedTask {
+		return &queuedTask{
+			run:        func() {},
+			done:       func() { superseded++ },
+			supersedes: supersedes,
+			deviceID:   deviceID,
+		}
+	}
+
+	require.NoError(t, pool.submit("tenant1", "dev1", task("dev1", true)))
+	assert.ErrorIs(t, pool.submitAll("tenant1", []*queuedTask{
+		task("dev2", true), task("dev3", true), task("dev4", true),
+	}), ErrTooManyTasks, "the batch exceeds the tenant queue")
+	assert.Equal(t, 1, pool.queued, "no task of the batch must be queued")
+	assert.Len(t, pool.queues["tenant1"].devices, 1)
+
+	// The status changes of dev1 supersede the pending one and the second
+	// status change of dev2 supersedes the first: they take two slots.
+	require.NoError(t, pool.submitAll("tenant1", []*queuedTask{
+		task("dev1", true), task("dev2", true), task("dev2", true), task("dev3", true),
+	}))
+	assert.Equal(t, 3, pool.queued)
+	assert.Equal(t, 2, superseded)
+
+	assert.ErrorIs(t, pool.submitAll("tenant2", []*queuedTask{
+		task("dev1", false), task("dev2", false),
+	}), ErrTooManyTasks, "the batch exceeds the pool queue")
+	assert.NotContains(t, pool.queues, "tenant2")
+	assert.Equal(t, 3, pool.queued)
+}
+
+func TestTaskPoolDrain(t *testing.T) {
+	t.Parallel()
+	pool := newTaskPool(2, 10, 10, 1)
+
+	done := make(chan string, 4)
+	for _, deviceID := range []string{"dev1", "dev1", "dev2", "dev2"} {
+		deviceID := deviceID
+		require.NoError(t, pool.submit("tenant", deviceID, &queuedTask{
+			run: func() {
+				time.Sleep(10 * time.Millisecond)
+				done <- deviceID
+			},
+			done: func() {},
+		}))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, pool.drain(ctx))
+	assert.Len(t, done, 4, "the queued tasks must complete before drain returns")
+	assert.ErrorIs(t,
+		pool.submit("tenant", "dev1", &queuedTask{run: func() {}, done: func() {}}),
+		ErrShuttingDown,
+	)
+}
+
+func TestTaskPoolDrainTimeout(t *testing.T) {
+	t.Parallel()
+	pool := newTaskPool(1, 10, 10, 1)
+
+	release := make(chan struct{})
+	defer close(release)
+	require.NoError(t, pool.submit("tenant", "dev1", &queuedTask{
+		run:  func() { <-release },
+		done: func() {},
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, pool.drain(ctx), context.DeadlineExceeded)
+}
+
+func TestRunAsync(t *testing.T) {
+	t.Parallel()
+	const tenantID = "123456789012345678901234"
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenantID,
+	})
+
+	a := New(nil, nil, nil).
+		WithWebhooksTimeout(1).
+		WithAsyncWorkers(1, 1, 1, 1).(*app)
+
+	release := make(chan struct{})
+	tenants := make(chan string, 2)
+	task := func(deviceID string) asyncTask {
+		return asyncTask{
+			name:     "test",
+			metric:   "test",
+			deviceID: deviceID,
+			run: func(ctx context.Context) error {
+				<-release
+				tenants <- identity.FromContext(ctx).Tenant
+				return nil
+			},
+		}
+	}
+	require.NoError(t, a.runAsync(ctx, task("dev1")))
+	// Wait for the worker to pick the task up before filling the queue.
+	require.Eventually(t, func() bool {
+		a.tasks.mu.Lock()
+		defer a.tasks.mu.Unlock()
+		return a.tasks.queued == 0
+	}, time.Second, time.Millisecond)
+	require.NoError(t, a.runAsync(ctx, task("dev2")))
+	assert.ErrorIs(t, a.runAsync(ctx, task("dev3")), ErrTooManyTasks)
+	close(release)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, a.DrainTasks(drainCtx))
+	assert.Equal(t, tenantID, <-tenants)
+	assert.Equal(t, tenantID, <-tenants)
+	assert.ErrorIs(t, a.runAsync(ctx, task("dev1")), ErrShuttingDown)
+}
+
+func TestRunAsyncBatchTimeout(t *testing.T) {
+	t.Parallel()
+	a := &app{
+		webhooksTimeout: time.Minute,
+		tasks:           newTaskPool(0, 10, 10, 10),
+	}
+
+	type deadlines struct {
+		task bool
+		call time.Time
+	}
+	result := make(chan deadlines, 1)
+	tasks := make([]asyncTask, 5)
+	for i := range tasks {
+		tasks[i] = asyncTask{
+			name:     "test",
+			metric:   "test",
+			deviceID: fmt.Sprintf("dev%d", i),
+			batch:    "test",
+			runBatch: func(ctx context.Context, events []deviceEvent) error {
+				_, hasDeadline := ctx.Deadline()
+				callCtx, cancel := a.callContext(ctx)
+				defer cancel()
+				callDeadline, _ := callCtx.Deadline()
+				result <- deadlines{task: hasDeadline, call: callDeadline}
+				return nil
+			},
+		}
+	}
+	require.NoError(t, a.runAsync(context.Background(), tasks...))
+	tenantID, batch, ok := a.tasks.next()
+	require.True(t, ok)
+	require.Len(t, batch, len(tasks))
+	batch[0].runBatch(batch)
+	for _, task := range batch {
+		task.done()
+		a.tasks.complete(tenantID, task.deviceID)
+	}
+
+	// The calls of the batch have the timeout of a single task whatever
+	// the size of the batch.
+	res := <-result
+	assert.False(t, res.task)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), res.call, 5*time.Second)
+
+	callCtx, cancel := (&app{}).callContext(context.Background())
+	defer cancel()
+	_, hasDeadline := callCtx.Deadline()
+	assert.False(t, hasDeadline, "no timeout configured")
+}
+
+func TestEventSequenceOnSubmit(t *testing.T) {
+	t.Parallel()
+	ds := new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	var sequences []int64
+	ds.On("ReserveEventSequence", contextMatcher, 1).
+		Return(int64(1), nil).
+		Once().
+		On("ReserveEventSequence", contextMatcher, 1).
+		Return(int64(2), nil).
+		Once().
+		On("ReserveEventSequence", contextMatcher, 2).
+		Return(int64(3), nil).
+		Once().
+		On("GetIntegrations", contextMatcher, model.IntegrationFilter{}).
+		Return([]model.Integration{}, nil).
+		Times(4).
+		On("DeleteDevice", contextMatcher, "dev1").
+		Return(nil).
+		Once().
+		On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+		Run(func(args mock.Arguments) {
+			sequences = append(sequences, args.Get(1).(model.Event).Sequence)
+		}).
+		Return(nil).
+		Times(4)
+
+	a := &app{
+		store:           ds,
+		webhooksTimeout: time.Second,
+		tasks:           newTaskPool(0, 10, 10, 1),
+	}
+	ctx := context.Background()
+	require.NoError(t, a.DecommissionDevice(ctx, "dev1"))
+	require.NoError(t, a.SetDeviceStatus(ctx, "dev2", model.StatusAccepted))
+	require.NoError(t, a.BulkSetDeviceStatus(ctx,
+		[]string{"dev3", "dev4"}, model.StatusAccepted))
+
+	// The sequence numbers are taken on submission, before the tasks run.
+	for i := 0; i < 4; i++ {
+		runNext(t, a.tasks)
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4}, sequences)
+}
+
+func TestEventSequenceError(t *testing.T) {
+	t.Parallel()
+	ds := new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	ds.On("ReserveEventSequence", contextMatcher, 1).
+		Return(int64(0), errors.New("internal error")).
+		Once()
+
+	a := &app{
+		store: ds,
+		tasks: newTaskPool(0, 10, 10, 1),
+	}
+	err := a.DecommissionDevice(context.Background(), "dev1")
+	assert.EqualError(t, err,
+		"app: failed to reserve event sequence: internal error")
+	assert.Zero(t, a.tasks.queued)
+}
+
+func TestBatchStatusTasks(t *testing.T) {
+	t.Parallel()
+	hubFilter := model.IntegrationFilter{Provider: model.ProviderIoTHub, Limit: 1}
+	testCases := []struct {
+		Name string
+
+		Tasks *taskPool
+		Store func(t *testing.T) *storeMocks.DataStore
+
+		Batch bool
+		Error error
+	}{{
+		Name: "ok, IoT Hub integration",
+
+		Tasks: newTaskPool(0, 10, 10, 10),
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return([]model.Integration{{Provider: model.ProviderIoTHub}}, nil).
+				Once()
+			return ds
+		},
+		Batch: true,
+	}, {
+		Name: "ok, no IoT Hub integration",
+
+		Tasks: newTaskPool(0, 10, 10, 10),
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return([]model.Integration{}, nil).
+				Once()
+			return ds
+		},
+	}, {
+		Name: "ok, batches disabled",
+
+		Tasks: newTaskPool(0, 10, 10, 1),
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			return new(storeMocks.DataStore)
+		},
+	}, {
+		Name: "error, store",
+
+		Tasks: newTaskPool(0, 10, 10, 10),
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("GetIntegrations", contextMatcher, hubFilter).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Error: errors.New("app: failed to retrieve integrations: internal error"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ds := tc.Store(t)
+			defer ds.AssertExpectations(t)
+			a := &app{store: ds, tasks: tc.Tasks}
+
+			batch, err := a.batchStatusTasks(context.Background())
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Batch, batch)
+			}
+		})
+	}
+}
@@ -0,0 +1,505 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/iot-manager/client"
+	"github.com/mendersoftware/iot-manager/crypto"
+	"github.com/mendersoftware/iot-manager/metrics"
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+	"github.com/mendersoftware/iot-manager/tracing"
+)
+
+// deliveryLeaseMargin is added to the webhooks timeout when claiming a
+// delivery: if the worker dies while processing it, the delivery becomes
+// due again after the lease expires.
+const deliveryLeaseMargin = time.Minute
+
+// WithWebhooksRetry sets the retry policy for failed webhook deliveries.
+// maxAttempts includes the first attempt; backoff and maxBackoff are the
+// initial and maximum delay between attempts in seconds.
+func (a *app) WithWebhooksRetry(maxAttempts, backoff, maxBackoff uint) App {
+	a.webhooksMaxAttempts = int(maxAttempts)
+	a.webhooksBackoff = time.Duration(backoff * uint(time.Second))
+	a.webhooksMaxBackoff = time.Duration(maxBackoff * uint(time.Second))
+	return a
+}
+
+// webhookSecretLength is the length in bytes of the generated webhook
+// secrets.
+const webhookSecretLength = 32
+
+// RotateWebhookSecret replaces the webhook secret with the given secret, or
+// with a generated one if nil. The previous secret becomes the secondary
+// secret and keeps signing requests for the duration of the grace period.
+// It returns ErrIntegrationConflict if the integration is modified
+// concurrently.
+func (a *app) RotateWebhookSecret(
+	ctx context.Context,
+	integrationID uuid.UUID,
+	secret *model.HexSecret,
+	gracePeriod time.Duration,
+) (*model.HTTPCredentials, error) {
+	integration, err := a.GetIntegrationById(ctx, integrationID)
+	if err != nil {
+		return nil, err
+	} else if integration.Provider != model.ProviderWebhook ||
+		integration.Credentials.HTTP == nil {
+		return nil, ErrNotWebhook
+	}
+	if secret == nil {
+		b := make([]byte, webhookSecretLength)
+		if _, err = io.ReadFull(crand.Reader, b); err != nil {
+			return nil, errors.Wrap(err, "failed to generate secret")
+		}
+		generated := model.HexSecret(b)
+		secret = &generated
+	}
+	creds := *integration.Credentials.HTTP
+	creds.SecondarySecret = nil
+	creds.SecondarySecretExpiresAt = nil
+	if creds.Secret != nil && gracePeriod > 0 {
+		expiresAt := time.Now().Add(gracePeriod)
+		creds.SecondarySecret = creds.Secret
+		creds.SecondarySecretExpiresAt = &expiresAt
+	}
+	creds.Secret = secret
+
+	credentials := integration.Credentials
+	credentials.HTTP = &creds
+	err = a.store.UpdateIntegrationCredentials(ctx,
+		integrationID, integration.Version, credentials)
+	switch err {
+	case nil:
+		return &creds, nil
+	case store.ErrObjectNotFound:
+		// Either the integration was removed or another update won the
+		// race: rotating on top of it could drop the secret it set.
+		_, err = a.store.GetIntegrationById(ctx, integrationID)
+		if err == store.ErrObjectNotFound {
+			return nil, ErrIntegrationNotFound
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to retrieve the integration")
+		}
+		return nil, ErrIntegrationConflict
+	default:
+		return nil, errors.Wrap(err, "failed to update the integration credentials")
+	}
+}
+
+// deliverWebhook performs a single delivery attempt of the event to the
+// webhook integration. It returns the resulting delivery status and
+// whether a failed delivery is worth retrying.
+func (a *app) deliverWebhook(
+	ctx context.Context,
+	integration model.Integration,
+	event model.WebhookEvent,
+) (deliver model.DeliveryStatus, retry bool) {
+	deliver = model.DeliveryStatus{
+		IntegrationID: integration.ID,
+		Success:       true,
+	}
+	ts := time.Now()
+	req, err := client.NewWebhookRequest(ctx,
+		&integration.Credentials,
+		event)
+	var httpClient *http.Client
+	if err == nil {
+		httpClient, err = a.webhookClient(integration)
+	}
+	if err == nil {
+		var rsp *http.Response
+		start := time.Now()
+		rsp, err = httpClient.Do(req)
+		duration := time.Since(start).Milliseconds()
+		deliver.Duration = &duration
+		if err != nil {
+			// Network errors are transient
+			retry = true
+		} else {
+			deliver.StatusCode = &rsp.StatusCode
+			if rsp.StatusCode >= 300 {
+				err = client.NewHTTPError(rsp.StatusCode)
+				retry = isRetryableStatus(rsp.StatusCode)
+			}
+			_ = rsp.Body.Close()
+		}
+	}
+	if err != nil {
+		deliver.Success = false
+		deliver.Error = err.Error()
+	}
+	deliver.Attempts = []model.DeliveryAttempt{{
+		Success:    deliver.Success,
+		Error:      deliver.Error,
+		StatusCode: deliver.StatusCode,
+		Duration:   deliver.Duration,
+		Timestamp:  ts,
+	}}
+	return deliver, retry
+}
+
+// tlsClient is the HTTP client of a webhook with a TLS configuration.
+type tlsClient struct {
+	fingerprint string
+	// base is the uninstrumented client sharing the transport.
+	base   *http.Client
+	client *http.Client
+}
+
+// webhookClient returns the HTTP client for delivering webhooks of the
+// integration. Integrations with a TLS configuration get a dedicated
+// client, cached by integration ID to reuse the connections and replaced
+// when the TLS configuration changes.
+func (a *app) webhookClient(integration model.Integration) (*http.Client, error) {
+	creds := integration.Credentials.HTTP
+	if creds == nil || creds.TLS == nil {
+		a.evictWebhookClient(integration.ID)
+		return a.httpClient, nil
+	}
+	fingerprint := tlsConfigFingerprint(creds.TLS)
+	a.tlsClientsMu.Lock()
+	cached := a.tlsClients[integration.ID]
+	a.tlsClientsMu.Unlock()
+	if cached != nil && cached.fingerprint == fingerprint {
+		return cached.client, nil
+	}
+	config, err := creds.TLS.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	base := client.NewWithTLSConfig(config)
+	entry := &tlsClient{
+		fingerprint: fingerprint,
+		base:        base,
+		client: metrics.InstrumentClient(
+			metrics.ProviderWebhook, tracing.InstrumentExternalClient(base),
+		),
+	}
+
+	a.tlsClientsMu.Lock()
+	defer a.tlsClientsMu.Unlock()
+	previous := a.tlsClients[integration.ID]
+	if previous != nil && previous.fingerprint == fingerprint {
+		// Another delivery raced us to it.
+		return previous.client, nil
+	}
+	if a.tlsClients == nil {
+		a.tlsClients = make(map[uuid.UUID]*tlsClient)
+	}
+	a.tlsClients[integration.ID] = entry
+	if previous != nil {
+		previous.base.CloseIdleConnections()
+	}
+	return entry.client, nil
+}
+
+// evictWebhookClient removes the cached HTTP client of the integration and
+// closes its idle connections.
+func (a *app) evictWebhookClient(integrationID uuid.UUID) {
+	a.tlsClientsMu.Lock()
+	defer a.tlsClientsMu.Unlock()
+	if cached, ok := a.tlsClients[integrationID]; ok {
+		delete(a.tlsClients, integrationID)
+		cached.base.CloseIdleConnections()
+	}
+}
+
+func tlsConfigFingerprint(cfg *model.HTTPTLSConfig) string {
+	hash := sha256.New()
+	for _, value := range []*crypto.String{
+		cfg.ClientCertificate,
+		cfg.ClientKey,
+	} {
+		if value != nil {
+			_, _ = hash.Write([]byte(*value))
+		}
+		_, _ = hash.Write([]byte{0})
+	}
+	_, _ = hash.Write([]byte(cfg.CACertificates))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout ||
+		code == http.StatusTooManyRequests ||
+		code >= http.StatusInternalServerError
+}
+
+// webhookBackoff returns the delay before the next delivery attempt after
+// the given number of attempts: the delay doubles on every attempt up to
+// the maximum, and is randomized within [delay/2, delay] to spread out
+// retries to the same receiver.
+func (a *app) webhookBackoff(attempts int) time.Duration {
+	delay := a.webhooksMaxBackoff
+	if attempts < 1 {
+		attempts = 1
+	}
+	if shift := attempts - 1; shift < 32 {
+		d := a.webhooksBackoff << shift
+		if d > 0 && d < delay {
+			delay = d
+		}
+	}
+	if delay <= 1 {
+		return delay
+	}
+	//nolint:gosec
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// outboxTimeout is the timeout of the outbox updates recording the outcome
+// of a delivery attempt.
+const outboxTimeout = 10 * time.Second
+
+// pendingDelivery returns the delivery status of an event which has yet
+// to be delivered to the webhook integration.
+func pendingDelivery(integrationID uuid.UUID) model.DeliveryStatus {
+	return model.DeliveryStatus{
+		IntegrationID: integrationID,
+		Pending:       true,
+	}
+}
+
+var ErrEventSuperseded = errors.New(
+	"delivery skipped: a newer status change of the device targets the integration",
+)
+
+// supersededDelivery returns the delivery status of an event which is not
+// delivered since a newer status change of the device targets the
+// integration.
+func supersededDelivery(integrationID uuid.UUID) model.DeliveryStatus {
+	return model.DeliveryStatus{
+		IntegrationID: integrationID,
+		Skipped:       true,
+		Error:         ErrEventSuperseded.Error(),
+	}
+}
+
+// eventSuperseded returns true if the event is a status change and a newer
+// status change of the same device targets the integration: delivering the
+// event after the newer one would roll the integration back to an outdated
+// status of the device. The other events are never superseded.
+func (a *app) eventSuperseded(
+	ctx context.Context,
+	event *model.Event,
+	integrationID uuid.UUID,
+) (bool, error) {
+	if event.Type != model.EventTypeDeviceStatusChanged || event.Sequence == 0 {
+		return false, nil
+	}
+	device, err := decodeDeviceEvent(event)
+	if err != nil || device.ID == "" {
+		return false, err
+	}
+	events, err := a.store.GetEvents(ctx, model.EventsFilter{
+		Limit:         1,
+		Type:          model.EventTypeDeviceStatusChanged,
+		DeviceID:      device.ID,
+		IntegrationID: integrationID,
+		SequenceAfter: event.Sequence,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to retrieve newer events")
+	}
+	return len(events) > 0, nil
+}
+
+// saveEvent saves the event and delivers it to the webhooks, which must
+// have a pending delivery status in the event. The deliveries are added
+// to the outbox together with the event, before the first attempt, so that
+// they are retried even if the attempt does not complete.
+func (a *app) saveEvent(
+	ctx context.Context,
+	event model.Event,
+	webhooks []model.Integration,
+) error {
+	err := a.store.SaveEvent(ctx, event)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+	// The worker must not pick the deliveries up before the first
+	// attempts complete.
+	leaseTS := time.Now().Add(a.webhooksTimeout)
+	if deadline, ok := ctx.Deadline(); ok {
+		leaseTS = deadline
+	}
+	leaseTS = leaseTS.Add(deliveryLeaseMargin)
+	deliveries := make([]model.Delivery, len(webhooks))
+	for i, integration := range webhooks {
+		deliveries[i] = model.Delivery{
+			ID:            uuid.New(),
+			EventID:       event.ID,
+			IntegrationID: integration.ID,
+			NextTS:        leaseTS,
+			LeaseTS:       leaseTS,
+		}
+	}
+	err = a.store.EnqueueDeliveries(ctx, deliveries)
+	if err != nil {
+		return errors.Wrap(err, "failed to queue webhook deliveries")
+	}
+	var firstErr error
+	for i, integration := range webhooks {
+		if until := a.suspendedUntil(ctx, integration); !until.IsZero() {
+			err = a.deferDelivery(ctx, &deliveries[i], until)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		deliver, retry := a.deliverWebhookEvent(ctx, integration, event.WebhookEvent)
+		// The attempt may have used up the context of the task.
+		ctxOutbox, cancel := context.WithTimeout(detachedContext{ctx}, outboxTimeout)
+		err = a.completeDelivery(ctxOutbox, &deliveries[i], deliver, retry)
+		cancel()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// completeDelivery records the outcome of a delivery attempt in the event
+// and removes the delivery from the outbox, or schedules the next attempt.
+func (a *app) completeDelivery(
+	ctx context.Context,
+	delivery *model.Delivery,
+	deliver model.DeliveryStatus,
+	retry bool,
+) error {
+	delivery.Attempts++
+	err := a.store.UpdateEventDeliveryStatus(ctx, delivery.EventID, deliver)
+	if err != nil && !errors.Is(err, store.ErrObjectNotFound) {
+		return errors.Wrap(err, "failed to update event delivery status")
+	}
+	if deliver.Success || !retry || delivery.Attempts >= a.webhooksMaxAttempts {
+		err = a.store.DeleteDelivery(ctx, delivery.ID)
+		return errors.Wrap(err, "failed to remove delivery")
+	}
+	delivery.NextTS = time.Now().Add(a.webhookBackoff(delivery.Attempts))
+	err = a.store.RescheduleDelivery(ctx, *delivery)
+	return errors.Wrap(err, "failed to reschedule delivery")
+}
+
+// detachedContext keeps the values of the parent context, such as the
+// identity and the logger, without its deadline and cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (ctx detachedContext) Value(key interface{}) interface{} {
+	return ctx.parent.Value(key)
+}
+
+// RunDeliveryWorker retries the pending webhook deliveries as they become
+// due, polling the outbox at the given interval until the context is
+// cancelled.
+func (a *app) RunDeliveryWorker(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("delivery worker: interval must be positive")
+	}
+	l := log.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			processed, err := a.processDelivery(ctx)
+			if err != nil {
+				l.Errorf("failed to process webhook delivery: %s", err.Error())
+				break
+			} else if !processed {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// processDelivery claims a due delivery and performs the next attempt. It
+// returns false if there are no due deliveries.
+func (a *app) processDelivery(ctx context.Context) (bool, error) {
+	delivery, err := a.store.ClaimDelivery(ctx,
+		a.webhooksTimeout+deliveryLeaseMargin)
+	if errors.Is(err, store.ErrObjectNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "failed to claim delivery")
+	}
+	ctx = identity.WithContext(ctx, &identity.Identity{
+		Tenant: delivery.TenantID,
+	})
+	event, err := a.store.GetEvent(ctx, delivery.EventID)
+	var integration *model.Integration
+	if err == nil {
+		integration, err = a.store.GetIntegrationById(ctx, delivery.IntegrationID)
+	}
+	if errors.Is(err, store.ErrObjectNotFound) ||
+		(err == nil && integration.Provider != model.ProviderWebhook) {
+		// The event expired or the integration changed in the meantime
+		err = a.store.DeleteDelivery(ctx, delivery.ID)
+		return true, errors.Wrap(err, "failed to remove stale delivery")
+	} else if err != nil {
+		return true, errors.Wrap(err, "failed to retrieve delivery details")
+	}
+	superseded, err := a.eventSuperseded(ctx, event, integration.ID)
+	if err != nil {
+		return true, err
+	} else if superseded {
+		return true, a.completeDelivery(ctx,
+			delivery, supersededDelivery(integration.ID), false)
+	}
+
+	if until := a.suspendedUntil(ctx, *integration); !until.IsZero() {
+		return true, a.deferDelivery(ctx, delivery, until)
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, a.webhooksTimeout)
+	deliver, retry := a.deliverWebhookEvent(ctxWithTimeout, *integration, event.WebhookEvent)
+	cancel()
+	return true, a.completeDelivery(ctx, delivery, deliver, retry)
+}
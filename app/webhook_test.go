@@ -0,0 +1,905 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/iot-manager/client"
+	"github.com/mendersoftware/iot-manager/crypto"
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+	storeMocks "github.com/mendersoftware/iot-manager/store/mocks"
+)
+
+func newWebhookIntegration(id uuid.UUID) *model.Integration {
+	secret := model.HexSecret([]byte{'1', '2', '3'})
+	return &model.Integration{
+		ID:       id,
+		Provider: model.ProviderWebhook,
+		Credentials: model.Credentials{
+			Type: model.CredentialTypeHTTP,
+			HTTP: &model.HTTPCredentials{
+				URL:    "http://localhost",
+				Secret: &secret,
+			},
+		},
+	}
+}
+
+func newStatusRoundTripper(code int) *http.Client {
+	return &http.Client{
+		Transport: roundTripperFunc(
+			func(req *http.Request) (*http.Response, error) {
+				w := httptest.NewRecorder()
+				w.WriteHeader(code)
+				return w.Result(), nil
+			},
+		),
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	t.Parallel()
+	a := &app{}
+	a.WithWebhooksRetry(5, 10, 60)
+	for attempts, expected := range map[int]time.Duration{
+		0:  10 * time.Second,
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		4:  60 * time.Second,
+		64: 60 * time.Second,
+	} {
+		for i := 0; i < 10; i++ {
+			delay := a.webhookBackoff(attempts)
+			assert.GreaterOrEqual(t, delay, expected/2)
+			assert.LessOrEqual(t, delay, expected)
+		}
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	t.Parallel()
+	for code, expected := range map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusNotFound:            false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+	} {
+		assert.Equal(t, expected, isRetryableStatus(code), code)
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	t.Parallel()
+	integration := newWebhookIntegration(uuid.New())
+	event := model.WebhookEvent{
+		ID:   uuid.New(),
+		Type: model.EventTypeDeviceDecommissioned,
+		Data: model.DeviceEvent{ID: "foo"},
+	}
+
+	a := &app{httpClient: newStatusRoundTripper(http.StatusNoContent)}
+	deliver, retry := a.deliverWebhook(context.Background(), *integration, event)
+	assert.False(t, retry)
+	assert.True(t, deliver.Success)
+	if assert.NotNil(t, deliver.StatusCode) {
+		assert.Equal(t, http.StatusNoContent, *deliver.StatusCode)
+	}
+	assert.NotNil(t, deliver.Duration)
+	if assert.Len(t, deliver.Attempts, 1) {
+		assert.True(t, deliver.Attempts[0].Success)
+		assert.Equal(t, deliver.Duration, deliver.Attempts[0].Duration)
+		assert.False(t, deliver.Attempts[0].Timestamp.IsZero())
+	}
+
+	a.httpClient = newStatusRoundTripper(http.StatusServiceUnavailable)
+	deliver, retry = a.deliverWebhook(context.Background(), *integration, event)
+	assert.True(t, retry)
+	assert.False(t, deliver.Success)
+	assert.NotEmpty(t, deliver.Error)
+	if assert.Len(t, deliver.Attempts, 1) {
+		assert.Equal(t, deliver.Error, deliver.Attempts[0].Error)
+		assert.Equal(t, deliver.StatusCode, deliver.Attempts[0].StatusCode)
+	}
+
+	a.httpClient = newStatusRoundTripper(http.StatusForbidden)
+	deliver, retry = a.deliverWebhook(context.Background(), *integration, event)
+	assert.False(t, retry)
+	assert.False(t, deliver.Success)
+
+	a.httpClient = &http.Client{
+		Transport: roundTripperFunc(
+			func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+		),
+	}
+	deliver, retry = a.deliverWebhook(context.Background(), *integration, event)
+	assert.True(t, retry)
+	assert.False(t, deliver.Success)
+	assert.Nil(t, deliver.StatusCode)
+
+	// Invalid credentials cannot be fixed by retrying
+	deliver, retry = a.deliverWebhook(context.Background(),
+		model.Integration{Provider: model.ProviderWebhook}, event)
+	assert.False(t, retry)
+	assert.False(t, deliver.Success)
+
+	// Payload template errors are reported in the delivery status
+	integration.Credentials.HTTP.PayloadFormat = model.PayloadFormatTemplate
+	integration.Credentials.HTTP.PayloadTemplate = `{"text": "{{ .data.status }}"}`
+	deliver, retry = a.deliverWebhook(context.Background(), *integration, event)
+	assert.False(t, retry)
+	assert.False(t, deliver.Success)
+	assert.Contains(t, deliver.Error, "failed to render payload template")
+}
+
+func TestWebhookClient(t *testing.T) {
+	t.Parallel()
+	a := &app{httpClient: client.New()}
+	integration := newWebhookIntegration(uuid.New())
+	c, err := a.webhookClient(*integration)
+	assert.NoError(t, err)
+	assert.Same(t, a.httpClient, c)
+
+	// The SSRF guard and the TLS configuration are tested by the client
+	// package, only check that the clients are cached by integration.
+	integration.Credentials.HTTP.TLS = &model.HTTPTLSConfig{}
+	c, err = a.webhookClient(*integration)
+	if assert.NoError(t, err) {
+		assert.NotSame(t, a.httpClient, c)
+		cached, _ := a.webhookClient(*integration)
+		assert.Same(t, c, cached)
+
+		other := newWebhookIntegration(uuid.New())
+		other.Credentials.HTTP.TLS = &model.HTTPTLSConfig{}
+		otherClient, _ := a.webhookClient(*other)
+		assert.NotSame(t, c, otherClient)
+	}
+
+	// Changing the TLS configuration replaces the cached client
+	key := crypto.String("key")
+	integration.Credentials.HTTP.TLS = &model.HTTPTLSConfig{ClientKey: &key}
+	replaced, _ := a.webhookClient(*integration)
+	assert.NotSame(t, c, replaced)
+	assert.Len(t, a.tlsClients, 2)
+
+	// Removing the TLS configuration evicts the cached client
+	integration.Credentials.HTTP.TLS = nil
+	c, err = a.webhookClient(*integration)
+	assert.NoError(t, err)
+	assert.Same(t, a.httpClient, c)
+	assert.Len(t, a.tlsClients, 1)
+
+	integration.Credentials.HTTP.TLS = &model.HTTPTLSConfig{
+		CACertificates: "not a certificate",
+	}
+	_, err = a.webhookClient(*integration)
+	assert.EqualError(t, err, "invalid CA certificates: "+
+		"no PEM encoded certificates found")
+}
+
+func TestRemoveIntegrationEvictsWebhookClient(t *testing.T) {
+	t.Parallel()
+	integration := newWebhookIntegration(uuid.New())
+	integration.Credentials.HTTP.TLS = &model.HTTPTLSConfig{}
+	ds := new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	ds.On("GetIntegrationById", contextMatcher, integration.ID).
+		Return(integration, nil).
+		Once()
+	ds.On("RemoveIntegration", contextMatcher, integration.ID).
+		Return(nil).
+		Once()
+	a := &app{store: ds, httpClient: client.New()}
+	_, err := a.webhookClient(*integration)
+	assert.NoError(t, err)
+	assert.Len(t, a.tlsClients, 1)
+
+	err = a.RemoveIntegration(context.Background(), integration.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, a.tlsClients)
+}
+
+func TestDecommissionDeviceQueuesDeliveries(t *testing.T) {
+	t.Parallel()
+	const deviceID = "68ac6f41-c2e7-429f-a4bd-852fac9a5045"
+	integration := newWebhookIntegration(uuid.New())
+	ds := new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	var (
+		eventID    uuid.UUID
+		deliveryID uuid.UUID
+	)
+	ds.On("GetIntegrations", contextMatcher, model.IntegrationFilter{}).
+		Return([]model.Integration{*integration}, nil).
+		Once().
+		On("DeleteDevice", contextMatcher, deviceID).
+		Return(nil).
+		Once().
+		On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+		Run(func(args mock.Arguments) {
+			event := args.Get(1).(model.Event)
+			eventID = event.ID
+			if assert.Len(t, event.DeliveryStatus, 1) {
+				assert.True(t, event.DeliveryStatus[0].Pending)
+				assert.Empty(t, event.DeliveryStatus[0].Attempts)
+			}
+		}).
+		Return(nil).
+		Once().
+		On("EnqueueDeliveries", contextMatcher,
+			mock.AnythingOfType("[]model.Delivery")).
+		Run(func(args mock.Arguments) {
+			deliveries := args.Get(1).([]model.Delivery)
+			if assert.Len(t, deliveries, 1) {
+				deliveryID = deliveries[0].ID
+				assert.Equal(t, eventID, deliveries[0].EventID)
+				assert.Equal(t, integration.ID, deliveries[0].IntegrationID)
+				assert.Equal(t, 0, deliveries[0].Attempts)
+				assert.True(t, deliveries[0].NextTS.After(time.Now()))
+			}
+		}).
+		Return(nil).
+		Once().
+		On("UpdateEventDeliveryStatus", contextMatcher,
+			mock.AnythingOfType("uuid.UUID"),
+			mock.AnythingOfType("model.DeliveryStatus")).
+		Run(func(args mock.Arguments) {
+			assert.Equal(t, eventID, args.Get(1))
+			stat := args.Get(2).(model.DeliveryStatus)
+			assert.False(t, stat.Success)
+			assert.False(t, stat.Pending)
+			assert.Len(t, stat.Attempts, 1)
+		}).
+		Return(nil).
+		Once().
+		On("RescheduleDelivery", contextMatcher,
+			mock.AnythingOfType("model.Delivery")).
+		Run(func(args mock.Arguments) {
+			delivery := args.Get(1).(model.Delivery)
+			assert.Equal(t, deliveryID, delivery.ID)
+			assert.Equal(t, 1, delivery.Attempts)
+			assert.True(t, delivery.NextTS.After(time.Now()))
+		}).
+		Return(nil).
+		Once()
+
+	a := &app{
+		store:      ds,
+		httpClient: newStatusRoundTripper(http.StatusBadGateway),
+	}
+	a.WithWebhooksRetry(3, 10, 60)
+	err := a.decommissionDevice(context.Background(), deviceID, 1)
+	assert.NoError(t, err)
+}
+
+func TestDecommissionDeviceWebhookTimeout(t *testing.T) {
+	t.Parallel()
+	const deviceID = "68ac6f41-c2e7-429f-a4bd-852fac9a5045"
+	integration := newWebhookIntegration(uuid.New())
+	ds := new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	queued := make(chan struct{})
+	// The outbox must be updated with a live context after the receiver
+	// used up the context of the task.
+	liveContext := mock.MatchedBy(func(ctx context.Context) bool {
+		return ctx.Err() == nil
+	})
+	ds.On("GetIntegrations", contextMatcher, model.IntegrationFilter{}).
+		Return([]model.Integration{*integration}, nil).
+		Once().
+		On("DeleteDevice", contextMatcher, deviceID).
+		Return(nil).
+		Once().
+		On("SaveEvent", contextMatcher, mock.AnythingOfType("model.Event")).
+		Return(nil).
+		Once().
+		On("EnqueueDeliveries", contextMatcher,
+			mock.AnythingOfType("[]model.Delivery")).
+		Run(func(args mock.Arguments) {
+			close(queued)
+		}).
+		Return(nil).
+		Once().
+		On("UpdateEventDeliveryStatus", liveContext,
+			mock.AnythingOfType("uuid.UUID"),
+			mock.AnythingOfType("model.DeliveryStatus")).
+		Run(func(args mock.Arguments) {
+			stat := args.Get(2).(model.DeliveryStatus)
+			assert.False(t, stat.Success)
+			assert.Contains(t, stat.Error, context.DeadlineExceeded.Error())
+		}).
+		Return(nil).
+		Once().
+		On("RescheduleDelivery", liveContext,
+			mock.AnythingOfType("model.Delivery")).
+		Return(nil).
+		Once()
+
+	a := &app{
+		store: ds,
+		httpClient: &http.Client{
+			Transport: roundTripperFunc(
+				func(req *http.Request) (*http.Response, error) {
+					select {
+					case <-queued:
+					default:
+						assert.Fail(t, "delivery attempted before queueing")
+					}
+					// The receiver blocks past the timeout of the task.
+					<-req.Context().Done()
+					return nil, req.Context().Err()
+				},
+			),
+		},
+	}
+	a.WithWebhooksRetry(3, 10, 60)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := a.decommissionDevice(ctx, deviceID, 1)
+	assert.NoError(t, err)
+}
+
+func TestProcessDelivery(t *testing.T) {
+	t.Parallel()
+	const tenantID = "123456789012345678901234"
+	integrationID := uuid.New()
+	event := &model.Event{
+		WebhookEvent: model.WebhookEvent{
+			ID:   uuid.New(),
+			Type: model.EventTypeDeviceDecommissioned,
+			Data: model.DeviceEvent{ID: "foo"},
+		},
+	}
+	sequencedEvent := *event
+	sequencedEvent.Type = model.EventTypeDeviceStatusChanged
+	sequencedEvent.Sequence = 42
+	sequencedDecommission := *event
+	sequencedDecommission.Sequence = 43
+	newerEventsFilter := model.EventsFilter{
+		Limit:         1,
+		Type:          model.EventTypeDeviceStatusChanged,
+		DeviceID:      "foo",
+		IntegrationID: integrationID,
+		SequenceAfter: sequencedEvent.Sequence,
+	}
+	newDelivery := func(attempts int) *model.Delivery {
+		return &model.Delivery{
+			ID:            uuid.New(),
+			TenantID:      tenantID,
+			EventID:       event.ID,
+			IntegrationID: integrationID,
+			Attempts:      attempts,
+		}
+	}
+	tenantMatcher := mock.MatchedBy(func(ctx context.Context) bool {
+		id := identity.FromContext(ctx)
+		return id != nil && id.Tenant == tenantID
+	})
+
+	type testCase struct {
+		Name string
+
+		StatusCode int
+		Store      func(t *testing.T) *storeMocks.DataStore
+
+		Processed bool
+		Error     error
+	}
+	testCases := []testCase{{
+		Name: "ok, nothing to do",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(nil, store.ErrObjectNotFound).
+				Once()
+			return ds
+		},
+	}, {
+		Name: "ok, delivered",
+
+		StatusCode: http.StatusOK,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			delivery := newDelivery(1)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(delivery, nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(event, nil).
+				Once().
+				On("GetIntegrationById", tenantMatcher, integrationID).
+				Return(newWebhookIntegration(integrationID), nil).
+				Once().
+				On("UpdateEventDeliveryStatus", tenantMatcher, event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return status.Success && len(status.Attempts) == 1
+					})).
+				Return(nil).
+				Once().
+				On("DeleteDelivery", tenantMatcher, delivery.ID).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Processed: true,
+	}, {
+		Name: "ok, rescheduled",
+
+		StatusCode: http.StatusTooManyRequests,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			delivery := newDelivery(1)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(delivery, nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(event, nil).
+				Once().
+				On("GetIntegrationById", tenantMatcher, integrationID).
+				Return(newWebhookIntegration(integrationID), nil).
+				Once().
+				On("UpdateEventDeliveryStatus", tenantMatcher, event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return !status.Success &&
+							*status.StatusCode == http.StatusTooManyRequests
+					})).
+				Return(nil).
+				Once().
+				On("RescheduleDelivery", tenantMatcher,
+					mock.MatchedBy(func(d model.Delivery) bool {
+						return d.ID == delivery.ID &&
+							d.Attempts == 2 &&
+							d.NextTS.After(time.Now())
+					})).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Processed: true,
+	}, {
+		Name: "ok, deferred while suspended",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			delivery := newDelivery(1)
+			integration := newWebhookIntegration(integrationID)
+			integration.State = model.IntegrationStateSuspended
+			probeTS := time.Now().Add(time.Minute)
+			integration.CircuitBreaker = &model.CircuitBreaker{ProbeTS: &probeTS}
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(delivery, nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(event, nil).
+				Once().
+				On("GetIntegrationById", tenantMatcher, integrationID).
+				Return(integration, nil).
+				Once().
+				On("ClaimIntegrationProbe", tenantMatcher, integrationID,
+					mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).
+				Return(false, nil).
+				Once().
+				On("RescheduleDelivery", tenantMatcher,
+					mock.MatchedBy(func(d model.Delivery) bool {
+						return d.ID == delivery.ID &&
+							d.Attempts == 1 &&
+							d.NextTS.Equal(probeTS)
+					})).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Processed: true,
+	}, {
+		Name: "ok, max attempts reached",
+
+		StatusCode: http.StatusInternalServerError,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			delivery := newDelivery(2)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(delivery, nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(event, nil).
+				Once().
+				On("GetIntegrationById", tenantMatcher, integrationID).
+				Return(newWebhookIntegration(integrationID), nil).
+				Once().
+				On("UpdateEventDeliveryStatus", tenantMatcher, event.ID,
+					mock.AnythingOfType("model.DeliveryStatus")).
+				Return(nil).
+				Once().
+				On("DeleteDelivery", tenantMatcher, delivery.ID).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Processed: true,
+	}, {
+		Name: "ok, integration removed",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			delivery := newDelivery(1)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(delivery, nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(event, nil).
+				Once().
+				On("GetIntegrationById", tenantMatcher, integrationID).
+				Return(nil, store.ErrObjectNotFound).
+				Once().
+				On("DeleteDelivery", tenantMatcher, delivery.ID).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Processed: true,
+	}, {
+		Name: "ok, superseded by a newer status change",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			delivery := newDelivery(1)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(delivery, nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(&sequencedEvent, nil).
+				Once().
+				On("GetIntegrationById", tenantMatcher, integrationID).
+				Return(newWebhookIntegration(integrationID), nil).
+				Once().
+				On("GetEvents", tenantMatcher, newerEventsFilter).
+				Return([]model.Event{{}}, nil).
+				Once().
+				On("UpdateEventDeliveryStatus", tenantMatcher, event.ID,
+					supersededDelivery(integrationID)).
+				Return(nil).
+				Once().
+				On("DeleteDelivery", tenantMatcher, delivery.ID).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Processed: true,
+	}, {
+		Name: "ok, not superseded",
+
+		StatusCode: http.StatusOK,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			delivery := newDelivery(1)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(delivery, nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(&sequencedEvent, nil).
+				Once().
+				On("GetIntegrationById", tenantMatcher, integrationID).
+				Return(newWebhookIntegration(integrationID), nil).
+				Once().
+				On("GetEvents", tenantMatcher, newerEventsFilter).
+				Return([]model.Event{}, nil).
+				Once().
+				On("UpdateEventDeliveryStatus", tenantMatcher, event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return status.Success
+					})).
+				Return(nil).
+				Once().
+				On("DeleteDelivery", tenantMatcher, delivery.ID).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Processed: true,
+	}, {
+		Name: "ok, only status changes are superseded",
+
+		StatusCode: http.StatusOK,
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			delivery := newDelivery(1)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(delivery, nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(&sequencedDecommission, nil).
+				Once().
+				On("GetIntegrationById", tenantMatcher, integrationID).
+				Return(newWebhookIntegration(integrationID), nil).
+				Once().
+				On("UpdateEventDeliveryStatus", tenantMatcher, event.ID,
+					mock.MatchedBy(func(status model.DeliveryStatus) bool {
+						return status.Success
+					})).
+				Return(nil).
+				Once().
+				On("DeleteDelivery", tenantMatcher, delivery.ID).
+				Return(nil).
+				Once()
+			return ds
+		},
+		Processed: true,
+	}, {
+		Name: "error, retrieving newer events",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(newDelivery(1), nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(&sequencedEvent, nil).
+				Once().
+				On("GetIntegrationById", tenantMatcher, integrationID).
+				Return(newWebhookIntegration(integrationID), nil).
+				Once().
+				On("GetEvents", tenantMatcher, newerEventsFilter).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Processed: true,
+		Error:     errors.New("failed to retrieve newer events: internal error"),
+	}, {
+		Name: "error, claiming delivery",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Error: errors.New("failed to claim delivery: internal error"),
+	}, {
+		Name: "error, retrieving event",
+
+		Store: func(t *testing.T) *storeMocks.DataStore {
+			ds := new(storeMocks.DataStore)
+			ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+				Return(newDelivery(1), nil).
+				Once().
+				On("GetEvent", tenantMatcher, event.ID).
+				Return(nil, errors.New("internal error")).
+				Once()
+			return ds
+		},
+		Processed: true,
+		Error:     errors.New("failed to retrieve delivery details: internal error"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ds := tc.Store(t)
+			defer ds.AssertExpectations(t)
+			a := &app{
+				store:           ds,
+				httpClient:      newStatusRoundTripper(tc.StatusCode),
+				webhooksTimeout: time.Second,
+			}
+			a.WithWebhooksRetry(3, 10, 60)
+
+			processed, err := a.processDelivery(context.Background())
+			assert.Equal(t, tc.Processed, processed)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRunDeliveryWorker(t *testing.T) {
+	t.Parallel()
+	ds := new(storeMocks.DataStore)
+	defer ds.AssertExpectations(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	ds.On("ClaimDelivery", contextMatcher, mock.AnythingOfType("time.Duration")).
+		Run(func(args mock.Arguments) {
+			cancel()
+		}).
+		Return(nil, store.ErrObjectNotFound).
+		Once()
+
+	a := &app{store: ds}
+	err := a.RunDeliveryWorker(ctx, time.Minute)
+	assert.NoError(t, err)
+
+	err = a.RunDeliveryWorker(context.Background(), 0)
+	assert.Error(t, err)
+}
+
+func TestRotateWebhookSecret(t *testing.T) {
+	t.Parallel()
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("webhook"))
+	newSecret := model.HexSecret("new secret")
+	testCases := []struct {
+		Name string
+
+		Integration *model.Integration
+		Secret      *model.HexSecret
+		GracePeriod time.Duration
+		StoreError  error
+		// RefetchError is returned when retrieving the integration again
+		// after the version condition failed.
+		RefetchError error
+
+		Error error
+	}{{
+		Name: "ok",
+
+		Integration: newWebhookIntegration(integrationID),
+		Secret:      &newSecret,
+		GracePeriod: time.Hour,
+	}, {
+		Name: "ok, versioned integration",
+
+		Integration: func() *model.Integration {
+			integration := newWebhookIntegration(integrationID)
+			integration.Version = 3
+			return integration
+		}(),
+		Secret: &newSecret,
+	}, {
+		Name: "ok, generated secret",
+
+		Integration: newWebhookIntegration(integrationID),
+		GracePeriod: time.Hour,
+	}, {
+		Name: "ok, no grace period",
+
+		Integration: newWebhookIntegration(integrationID),
+		Secret:      &newSecret,
+	}, {
+		Name: "ok, no previous secret",
+
+		Integration: func() *model.Integration {
+			integration := newWebhookIntegration(integrationID)
+			integration.Credentials.HTTP.Secret = nil
+			return integration
+		}(),
+		Secret:      &newSecret,
+		GracePeriod: time.Hour,
+	}, {
+		Name: "error, not a webhook",
+
+		Integration: &testHubIntegration,
+		Error:       ErrNotWebhook,
+	}, {
+		Name: "error, integration not found",
+
+		Error: ErrIntegrationNotFound,
+	}, {
+		Name: "error, failed to update credentials",
+
+		Integration: newWebhookIntegration(integrationID),
+		StoreError:  errors.New("internal error"),
+		Error: errors.New("failed to update the integration credentials: " +
+			"internal error"),
+	}, {
+		Name: "error, modified concurrently",
+
+		Integration: newWebhookIntegration(integrationID),
+		StoreError:  store.ErrObjectNotFound,
+		Error:       ErrIntegrationConflict,
+	}, {
+		Name: "error, removed concurrently",
+
+		Integration:  newWebhookIntegration(integrationID),
+		StoreError:   store.ErrObjectNotFound,
+		RefetchError: store.ErrObjectNotFound,
+		Error:        ErrIntegrationNotFound,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ds := new(storeMocks.DataStore)
+			defer ds.AssertExpectations(t)
+			if tc.Integration != nil {
+				ds.On("GetIntegrationById", contextMatcher, integrationID).
+					Return(tc.Integration, nil).
+					Once()
+			} else {
+				ds.On("GetIntegrationById", contextMatcher, integrationID).
+					Return(nil, store.ErrObjectNotFound).
+					Once()
+			}
+			var previous *model.HexSecret
+			if tc.Integration != nil && tc.Integration.Credentials.HTTP != nil {
+				previous = tc.Integration.Credentials.HTTP.Secret
+				ds.On("UpdateIntegrationCredentials",
+					contextMatcher,
+					integrationID,
+					tc.Integration.Version,
+					mock.MatchedBy(func(creds model.Credentials) bool {
+						return creds.HTTP != nil &&
+							creds.HTTP.URL == tc.Integration.Credentials.HTTP.URL
+					})).
+					Return(tc.StoreError).
+					Once()
+			}
+			if tc.StoreError == store.ErrObjectNotFound {
+				if tc.RefetchError != nil {
+					ds.On("GetIntegrationById", contextMatcher, integrationID).
+						Return(nil, tc.RefetchError).
+						Once()
+				} else {
+					ds.On("GetIntegrationById", contextMatcher, integrationID).
+						Return(tc.Integration, nil).
+						Once()
+				}
+			}
+			a := New(ds, nil, nil)
+
+			creds, err := a.RotateWebhookSecret(context.Background(),
+				integrationID, tc.Secret, tc.GracePeriod)
+			if tc.Error != nil {
+				assert.EqualError(t, err, tc.Error.Error())
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			if tc.Secret != nil {
+				assert.Equal(t, tc.Secret, creds.Secret)
+			} else if assert.NotNil(t, creds.Secret) {
+				assert.Len(t, *creds.Secret, webhookSecretLength)
+			}
+			if previous != nil && tc.GracePeriod > 0 {
+				assert.Equal(t, previous, creds.SecondarySecret)
+				if assert.NotNil(t, creds.SecondarySecretExpiresAt) {
+					assert.WithinDuration(t,
+						time.Now().Add(tc.GracePeriod),
+						*creds.SecondarySecretExpiresAt,
+						time.Minute,
+					)
+				}
+			} else {
+				assert.Nil(t, creds.SecondarySecret)
+				assert.Nil(t, creds.SecondarySecretExpiresAt)
+			}
+			assert.Equal(t, previous, tc.Integration.Credentials.HTTP.Secret,
+				"stored integration must not be modified")
+		})
+	}
+}
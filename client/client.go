@@ -21,10 +21,12 @@ import (
 	"crypto/sha256"
 	"crypto/tls"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
+	"io"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -35,14 +37,44 @@ import (
 const (
 	ParamAlgorithmType = "X-Men-Algorithm"
 	ParamSignature     = "X-Men-Signature"
+	ParamTimestamp     = "X-Men-Timestamp"
+	ParamEventID       = "X-Men-Event-Id"
 
 	HdrKeyContentType    = "Content-Type"
+	HdrKeyAuthorization  = "Authorization"
 	AlgorithmTypeHMAC256 = "MEN-HMAC-SHA256-Payload"
+	// AlgorithmTypeHMAC256Timestamp signs the timestamp and the payload
+	// separated by a "."
+	AlgorithmTypeHMAC256Timestamp = "MEN-HMAC-SHA256-Timestamp-Payload"
+
+	// DefaultTimestampTolerance is the maximum age of a webhook request
+	// signed with AlgorithmTypeHMAC256Timestamp accepted by
+	// VerifyWebhookRequest.
+	DefaultTimestampTolerance = 5 * time.Minute
+)
+
+var (
+	ErrSignatureMissing  = errors.New("webhook request is not signed")
+	ErrSignatureMismatch = errors.New("webhook request signature mismatch")
+	ErrUnknownAlgorithm  = errors.New("unknown webhook signature algorithm")
+	ErrTimestampInvalid  = errors.New("invalid webhook request timestamp")
+	ErrTimestampExpired  = errors.New("webhook request timestamp is outside " +
+		"the tolerance window")
 )
 
 func New() *http.Client {
+	return newClient(NewTransport())
+}
+
+// NewWithTLSConfig returns a client like New using the TLS configuration
+// for the connections, e.g. for presenting a client certificate.
+func NewWithTLSConfig(config *tls.Config) *http.Client {
+	return newClient(newTransport(addrIsGlobalUnicast, config))
+}
+
+func newClient(transport http.RoundTripper) *http.Client {
 	return &http.Client{
-		Transport: NewTransport(),
+		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
@@ -67,11 +99,19 @@ func addrIsGlobalUnicast(network, address string, _ syscall.RawConn) error {
 }
 
 func NewTransport() http.RoundTripper {
+	return newTransport(addrIsGlobalUnicast, nil)
+}
+
+func newTransport(
+	control func(network, address string, c syscall.RawConn) error,
+	config *tls.Config,
+) *http.Transport {
 	dialer := &net.Dialer{
-		Control: addrIsGlobalUnicast,
+		Control: control,
 	}
 	tlsDialer := &tls.Dialer{
 		NetDialer: dialer,
+		Config:    config,
 	}
 	return &http.Transport{
 		Proxy:                 nil,
@@ -99,15 +139,110 @@ func NewSignedRequest(
 		return nil, err
 	}
 	req.Header.Set(ParamAlgorithmType, AlgorithmTypeHMAC256)
+	req.Header.Set(ParamSignature, hex.EncodeToString(signPayload(secret, body)))
+
+	return req, nil
+}
 
+func signPayload(secret []byte, body []byte) []byte {
 	sign := hmac.New(sha256.New, secret)
 	_, _ = sign.Write(body) // Writer cannot error
+	return sign.Sum(nil)
+}
 
-	req.Header.Set(ParamSignature, hex.EncodeToString(sign.Sum(nil)))
+// NewTimestampSignedRequest appends header X-Men-Timestamp with the unix
+// timestamp in seconds and X-Men-Signature with value:
+// HMAC256(timestamp + "." + Request.Body, secret)
+func NewTimestampSignedRequest(
+	ctx context.Context,
+	secret []byte,
+	method string,
+	url string,
+	body []byte,
+	timestamp time.Time,
+) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	req.Header.Set(ParamAlgorithmType, AlgorithmTypeHMAC256Timestamp)
+	req.Header.Set(ParamTimestamp, ts)
+	req.Header.Set(ParamSignature, hex.EncodeToString(signTimestamp(secret, ts, body)))
 
 	return req, nil
 }
 
+func signTimestamp(secret []byte, timestamp string, body []byte) []byte {
+	sign := hmac.New(sha256.New, secret)
+	_, _ = sign.Write([]byte(timestamp))
+	_, _ = sign.Write([]byte{'.'})
+	_, _ = sign.Write(body)
+	return sign.Sum(nil)
+}
+
+// VerifyWebhookRequest verifies the signature of a webhook request received
+// from the iot-manager using the integration secret. Requests signed with
+// AlgorithmTypeHMAC256Timestamp are rejected if the timestamp differs from
+// the current time by more than tolerance (DefaultTimestampTolerance if
+// zero). The request body is restored so it can be read by the caller.
+func VerifyWebhookRequest(req *http.Request, secret []byte, tolerance time.Duration) error {
+	// The header contains one signature per secret while the integration
+	// secret is being rotated.
+	var signatures [][]byte
+	for _, value := range strings.Split(req.Header.Get(ParamSignature), ",") {
+		signature, err := hex.DecodeString(strings.TrimSpace(value))
+		if err == nil && len(signature) > 0 {
+			signatures = append(signatures, signature)
+		}
+	}
+	if len(signatures) == 0 {
+		return ErrSignatureMissing
+	}
+	var (
+		body []byte
+		err  error
+	)
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	var expected []byte
+	switch req.Header.Get(ParamAlgorithmType) {
+	case AlgorithmTypeHMAC256:
+		expected = signPayload(secret, body)
+
+	case AlgorithmTypeHMAC256Timestamp:
+		if tolerance <= 0 {
+			tolerance = DefaultTimestampTolerance
+		}
+		ts := req.Header.Get(ParamTimestamp)
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return ErrTimestampInvalid
+		}
+		age := time.Since(time.Unix(unix, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrTimestampExpired
+		}
+		expected = signTimestamp(secret, ts, body)
+
+	default:
+		return ErrUnknownAlgorithm
+	}
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return ErrSignatureMismatch
+}
+
 func NewWebhookRequest(
 	ctx context.Context,
 	creds *model.Credentials,
@@ -120,27 +255,80 @@ func NewWebhookRequest(
 		return nil, errors.New("invalid credentials for webhooks")
 	}
 
-	b, err := json.Marshal(event)
+	payload, err := renderPayload(creds.HTTP, event)
 	if err != nil {
 		return nil, err
 	}
-	var req *http.Request
-	if creds.HTTP.Secret != nil {
+	var (
+		b       = payload.Body
+		req     *http.Request
+		now     = time.Now()
+		secrets = creds.HTTP.Secrets(now)
+		v2      = creds.HTTP.SignatureVersion == model.SignatureVersion2
+	)
+	switch {
+	case len(secrets) == 0:
+		req, err = http.NewRequestWithContext(
+			ctx, http.MethodPost,
+			creds.HTTP.URL, bytes.NewReader(b),
+		)
+	case v2:
+		req, err = NewTimestampSignedRequest(
+			ctx,
+			secrets[0],
+			http.MethodPost,
+			creds.HTTP.URL,
+			b,
+			now,
+		)
+	default:
 		req, err = NewSignedRequest(
 			ctx,
-			[]byte(*creds.HTTP.Secret),
+			secrets[0],
 			http.MethodPost,
 			creds.HTTP.URL,
 			b,
 		)
-	} else {
-		req, err = http.NewRequestWithContext(
-			ctx, http.MethodPost,
-			creds.HTTP.URL, bytes.NewReader(b),
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Sign the request with the secondary secret during the rotation
+	// grace period.
+	for i := 1; i < len(secrets); i++ {
+		var signature []byte
+		if v2 {
+			signature = signTimestamp(secrets[i], req.Header.Get(ParamTimestamp), b)
+		} else {
+			signature = signPayload(secrets[i], b)
+		}
+		req.Header.Set(ParamSignature,
+			req.Header.Get(ParamSignature)+","+hex.EncodeToString(signature),
 		)
 	}
-	if err == nil {
-		req.Header.Set(HdrKeyContentType, "application/json")
+	for _, hdr := range creds.HTTP.Headers {
+		if hdr.Value != nil {
+			req.Header.Set(hdr.Name, string(*hdr.Value))
+		}
+	}
+	if auth := creds.HTTP.Auth; auth != nil {
+		switch auth.Type {
+		case model.HTTPAuthTypeBearer:
+			if auth.Token != nil {
+				req.Header.Set(HdrKeyAuthorization, "Bearer "+string(*auth.Token))
+			}
+		case model.HTTPAuthTypeBasic:
+			var password string
+			if auth.Password != nil {
+				password = string(*auth.Password)
+			}
+			req.SetBasicAuth(auth.Username, password)
+		}
+	}
+	for key, values := range payload.Header {
+		req.Header[key] = values
 	}
-	return req, err
+	req.Header.Set(HdrKeyContentType, payload.ContentType)
+	req.Header.Set(ParamEventID, event.ID.String())
+	return req, nil
 }
@@ -22,4 +22,6 @@ import (
 type Device struct {
 	ID     string       `json:"id"`
 	Status model.Status `json:"status"`
+
+	IdentityData map[string]interface{} `json:"identity_data,omitempty"`
 }
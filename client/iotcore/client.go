@@ -31,16 +31,35 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/iot"
 	"github.com/aws/aws-sdk-go-v2/service/iot/types"
 	"github.com/aws/aws-sdk-go-v2/service/iotdataplane"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 
 	"github.com/mendersoftware/iot-manager/crypto"
+	"github.com/mendersoftware/iot-manager/metrics"
 	"github.com/mendersoftware/iot-manager/model"
 )
 
 var (
 	ErrDeviceNotFound            = errors.New("device not found")
+	ErrPolicyNotFound            = errors.New("device policy not found")
 	ErrDeviceIncosistent         = errors.New("device is not consistent")
 	ErrThingPrincipalNotDetached = errors.New(
 		"giving up on waiting for Thing principal being detached")
+	// ErrInvalidCredentials is returned when AWS does not recognize the
+	// access key or the request signature.
+	ErrInvalidCredentials = errors.New("the AWS credentials were rejected")
+)
+
+// IAM actions required by the integration.
+const (
+	PermissionDescribeEndpoint = "iot:DescribeEndpoint"
+	PermissionGetPolicy        = "iot:GetPolicy"
+)
+
+const (
+	errCodeAccessDenied         = "AccessDeniedException"
+	errCodeUnrecognizedClient   = "UnrecognizedClientException"
+	errCodeInvalidSignature     = "InvalidSignatureException"
+	errCodeInvalidClientTokenID = "InvalidClientTokenId"
 )
 
 const (
@@ -64,6 +83,10 @@ type Client interface {
 	GetDevice(ctx context.Context, creds model.AWSCredentials, deviceID string) (*Device, error)
 	UpsertDevice(ctx context.Context, creds model.AWSCredentials, deviceID string, device *Device, policy string) (*Device, error)
 	DeleteDevice(ctx context.Context, creds model.AWSCredentials, deviceID string) error
+
+	// CheckPermissions probes AWS IoT Core using the credentials and
+	// returns the IAM actions that are not allowed.
+	CheckPermissions(ctx context.Context, creds model.AWSCredentials) ([]string, error)
 }
 
 type client struct{}
@@ -72,6 +95,16 @@ func NewClient() Client {
 	return &client{}
 }
 
+// httpClient is the AWS SDK default client with the transport instrumented
+// for the IoT Core metrics.
+var httpClient = func() *http.Client {
+	c := awshttp.NewBuildableClient()
+	return &http.Client{
+		Transport: metrics.NewTransport(metrics.ProviderIoTCore, c.GetTransport()),
+		Timeout:   c.GetTimeout(),
+	}
+}()
+
 func getAWSConfig(creds model.AWSCredentials) (*aws.Config, error) {
 	err := creds.Validate()
 	if err != nil {
@@ -86,8 +119,13 @@ func getAWSConfig(creds model.AWSCredentials) (*aws.Config, error) {
 	cfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithRegion(*creds.Region),
 		config.WithCredentialsProvider(appCreds),
+		config.WithHTTPClient(httpClient),
 	)
-	return &cfg, err
+	if err != nil {
+		return nil, err
+	}
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+	return &cfg, nil
 }
 
 func (c *client) GetDevice(
@@ -439,3 +477,62 @@ func (c *client) UpdateDeviceShadow(
 	}
 	return &shadow, nil
 }
+
+func (c *client) CheckPermissions(
+	ctx context.Context,
+	creds model.AWSCredentials,
+) ([]string, error) {
+	cfg, err := getAWSConfig(creds)
+	if err != nil {
+		return nil, err
+	}
+	svc := iot.NewFromConfig(*cfg)
+
+	var missing []string
+	_, err = svc.DescribeEndpoint(ctx, &iot.DescribeEndpointInput{
+		EndpointType: aws.String(endpointType),
+	})
+	if isInvalidCredentials(err) {
+		return nil, ErrInvalidCredentials
+	} else if isAccessDenied(err) {
+		missing = append(missing, PermissionDescribeEndpoint)
+	} else if err != nil {
+		return nil, err
+	}
+
+	_, err = svc.GetPolicy(ctx, &iot.GetPolicyInput{
+		PolicyName: creds.DevicePolicyName,
+	})
+	var notFoundErr *types.ResourceNotFoundException
+	if isAccessDenied(err) {
+		missing = append(missing, PermissionGetPolicy)
+	} else if errors.As(err, &notFoundErr) {
+		return nil, ErrPolicyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+func isAccessDenied(err error) bool {
+	var unauthorizedErr *types.UnauthorizedException
+	if errors.As(err, &unauthorizedErr) {
+		return true
+	}
+	var apiErr interface{ ErrorCode() string }
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == errCodeAccessDenied
+}
+
+func isInvalidCredentials(err error) bool {
+	var apiErr interface{ ErrorCode() string }
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case errCodeUnrecognizedClient,
+		errCodeInvalidSignature,
+		errCodeInvalidClientTokenID:
+		return true
+	}
+	return false
+}
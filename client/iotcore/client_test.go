@@ -172,6 +172,25 @@ func TestUpsertDevice(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCheckPermissions(t *testing.T) {
+	if !validAWSSettings(t) {
+		return
+	}
+
+	ctx := context.Background()
+	client := NewClient()
+
+	missing, err := client.CheckPermissions(ctx, awsCredentials)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+
+	creds := awsCredentials
+	policyName := "iot-manager-" + uuid.NewString()
+	creds.DevicePolicyName = &policyName
+	_, err = client.CheckPermissions(ctx, creds)
+	assert.EqualError(t, err, ErrPolicyNotFound.Error())
+}
+
 func TestIoTCoreExternal(t *testing.T) {
 	if !validAWSSettings(t) {
 		return
@@ -30,6 +30,29 @@ type Client struct {
 	mock.Mock
 }
 
+// CheckPermissions provides a mock function with given fields: ctx, creds
+func (_m *Client) CheckPermissions(ctx context.Context, creds model.AWSCredentials) ([]string, error) {
+	ret := _m.Called(ctx, creds)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, model.AWSCredentials) []string); ok {
+		r0 = rf(ctx, creds)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.AWSCredentials) error); ok {
+		r1 = rf(ctx, creds)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteDevice provides a mock function with given fields: ctx, creds, deviceID
 func (_m *Client) DeleteDevice(ctx context.Context, creds model.AWSCredentials, deviceID string) error {
 	ret := _m.Called(ctx, creds, deviceID)
@@ -29,19 +29,32 @@ import (
 	common "github.com/mendersoftware/iot-manager/client"
 	"github.com/mendersoftware/iot-manager/model"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
 var (
-	ErrNoCredentials = errors.New("no connection string configured for tenant")
+	ErrNoCredentials  = errors.New("no connection string configured for tenant")
+	ErrTooManyDevices = errors.New("iothub: too many devices in bulk request")
 )
 
 const (
 	uriTwin      = "/twins"
 	uriDevices   = "/devices"
 	uriQueryTwin = uriDevices + "/query"
+	uriJobs      = "/jobs"
+	uriJobCreate = uriJobs + "/create"
 
-	hdrKeyCount = "X-Ms-Max-Item-Count"
+	hdrKeyCount        = "X-Ms-Max-Item-Count"
+	hdrKeyContinuation = "X-Ms-Continuation"
+
+	// queryPageSize is the maximum number of device twins of a page of
+	// query results.
+	queryPageSize = 1000
+
+	// MaxBulkDevices is the maximum number of devices of a bulk registry
+	// request.
+	MaxBulkDevices = 100
 
 	// https://docs.microsoft.com/en-us/rest/api/iothub/service/devices
 	APIVersion = "2021-04-12"
@@ -51,6 +64,10 @@ func uriDevice(id string) string {
 	return uriDevices + "/" + url.QueryEscape(id)
 }
 
+func uriJob(id string) string {
+	return uriJobs + "/" + url.QueryEscape(id)
+}
+
 const (
 	defaultTTL = time.Minute
 )
@@ -59,10 +76,29 @@ const (
 	hdrKeyAuthorization = "Authorization"
 )
 
+// Shared access policy permissions required by the integration.
+const (
+	PermissionRegistryRead  = "RegistryRead"
+	PermissionRegistryWrite = "RegistryWrite"
+)
+
+const (
+	// probeQuery counts the devices in the registry without returning
+	// any device twins.
+	probeQuery = `{"query":"SELECT COUNT() AS numberOfDevices FROM devices"}`
+	// probeETag never matches a device ETag, so that probing the registry
+	// write permission cannot delete an existing device.
+	probeETag = `"iot-manager-probe"`
+)
+
 //nolint:lll
 //go:generate ../../utils/mockgen.sh
 type Client interface {
 	GetDeviceTwins(ctx context.Context, cs *model.ConnectionString, deviceIDs []string) ([]DeviceTwin, error)
+	// QueryTwins runs the IoT Hub query and returns an iterator over the
+	// resulting device twins. The first page of results is fetched before
+	// returning, the following pages as the iteration proceeds.
+	QueryTwins(ctx context.Context, cs *model.ConnectionString, query string) (TwinIterator, error)
 	GetDeviceTwin(ctx context.Context, cs *model.ConnectionString, id string) (*DeviceTwin, error)
 	UpdateDeviceTwin(ctx context.Context, cs *model.ConnectionString, id string, r *DeviceTwinUpdate) error
 
@@ -82,6 +118,31 @@ type Client interface {
 	// }.String()
 	UpsertDevice(ctx context.Context, cs *model.ConnectionString, id string, deviceUpdate ...*Device) (*Device, error)
 	DeleteDevice(ctx context.Context, cs *model.ConnectionString, id string) error
+	// BulkUpdateDevices overwrites the identities of up to MaxBulkDevices
+	// devices in a single request. The devices must contain the complete
+	// identities, including the authentication, as returned by GetDevice;
+	// the identities with an ETag are only updated if the ETag matches.
+	// The errors of the individual devices are returned in the result.
+	BulkUpdateDevices(ctx context.Context, cs *model.ConnectionString, devices []*Device) (*BulkRegistryOperationResult, error)
+
+	// ExportDevices submits a job exporting the device identities of the
+	// registry, without their keys, to the blob of the storage container.
+	// The container URL must contain a SAS token granting write access.
+	ExportDevices(ctx context.Context, cs *model.ConnectionString, containerURL, blobName string) (*Job, error)
+	GetJob(ctx context.Context, cs *model.ConnectionString, jobID string) (*Job, error)
+	CancelJob(ctx context.Context, cs *model.ConnectionString, jobID string) error
+	// GetExportedDevices reads the device identities from the blob written
+	// by a completed export job. The container URL must contain a SAS
+	// token granting read access.
+	GetExportedDevices(ctx context.Context, containerURL, blobName string) ([]Device, error)
+	// DeleteExportedDevices deletes the blob written by an export job. The
+	// container URL must contain a SAS token granting delete access.
+	DeleteExportedDevices(ctx context.Context, containerURL, blobName string) error
+
+	// CheckPermissions probes the IoT Hub registry using the connection
+	// string and returns the shared access policy permissions that are
+	// not granted.
+	CheckPermissions(ctx context.Context, cs *model.ConnectionString) ([]string, error)
 }
 
 type client struct {
@@ -258,37 +319,334 @@ func (c *client) DeleteDevice(ctx context.Context, cs *model.ConnectionString, i
 	return nil
 }
 
+// POST /devices
+func (c *client) BulkUpdateDevices(
+	ctx context.Context,
+	cs *model.ConnectionString,
+	devices []*Device,
+) (*BulkRegistryOperationResult, error) {
+	if len(devices) == 0 {
+		return &BulkRegistryOperationResult{IsSuccessful: true}, nil
+	} else if len(devices) > MaxBulkDevices {
+		return nil, ErrTooManyDevices
+	}
+	ops := make([]exportImportDevice, len(devices))
+	for i, dev := range devices {
+		ops[i] = newExportImportDevice(dev)
+	}
+	b, _ := json.Marshal(ops)
+	req, err := c.NewRequestWithContext(ctx,
+		cs,
+		http.MethodPost,
+		uriDevices,
+		bytes.NewReader(b),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "iothub: failed to prepare request")
+	}
+	rsp, err := c.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "iothub: failed to execute request")
+	}
+	defer rsp.Body.Close()
+	// The IoT Hub responds with 400 if any of the operations failed.
+	if rsp.StatusCode >= 400 && rsp.StatusCode != http.StatusBadRequest {
+		return nil, common.NewHTTPError(rsp.StatusCode)
+	}
+	result := new(BulkRegistryOperationResult)
+	dec := json.NewDecoder(rsp.Body)
+	if err = dec.Decode(result); err != nil {
+		if rsp.StatusCode == http.StatusBadRequest {
+			return nil, common.NewHTTPError(rsp.StatusCode)
+		}
+		return nil, errors.Wrap(err, "iothub: failed to decode API response")
+	}
+	if rsp.StatusCode == http.StatusBadRequest && len(result.Errors) == 0 {
+		return nil, common.NewHTTPError(rsp.StatusCode)
+	}
+	return result, nil
+}
+
+// POST /jobs/create
+func (c *client) ExportDevices(
+	ctx context.Context,
+	cs *model.ConnectionString,
+	containerURL, blobName string,
+) (*Job, error) {
+	b, _ := json.Marshal(Job{
+		Type:                   JobTypeExport,
+		OutputBlobContainerURI: containerURL,
+		OutputBlobName:         blobName,
+		ExcludeKeysInExport:    true,
+	})
+	req, err := c.NewRequestWithContext(ctx,
+		cs,
+		http.MethodPost,
+		uriJobCreate,
+		bytes.NewReader(b),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "iothub: failed to prepare request")
+	}
+	return c.doJob(req)
+}
+
+// GET /jobs/{id}
+func (c *client) GetJob(
+	ctx context.Context,
+	cs *model.ConnectionString,
+	jobID string,
+) (*Job, error) {
+	req, err := c.NewRequestWithContext(ctx, cs, http.MethodGet, uriJob(jobID), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "iothub: failed to prepare request")
+	}
+	return c.doJob(req)
+}
+
+func (c *client) doJob(req *http.Request) (*Job, error) {
+	rsp, err := c.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "iothub: failed to execute request")
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode >= 400 {
+		return nil, common.NewHTTPError(rsp.StatusCode)
+	}
+	job := new(Job)
+	dec := json.NewDecoder(rsp.Body)
+	if err = dec.Decode(job); err != nil {
+		return nil, errors.Wrap(err, "iothub: failed to decode job")
+	}
+	return job, nil
+}
+
+// DELETE /jobs/{id}
+func (c *client) CancelJob(
+	ctx context.Context,
+	cs *model.ConnectionString,
+	jobID string,
+) error {
+	req, err := c.NewRequestWithContext(ctx, cs, http.MethodDelete, uriJob(jobID), nil)
+	if err != nil {
+		return errors.Wrap(err, "iothub: failed to prepare request")
+	}
+	rsp, err := c.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "iothub: failed to execute request")
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode >= 400 {
+		return common.NewHTTPError(rsp.StatusCode)
+	}
+	return nil
+}
+
+// GET {containerURL}/{blobName}
+func (c *client) GetExportedDevices(
+	ctx context.Context,
+	containerURL, blobName string,
+) ([]Device, error) {
+	req, err := newBlobRequest(ctx, http.MethodGet, containerURL, blobName)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := c.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(unwrapURLError(err), "iothub: failed to fetch exported devices")
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode >= 400 {
+		return nil, common.NewHTTPError(rsp.StatusCode)
+	}
+	// The blob holds one device identity per line.
+	var devices []Device
+	dec := json.NewDecoder(rsp.Body)
+	for {
+		var dev exportImportDevice
+		err = dec.Decode(&dev)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "iothub: failed to decode exported devices")
+		}
+		devices = append(devices, Device{
+			DeviceID:     dev.ID,
+			ETag:         dev.ETag,
+			Status:       dev.Status,
+			StatusReason: dev.StatusReason,
+		})
+	}
+	return devices, nil
+}
+
+// DELETE {containerURL}/{blobName}
+func (c *client) DeleteExportedDevices(
+	ctx context.Context,
+	containerURL, blobName string,
+) error {
+	req, err := newBlobRequest(ctx, http.MethodDelete, containerURL, blobName)
+	if err != nil {
+		return err
+	}
+	rsp, err := c.Do(req)
+	if err != nil {
+		return errors.Wrap(unwrapURLError(err), "iothub: failed to delete exported devices")
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode >= 400 && rsp.StatusCode != http.StatusNotFound {
+		return common.NewHTTPError(rsp.StatusCode)
+	}
+	return nil
+}
+
+// newBlobRequest prepares a request on the blob of the storage container.
+// The container URL contains the SAS token: make sure it does not leak
+// into the errors.
+func newBlobRequest(
+	ctx context.Context,
+	method, containerURL, blobName string,
+) (*http.Request, error) {
+	uri, err := url.Parse(containerURL)
+	if err != nil {
+		return nil, errors.New("iothub: invalid blob container URL")
+	}
+	uri.Path = strings.TrimSuffix(uri.Path, "/") + "/" + blobName
+	uri.RawPath = ""
+	req, err := http.NewRequestWithContext(ctx, method, uri.String(), nil)
+	if err != nil {
+		return nil, errors.New("iothub: invalid blob container URL")
+	}
+	return req, nil
+}
+
+// unwrapURLError strips the request URL, and thus the SAS token, from the
+// errors returned by the HTTP client.
+func unwrapURLError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
+
 func (c *client) GetDeviceTwins(
 	ctx context.Context, cs *model.ConnectionString, deviceIDs []string,
 ) ([]DeviceTwin, error) {
 	if len(deviceIDs) == 0 {
 		return []DeviceTwin{}, nil
 	}
-	SQLQuery := fmt.Sprintf(
-		`{"query":"SELECT * FROM devices WHERE devices.deviceid IN ['%s']"}`,
+	query := fmt.Sprintf(
+		"SELECT * FROM devices WHERE devices.deviceid IN ['%s']",
 		strings.Join(deviceIDs, "','"),
 	)
-	q := bytes.NewReader([]byte(SQLQuery))
-	req, err := c.NewRequestWithContext(ctx, cs, http.MethodPost, uriQueryTwin, q)
+	iter, err := c.QueryTwins(ctx, cs, query)
 	if err != nil {
-		return nil, errors.Wrap(err, "iothub: failed to prepare request")
+		return nil, err
+	}
+	twins := make([]DeviceTwin, 0, len(deviceIDs))
+	for iter.Next(ctx) {
+		twins = append(twins, iter.Twin())
+	}
+	if err = iter.Err(); err != nil {
+		return nil, err
 	}
-	req.Header.Set(hdrKeyCount, strconv.Itoa(len(deviceIDs)))
+	return twins, nil
+}
 
-	rsp, err := c.Do(req)
+// TwinIterator iterates over the device twins of a query result.
+type TwinIterator interface {
+	// Next advances to the next device twin, fetching the next page of
+	// results if needed. It returns false when the results are exhausted
+	// or fetching a page failed.
+	Next(ctx context.Context) bool
+	// Twin returns the current device twin.
+	Twin() DeviceTwin
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+}
+
+type twinIterator struct {
+	client *client
+	cs     *model.ConnectionString
+	query  []byte
+
+	page []DeviceTwin
+	twin DeviceTwin
+	// continuation is the token of the next page of results, it is empty
+	// after the last page.
+	continuation string
+	err          error
+}
+
+// POST /devices/query
+func (c *client) QueryTwins(
+	ctx context.Context,
+	cs *model.ConnectionString,
+	query string,
+) (TwinIterator, error) {
+	b, _ := json.Marshal(map[string]string{"query": query})
+	iter := &twinIterator{
+		client: c,
+		cs:     cs,
+		query:  b,
+	}
+	if err := iter.fetch(ctx); err != nil {
+		return nil, err
+	}
+	return iter, nil
+}
+
+func (iter *twinIterator) fetch(ctx context.Context) error {
+	req, err := iter.client.NewRequestWithContext(ctx,
+		iter.cs,
+		http.MethodPost,
+		uriQueryTwin,
+		bytes.NewReader(iter.query),
+	)
 	if err != nil {
-		return nil, errors.Wrap(err, "iothub: failed to fetch device twins")
+		return errors.Wrap(err, "iothub: failed to prepare request")
+	}
+	req.Header.Set(hdrKeyCount, strconv.Itoa(queryPageSize))
+	if iter.continuation != "" {
+		req.Header.Set(hdrKeyContinuation, iter.continuation)
+	}
+
+	rsp, err := iter.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "iothub: failed to fetch device twins")
 	}
 	defer rsp.Body.Close()
 	if rsp.StatusCode >= 400 {
-		return nil, common.NewHTTPError(rsp.StatusCode)
+		return common.NewHTTPError(rsp.StatusCode)
 	}
-	twins := make([]DeviceTwin, 0, len(deviceIDs))
+	var page []DeviceTwin
 	dec := json.NewDecoder(rsp.Body)
-	if err = dec.Decode(&twins); err != nil {
-		return nil, errors.Wrap(err, "iothub: failed to decode API response")
+	if err = dec.Decode(&page); err != nil {
+		return errors.Wrap(err, "iothub: failed to decode API response")
 	}
-	return twins, nil
+	iter.page = page
+	iter.continuation = rsp.Header.Get(hdrKeyContinuation)
+	return nil
+}
+
+func (iter *twinIterator) Next(ctx context.Context) bool {
+	for len(iter.page) == 0 {
+		if iter.err != nil || iter.continuation == "" {
+			return false
+		}
+		iter.err = iter.fetch(ctx)
+	}
+	iter.twin = iter.page[0]
+	iter.page = iter.page[1:]
+	return true
+}
+
+func (iter *twinIterator) Twin() DeviceTwin {
+	return iter.twin
+}
+
+func (iter *twinIterator) Err() error {
+	return iter.err
 }
 
 func (c *client) GetDeviceTwin(
@@ -350,3 +708,68 @@ func (c *client) UpdateDeviceTwin(
 	}
 	return nil
 }
+
+func (c *client) CheckPermissions(
+	ctx context.Context,
+	cs *model.ConnectionString,
+) ([]string, error) {
+	var missing []string
+
+	// Registry read: query the number of devices in the registry.
+	req, err := c.NewRequestWithContext(ctx,
+		cs,
+		http.MethodPost,
+		uriQueryTwin,
+		strings.NewReader(probeQuery),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "iothub: failed to prepare request")
+	}
+	req.Header.Set(hdrKeyCount, "1")
+	granted, err := c.probe(req)
+	if err != nil {
+		return nil, err
+	} else if !granted {
+		missing = append(missing, PermissionRegistryRead)
+	}
+
+	// Registry write: delete a device that does not exist.
+	req, err = c.NewRequestWithContext(ctx,
+		cs,
+		http.MethodDelete,
+		uriDevice("iot-manager-probe-"+uuid.NewString()),
+		nil,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "iothub: failed to prepare request")
+	}
+	req.Header.Set("If-Match", probeETag)
+	granted, err = c.probe(req)
+	if err != nil {
+		return nil, err
+	} else if !granted {
+		missing = append(missing, PermissionRegistryWrite)
+	}
+	return missing, nil
+}
+
+// probe executes the request and returns false if the request was denied.
+// IoT Hub denies the requests not granted by the shared access policy with
+// 401 (IotHubUnauthorizedAccess), while 403 reports an exceeded quota or
+// throttling (403002, 403004) which says nothing about the permissions.
+func (c *client) probe(req *http.Request) (bool, error) {
+	rsp, err := c.Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, "iothub: failed to execute request")
+	}
+	defer rsp.Body.Close()
+	switch {
+	case rsp.StatusCode == http.StatusUnauthorized:
+		return false, nil
+	case rsp.StatusCode == http.StatusForbidden,
+		rsp.StatusCode == http.StatusTooManyRequests,
+		rsp.StatusCode >= 500:
+		return false, common.NewHTTPError(rsp.StatusCode)
+	}
+	return true, nil
+}
@@ -321,6 +321,582 @@ func TestDeleteDevice(t *testing.T) {
 	}
 }
 
+func TestBulkUpdateDevices(t *testing.T) {
+	t.Parallel()
+	cs := &model.ConnectionString{
+		HostName: "localhost",
+		Key:      crypto.String("secret"),
+		Name:     "gimmeAccessPls",
+	}
+	devices := []*Device{{
+		Auth: &Auth{
+			Type: AuthTypeSymmetric,
+			SymmetricKey: &SymmetricKey{
+				Primary:   Key("foo"),
+				Secondary: Key("bar"),
+			},
+		},
+		DeviceID: "6c985f61-5093-45eb-8ece-7dfe97a6de7b",
+		ETag:     "qwerty",
+		Status:   StatusDisabled,
+	}, {
+		DeviceID: "b8ea97f2-1c2b-492c-84ce-7a90170291b9",
+		Status:   StatusEnabled,
+	}}
+	testCases := []struct {
+		Name string
+
+		Devices []*Device
+		ConnStr *model.ConnectionString
+
+		RSPCode int
+		RSPBody interface{}
+
+		RTError error
+
+		Result *BulkRegistryOperationResult
+		Error  error
+	}{{
+		Name: "ok",
+
+		Devices: devices,
+		ConnStr: cs,
+
+		RSPCode: http.StatusOK,
+		RSPBody: BulkRegistryOperationResult{IsSuccessful: true},
+
+		Result: &BulkRegistryOperationResult{IsSuccessful: true},
+	}, {
+		Name: "ok/partial failure",
+
+		Devices: devices,
+		ConnStr: cs,
+
+		RSPCode: http.StatusBadRequest,
+		RSPBody: BulkRegistryOperationResult{
+			Errors: []DeviceRegistryOperationError{{
+				DeviceID:    devices[0].DeviceID,
+				ErrorCode:   "PreconditionFailed",
+				ErrorStatus: "Precondition failed",
+			}},
+		},
+
+		Result: &BulkRegistryOperationResult{
+			Errors: []DeviceRegistryOperationError{{
+				DeviceID:    devices[0].DeviceID,
+				ErrorCode:   "PreconditionFailed",
+				ErrorStatus: "Precondition failed",
+			}},
+		},
+	}, {
+		Name: "ok/no devices",
+
+		ConnStr: cs,
+		RTError: errors.New("no request expected"),
+
+		Result: &BulkRegistryOperationResult{IsSuccessful: true},
+	}, {
+		Name: "error/too many devices",
+
+		Devices: make([]*Device, MaxBulkDevices+1),
+		ConnStr: cs,
+
+		Error: ErrTooManyDevices,
+	}, {
+		Name: "error/invalid connection string",
+
+		Devices: devices,
+		ConnStr: &model.ConnectionString{
+			Name: "bad",
+		},
+		Error: errors.New("failed to prepare request: invalid connection string"),
+	}, {
+		Name: "error/internal roundtrip error",
+
+		Devices: devices,
+		ConnStr: cs,
+		RTError: errors.New("idk"),
+		Error:   errors.New("failed to execute request:.*idk"),
+	}, {
+		Name: "error/bad request",
+
+		Devices: devices,
+		ConnStr: cs,
+
+		RSPCode: http.StatusBadRequest,
+		RSPBody: rest.Error{Err: "bad request"},
+		Error:   common.NewHTTPError(http.StatusBadRequest),
+	}, {
+		Name: "error/bad status code",
+
+		Devices: devices,
+		ConnStr: cs,
+
+		RSPCode: http.StatusInternalServerError,
+		Error:   common.NewHTTPError(http.StatusInternalServerError),
+	}, {
+		Name: "error/malformed response",
+
+		Devices: devices,
+		ConnStr: cs,
+
+		RSPCode: http.StatusOK,
+		RSPBody: []byte("imagine a result in this reponse pls"),
+		Error:   errors.New("iothub: failed to decode API response"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			w := httptest.NewRecorder()
+			httpClient := &http.Client{
+				Transport: RoundTripperFunc(func(
+					r *http.Request,
+				) (*http.Response, error) {
+					if tc.RTError != nil {
+						return nil, tc.RTError
+					}
+					assert.Equal(t, http.MethodPost, r.Method)
+					assert.Equal(t, uriDevices, r.URL.Path)
+					var ops []map[string]interface{}
+					if assert.NoError(t, json.NewDecoder(r.Body).Decode(&ops)) &&
+						assert.Len(t, ops, 2) {
+						assert.Equal(t, "updateIfMatchETag", ops[0]["importMode"])
+						assert.Equal(t, "qwerty", ops[0]["eTag"])
+						assert.Contains(t, ops[0], "authentication")
+						assert.Equal(t, "update", ops[1]["importMode"])
+						assert.Equal(t, "enabled", ops[1]["status"])
+					}
+					w.WriteHeader(tc.RSPCode)
+					switch typ := tc.RSPBody.(type) {
+					case []byte:
+						w.Write(typ)
+					default:
+						b, _ := json.Marshal(typ)
+						w.Write(b)
+					}
+					return w.Result(), nil
+				}),
+			}
+			client := NewClient(NewOptions(nil).
+				SetClient(httpClient))
+
+			result, err := client.BulkUpdateDevices(ctx, tc.ConnStr, tc.Devices)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Result, result)
+			}
+		})
+	}
+}
+
+func TestExportDevices(t *testing.T) {
+	t.Parallel()
+	cs := &model.ConnectionString{
+		HostName: "localhost",
+		Key:      crypto.String("secret"),
+		Name:     "gimmeAccessPls",
+	}
+	const containerURL = "https://mender.blob.core.windows.net/devices?sig=secret"
+	testCases := []struct {
+		Name string
+
+		ConnStr *model.ConnectionString
+
+		RSPCode int
+		RSPBody interface{}
+		RTError error
+
+		Job   *Job
+		Error error
+	}{{
+		Name: "ok",
+
+		ConnStr: cs,
+		RSPCode: http.StatusOK,
+		RSPBody: Job{
+			JobID:  "job",
+			Type:   JobTypeExport,
+			Status: JobStatusEnqueued,
+		},
+
+		Job: &Job{
+			JobID:  "job",
+			Type:   JobTypeExport,
+			Status: JobStatusEnqueued,
+		},
+	}, {
+		Name: "error/invalid connection string",
+
+		ConnStr: &model.ConnectionString{
+			Name: "bad",
+		},
+		Error: errors.New("failed to prepare request: invalid connection string"),
+	}, {
+		Name: "error/internal roundtrip error",
+
+		ConnStr: cs,
+		RTError: errors.New("idk"),
+		Error:   errors.New("failed to execute request:.*idk"),
+	}, {
+		Name: "error/bad status code",
+
+		ConnStr: cs,
+		RSPCode: http.StatusConflict,
+		Error:   common.NewHTTPError(http.StatusConflict),
+	}, {
+		Name: "error/malformed response",
+
+		ConnStr: cs,
+		RSPCode: http.StatusOK,
+		RSPBody: []byte("a job of some sort"),
+		Error:   errors.New("iothub: failed to decode job"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			w := httptest.NewRecorder()
+			httpClient := &http.Client{
+				Transport: RoundTripperFunc(func(
+					r *http.Request,
+				) (*http.Response, error) {
+					if tc.RTError != nil {
+						return nil, tc.RTError
+					}
+					assert.Equal(t, http.MethodPost, r.Method)
+					assert.Equal(t, uriJobCreate, r.URL.Path)
+					var job Job
+					if assert.NoError(t, json.NewDecoder(r.Body).Decode(&job)) {
+						assert.Equal(t, Job{
+							Type:                   JobTypeExport,
+							OutputBlobContainerURI: containerURL,
+							OutputBlobName:         "devices.txt",
+							ExcludeKeysInExport:    true,
+						}, job)
+					}
+					w.WriteHeader(tc.RSPCode)
+					switch typ := tc.RSPBody.(type) {
+					case []byte:
+						w.Write(typ)
+					default:
+						b, _ := json.Marshal(typ)
+						w.Write(b)
+					}
+					return w.Result(), nil
+				}),
+			}
+			client := NewClient(NewOptions(nil).
+				SetClient(httpClient))
+
+			job, err := client.ExportDevices(ctx, tc.ConnStr, containerURL, "devices.txt")
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Job, job)
+			}
+		})
+	}
+}
+
+func TestGetJob(t *testing.T) {
+	t.Parallel()
+	cs := &model.ConnectionString{
+		HostName: "localhost",
+		Key:      crypto.String("secret"),
+		Name:     "gimmeAccessPls",
+	}
+	testCases := []struct {
+		Name string
+
+		RSPCode int
+		RSPBody interface{}
+
+		Job   *Job
+		Error error
+	}{{
+		Name: "ok",
+
+		RSPCode: http.StatusOK,
+		RSPBody: Job{
+			JobID:         "job",
+			Type:          JobTypeExport,
+			Status:        JobStatusFailed,
+			FailureReason: "storage account unreachable",
+		},
+
+		Job: &Job{
+			JobID:         "job",
+			Type:          JobTypeExport,
+			Status:        JobStatusFailed,
+			FailureReason: "storage account unreachable",
+		},
+	}, {
+		Name: "error/not found",
+
+		RSPCode: http.StatusNotFound,
+		Error:   common.NewHTTPError(http.StatusNotFound),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			w := httptest.NewRecorder()
+			httpClient := &http.Client{
+				Transport: RoundTripperFunc(func(
+					r *http.Request,
+				) (*http.Response, error) {
+					assert.Equal(t, http.MethodGet, r.Method)
+					assert.Equal(t, uriJobs+"/job", r.URL.Path)
+					w.WriteHeader(tc.RSPCode)
+					b, _ := json.Marshal(tc.RSPBody)
+					w.Write(b)
+					return w.Result(), nil
+				}),
+			}
+			client := NewClient(NewOptions(nil).
+				SetClient(httpClient))
+
+			job, err := client.GetJob(ctx, cs, "job")
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Job, job)
+			}
+		})
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	t.Parallel()
+	cs := &model.ConnectionString{
+		HostName: "localhost",
+		Key:      crypto.String("secret"),
+		Name:     "gimmeAccessPls",
+	}
+	testCases := []struct {
+		Name string
+
+		RSPCode int
+
+		Error error
+	}{{
+		Name: "ok",
+
+		RSPCode: http.StatusNoContent,
+	}, {
+		Name: "error/bad status code",
+
+		RSPCode: http.StatusInternalServerError,
+		Error:   common.NewHTTPError(http.StatusInternalServerError),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			w := httptest.NewRecorder()
+			httpClient := &http.Client{
+				Transport: RoundTripperFunc(func(
+					r *http.Request,
+				) (*http.Response, error) {
+					assert.Equal(t, http.MethodDelete, r.Method)
+					assert.Equal(t, uriJobs+"/job", r.URL.Path)
+					w.WriteHeader(tc.RSPCode)
+					return w.Result(), nil
+				}),
+			}
+			client := NewClient(NewOptions(nil).
+				SetClient(httpClient))
+
+			err := client.CancelJob(ctx, cs, "job")
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGetExportedDevices(t *testing.T) {
+	t.Parallel()
+	// The storage container is replaced by a server serving the blobs.
+	blobs := map[string]string{
+		"/devices/devices.txt": `{"id":"dev1","eTag":"MQ==","status":"enabled",` +
+			`"authentication":{"type":"sas"},"tags":{"mender":true}}` + "\n" +
+			`{"id":"dev2","eTag":"Mg==","status":"disabled","statusReason":"rejected"}` +
+			"\n",
+		"/devices/empty.txt":     "",
+		"/devices/malformed.txt": `{"id":"dev1"`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "secret", r.URL.Query().Get("sig"))
+		blob, ok := blobs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(blob))
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		Name string
+
+		ContainerURL string
+		BlobName     string
+
+		Devices []Device
+		Error   error
+	}{{
+		Name: "ok",
+
+		ContainerURL: srv.URL + "/devices?sig=secret",
+		BlobName:     "devices.txt",
+
+		Devices: []Device{{
+			DeviceID: "dev1",
+			ETag:     "MQ==",
+			Status:   StatusEnabled,
+		}, {
+			DeviceID:     "dev2",
+			ETag:         "Mg==",
+			Status:       StatusDisabled,
+			StatusReason: "rejected",
+		}},
+	}, {
+		Name: "ok/no devices",
+
+		ContainerURL: srv.URL + "/devices/?sig=secret",
+		BlobName:     "empty.txt",
+	}, {
+		Name: "error/blob not found",
+
+		ContainerURL: srv.URL + "/devices?sig=secret",
+		BlobName:     "missing.txt",
+		Error:        common.NewHTTPError(http.StatusNotFound),
+	}, {
+		Name: "error/malformed blob",
+
+		ContainerURL: srv.URL + "/devices?sig=secret",
+		BlobName:     "malformed.txt",
+		Error:        errors.New("iothub: failed to decode exported devices"),
+	}, {
+		Name: "error/invalid container URL",
+
+		ContainerURL: "https://mender.blob\x7f/devices?sig=secret",
+		BlobName:     "devices.txt",
+		Error:        errors.New("iothub: invalid blob container URL$"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			client := NewClient(NewOptions(nil).
+				SetClient(srv.Client()))
+
+			devices, err := client.GetExportedDevices(
+				context.Background(), tc.ContainerURL, tc.BlobName,
+			)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+					assert.NotContains(t, err.Error(), "secret")
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Devices, devices)
+			}
+		})
+	}
+}
+
+func TestDeleteExportedDevices(t *testing.T) {
+	t.Parallel()
+	// The storage container is replaced by a server holding the blobs.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, "secret", r.URL.Query().Get("sig"))
+		switch r.URL.Path {
+		case "/devices/devices.txt":
+			w.WriteHeader(http.StatusAccepted)
+		case "/devices/forbidden.txt":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := []struct {
+		Name string
+
+		ContainerURL string
+		BlobName     string
+
+		Error error
+	}{{
+		Name: "ok",
+
+		ContainerURL: srv.URL + "/devices?sig=secret",
+		BlobName:     "devices.txt",
+	}, {
+		Name: "ok/blob not found",
+
+		ContainerURL: srv.URL + "/devices/?sig=secret",
+		BlobName:     "missing.txt",
+	}, {
+		Name: "error/no delete permission",
+
+		ContainerURL: srv.URL + "/devices?sig=secret",
+		BlobName:     "forbidden.txt",
+		Error:        common.NewHTTPError(http.StatusForbidden),
+	}, {
+		Name: "error/invalid container URL",
+
+		ContainerURL: "https://mender.blob\x7f/devices?sig=secret",
+		BlobName:     "devices.txt",
+		Error:        errors.New("iothub: invalid blob container URL$"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			client := NewClient(NewOptions(nil).
+				SetClient(srv.Client()))
+
+			err := client.DeleteExportedDevices(
+				context.Background(), tc.ContainerURL, tc.BlobName,
+			)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+					assert.NotContains(t, err.Error(), "secret")
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestGetDevice(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
@@ -628,3 +1204,297 @@ func TestGetDeviceTwins(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryTwins(t *testing.T) {
+	t.Parallel()
+	cs := &model.ConnectionString{
+		HostName: "localhost",
+		Key:      crypto.String("secret"),
+		Name:     "gibDevice",
+	}
+	const query = "SELECT * FROM devices WHERE tags.mender = true"
+	type page struct {
+		Code         int
+		Body         interface{}
+		Continuation string
+	}
+	testCases := []struct {
+		Name string
+
+		Pages []page
+
+		Twins   []DeviceTwin
+		Error   error
+		NextErr error
+	}{{
+		Name: "ok/single page",
+
+		Pages: []page{{
+			Code: http.StatusOK,
+			Body: []DeviceTwin{{DeviceID: "dev1"}, {DeviceID: "dev2"}},
+		}},
+		Twins: []DeviceTwin{{DeviceID: "dev1"}, {DeviceID: "dev2"}},
+	}, {
+		Name: "ok/multiple pages",
+
+		Pages: []page{{
+			Code:         http.StatusOK,
+			Body:         []DeviceTwin{{DeviceID: "dev1"}, {DeviceID: "dev2"}},
+			Continuation: "page2",
+		}, {
+			Code:         http.StatusOK,
+			Body:         []DeviceTwin{},
+			Continuation: "page3",
+		}, {
+			Code: http.StatusOK,
+			Body: []DeviceTwin{{DeviceID: "dev3"}},
+		}},
+		Twins: []DeviceTwin{{DeviceID: "dev1"}, {DeviceID: "dev2"}, {DeviceID: "dev3"}},
+	}, {
+		Name: "error/first page",
+
+		Pages: []page{{
+			Code: http.StatusTooManyRequests,
+		}},
+		Error: common.NewHTTPError(http.StatusTooManyRequests),
+	}, {
+		Name: "error/next page",
+
+		Pages: []page{{
+			Code:         http.StatusOK,
+			Body:         []DeviceTwin{{DeviceID: "dev1"}},
+			Continuation: "page2",
+		}, {
+			Code: http.StatusOK,
+			Body: []byte(`[{"deviceId": "dev2"`),
+		}},
+		Twins:   []DeviceTwin{{DeviceID: "dev1"}},
+		NextErr: errors.New("iothub: failed to decode API response"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			var n int
+			httpClient := &http.Client{
+				Transport: RoundTripperFunc(func(
+					req *http.Request,
+				) (*http.Response, error) {
+					if !assert.Less(t, n, len(tc.Pages), "unexpected request") {
+						return nil, errors.New("unexpected request")
+					}
+					var body struct {
+						Query string `json:"query"`
+					}
+					if assert.NoError(t, json.NewDecoder(req.Body).Decode(&body)) {
+						assert.Equal(t, query, body.Query)
+					}
+					var continuation string
+					if n > 0 {
+						continuation = tc.Pages[n-1].Continuation
+					}
+					assert.Equal(t, continuation, req.Header.Get(hdrKeyContinuation))
+
+					page := tc.Pages[n]
+					n++
+					w := httptest.NewRecorder()
+					if page.Continuation != "" {
+						w.Header().Set(hdrKeyContinuation, page.Continuation)
+					}
+					w.WriteHeader(page.Code)
+					switch typ := page.Body.(type) {
+					case []byte:
+						_, _ = w.Write(typ)
+					default:
+						b, _ := json.Marshal(typ)
+						_, _ = w.Write(b)
+					}
+					return w.Result(), nil
+				}),
+			}
+			client := NewClient(NewOptions().SetClient(httpClient))
+			ctx := context.Background()
+			iter, err := client.QueryTwins(ctx, cs, query)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			var twins []DeviceTwin
+			for iter.Next(ctx) {
+				twins = append(twins, iter.Twin())
+			}
+			assert.Equal(t, tc.Twins, twins)
+			assert.Equal(t, len(tc.Pages), n, "all pages must be fetched")
+			if tc.NextErr != nil {
+				if assert.Error(t, iter.Err()) {
+					assert.Regexp(t, tc.NextErr.Error(), iter.Err().Error())
+				}
+			} else {
+				assert.NoError(t, iter.Err())
+			}
+		})
+	}
+}
+
+func TestGetDeviceTwinsContinuation(t *testing.T) {
+	t.Parallel()
+	cs := &model.ConnectionString{
+		HostName: "localhost",
+		Key:      crypto.String("secret"),
+		Name:     "gibDevice",
+	}
+	deviceIDs := []string{
+		"d9b4b693-fb1c-44fa-9e84-30e6aa0ee0c5",
+		"53a57499-51a6-41ee-a1ed-7abb994e8bb4",
+		"53a57499-51a6-41ee-a1ed-7abb994e8bb3",
+	}
+	// The IoT Hub may return fewer twins per page than requested.
+	httpClient := &http.Client{
+		Transport: RoundTripperFunc(func(
+			req *http.Request,
+		) (*http.Response, error) {
+			w := httptest.NewRecorder()
+			var page []DeviceTwin
+			switch req.Header.Get(hdrKeyContinuation) {
+			case "":
+				w.Header().Set(hdrKeyContinuation, "next")
+				page = []DeviceTwin{{DeviceID: deviceIDs[0]}, {DeviceID: deviceIDs[1]}}
+			case "next":
+				page = []DeviceTwin{{DeviceID: deviceIDs[2]}}
+			}
+			b, _ := json.Marshal(page)
+			_, _ = w.Write(b)
+			return w.Result(), nil
+		}),
+	}
+	client := NewClient(NewOptions().SetClient(httpClient))
+	twins, err := client.GetDeviceTwins(context.Background(), cs, deviceIDs)
+	assert.NoError(t, err)
+	assert.Equal(t, []DeviceTwin{
+		{DeviceID: deviceIDs[0]},
+		{DeviceID: deviceIDs[1]},
+		{DeviceID: deviceIDs[2]},
+	}, twins)
+}
+
+func TestCheckPermissions(t *testing.T) {
+	t.Parallel()
+	cs := &model.ConnectionString{
+		HostName: "localhost",
+		Key:      crypto.String("secret"),
+		Name:     "gimmeAccessPls",
+	}
+	testCases := []struct {
+		Name string
+
+		ConnStr *model.ConnectionString
+
+		QueryCode  int
+		DeleteCode int
+		RTError    error
+
+		Missing []string
+		Error   error
+	}{{
+		Name: "ok",
+
+		ConnStr:    cs,
+		QueryCode:  http.StatusOK,
+		DeleteCode: http.StatusNotFound,
+	}, {
+		Name: "ok, registry write missing",
+
+		ConnStr:    cs,
+		QueryCode:  http.StatusOK,
+		DeleteCode: http.StatusUnauthorized,
+
+		Missing: []string{PermissionRegistryWrite},
+	}, {
+		Name: "ok, all permissions missing",
+
+		ConnStr:    cs,
+		QueryCode:  http.StatusUnauthorized,
+		DeleteCode: http.StatusUnauthorized,
+
+		Missing: []string{PermissionRegistryRead, PermissionRegistryWrite},
+	}, {
+		Name: "error/quota exceeded",
+
+		ConnStr:   cs,
+		QueryCode: http.StatusForbidden,
+		Error:     common.NewHTTPError(http.StatusForbidden),
+	}, {
+		Name: "error/throttled",
+
+		ConnStr:    cs,
+		QueryCode:  http.StatusOK,
+		DeleteCode: http.StatusTooManyRequests,
+		Error:      common.NewHTTPError(http.StatusTooManyRequests),
+	}, {
+		Name: "error/invalid connection string",
+
+		ConnStr: &model.ConnectionString{
+			Name: "bad",
+		},
+		Error: errors.New("failed to prepare request: invalid connection string"),
+	}, {
+		Name: "error/internal roundtrip error",
+
+		ConnStr: cs,
+		RTError: errors.New("idk"),
+		Error:   errors.New("failed to execute request:.*idk"),
+	}, {
+		Name: "error/bad status code",
+
+		ConnStr:   cs,
+		QueryCode: http.StatusServiceUnavailable,
+		Error:     common.NewHTTPError(http.StatusServiceUnavailable),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			httpClient := &http.Client{
+				Transport: RoundTripperFunc(func(
+					r *http.Request,
+				) (*http.Response, error) {
+					if tc.RTError != nil {
+						return nil, tc.RTError
+					}
+					w := httptest.NewRecorder()
+					switch r.Method {
+					case http.MethodPost:
+						assert.Equal(t, uriQueryTwin, r.URL.Path)
+						w.WriteHeader(tc.QueryCode)
+					case http.MethodDelete:
+						assert.True(t, strings.HasPrefix(r.URL.Path,
+							uriDevices+"/iot-manager-probe-"))
+						assert.Equal(t, probeETag, r.Header.Get("If-Match"))
+						w.WriteHeader(tc.DeleteCode)
+					default:
+						t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+					}
+					return w.Result(), nil
+				}),
+			}
+			client := NewClient(NewOptions(nil).
+				SetClient(httpClient))
+
+			missing, err := client.CheckPermissions(ctx, tc.ConnStr)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t, tc.Error.Error(), err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Missing, missing)
+			}
+		})
+	}
+}
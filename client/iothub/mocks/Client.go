@@ -30,6 +30,66 @@ type Client struct {
 	mock.Mock
 }
 
+// BulkUpdateDevices provides a mock function with given fields: ctx, cs, devices
+func (_m *Client) BulkUpdateDevices(ctx context.Context, cs *model.ConnectionString, devices []*iothub.Device) (*iothub.BulkRegistryOperationResult, error) {
+	ret := _m.Called(ctx, cs, devices)
+
+	var r0 *iothub.BulkRegistryOperationResult
+	if rf, ok := ret.Get(0).(func(context.Context, *model.ConnectionString, []*iothub.Device) *iothub.BulkRegistryOperationResult); ok {
+		r0 = rf(ctx, cs, devices)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*iothub.BulkRegistryOperationResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.ConnectionString, []*iothub.Device) error); ok {
+		r1 = rf(ctx, cs, devices)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CancelJob provides a mock function with given fields: ctx, cs, jobID
+func (_m *Client) CancelJob(ctx context.Context, cs *model.ConnectionString, jobID string) error {
+	ret := _m.Called(ctx, cs, jobID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.ConnectionString, string) error); ok {
+		r0 = rf(ctx, cs, jobID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CheckPermissions provides a mock function with given fields: ctx, cs
+func (_m *Client) CheckPermissions(ctx context.Context, cs *model.ConnectionString) ([]string, error) {
+	ret := _m.Called(ctx, cs)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, *model.ConnectionString) []string); ok {
+		r0 = rf(ctx, cs)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.ConnectionString) error); ok {
+		r1 = rf(ctx, cs)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteDevice provides a mock function with given fields: ctx, cs, id
 func (_m *Client) DeleteDevice(ctx context.Context, cs *model.ConnectionString, id string) error {
 	ret := _m.Called(ctx, cs, id)
@@ -44,6 +104,43 @@ func (_m *Client) DeleteDevice(ctx context.Context, cs *model.ConnectionString,
 	return r0
 }
 
+// DeleteExportedDevices provides a mock function with given fields: ctx, containerURL, blobName
+func (_m *Client) DeleteExportedDevices(ctx context.Context, containerURL string, blobName string) error {
+	ret := _m.Called(ctx, containerURL, blobName)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, containerURL, blobName)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ExportDevices provides a mock function with given fields: ctx, cs, containerURL, blobName
+func (_m *Client) ExportDevices(ctx context.Context, cs *model.ConnectionString, containerURL string, blobName string) (*iothub.Job, error) {
+	ret := _m.Called(ctx, cs, containerURL, blobName)
+
+	var r0 *iothub.Job
+	if rf, ok := ret.Get(0).(func(context.Context, *model.ConnectionString, string, string) *iothub.Job); ok {
+		r0 = rf(ctx, cs, containerURL, blobName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*iothub.Job)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.ConnectionString, string, string) error); ok {
+		r1 = rf(ctx, cs, containerURL, blobName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetDevice provides a mock function with given fields: ctx, cs, id
 func (_m *Client) GetDevice(ctx context.Context, cs *model.ConnectionString, id string) (*iothub.Device, error) {
 	ret := _m.Called(ctx, cs, id)
@@ -113,6 +210,75 @@ func (_m *Client) GetDeviceTwins(ctx context.Context, cs *model.ConnectionString
 	return r0, r1
 }
 
+// GetExportedDevices provides a mock function with given fields: ctx, containerURL, blobName
+func (_m *Client) GetExportedDevices(ctx context.Context, containerURL string, blobName string) ([]iothub.Device, error) {
+	ret := _m.Called(ctx, containerURL, blobName)
+
+	var r0 []iothub.Device
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []iothub.Device); ok {
+		r0 = rf(ctx, containerURL, blobName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]iothub.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, containerURL, blobName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJob provides a mock function with given fields: ctx, cs, jobID
+func (_m *Client) GetJob(ctx context.Context, cs *model.ConnectionString, jobID string) (*iothub.Job, error) {
+	ret := _m.Called(ctx, cs, jobID)
+
+	var r0 *iothub.Job
+	if rf, ok := ret.Get(0).(func(context.Context, *model.ConnectionString, string) *iothub.Job); ok {
+		r0 = rf(ctx, cs, jobID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*iothub.Job)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.ConnectionString, string) error); ok {
+		r1 = rf(ctx, cs, jobID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// QueryTwins provides a mock function with given fields: ctx, cs, query
+func (_m *Client) QueryTwins(ctx context.Context, cs *model.ConnectionString, query string) (iothub.TwinIterator, error) {
+	ret := _m.Called(ctx, cs, query)
+
+	var r0 iothub.TwinIterator
+	if rf, ok := ret.Get(0).(func(context.Context, *model.ConnectionString, string) iothub.TwinIterator); ok {
+		r0 = rf(ctx, cs, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(iothub.TwinIterator)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.ConnectionString, string) error); ok {
+		r1 = rf(ctx, cs, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdateDeviceTwin provides a mock function with given fields: ctx, cs, id, r
 func (_m *Client) UpdateDeviceTwin(ctx context.Context, cs *model.ConnectionString, id string, r *iothub.DeviceTwinUpdate) error {
 	ret := _m.Called(ctx, cs, id, r)
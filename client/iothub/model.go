@@ -20,6 +20,7 @@ import (
 	"encoding/base64"
 	"io"
 	"reflect"
+	"time"
 
 	"github.com/mendersoftware/iot-manager/model"
 
@@ -195,3 +196,110 @@ type DeviceTwinUpdate struct {
 	ETag       string                 `json:"-"`
 	Replace    bool                   `json:"-"`
 }
+
+// ImportMode is the registry operation applied to a device by a bulk
+// registry request.
+type ImportMode string
+
+const (
+	// ImportModeUpdate overwrites the device identity regardless of
+	// its ETag.
+	ImportModeUpdate ImportMode = "update"
+	// ImportModeUpdateIfMatchETag overwrites the device identity if the
+	// ETag matches.
+	ImportModeUpdateIfMatchETag ImportMode = "updateIfMatchETag"
+)
+
+// exportImportDevice is a device operation of a bulk registry request.
+type exportImportDevice struct {
+	ID           string              `json:"id"`
+	ETag         string              `json:"eTag,omitempty"`
+	ImportMode   ImportMode          `json:"importMode"`
+	Status       Status              `json:"status,omitempty"`
+	StatusReason string              `json:"statusReason,omitempty"`
+	Auth         *Auth               `json:"authentication,omitempty"`
+	Capabilities *DeviceCapabilities `json:"capabilities,omitempty"`
+	DeviceScope  string              `json:"deviceScope,omitempty"`
+}
+
+func newExportImportDevice(dev *Device) exportImportDevice {
+	mode := ImportModeUpdate
+	if dev.ETag != "" {
+		mode = ImportModeUpdateIfMatchETag
+	}
+	return exportImportDevice{
+		ID:           dev.DeviceID,
+		ETag:         dev.ETag,
+		ImportMode:   mode,
+		Status:       dev.Status,
+		StatusReason: dev.StatusReason,
+		Auth:         dev.Auth,
+		Capabilities: dev.DeviceCapabilities,
+		DeviceScope:  dev.DeviceScope,
+	}
+}
+
+// DeviceRegistryOperationError is the error of a device operation of a
+// bulk registry request.
+type DeviceRegistryOperationError struct {
+	DeviceID    string `json:"deviceId"`
+	ErrorCode   string `json:"errorCode"`
+	ErrorStatus string `json:"errorStatus"`
+}
+
+func (err DeviceRegistryOperationError) Error() string {
+	return "iothub: " + err.ErrorCode + ": " + err.ErrorStatus
+}
+
+// BulkRegistryOperationResult is the result of a bulk registry request.
+type BulkRegistryOperationResult struct {
+	IsSuccessful bool                           `json:"isSuccessful"`
+	Errors       []DeviceRegistryOperationError `json:"errors,omitempty"`
+}
+
+// JobType is the type of an import/export devices job.
+type JobType string
+
+const (
+	// JobTypeExport exports the device identities of the registry to a
+	// blob storage container.
+	JobTypeExport JobType = "export"
+)
+
+// JobStatus is the status of an import/export devices job.
+type JobStatus string
+
+const (
+	JobStatusUnknown   JobStatus = "unknown"
+	JobStatusEnqueued  JobStatus = "enqueued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// Done returns true if the job will not make any further progress.
+func (status JobStatus) Done() bool {
+	switch status {
+	case JobStatusCompleted, JobStatusFailed, JobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Job holds the properties of an import/export devices job.
+type Job struct {
+	JobID  string    `json:"jobId,omitempty"`
+	Type   JobType   `json:"type"`
+	Status JobStatus `json:"status,omitempty"`
+	// Progress is the completion percentage of the job.
+	Progress int `json:"progress,omitempty"`
+
+	OutputBlobContainerURI string `json:"outputBlobContainerUri,omitempty"`
+	OutputBlobName         string `json:"outputBlobName,omitempty"`
+	ExcludeKeysInExport    bool   `json:"excludeKeysInExport,omitempty"`
+
+	FailureReason string     `json:"failureReason,omitempty"`
+	StartTime     *time.Time `json:"startTimeUtc,omitempty"`
+	EndTime       *time.Time `json:"endTimeUtc,omitempty"`
+}
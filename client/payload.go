@@ -0,0 +1,140 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mendersoftware/iot-manager/model"
+)
+
+const (
+	ContentTypeJSON        = "application/json"
+	ContentTypeCloudEvents = "application/cloudevents+json"
+
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventsSource is the source attribute of the CloudEvents.
+	CloudEventsSource = "/mender/iot-manager"
+	// CloudEventsTypePrefix is prepended to the event type to form the
+	// type attribute of the CloudEvents.
+	CloudEventsTypePrefix = "io.mender."
+
+	HdrKeyCloudEventsSpecVersion = "Ce-Specversion"
+	HdrKeyCloudEventsID          = "Ce-Id"
+	HdrKeyCloudEventsSource      = "Ce-Source"
+	HdrKeyCloudEventsType        = "Ce-Type"
+	HdrKeyCloudEventsTime        = "Ce-Time"
+)
+
+var ErrPayloadNotJSON = errors.New("payload template did not render valid JSON")
+
+// cloudEvent is a CloudEvents 1.0 event in the JSON event format.
+type cloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Time            string      `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+func newCloudEvent(event model.WebhookEvent) cloudEvent {
+	return cloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              event.ID.String(),
+		Source:          CloudEventsSource,
+		Type:            CloudEventsTypePrefix + string(event.Type),
+		Time:            event.EventTS.UTC().Format(time.RFC3339Nano),
+		DataContentType: ContentTypeJSON,
+		Data:            event.Data,
+	}
+}
+
+// webhookPayload is the rendered body of a webhook request.
+type webhookPayload struct {
+	Body        []byte
+	ContentType string
+	// Header contains additional headers describing the payload.
+	Header http.Header
+}
+
+// renderPayload renders the body of the webhook request in the format
+// configured by the credentials.
+func renderPayload(
+	creds *model.HTTPCredentials,
+	event model.WebhookEvent,
+) (*webhookPayload, error) {
+	var (
+		payload = &webhookPayload{ContentType: ContentTypeJSON}
+		err     error
+	)
+	switch creds.PayloadFormat {
+	case model.PayloadFormatCloudEvents:
+		payload.ContentType = ContentTypeCloudEvents
+		payload.Body, err = json.Marshal(newCloudEvent(event))
+
+	case model.PayloadFormatCloudEventsBinary:
+		ce := newCloudEvent(event)
+		payload.Header = http.Header{
+			HdrKeyCloudEventsSpecVersion: {ce.SpecVersion},
+			HdrKeyCloudEventsID:          {ce.ID},
+			HdrKeyCloudEventsSource:      {ce.Source},
+			HdrKeyCloudEventsType:        {ce.Type},
+			HdrKeyCloudEventsTime:        {ce.Time},
+		}
+		payload.Body, err = json.Marshal(ce.Data)
+
+	case model.PayloadFormatTemplate:
+		payload.Body, err = renderTemplate(creds.PayloadTemplate, event)
+
+	default:
+		payload.Body, err = json.Marshal(event)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func renderTemplate(text string, event model.WebhookEvent) ([]byte, error) {
+	tmpl, err := model.ParsePayloadTemplate(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse payload template: %w", err)
+	}
+	// Execute the template on the JSON representation of the event so
+	// that the fields are referenced by the documented names.
+	var data map[string]interface{}
+	b, err := json.Marshal(event)
+	if err == nil {
+		err = json.Unmarshal(b, &data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render payload template: %w", err)
+	} else if !json.Valid(buf.Bytes()) {
+		return nil, ErrPayloadNotJSON
+	}
+	return buf.Bytes(), nil
+}
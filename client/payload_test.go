@@ -0,0 +1,132 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/iot-manager/model"
+)
+
+func TestNewWebhookRequestPayloadFormat(t *testing.T) {
+	t.Parallel()
+	event := model.WebhookEvent{
+		ID:      uuid.MustParse("9cfb3f6c-5a4f-4bd0-8a1c-0f1b5a2e6d3e"),
+		Type:    model.EventTypeDeviceStatusChanged,
+		Data:    model.DeviceEvent{ID: "foo", Status: model.StatusAccepted},
+		EventTS: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	testCases := map[string]struct {
+		Format   model.PayloadFormat
+		Template string
+
+		ContentType string
+		Header      http.Header
+		Body        string
+		Error       string
+	}{
+		"native": {
+			ContentType: ContentTypeJSON,
+			Body: `{
+				"id": "9cfb3f6c-5a4f-4bd0-8a1c-0f1b5a2e6d3e",
+				"type": "device-status-changed",
+				"data": {"id": "foo", "status": "accepted"},
+				"time": "2024-01-02T03:04:05Z"
+			}`,
+		},
+		"cloudevents": {
+			Format:      model.PayloadFormatCloudEvents,
+			ContentType: ContentTypeCloudEvents,
+			Body: `{
+				"specversion": "1.0",
+				"id": "9cfb3f6c-5a4f-4bd0-8a1c-0f1b5a2e6d3e",
+				"source": "/mender/iot-manager",
+				"type": "io.mender.device-status-changed",
+				"time": "2024-01-02T03:04:05Z",
+				"datacontenttype": "application/json",
+				"data": {"id": "foo", "status": "accepted"}
+			}`,
+		},
+		"cloudevents binary": {
+			Format:      model.PayloadFormatCloudEventsBinary,
+			ContentType: ContentTypeJSON,
+			Header: http.Header{
+				HdrKeyCloudEventsSpecVersion: {"1.0"},
+				HdrKeyCloudEventsID:          {"9cfb3f6c-5a4f-4bd0-8a1c-0f1b5a2e6d3e"},
+				HdrKeyCloudEventsSource:      {"/mender/iot-manager"},
+				HdrKeyCloudEventsType:        {"io.mender.device-status-changed"},
+				HdrKeyCloudEventsTime:        {"2024-01-02T03:04:05Z"},
+			},
+			Body: `{"id": "foo", "status": "accepted"}`,
+		},
+		"template": {
+			Format: model.PayloadFormatTemplate,
+			Template: `{"text": {{ printf "Device %s is %s" ` +
+				`.data.id .data.status | json }}}`,
+			ContentType: ContentTypeJSON,
+			Body:        `{"text": "Device foo is accepted"}`,
+		},
+		"error, template missing key": {
+			Format:   model.PayloadFormatTemplate,
+			Template: `{"text": "{{ .data.name }}"}`,
+			Error: `failed to render payload template: template: payload:1:18: ` +
+				`executing "payload" at <.data.name>: map has no entry for key "name"`,
+		},
+		"error, template not JSON": {
+			Format:   model.PayloadFormatTemplate,
+			Template: `text: {{ .data.id }}`,
+			Error:    ErrPayloadNotJSON.Error(),
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			secret := model.HexSecret("secret")
+			creds := &model.Credentials{
+				Type: model.CredentialTypeHTTP,
+				HTTP: &model.HTTPCredentials{
+					URL:             "http://localhost",
+					Secret:          &secret,
+					PayloadFormat:   tc.Format,
+					PayloadTemplate: tc.Template,
+				},
+			}
+			req, err := NewWebhookRequest(context.Background(), creds, event)
+			if tc.Error != "" {
+				assert.EqualError(t, err, tc.Error)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.ContentType, req.Header.Get(HdrKeyContentType))
+			for key := range tc.Header {
+				assert.Equal(t, tc.Header.Get(key), req.Header.Get(key))
+			}
+			// The rendered payload is signed
+			assert.NoError(t, VerifyWebhookRequest(req, []byte(secret), 0))
+			b, _ := io.ReadAll(req.Body)
+			assert.JSONEq(t, tc.Body, string(b))
+		})
+	}
+}
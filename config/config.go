@@ -93,6 +93,107 @@ const (
 	// SettingWebhooksTimeoutSecondsDefault define the default timeout
 	// in seconds for webhook requests.
 	SettingWebhooksTimeoutSecondsDefault = "10" // 10 seconds
+
+	// SettingWebhooksRetryMaxAttempts sets the maximum number of attempts
+	// (including the first one) for delivering an event to a webhook.
+	SettingWebhooksRetryMaxAttempts = "webhooks_retry_max_attempts"
+	// SettingWebhooksRetryMaxAttemptsDefault defines the default maximum
+	// number of webhook delivery attempts.
+	SettingWebhooksRetryMaxAttemptsDefault = "5"
+
+	// SettingWebhooksRetryBackoffSeconds sets the delay before the first
+	// webhook retry; the delay doubles on every following attempt.
+	SettingWebhooksRetryBackoffSeconds = "webhooks_retry_backoff_seconds"
+	// SettingWebhooksRetryBackoffSecondsDefault defines the default delay
+	// before the first webhook retry.
+	SettingWebhooksRetryBackoffSecondsDefault = "30" // 30 seconds
+
+	// SettingWebhooksRetryMaxBackoffSeconds sets the upper bound for the
+	// delay between two webhook delivery attempts.
+	SettingWebhooksRetryMaxBackoffSeconds = "webhooks_retry_max_backoff_seconds"
+	// SettingWebhooksRetryMaxBackoffSecondsDefault defines the default upper
+	// bound for the delay between webhook delivery attempts.
+	SettingWebhooksRetryMaxBackoffSecondsDefault = "3600" // one hour
+
+	// SettingWebhooksRetryIntervalSeconds sets how often the delivery
+	// worker polls for pending webhook deliveries.
+	SettingWebhooksRetryIntervalSeconds = "webhooks_retry_interval_seconds"
+	// SettingWebhooksRetryIntervalSecondsDefault defines the default
+	// polling interval of the delivery worker.
+	SettingWebhooksRetryIntervalSecondsDefault = "10" // 10 seconds
+
+	// SettingWebhooksCircuitBreakerFailures sets the number of consecutive
+	// delivery failures suspending a webhook integration; 0 disables it.
+	SettingWebhooksCircuitBreakerFailures = "webhooks_circuit_breaker_failures"
+	// SettingWebhooksCircuitBreakerFailuresDefault defines the default
+	// number of consecutive failures suspending a webhook integration.
+	SettingWebhooksCircuitBreakerFailuresDefault = "5"
+
+	// SettingWebhooksCircuitBreakerFailureRate sets the percentage of
+	// failures among the latest deliveries suspending a webhook
+	// integration; 0 disables it.
+	SettingWebhooksCircuitBreakerFailureRate = "webhooks_circuit_breaker_failure_rate"
+	// SettingWebhooksCircuitBreakerFailureRateDefault defines the default
+	// percentage of failures suspending a webhook integration.
+	SettingWebhooksCircuitBreakerFailureRateDefault = "50"
+
+	// SettingWebhooksCircuitBreakerWindow sets the number of latest
+	// deliveries the failure rate is computed on.
+	SettingWebhooksCircuitBreakerWindow = "webhooks_circuit_breaker_window"
+	// SettingWebhooksCircuitBreakerWindowDefault defines the default
+	// number of deliveries the failure rate is computed on.
+	SettingWebhooksCircuitBreakerWindowDefault = "20"
+
+	// SettingWebhooksCircuitBreakerCooldownSeconds sets the delay between
+	// two probe deliveries to a suspended webhook integration.
+	SettingWebhooksCircuitBreakerCooldownSeconds = "webhooks_circuit_breaker_cooldown_seconds"
+	// SettingWebhooksCircuitBreakerCooldownSecondsDefault defines the
+	// default delay between two probes of a suspended integration.
+	SettingWebhooksCircuitBreakerCooldownSecondsDefault = "300" // 5 minutes
+
+	// SettingAsyncWorkers sets the number of workers processing the device
+	// events (status changes, provisioning and decommissioning).
+	SettingAsyncWorkers = "async_workers"
+	// SettingAsyncWorkersDefault defines the default number of workers
+	// processing the device events.
+	SettingAsyncWorkersDefault = "16"
+
+	// SettingAsyncQueueSize sets the maximum number of device events
+	// waiting for a worker; further events are rejected.
+	SettingAsyncQueueSize = "async_queue_size"
+	// SettingAsyncQueueSizeDefault defines the default maximum number of
+	// device events waiting for a worker.
+	SettingAsyncQueueSizeDefault = "10000"
+
+	// SettingAsyncTenantQueueSize sets the maximum number of device events
+	// of a single tenant waiting for a worker.
+	SettingAsyncTenantQueueSize = "async_tenant_queue_size"
+	// SettingAsyncTenantQueueSizeDefault defines the default maximum
+	// number of device events of a tenant waiting for a worker.
+	SettingAsyncTenantQueueSizeDefault = "1000"
+
+	// SettingAsyncBatchSize sets the maximum number of status changes of
+	// the devices of a tenant processed together, e.g. with a single IoT
+	// Hub bulk request.
+	SettingAsyncBatchSize = "async_batch_size"
+	// SettingAsyncBatchSizeDefault defines the default maximum number of
+	// status changes processed together.
+	SettingAsyncBatchSizeDefault = "100"
+
+	// SettingAsyncDrainTimeoutSeconds sets how long the service waits for
+	// the queued device events to be processed on shutdown.
+	SettingAsyncDrainTimeoutSeconds = "async_drain_timeout_seconds"
+	// SettingAsyncDrainTimeoutSecondsDefault defines the default time to
+	// wait for the queued device events on shutdown; together with the
+	// time given to the HTTP server to shut down, it stays below the
+	// default termination grace period of a Kubernetes pod (30 seconds).
+	SettingAsyncDrainTimeoutSecondsDefault = "20"
+
+	// SettingTracingOTLPEndpoint sets the URL of the OTLP/HTTP endpoint
+	// the trace spans are exported to; tracing is disabled if empty.
+	SettingTracingOTLPEndpoint = "tracing_otlp_endpoint"
+	// SettingTracingOTLPEndpointDefault disables the export of the spans.
+	SettingTracingOTLPEndpointDefault = ""
 )
 
 var (
@@ -109,5 +210,40 @@ var (
 		{Key: SettingDomainWhitelist, Value: SettingDomainWhitelistDefault},
 		{Key: SettingEventExpirationTimeout, Value: SettingEventExpirationTimeoutDefault},
 		{Key: SettingWebhooksTimeoutSeconds, Value: SettingWebhooksTimeoutSecondsDefault},
+		{Key: SettingWebhooksRetryMaxAttempts, Value: SettingWebhooksRetryMaxAttemptsDefault},
+		{Key: SettingWebhooksRetryBackoffSeconds, Value: SettingWebhooksRetryBackoffSecondsDefault},
+		{
+			Key:   SettingWebhooksRetryMaxBackoffSeconds,
+			Value: SettingWebhooksRetryMaxBackoffSecondsDefault,
+		},
+		{
+			Key:   SettingWebhooksRetryIntervalSeconds,
+			Value: SettingWebhooksRetryIntervalSecondsDefault,
+		},
+		{
+			Key:   SettingWebhooksCircuitBreakerFailures,
+			Value: SettingWebhooksCircuitBreakerFailuresDefault,
+		},
+		{
+			Key:   SettingWebhooksCircuitBreakerFailureRate,
+			Value: SettingWebhooksCircuitBreakerFailureRateDefault,
+		},
+		{
+			Key:   SettingWebhooksCircuitBreakerWindow,
+			Value: SettingWebhooksCircuitBreakerWindowDefault,
+		},
+		{
+			Key:   SettingWebhooksCircuitBreakerCooldownSeconds,
+			Value: SettingWebhooksCircuitBreakerCooldownSecondsDefault,
+		},
+		{Key: SettingAsyncWorkers, Value: SettingAsyncWorkersDefault},
+		{Key: SettingAsyncQueueSize, Value: SettingAsyncQueueSizeDefault},
+		{Key: SettingAsyncTenantQueueSize, Value: SettingAsyncTenantQueueSizeDefault},
+		{Key: SettingAsyncBatchSize, Value: SettingAsyncBatchSizeDefault},
+		{
+			Key:   SettingAsyncDrainTimeoutSeconds,
+			Value: SettingAsyncDrainTimeoutSecondsDefault,
+		},
+		{Key: SettingTracingOTLPEndpoint, Value: SettingTracingOTLPEndpointDefault},
 	}
 )
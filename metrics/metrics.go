@@ -0,0 +1,209 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package metrics collects the Prometheus metrics of the service.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "iot_manager"
+
+	// routeUnmatched labels the requests not matching any route.
+	routeUnmatched = "unmatched"
+	// outboundErrorStatusCode is the lowest response status code counted
+	// as an outbound request error.
+	outboundErrorStatusCode = http.StatusInternalServerError
+)
+
+// Outbound providers
+const (
+	ProviderIoTHub     = "iothub"
+	ProviderIoTCore    = "iotcore"
+	ProviderWebhook    = "webhook"
+	ProviderWorkflows  = "workflows"
+	ProviderDeviceauth = "deviceauth"
+)
+
+// Actions taken on the devices by the devices synchronization
+const (
+	SyncDevicesChecked     = "checked"
+	SyncDevicesProvisioned = "provisioned"
+	SyncDevicesDeleted     = "deleted"
+	SyncDevicesStatusFixed = "status_fixed"
+)
+
+// Asynchronous tasks spawned by the internal API
+const (
+	TaskSetDeviceStatus    = "set_device_status"
+	TaskProvisionDevice    = "provision_device"
+	TaskDecommissionDevice = "decommission_device"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests handled by route and status code.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the HTTP requests handled by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	outboundRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "outbound",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the outbound requests by provider.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+	outboundRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "outbound",
+		Name:      "request_errors_total",
+		Help: "Number of outbound requests by provider which failed " +
+			"or returned a server error.",
+	}, []string{"provider"})
+
+	syncRuns = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "sync",
+		Name:      "runs_total",
+		Help:      "Number of devices synchronization runs.",
+	})
+	syncDevices = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "sync",
+		Name:      "devices_total",
+		Help:      "Number of devices checked and fixed by the devices synchronization.",
+	}, []string{"action"})
+
+	asyncTasksInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "async",
+		Name:      "tasks_in_flight",
+		Help:      "Number of queued and running asynchronous tasks.",
+	}, []string{"task"})
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		outboundRequestDuration,
+		outboundRequestErrors,
+		syncRuns,
+		syncDevices,
+		asyncTasksInFlight,
+	)
+}
+
+// Handler returns the HTTP handler exposing the metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the count and latency of the requests handled by
+// the router. Requests are labeled by route template to keep the number
+// of series bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = routeUnmatched
+		}
+		method := c.Request.Method
+		httpRequests.
+			WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).
+			Inc()
+		httpRequestDuration.
+			WithLabelValues(method, route).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// NewTransport wraps the transport recording the latency and errors of
+// the requests to the provider. A nil transport defaults to
+// http.DefaultTransport.
+func NewTransport(provider string, transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	duration := outboundRequestDuration.WithLabelValues(provider)
+	errs := outboundRequestErrors.WithLabelValues(provider)
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		rsp, err := transport.RoundTrip(req)
+		duration.Observe(time.Since(start).Seconds())
+		if err != nil || rsp.StatusCode >= outboundErrorStatusCode {
+			errs.Inc()
+		}
+		return rsp, err
+	})
+}
+
+// InstrumentClient returns a copy of the client with the transport
+// instrumented for the provider.
+func InstrumentClient(provider string, client *http.Client) *http.Client {
+	if client == nil {
+		client = new(http.Client)
+	}
+	instrumented := *client
+	instrumented.Transport = NewTransport(provider, client.Transport)
+	return &instrumented
+}
+
+// SyncDevicesRun counts a devices synchronization run.
+func SyncDevicesRun() {
+	syncRuns.Inc()
+}
+
+// AddSyncDevices adds n devices to the count of the synchronization action.
+func AddSyncDevices(action string, n int) {
+	syncDevices.WithLabelValues(action).Add(float64(n))
+}
+
+// TrackAsyncTask counts the task as in flight until the returned function
+// is called.
+func TrackAsyncTask(task string) (done func()) {
+	gauge := asyncTasksInFlight.WithLabelValues(task)
+	gauge.Inc()
+	return gauge.Dec
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/devices/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	matched := httpRequests.WithLabelValues(http.MethodGet, "/devices/:id", "204")
+	unmatched := httpRequests.WithLabelValues(http.MethodGet, routeUnmatched, "404")
+	before := testutil.ToFloat64(matched)
+	beforeUnmatched := testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/devices/1", "/devices/2", "/foo"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, before+2, testutil.ToFloat64(matched))
+	assert.Equal(t, beforeUnmatched+1, testutil.ToFloat64(unmatched))
+}
+
+type roundTripperStub struct {
+	code int
+	err  error
+}
+
+func (rt roundTripperStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.err != nil {
+		return nil, rt.err
+	}
+	return &http.Response{
+		StatusCode: rt.code,
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+func TestNewTransport(t *testing.T) {
+	const provider = "test"
+	errs := outboundRequestErrors.WithLabelValues(provider)
+
+	testCases := []struct {
+		Name string
+
+		RoundTripper roundTripperStub
+
+		Error bool
+	}{{
+		Name: "ok",
+
+		RoundTripper: roundTripperStub{code: http.StatusOK},
+	}, {
+		Name: "ok, client error",
+
+		RoundTripper: roundTripperStub{code: http.StatusNotFound},
+	}, {
+		Name: "error, server error",
+
+		RoundTripper: roundTripperStub{code: http.StatusBadGateway},
+		Error:        true,
+	}, {
+		Name: "error, transport",
+
+		RoundTripper: roundTripperStub{err: errors.New("connection refused")},
+		Error:        true,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			before := testutil.ToFloat64(errs)
+			client := InstrumentClient(provider, &http.Client{
+				Transport: tc.RoundTripper,
+			})
+			req, _ := http.NewRequest(http.MethodGet, "http://localhost", nil)
+			rsp, err := client.Do(req)
+			if err == nil {
+				rsp.Body.Close()
+			}
+			if tc.Error {
+				assert.Equal(t, before+1, testutil.ToFloat64(errs))
+			} else {
+				assert.Equal(t, before, testutil.ToFloat64(errs))
+			}
+		})
+	}
+}
+
+func TestInstrumentClient(t *testing.T) {
+	transport := roundTripperStub{code: http.StatusOK}
+	client := &http.Client{Transport: transport}
+	instrumented := InstrumentClient(ProviderWebhook, client)
+	assert.Equal(t, transport, client.Transport, "the client must not be modified")
+	assert.NotEqual(t, client, instrumented)
+
+	instrumented = InstrumentClient(ProviderWebhook, nil)
+	assert.NotNil(t, instrumented.Transport)
+}
+
+func TestSyncDevices(t *testing.T) {
+	runs := testutil.ToFloat64(syncRuns)
+	checked := testutil.ToFloat64(syncDevices.WithLabelValues(SyncDevicesChecked))
+
+	SyncDevicesRun()
+	AddSyncDevices(SyncDevicesChecked, 3)
+
+	assert.Equal(t, runs+1, testutil.ToFloat64(syncRuns))
+	assert.Equal(t, checked+3,
+		testutil.ToFloat64(syncDevices.WithLabelValues(SyncDevicesChecked)))
+}
+
+func TestTrackAsyncTask(t *testing.T) {
+	gauge := asyncTasksInFlight.WithLabelValues(TaskProvisionDevice)
+	before := testutil.ToFloat64(gauge)
+
+	done := TrackAsyncTask(TaskProvisionDevice)
+	assert.Equal(t, before+1, testutil.ToFloat64(gauge))
+	done()
+	assert.Equal(t, before, testutil.ToFloat64(gauge))
+}
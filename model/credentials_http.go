@@ -15,11 +15,19 @@
 package model
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"net/textproto"
 	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/mendersoftware/iot-manager/crypto"
 	inet "github.com/mendersoftware/iot-manager/internal/net"
@@ -53,9 +61,283 @@ func (sec *HexSecret) UnmarshalBSON(b []byte) error {
 	return cStr.UnmarshalBSON(b)
 }
 
+type SignatureVersion string
+
+const (
+	// SignatureVersion1 signs the request body.
+	SignatureVersion1 SignatureVersion = "v1"
+	// SignatureVersion2 signs the request timestamp and body.
+	SignatureVersion2 SignatureVersion = "v2"
+)
+
+var validateSignatureVersion = validation.In(
+	SignatureVersion1,
+	SignatureVersion2,
+)
+
+func (ver SignatureVersion) Validate() error {
+	return validateSignatureVersion.Validate(ver)
+}
+
+type PayloadFormat string
+
+const (
+	// PayloadFormatNative posts the WebhookEvent as JSON.
+	PayloadFormatNative PayloadFormat = "native"
+	// PayloadFormatCloudEvents posts a CloudEvents 1.0 event in structured
+	// content mode.
+	PayloadFormatCloudEvents PayloadFormat = "cloudevents"
+	// PayloadFormatCloudEventsBinary posts a CloudEvents 1.0 event in
+	// binary content mode: the event data is the body and the attributes
+	// are sent as ce- headers.
+	PayloadFormatCloudEventsBinary PayloadFormat = "cloudevents-binary"
+	// PayloadFormatTemplate posts the JSON rendered by the payload
+	// template.
+	PayloadFormatTemplate PayloadFormat = "template"
+)
+
+var validatePayloadFormat = validation.In(
+	PayloadFormatNative,
+	PayloadFormatCloudEvents,
+	PayloadFormatCloudEventsBinary,
+	PayloadFormatTemplate,
+)
+
+func (format PayloadFormat) Validate() error {
+	return validatePayloadFormat.Validate(format)
+}
+
+const maxPayloadTemplateLength = 8192
+
+var payloadTemplateFuncs = template.FuncMap{
+	// json encodes the argument as JSON, it is used for embedding values
+	// in the rendered JSON document.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ParsePayloadTemplate parses a webhook payload template. The template is
+// executed with the JSON representation of the WebhookEvent as a map, so
+// fields are referenced by their JSON name, e.g. {{ .data.id }}.
+func ParsePayloadTemplate(text string) (*template.Template, error) {
+	return template.New("payload").
+		Option("missingkey=error").
+		Funcs(payloadTemplateFuncs).
+		Parse(text)
+}
+
+func validatePayloadTemplate(value interface{}) error {
+	text, _ := value.(string)
+	if text == "" {
+		return nil
+	}
+	_, err := ParsePayloadTemplate(text)
+	return err
+}
+
+type HTTPAuthType string
+
+const (
+	// HTTPAuthTypeBearer sets the Authorization header to a bearer token.
+	HTTPAuthTypeBearer HTTPAuthType = "bearer"
+	// HTTPAuthTypeBasic sets the Authorization header to the basic
+	// authentication credentials.
+	HTTPAuthTypeBasic HTTPAuthType = "basic"
+)
+
+var validateHTTPAuthType = validation.In(
+	HTTPAuthTypeBearer,
+	HTTPAuthTypeBasic,
+)
+
+func (typ HTTPAuthType) Validate() error {
+	return validateHTTPAuthType.Validate(typ)
+}
+
+// HTTPAuth configures the authentication of webhook requests.
+type HTTPAuth struct {
+	Type HTTPAuthType `json:"type" bson:"type"`
+	// Token is the bearer token.
+	Token *crypto.String `json:"token,omitempty" bson:"token,omitempty"`
+	// Username and Password are the basic authentication credentials.
+	Username string         `json:"username,omitempty" bson:"username,omitempty"`
+	Password *crypto.String `json:"password,omitempty" bson:"password,omitempty"`
+}
+
+func (auth HTTPAuth) Validate() error {
+	bearer := auth.Type == HTTPAuthTypeBearer
+	basic := auth.Type == HTTPAuthTypeBasic
+	return validation.ValidateStruct(&auth,
+		validation.Field(&auth.Type, validation.Required),
+		validation.Field(&auth.Token,
+			validation.When(bearer, validation.Required).
+				Else(validation.Nil),
+		),
+		validation.Field(&auth.Username,
+			validation.When(basic,
+				validation.Required,
+				validation.By(validateNoColon),
+			).Else(validation.Empty),
+		),
+		validation.Field(&auth.Password,
+			validation.When(basic, validation.NotNil).
+				Else(validation.Nil),
+		),
+	)
+}
+
+func validateNoColon(value interface{}) error {
+	if s, _ := value.(string); strings.ContainsRune(s, ':') {
+		return errors.New("must not contain ':'")
+	}
+	return nil
+}
+
+// HTTPHeader is a static header added to webhook requests.
+type HTTPHeader struct {
+	Name  string         `json:"name" bson:"name"`
+	Value *crypto.String `json:"value" bson:"value"`
+}
+
+const maxHTTPHeaders = 16
+
+var (
+	validHeaderName = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+	// reservedHeaders are set by the iot-manager and cannot be overridden.
+	reservedHeaders = []string{
+		"Authorization",
+		"Content-Length",
+		"Content-Type",
+		"Host",
+	}
+	reservedHeaderPrefix = "X-Men-"
+)
+
+func (hdr HTTPHeader) Validate() error {
+	return validation.ValidateStruct(&hdr,
+		validation.Field(&hdr.Name,
+			validation.Required,
+			lenLessThan128,
+			validation.Match(validHeaderName),
+			validation.By(validateHeaderNotReserved),
+		),
+		validation.Field(&hdr.Value,
+			validation.NotNil,
+			validation.By(validateHeaderValue),
+		),
+	)
+}
+
+func validateHeaderNotReserved(value interface{}) error {
+	name := textproto.CanonicalMIMEHeaderKey(value.(string))
+	if strings.HasPrefix(name, reservedHeaderPrefix) {
+		return errors.New("headers with prefix " +
+			reservedHeaderPrefix + " are reserved")
+	}
+	for _, reserved := range reservedHeaders {
+		if name == reserved {
+			return errors.New("header is reserved")
+		}
+	}
+	return nil
+}
+
+func validateHeaderValue(value interface{}) error {
+	if v, _ := value.(*crypto.String); v != nil &&
+		strings.ContainsAny(string(*v), "\r\n") {
+		return errors.New("must not contain line breaks")
+	}
+	return nil
+}
+
+// HTTPTLSConfig configures the TLS connections of webhook requests.
+type HTTPTLSConfig struct {
+	// ClientCertificate and ClientKey are the PEM encoded certificate
+	// chain and private key presented to the receiver for mutual TLS.
+	//nolint:lll
+	ClientCertificate *crypto.String `json:"client_certificate,omitempty" bson:"client_certificate,omitempty"`
+	ClientKey         *crypto.String `json:"client_key,omitempty" bson:"client_key,omitempty"`
+	// CACertificates is a PEM encoded bundle of certificate authorities
+	// trusted for the receiver certificate instead of the system roots.
+	CACertificates string `json:"ca_certificates,omitempty" bson:"ca_certificates,omitempty"`
+}
+
+func (cfg HTTPTLSConfig) Validate() error {
+	err := validation.ValidateStruct(&cfg,
+		validation.Field(&cfg.ClientCertificate,
+			validation.When(cfg.ClientKey != nil, validation.NotNil),
+		),
+		validation.Field(&cfg.ClientKey,
+			validation.When(cfg.ClientCertificate != nil, validation.NotNil),
+		),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = cfg.TLSConfig()
+	return err
+}
+
+// TLSConfig returns the TLS client configuration.
+func (cfg HTTPTLSConfig) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.ClientCertificate != nil && cfg.ClientKey != nil {
+		cert, err := tls.X509KeyPair(
+			[]byte(*cfg.ClientCertificate),
+			[]byte(*cfg.ClientKey),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CACertificates != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cfg.CACertificates)) {
+			return nil, errors.New("invalid CA certificates: " +
+				"no PEM encoded certificates found")
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
 type HTTPCredentials struct {
 	URL    string     `json:"url,omitempty" bson:"url,omitempty"`
 	Secret *HexSecret `json:"secret,omitempty" bson:"secret,omitempty"`
+	// SignatureVersion selects the algorithm used for signing requests,
+	// defaults to SignatureVersion1.
+	//nolint:lll
+	SignatureVersion SignatureVersion `json:"signature_version,omitempty" bson:"signature_version,omitempty"`
+	// SecondarySecret is the previous secret after a rotation: requests
+	// are signed with both secrets until SecondarySecretExpiresAt.
+	//nolint:lll
+	SecondarySecret *HexSecret `json:"secondary_secret,omitempty" bson:"secondary_secret,omitempty"`
+	//nolint:lll
+	SecondarySecretExpiresAt *time.Time `json:"secondary_secret_expires_at,omitempty" bson:"secondary_secret_expires_at,omitempty"`
+
+	// Auth configures the Authorization header of the requests.
+	Auth *HTTPAuth `json:"auth,omitempty" bson:"auth,omitempty"`
+	// Headers are added to the requests, the values are encrypted.
+	Headers []HTTPHeader `json:"headers,omitempty" bson:"headers,omitempty"`
+
+	// TLS configures client certificates and trusted CAs for the
+	// connections.
+	TLS *HTTPTLSConfig `json:"tls,omitempty" bson:"tls,omitempty"`
+
+	// PayloadFormat selects the format of the request body, defaults to
+	// PayloadFormatNative.
+	//nolint:lll
+	PayloadFormat PayloadFormat `json:"payload_format,omitempty" bson:"payload_format,omitempty"`
+	// PayloadTemplate is the text/template rendering the request body for
+	// PayloadFormatTemplate.
+	//nolint:lll
+	PayloadTemplate string `json:"payload_template,omitempty" bson:"payload_template,omitempty"`
 
 	// private field toggling validation verbosity
 	// - only set if unmarshaled from JSON
@@ -99,5 +381,72 @@ func (cred HTTPCredentials) Validate() error {
 			validation.Required,
 			validation.By(cred.validateURL),
 		),
+		validation.Field(&cred.SignatureVersion),
+		validation.Field(&cred.Auth),
+		validation.Field(&cred.Headers,
+			validation.Length(0, maxHTTPHeaders),
+		),
+		validation.Field(&cred.TLS),
+		validation.Field(&cred.PayloadFormat),
+		validation.Field(&cred.PayloadTemplate,
+			validation.When(
+				cred.PayloadFormat == PayloadFormatTemplate,
+				validation.Required,
+			).Else(validation.Empty),
+			validation.Length(0, maxPayloadTemplateLength),
+			validation.By(validatePayloadTemplate),
+		),
+		validation.Field(&cred.SecondarySecretExpiresAt,
+			validation.When(cred.SecondarySecret != nil, validation.Required),
+		),
+	)
+}
+
+// Secrets returns the secrets used for signing requests at the given time:
+// the secret followed by the secondary secret if it has not expired.
+func (cred HTTPCredentials) Secrets(now time.Time) [][]byte {
+	if cred.Secret == nil {
+		return nil
+	}
+	secrets := [][]byte{[]byte(*cred.Secret)}
+	if cred.SecondarySecret != nil &&
+		cred.SecondarySecretExpiresAt != nil &&
+		now.Before(*cred.SecondarySecretExpiresAt) {
+		secrets = append(secrets, []byte(*cred.SecondarySecret))
+	}
+	return secrets
+}
+
+const (
+	// DefaultSecretGracePeriod is the time the previous webhook secret keeps
+	// signing requests after a rotation, unless specified.
+	DefaultSecretGracePeriod = 24 * time.Hour
+	// MaxSecretGracePeriod is the maximum grace period of a rotation.
+	MaxSecretGracePeriod = 30 * 24 * time.Hour
+)
+
+// SecretRotation is the request for rotating the webhook secret.
+type SecretRotation struct {
+	// Secret is the new secret, a secret is generated if nil.
+	Secret *HexSecret `json:"secret,omitempty"`
+	// GracePeriod is the time in seconds the previous secret keeps
+	// signing requests.
+	GracePeriod *uint `json:"grace_period,omitempty"`
+}
+
+func (rot SecretRotation) Validate() error {
+	return validation.ValidateStruct(&rot,
+		validation.Field(&rot.Secret, validation.NilOrNotEmpty),
+		validation.Field(&rot.GracePeriod,
+			validation.Max(uint(MaxSecretGracePeriod/time.Second)),
+		),
 	)
 }
+
+// GracePeriodDuration returns the grace period of the rotation.
+func (rot SecretRotation) GracePeriodDuration() time.Duration {
+	if rot.GracePeriod == nil {
+		return DefaultSecretGracePeriod
+	}
+	return time.Duration(*rot.GracePeriod) * time.Second
+}
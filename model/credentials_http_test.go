@@ -15,12 +15,22 @@
 package model
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"math/big"
 	"net"
 	"testing"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/iot-manager/crypto"
 )
 
 func TestHTTPCredentials(t *testing.T) {
@@ -83,3 +93,325 @@ func TestHexSecret(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, hexSecret, actualSecret)
 }
+
+func TestHTTPCredentialsSecrets(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	primary := HexSecret("primary")
+	secondary := HexSecret("secondary")
+	expiresAt := now.Add(time.Hour)
+
+	creds := HTTPCredentials{URL: "http://localhost"}
+	assert.Empty(t, creds.Secrets(now))
+
+	creds.Secret = &primary
+	assert.Equal(t, [][]byte{[]byte("primary")}, creds.Secrets(now))
+
+	creds.SecondarySecret = &secondary
+	creds.SecondarySecretExpiresAt = &expiresAt
+	assert.Equal(t,
+		[][]byte{[]byte("primary"), []byte("secondary")},
+		creds.Secrets(now),
+	)
+	assert.Equal(t,
+		[][]byte{[]byte("primary")},
+		creds.Secrets(expiresAt),
+		"secondary secret must not be used after expiry",
+	)
+
+	creds.SecondarySecretExpiresAt = nil
+	assert.EqualError(t, creds.Validate(),
+		"secondary_secret_expires_at: cannot be blank.")
+}
+
+func TestSecretRotation(t *testing.T) {
+	t.Parallel()
+	var rotation SecretRotation
+	assert.NoError(t, rotation.Validate())
+	assert.Equal(t, DefaultSecretGracePeriod, rotation.GracePeriodDuration())
+
+	gracePeriod := uint(60)
+	rotation.GracePeriod = &gracePeriod
+	assert.NoError(t, rotation.Validate())
+	assert.Equal(t, time.Minute, rotation.GracePeriodDuration())
+
+	gracePeriod = uint(MaxSecretGracePeriod/time.Second) + 1
+	assert.EqualError(t, rotation.Validate(),
+		"grace_period: must be no greater than 2592000.")
+
+	rotation.GracePeriod = nil
+	err := json.Unmarshal([]byte(`{"secret": ""}`), &rotation)
+	assert.NoError(t, err)
+	assert.EqualError(t, rotation.Validate(), "secret: cannot be blank.")
+}
+
+func TestHTTPCredentialsValidate(t *testing.T) {
+	t.Parallel()
+	str := func(s string) *crypto.String {
+		c := crypto.String(s)
+		return &c
+	}
+	testCases := map[string]struct {
+		creds HTTPCredentials
+		err   string
+	}{
+		"ok, bearer": {
+			creds: HTTPCredentials{
+				URL: "http://localhost",
+				Auth: &HTTPAuth{
+					Type:  HTTPAuthTypeBearer,
+					Token: str("token"),
+				},
+			},
+		},
+		"ok, basic": {
+			creds: HTTPCredentials{
+				URL: "http://localhost",
+				Auth: &HTTPAuth{
+					Type:     HTTPAuthTypeBasic,
+					Username: "user",
+					Password: str("password"),
+				},
+			},
+		},
+		"ok, headers": {
+			creds: HTTPCredentials{
+				URL: "http://localhost",
+				Headers: []HTTPHeader{{
+					Name:  "X-Api-Key",
+					Value: str("key"),
+				}},
+			},
+		},
+		"error, bearer without token": {
+			creds: HTTPCredentials{
+				URL:  "http://localhost",
+				Auth: &HTTPAuth{Type: HTTPAuthTypeBearer},
+			},
+			err: "auth: (token: cannot be blank.).",
+		},
+		"error, basic with token": {
+			creds: HTTPCredentials{
+				URL: "http://localhost",
+				Auth: &HTTPAuth{
+					Type:     HTTPAuthTypeBasic,
+					Token:    str("token"),
+					Username: "user",
+					Password: str("password"),
+				},
+			},
+			err: "auth: (token: must be blank.).",
+		},
+		"error, basic username with colon": {
+			creds: HTTPCredentials{
+				URL: "http://localhost",
+				Auth: &HTTPAuth{
+					Type:     HTTPAuthTypeBasic,
+					Username: "user:name",
+					Password: str("password"),
+				},
+			},
+			err: "auth: (username: must not contain ':'.).",
+		},
+		"error, unknown auth type": {
+			creds: HTTPCredentials{
+				URL:  "http://localhost",
+				Auth: &HTTPAuth{Type: "digest"},
+			},
+			err: "auth: (type: must be a valid value.).",
+		},
+		"error, reserved header": {
+			creds: HTTPCredentials{
+				URL: "http://localhost",
+				Headers: []HTTPHeader{{
+					Name:  "authorization",
+					Value: str("token"),
+				}},
+			},
+			err: "headers: (0: (name: header is reserved.).).",
+		},
+		"error, reserved header prefix": {
+			creds: HTTPCredentials{
+				URL: "http://localhost",
+				Headers: []HTTPHeader{{
+					Name:  "X-Men-Signature",
+					Value: str("signature"),
+				}},
+			},
+			err: "headers: (0: (name: headers with prefix X-Men- are reserved.).).",
+		},
+		"error, invalid header": {
+			creds: HTTPCredentials{
+				URL: "http://localhost",
+				Headers: []HTTPHeader{{
+					Name:  "X Api Key",
+					Value: str("key\r\nHost: example.com"),
+				}},
+			},
+			err: "headers: (0: (name: must be in a valid format; " +
+				"value: must not contain line breaks.).).",
+		},
+		"ok, payload template": {
+			creds: HTTPCredentials{
+				URL:             "http://localhost",
+				PayloadFormat:   PayloadFormatTemplate,
+				PayloadTemplate: `{"text": {{ .data.id | json }}}`,
+			},
+		},
+		"ok, cloudevents": {
+			creds: HTTPCredentials{
+				URL:           "http://localhost",
+				PayloadFormat: PayloadFormatCloudEventsBinary,
+			},
+		},
+		"error, unknown payload format": {
+			creds: HTTPCredentials{
+				URL:           "http://localhost",
+				PayloadFormat: "xml",
+			},
+			err: "payload_format: must be a valid value.",
+		},
+		"error, payload template missing": {
+			creds: HTTPCredentials{
+				URL:           "http://localhost",
+				PayloadFormat: PayloadFormatTemplate,
+			},
+			err: "payload_template: cannot be blank.",
+		},
+		"error, payload template without format": {
+			creds: HTTPCredentials{
+				URL:             "http://localhost",
+				PayloadTemplate: `{}`,
+			},
+			err: "payload_template: must be blank.",
+		},
+		"error, payload template syntax": {
+			creds: HTTPCredentials{
+				URL:             "http://localhost",
+				PayloadFormat:   PayloadFormatTemplate,
+				PayloadTemplate: `{"text": "{{ .data.id "}`,
+			},
+			err: "payload_template: template: payload:1: " +
+				"unterminated quoted string.",
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.creds.Validate()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHTTPCredentialsRedacted(t *testing.T) {
+	t.Parallel()
+	token := crypto.String("token")
+	value := crypto.String("key")
+	creds := HTTPCredentials{
+		URL: "http://localhost",
+		Auth: &HTTPAuth{
+			Type:  HTTPAuthTypeBearer,
+			Token: &token,
+		},
+		Headers: []HTTPHeader{{
+			Name:  "X-Api-Key",
+			Value: &value,
+		}},
+	}
+	b, err := json.Marshal(creds)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{
+			"url": "http://localhost",
+			"auth": {"type": "bearer", "token": "<omitted>"},
+			"headers": [{"name": "X-Api-Key", "value": "<omitted>"}]
+		}`, string(b))
+	}
+}
+
+func newTestCertificate(t *testing.T) (certPEM, keyPEM string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "iot-manager"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certPEM, keyPEM
+}
+
+func TestHTTPTLSConfig(t *testing.T) {
+	t.Parallel()
+	certPEM, keyPEM := newTestCertificate(t)
+	_, otherKeyPEM := newTestCertificate(t)
+	str := func(s string) *crypto.String {
+		c := crypto.String(s)
+		return &c
+	}
+	testCases := map[string]struct {
+		config HTTPTLSConfig
+		err    string
+	}{
+		"ok": {
+			config: HTTPTLSConfig{
+				ClientCertificate: str(certPEM),
+				ClientKey:         str(keyPEM),
+				CACertificates:    certPEM,
+			},
+		},
+		"ok, CA only": {
+			config: HTTPTLSConfig{CACertificates: certPEM},
+		},
+		"error, certificate without key": {
+			config: HTTPTLSConfig{ClientCertificate: str(certPEM)},
+			err:    "client_key: is required.",
+		},
+		"error, key mismatch": {
+			config: HTTPTLSConfig{
+				ClientCertificate: str(certPEM),
+				ClientKey:         str(otherKeyPEM),
+			},
+			err: "invalid client certificate: " +
+				"tls: private key does not match public key",
+		},
+		"error, invalid CA": {
+			config: HTTPTLSConfig{CACertificates: "not a certificate"},
+			err: "invalid CA certificates: " +
+				"no PEM encoded certificates found",
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.config.Validate()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			if assert.NoError(t, err) {
+				config, _ := tc.config.TLSConfig()
+				assert.Equal(t, tc.config.ClientKey != nil, len(config.Certificates) == 1)
+				assert.Equal(t, tc.config.CACertificates != "", config.RootCAs != nil)
+			}
+		})
+	}
+}
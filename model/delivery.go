@@ -0,0 +1,40 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Delivery is a pending webhook delivery of an event to an integration.
+// Deliveries are kept in the outbox until they either succeed or run out
+// of attempts.
+type Delivery struct {
+	ID       uuid.UUID `bson:"_id"`
+	TenantID string    `bson:"tenant_id"`
+
+	EventID       uuid.UUID `bson:"event_id"`
+	IntegrationID uuid.UUID `bson:"integration_id"`
+
+	// Attempts is the number of attempts performed so far.
+	Attempts int `bson:"attempts"`
+	// NextTS is the time when the next attempt is due.
+	NextTS time.Time `bson:"next_ts"`
+	// LeaseTS is the time until which an attempt is in progress: the
+	// delivery cannot be claimed for a redelivery before then.
+	LeaseTS time.Time `bson:"lease_ts,omitempty"`
+}
@@ -23,3 +23,12 @@ type Device struct {
 	// Integrations contains the list of integrations for this device
 	IntegrationIDs []uuid.UUID `json:"integration_ids" bson:"integration_ids"`
 }
+
+// DeviceFilter selects the devices returned by a device listing
+type DeviceFilter struct {
+	Skip  int64
+	Limit int64
+	// IntegrationID, if set, only selects devices belonging to the
+	// integration.
+	IntegrationID uuid.UUID
+}
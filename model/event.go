@@ -15,10 +15,14 @@
 package model
 
 import (
+	"encoding/base64"
+	"strconv"
+	"strings"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
 type DeliveryStatus struct {
@@ -26,6 +30,27 @@ type DeliveryStatus struct {
 	Success       bool      `json:"success" bson:"success"`
 	Error         string    `json:"error,omitempty" bson:"err,omitempty"`
 	StatusCode    *int      `json:"status_code,omitempty" bson:"status,omitempty"`
+	// Skipped is set if the device did not match the integration selector
+	// and the event was not forwarded to the integration.
+	Skipped bool `json:"skipped,omitempty" bson:"skipped,omitempty"`
+	// Pending is set while the webhook delivery has not completed its
+	// first attempt.
+	Pending bool `json:"pending,omitempty" bson:"pending,omitempty"`
+	// Duration is the duration of the latest webhook request in
+	// milliseconds.
+	Duration *int64 `json:"duration_ms,omitempty" bson:"duration_ms,omitempty"`
+	// Attempts contains the history of webhook delivery attempts; the
+	// fields above reflect the outcome of the latest attempt.
+	Attempts []DeliveryAttempt `json:"attempts,omitempty" bson:"attempts,omitempty"`
+}
+
+// DeliveryAttempt is the outcome of a single webhook request.
+type DeliveryAttempt struct {
+	Success    bool      `json:"success" bson:"success"`
+	Error      string    `json:"error,omitempty" bson:"err,omitempty"`
+	StatusCode *int      `json:"status_code,omitempty" bson:"status,omitempty"`
+	Duration   *int64    `json:"duration_ms,omitempty" bson:"duration_ms,omitempty"`
+	Timestamp  time.Time `json:"time" bson:"ts"`
 }
 
 type WebhookEvent struct {
@@ -37,6 +62,9 @@ type WebhookEvent struct {
 	Data interface{} `json:"data" bson:"data"`
 	// EventTS is the timestamp when the event has been produced.
 	EventTS time.Time `json:"time" bson:"event_ts"`
+	// Sequence orders the events about the same device: the events of a
+	// device are processed in the order of their sequence numbers.
+	Sequence int64 `json:"sequence,omitempty" bson:"seq,omitempty"`
 }
 
 type Event struct {
@@ -78,6 +106,75 @@ func (typ EventType) Validate() error {
 type EventsFilter struct {
 	Skip  int64
 	Limit int64
+
+	// After only selects events older than the cursor. It is used for
+	// paging instead of Skip.
+	After *EventsCursor
+
+	// Type selects events of the given type.
+	Type EventType
+	// IntegrationID selects events delivered to the integration.
+	IntegrationID uuid.UUID
+	// Success selects events by the outcome of the delivery (to the
+	// integration if IntegrationID is set, or to any integration).
+	Success *bool
+	// DeviceID selects events about the device.
+	DeviceID string
+	// SequenceAfter selects events with a greater sequence number.
+	SequenceAfter int64
+	// From and To select events produced within the time range
+	// (inclusive).
+	From time.Time
+	To   time.Time
+}
+
+func (fltr EventsFilter) Validate() error {
+	return validation.ValidateStruct(&fltr,
+		validation.Field(&fltr.Type),
+		validation.Field(&fltr.To, validation.When(!fltr.From.IsZero(),
+			validation.Min(fltr.From).
+				Error("must be no less than from"),
+		)),
+	)
+}
+
+// EventsCursor points to the last event of a page sorted by time and ID.
+type EventsCursor struct {
+	EventTS time.Time
+	ID      uuid.UUID
+}
+
+var ErrInvalidEventsCursor = errors.New("invalid events cursor")
+
+// ParseEventsCursor decodes a cursor produced by EventsCursor.String.
+func ParseEventsCursor(s string) (*EventsCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidEventsCursor
+	}
+	ts, id, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return nil, ErrInvalidEventsCursor
+	}
+	millis, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidEventsCursor
+	}
+	cursor := &EventsCursor{EventTS: time.UnixMilli(millis)}
+	cursor.ID, err = uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidEventsCursor
+	}
+	return cursor, nil
+}
+
+// String returns an opaque representation of the cursor safe for use in
+// URL query parameters.
+func (cursor EventsCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(
+		strconv.FormatInt(cursor.EventTS.UnixMilli(), 10) +
+			":" + cursor.ID.String(),
+	))
 }
 
 // AuthSet contains a subset of the deviceauth AuthSet definition
@@ -106,3 +203,14 @@ type DeviceEvent struct {
 	// CreatedTS is the time when the device was created.
 	CreatedTS *time.Time `json:"created_ts,omitempty" bson:"created_ts,omitempty"`
 }
+
+// IdentityData returns the identity data of the device from the first auth
+// set that has it.
+func (dev DeviceEvent) IdentityData() map[string]interface{} {
+	for _, authSet := range dev.AuthSets {
+		if authSet.IdentityData != nil {
+			return authSet.IdentityData
+		}
+	}
+	return nil
+}
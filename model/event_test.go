@@ -0,0 +1,97 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsCursor(t *testing.T) {
+	t.Parallel()
+	cursor := EventsCursor{
+		EventTS: time.Now().Truncate(time.Millisecond),
+		ID:      uuid.New(),
+	}
+	res, err := ParseEventsCursor(cursor.String())
+	if assert.NoError(t, err) {
+		assert.True(t, cursor.EventTS.Equal(res.EventTS))
+		assert.Equal(t, cursor.ID, res.ID)
+	}
+
+	for _, s := range []string{
+		"",
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("12345")),
+		base64.RawURLEncoding.EncodeToString([]byte("foo:" + uuid.NewString())),
+		base64.RawURLEncoding.EncodeToString([]byte("12345:bar")),
+	} {
+		_, err := ParseEventsCursor(s)
+		assert.ErrorIs(t, err, ErrInvalidEventsCursor, s)
+	}
+}
+
+func TestEventsFilterValidate(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	testCases := []struct {
+		Name   string
+		Filter EventsFilter
+		Error  string
+	}{{
+		Name: "ok, empty",
+	}, {
+		Name: "ok",
+		Filter: EventsFilter{
+			Type: EventTypeDeviceStatusChanged,
+			From: now.Add(-time.Hour),
+			To:   now,
+		},
+	}, {
+		Name: "ok, open time range",
+		Filter: EventsFilter{
+			From: now,
+		},
+	}, {
+		Name: "error, invalid type",
+		Filter: EventsFilter{
+			Type: "foo",
+		},
+		Error: "Type: must be a valid value.",
+	}, {
+		Name: "error, invalid time range",
+		Filter: EventsFilter{
+			From: now,
+			To:   now.Add(-time.Hour),
+		},
+		Error: "To: must be no less than from.",
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.Filter.Validate()
+			if tc.Error != "" {
+				assert.EqualError(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Time windows of the integration health summary.
+const (
+	HealthWindowHour = time.Hour
+	HealthWindowDay  = 24 * time.Hour
+	HealthWindowWeek = 7 * 24 * time.Hour
+)
+
+// IntegrationHealth summarizes the outcome of the recent deliveries to an
+// integration. Deliveries skipped by the integration selector are not
+// accounted for.
+type IntegrationHealth struct {
+	LastHour DeliveryStats `json:"last_hour"`
+	LastDay  DeliveryStats `json:"last_day"`
+	LastWeek DeliveryStats `json:"last_week"`
+
+	// LastSuccess and LastFailure are the latest succeeded and failed
+	// deliveries within the last week.
+	LastSuccess *DeliveryOutcome `json:"last_success,omitempty"`
+	LastFailure *DeliveryOutcome `json:"last_failure,omitempty"`
+
+	// StatusCodes counts the deliveries of the last week by the
+	// status code of the response.
+	StatusCodes map[int]int64 `json:"status_codes"`
+	// AverageDuration is the average duration of the webhook requests of
+	// the last week in milliseconds.
+	AverageDuration *float64 `json:"average_duration_ms,omitempty"`
+}
+
+// DeliveryStats counts the deliveries within a time window.
+type DeliveryStats struct {
+	Total     int64 `json:"total"`
+	Succeeded int64 `json:"succeeded"`
+	// SuccessRate is the ratio of succeeded deliveries, it is nil if
+	// there were no deliveries.
+	SuccessRate *float64 `json:"success_rate"`
+}
+
+// NewDeliveryStats returns the stats of the total and succeeded number of
+// deliveries.
+func NewDeliveryStats(total, succeeded int64) DeliveryStats {
+	stats := DeliveryStats{
+		Total:     total,
+		Succeeded: succeeded,
+	}
+	if total > 0 {
+		rate := float64(succeeded) / float64(total)
+		stats.SuccessRate = &rate
+	}
+	return stats
+}
+
+// DeliveryOutcome is the outcome of the delivery of an event.
+type DeliveryOutcome struct {
+	EventID    uuid.UUID `json:"event_id" bson:"_id"`
+	Timestamp  time.Time `json:"time" bson:"ts"`
+	StatusCode *int      `json:"status_code,omitempty" bson:"status,omitempty"`
+	Error      string    `json:"error,omitempty" bson:"err,omitempty"`
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDeliveryStats(t *testing.T) {
+	t.Parallel()
+	stats := NewDeliveryStats(0, 0)
+	assert.Nil(t, stats.SuccessRate)
+
+	stats = NewDeliveryStats(4, 3)
+	assert.Equal(t, int64(4), stats.Total)
+	assert.Equal(t, int64(3), stats.Succeeded)
+	if assert.NotNil(t, stats.SuccessRate) {
+		assert.Equal(t, 0.75, *stats.SuccessRate)
+	}
+}
@@ -15,20 +15,88 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/iot-manager/crypto"
 )
 
 type Integration struct {
-	ID          uuid.UUID   `json:"id" bson:"_id"`
-	Provider    Provider    `json:"provider" bson:"provider"`
+	ID       uuid.UUID `json:"id" bson:"_id"`
+	Provider Provider  `json:"provider" bson:"provider"`
+	// Name distinguishes integrations with the same provider; the
+	// (tenant, provider, name) tuple is unique.
+	Name        string      `json:"name,omitempty" bson:"name"`
 	Credentials Credentials `json:"credentials" bson:"credentials"`
 	Description string      `json:"description,omitempty" bson:"description,omitempty"`
+	// Selector restricts the devices provisioned to IoT Hub and IoT Core
+	// integrations to the ones with matching identity data.
+	Selector DeviceSelector `json:"selector,omitempty" bson:"selector,omitempty"`
+	// Events restricts the events delivered to webhook integrations,
+	// all events are delivered if empty.
+	Events []EventType `json:"events,omitempty" bson:"events,omitempty"`
+	// Version is incremented on every update of the integration.
+	Version int64 `json:"version" bson:"version"`
+
+	// State is the delivery state of webhook integrations.
+	State IntegrationState `json:"state,omitempty" bson:"state,omitempty"`
+	// CircuitBreaker tracks the outcome of the latest deliveries to
+	// webhook integrations and their suspension.
+	//nolint:lll
+	CircuitBreaker *CircuitBreaker `json:"circuit_breaker,omitempty" bson:"circuit_breaker,omitempty"`
+}
+
+type IntegrationState string
+
+const (
+	// IntegrationStateActive is the state of webhook integrations
+	// receiving events.
+	IntegrationStateActive IntegrationState = "active"
+	// IntegrationStateSuspended is the state of webhook integrations
+	// suspended after repeated delivery failures: deliveries are deferred
+	// until a probe sent after the cool-down succeeds.
+	IntegrationStateSuspended IntegrationState = "suspended"
+)
+
+// CircuitBreaker contains the delivery outcomes the webhook circuit
+// breaker trips on and the suspension state of the integration.
+type CircuitBreaker struct {
+	// ConsecutiveFailures is the number of failed deliveries since the
+	// latest succeeded one.
+	ConsecutiveFailures int `json:"consecutive_failures" bson:"consecutive_failures"`
+	// Outcomes contains the outcome of the latest deliveries, true if
+	// succeeded, ordered from the oldest.
+	Outcomes []bool `json:"-" bson:"outcomes,omitempty"`
+	// SuspendedTS is the time the integration was suspended.
+	SuspendedTS *time.Time `json:"suspended_ts,omitempty" bson:"suspended_ts,omitempty"`
+	// ProbeTS is the time from when the next delivery to the suspended
+	// integration is attempted.
+	ProbeTS *time.Time `json:"probe_ts,omitempty" bson:"probe_ts,omitempty"`
+}
+
+// FailureRate returns the ratio of failed deliveries among the outcomes.
+func (cb CircuitBreaker) FailureRate() float64 {
+	if len(cb.Outcomes) == 0 {
+		return 0
+	}
+	var failures int
+	for _, success := range cb.Outcomes {
+		if !success {
+			failures++
+		}
+	}
+	return float64(failures) / float64(len(cb.Outcomes))
 }
 
 var (
+	lenLessThan128  = validation.Length(0, 128)
 	lenLessThan1024 = validation.Length(0, 1024)
 )
 
@@ -38,11 +106,100 @@ func (itg Integration) Validate() error {
 		validation.Field(&itg.Provider,
 			validation.Required,
 			validation.By(itg.compatibleCredentials)),
+		validation.Field(&itg.Name, lenLessThan128),
 		validation.Field(&itg.Credentials),
 		validation.Field(&itg.Description, lenLessThan1024),
+		validation.Field(&itg.Selector,
+			validation.When(itg.Provider == ProviderWebhook,
+				validation.Empty.Error("not supported by webhooks"))),
+		validation.Field(&itg.Events,
+			validation.When(itg.Provider != ProviderWebhook,
+				validation.Empty.Error("only supported by webhooks"))),
 	)
 }
 
+// ETag returns the entity tag of the current version of the integration.
+func (itg Integration) ETag() string {
+	return strconv.Quote(strconv.FormatInt(itg.Version, 10))
+}
+
+// integrationSettings are the integration fields that can be updated
+// with a merge patch.
+type integrationSettings struct {
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Selector    DeviceSelector `json:"selector,omitempty"`
+	Events      []EventType    `json:"events,omitempty"`
+}
+
+// MergePatch returns a copy of the integration with the JSON merge patch
+// (RFC 7396) applied. Only the name, description, selector and events can
+// be patched; the credentials have a dedicated API.
+func (itg Integration) MergePatch(patch map[string]interface{}) (*Integration, error) {
+	for key := range patch {
+		switch key {
+		case "name", "description", "selector", "events":
+		case "id", "provider", "credentials", "version",
+			"state", "circuit_breaker":
+			return nil, fmt.Errorf("%s: cannot be modified", key)
+		default:
+			return nil, fmt.Errorf("%s: unknown field", key)
+		}
+	}
+	var doc map[string]interface{}
+	b, _ := json.Marshal(integrationSettings{
+		Name:        itg.Name,
+		Description: itg.Description,
+		Selector:    itg.Selector,
+		Events:      itg.Events,
+	})
+	_ = json.Unmarshal(b, &doc)
+
+	b, _ = json.Marshal(mergePatch(doc, patch))
+	var settings integrationSettings
+	if err := json.Unmarshal(b, &settings); err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	itg.Name = settings.Name
+	itg.Description = settings.Description
+	itg.Selector = settings.Selector
+	itg.Events = settings.Events
+	return &itg, nil
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], value)
+		}
+	}
+	return t
+}
+
+// SubscribedTo returns true if events of the given type are delivered to
+// the integration.
+func (itg Integration) SubscribedTo(typ EventType) bool {
+	if len(itg.Events) == 0 {
+		return true
+	}
+	for _, t := range itg.Events {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
 func (itg Integration) compatibleCredentials(interface{}) error {
 	switch itg.Provider {
 	case ProviderIoTHub:
@@ -93,6 +250,13 @@ type Credentials struct {
 	// Azure IoT Hub
 	//nolint:lll
 	ConnectionString *ConnectionString `json:"connection_string,omitempty" bson:"connection_string,omitempty"`
+	// ExportContainerURL is the URL of an Azure storage container,
+	// including a SAS token with read, write and delete permissions, used
+	// for exporting the IoT Hub devices when synchronizing the devices.
+	// The synchronization works on the snapshot of the export: a device
+	// deleted from the IoT Hub after the export counts as present until
+	// the next synchronization.
+	ExportContainerURL *crypto.String `json:"export_container_url,omitempty" bson:"export_container_url,omitempty"`
 
 	// Webhooks
 	HTTP *HTTPCredentials `json:"http,omitempty" bson:"http,omitempty"`
@@ -103,6 +267,9 @@ func (s Credentials) Validate() error {
 		validation.Field(&s.Type, validation.Required),
 		validation.Field(&s.ConnectionString,
 			validation.When(s.Type == CredentialTypeSAS, validation.Required)),
+		validation.Field(&s.ExportContainerURL,
+			validation.When(s.Type != CredentialTypeSAS, validation.Nil),
+			validation.By(validateExportContainerURL)),
 		validation.Field(&s.AWSCredentials,
 			validation.When(s.Type == CredentialTypeAWS, validation.Required)),
 		validation.Field(&s.HTTP,
@@ -110,6 +277,21 @@ func (s Credentials) Validate() error {
 	)
 }
 
+var errExportContainerURL = errors.New("must be a valid https URL")
+
+func validateExportContainerURL(value interface{}) error {
+	containerURL, _ := value.(*crypto.String)
+	if containerURL == nil {
+		return nil
+	}
+	// The error must not contain the URL: it holds the SAS token.
+	uri, err := url.Parse(string(*containerURL))
+	if err != nil || uri.Scheme != "https" || uri.Host == "" {
+		return errExportContainerURL
+	}
+	return nil
+}
+
 type IntegrationFilter struct {
 	Skip     int64
 	Limit    int64
@@ -15,9 +15,12 @@
 package model
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 
@@ -33,6 +36,113 @@ func str2cyptoptr(s string) *crypto.String {
 	return &c
 }
 
+func TestIntegrationSubscribedTo(t *testing.T) {
+	integration := Integration{Provider: ProviderWebhook}
+	assert.True(t, integration.SubscribedTo(EventTypeDeviceStatusChanged))
+
+	integration.Events = []EventType{
+		EventTypeDeviceProvisioned,
+		EventTypeDeviceDecommissioned,
+	}
+	assert.True(t, integration.SubscribedTo(EventTypeDeviceProvisioned))
+	assert.True(t, integration.SubscribedTo(EventTypeDeviceDecommissioned))
+	assert.False(t, integration.SubscribedTo(EventTypeDeviceStatusChanged))
+}
+
+func TestIntegrationETag(t *testing.T) {
+	assert.Equal(t, `"0"`, Integration{}.ETag())
+	assert.Equal(t, `"42"`, Integration{Version: 42}.ETag())
+}
+
+func TestIntegrationMergePatch(t *testing.T) {
+	integration := Integration{
+		ID:          uuid.NewSHA1(uuid.NameSpaceOID, []byte("integration")),
+		Provider:    ProviderWebhook,
+		Name:        "webhook",
+		Description: "Webhook integration",
+		Events:      []EventType{EventTypeDeviceProvisioned},
+		Credentials: Credentials{
+			Type: CredentialTypeHTTP,
+			HTTP: &HTTPCredentials{
+				URL: "http://localhost",
+			},
+		},
+		Version: 1,
+	}
+	testCases := map[string]struct {
+		patch  string
+		result *Integration
+		err    error
+	}{
+		"ok": {
+			patch: `{"name": "hook", "events": ["device-decommissioned"]}`,
+			result: func() *Integration {
+				itg := integration
+				itg.Name = "hook"
+				itg.Events = []EventType{EventTypeDeviceDecommissioned}
+				return &itg
+			}(),
+		},
+		"ok, remove fields": {
+			patch: `{"description": null, "events": null}`,
+			result: func() *Integration {
+				itg := integration
+				itg.Description = ""
+				itg.Events = nil
+				return &itg
+			}(),
+		},
+		"ok, empty patch": {
+			patch:  `{}`,
+			result: &integration,
+		},
+		"error, immutable field": {
+			patch: `{"credentials": {"type": "http"}}`,
+			err:   errors.New("credentials: cannot be modified"),
+		},
+		"error, circuit breaker state": {
+			patch: `{"state": "active"}`,
+			err:   errors.New("state: cannot be modified"),
+		},
+		"error, unknown field": {
+			patch: `{"foo": "bar"}`,
+			err:   errors.New("foo: unknown field"),
+		},
+		"error, invalid type": {
+			patch: `{"name": 1234}`,
+			err: errors.New("invalid patch: json: cannot unmarshal number " +
+				"into Go struct field integrationSettings.name of type string"),
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			var patch map[string]interface{}
+			err := json.Unmarshal([]byte(tc.patch), &patch)
+			if !assert.NoError(t, err) {
+				return
+			}
+			result, err := integration.MergePatch(patch)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.result, result)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	assert.Equal(t, 0.0, CircuitBreaker{}.FailureRate())
+	assert.Equal(t, 0.25, CircuitBreaker{
+		Outcomes: []bool{true, false, true, true},
+	}.FailureRate())
+	assert.Equal(t, 1.0, CircuitBreaker{
+		Outcomes: []bool{false, false},
+	}.FailureRate())
+}
+
 func TestIntegrationValidate(t *testing.T) {
 	cs, _ := ParseConnectionString(
 		"HostName=mender-test-hub.azure-devices.net;DeviceId=7b478313-de33-4735-bf00-0ebc31851faf;" +
@@ -51,6 +161,33 @@ func TestIntegrationValidate(t *testing.T) {
 				},
 			},
 		},
+		"ok, Azure IoT Hub with export container": {
+			integration: &Integration{
+				Provider: ProviderIoTHub,
+				Credentials: Credentials{
+					Type:             CredentialTypeSAS,
+					ConnectionString: cs,
+					ExportContainerURL: str2cyptoptr(
+						"https://mender.blob.core.windows.net/devices?sig=secret",
+					),
+				},
+			},
+		},
+		"ko, Azure IoT Hub with invalid export container": {
+			integration: &Integration{
+				Provider: ProviderIoTHub,
+				Credentials: Credentials{
+					Type:               CredentialTypeSAS,
+					ConnectionString:   cs,
+					ExportContainerURL: str2cyptoptr("http://mender.blob/devices?sig=secret"),
+				},
+			},
+			err: validation.Errors{
+				"credentials": validation.Errors{
+					"export_container_url": errExportContainerURL,
+				},
+			},
+		},
 		"ko, Azure IoT Hub": {
 			integration: &Integration{
 				Provider: ProviderIoTHub,
@@ -90,6 +227,133 @@ func TestIntegrationValidate(t *testing.T) {
 				},
 			},
 		},
+		"ok, webhook signature v2": {
+			integration: &Integration{
+				Provider: ProviderWebhook,
+				Credentials: Credentials{
+					Type: CredentialTypeHTTP,
+					HTTP: &HTTPCredentials{
+						URL:              "http://localhost",
+						SignatureVersion: SignatureVersion2,
+					},
+				},
+			},
+		},
+		"ko, unknown webhook signature version": {
+			integration: &Integration{
+				Provider: ProviderWebhook,
+				Credentials: Credentials{
+					Type: CredentialTypeHTTP,
+					HTTP: &HTTPCredentials{
+						URL:              "http://localhost",
+						SignatureVersion: "v3",
+					},
+				},
+			},
+			err: errors.New("credentials: (http: (signature_version: " +
+				"must be a valid value.).)."),
+		},
+		"ko, name too long": {
+			integration: &Integration{
+				Provider: ProviderWebhook,
+				Name:     strings.Repeat("a", 129),
+				Credentials: Credentials{
+					Type: CredentialTypeHTTP,
+					HTTP: &HTTPCredentials{
+						URL: "http://localhost",
+					},
+				},
+			},
+			err: errors.New("name: the length must be no more than 128."),
+		},
+		"ok, Azure IoT Hub with selector": {
+			integration: &Integration{
+				Provider: ProviderIoTHub,
+				Credentials: Credentials{
+					Type:             CredentialTypeSAS,
+					ConnectionString: cs,
+				},
+				Selector: DeviceSelector{{
+					Key:   "device_type",
+					Op:    SelectorOpEqual,
+					Value: "gateway",
+				}},
+			},
+		},
+		"ko, invalid selector": {
+			integration: &Integration{
+				Provider: ProviderIoTHub,
+				Credentials: Credentials{
+					Type:             CredentialTypeSAS,
+					ConnectionString: cs,
+				},
+				Selector: DeviceSelector{{
+					Key:   "mac",
+					Op:    "suffix",
+					Value: "00",
+				}},
+			},
+			err: errors.New("selector: (0: (op: must be a valid value.).)."),
+		},
+		"ko, webhook with selector": {
+			integration: &Integration{
+				Provider: ProviderWebhook,
+				Credentials: Credentials{
+					Type: CredentialTypeHTTP,
+					HTTP: &HTTPCredentials{
+						URL: "http://localhost",
+					},
+				},
+				Selector: DeviceSelector{{
+					Key:   "device_type",
+					Op:    SelectorOpEqual,
+					Value: "gateway",
+				}},
+			},
+			err: errors.New("selector: not supported by webhooks."),
+		},
+		"ok, webhook with events": {
+			integration: &Integration{
+				Provider: ProviderWebhook,
+				Credentials: Credentials{
+					Type: CredentialTypeHTTP,
+					HTTP: &HTTPCredentials{
+						URL: "http://localhost",
+					},
+				},
+				Events: []EventType{
+					EventTypeDeviceProvisioned,
+					EventTypeDeviceDecommissioned,
+				},
+			},
+		},
+		"ko, webhook with invalid events": {
+			integration: &Integration{
+				Provider: ProviderWebhook,
+				Credentials: Credentials{
+					Type: CredentialTypeHTTP,
+					HTTP: &HTTPCredentials{
+						URL: "http://localhost",
+					},
+				},
+				Events: []EventType{
+					EventTypeDeviceProvisioned,
+					"device-exploded",
+				},
+			},
+			err: errors.New("events: (1: must be a valid value.)."),
+		},
+		"ko, Azure IoT Hub with events": {
+			integration: &Integration{
+				Provider: ProviderIoTHub,
+				Credentials: Credentials{
+					Type:             CredentialTypeSAS,
+					ConnectionString: cs,
+				},
+				Events: []EventType{EventTypeDeviceProvisioned},
+			},
+			err: errors.New("events: only supported by webhooks."),
+		},
 		"ko, AWS IoT Core": {
 			integration: &Integration{
 				Provider: ProviderIoTCore,
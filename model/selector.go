@@ -0,0 +1,154 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type SelectorOp string
+
+const (
+	// SelectorOpEqual matches identity attributes equal to the value.
+	SelectorOpEqual SelectorOp = "eq"
+	// SelectorOpPrefix matches identity attributes starting with the value.
+	SelectorOpPrefix SelectorOp = "prefix"
+)
+
+var validateSelectorOp = validation.In(SelectorOpEqual, SelectorOpPrefix)
+
+func (op SelectorOp) Validate() error {
+	return validateSelectorOp.Validate(op)
+}
+
+// SelectorRule matches a single attribute of the device identity data.
+type SelectorRule struct {
+	Key   string     `json:"key" bson:"key"`
+	Op    SelectorOp `json:"op" bson:"op"`
+	Value string     `json:"value" bson:"value"`
+}
+
+func (rule SelectorRule) Validate() error {
+	return validation.ValidateStruct(&rule,
+		validation.Field(&rule.Key, validation.Required, lenLessThan128),
+		validation.Field(&rule.Op, validation.Required),
+		validation.Field(&rule.Value, lenLessThan1024),
+	)
+}
+
+// Match returns true if the attribute exists in the identity data and
+// satisfies the rule. Attributes with multiple values match if any of the
+// values does.
+func (rule SelectorRule) Match(identityData map[string]interface{}) bool {
+	attr, ok := identityData[rule.Key]
+	if !ok {
+		return false
+	}
+	values, ok := attr.([]interface{})
+	if !ok {
+		values = []interface{}{attr}
+	}
+	for _, value := range values {
+		var s string
+		if str, ok := value.(string); ok {
+			s = str
+		} else {
+			s = fmt.Sprint(value)
+		}
+		switch rule.Op {
+		case SelectorOpEqual:
+			if s == rule.Value {
+				return true
+			}
+		case SelectorOpPrefix:
+			if strings.HasPrefix(s, rule.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeviceSelector restricts the devices managed by an integration to the
+// devices whose identity data match all of the rules. An empty selector
+// matches all devices.
+type DeviceSelector []SelectorRule
+
+const maxSelectorRules = 32
+
+func (sel DeviceSelector) Validate() error {
+	return validation.Validate([]SelectorRule(sel),
+		validation.Length(0, maxSelectorRules),
+	)
+}
+
+// Match returns true if the identity data match all of the selector rules.
+func (sel DeviceSelector) Match(identityData map[string]interface{}) bool {
+	for _, rule := range sel {
+		if !rule.Match(identityData) {
+			return false
+		}
+	}
+	return true
+}
+
+// Overlaps returns true if a device may match both selectors. The identity
+// attributes are assumed to hold a single value: the selectors overlap
+// unless the rules of both selectors on one of the attributes cannot be
+// satisfied by the same value.
+func (sel DeviceSelector) Overlaps(other DeviceSelector) bool {
+	rules := make(map[string][]SelectorRule, len(sel)+len(other))
+	for _, rule := range sel {
+		rules[rule.Key] = append(rules[rule.Key], rule)
+	}
+	for _, rule := range other {
+		rules[rule.Key] = append(rules[rule.Key], rule)
+	}
+	for _, keyRules := range rules {
+		if !satisfiable(keyRules) {
+			return false
+		}
+	}
+	return true
+}
+
+// satisfiable returns true if a single value satisfies all of the rules.
+func satisfiable(rules []SelectorRule) bool {
+	var (
+		value    string
+		hasValue bool
+		// prefix is the longest prefix, the others must be prefixes of it.
+		prefix string
+	)
+	for _, rule := range rules {
+		switch rule.Op {
+		case SelectorOpEqual:
+			if hasValue && value != rule.Value {
+				return false
+			}
+			value, hasValue = rule.Value, true
+		case SelectorOpPrefix:
+			if strings.HasPrefix(rule.Value, prefix) {
+				prefix = rule.Value
+			} else if !strings.HasPrefix(prefix, rule.Value) {
+				return false
+			}
+		}
+	}
+	return !hasValue || strings.HasPrefix(value, prefix)
+}
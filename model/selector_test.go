@@ -0,0 +1,217 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceSelectorMatch(t *testing.T) {
+	t.Parallel()
+	identityData := map[string]interface{}{
+		"device_type": "gateway",
+		"mac":         "00:11:22:33:44:55",
+		"serials":     []interface{}{"A-1", "B-2"},
+		"revision":    float64(3),
+	}
+	testCases := map[string]struct {
+		Selector DeviceSelector
+
+		Match bool
+	}{
+		"ok, empty selector": {
+			Match: true,
+		},
+		"ok, equal": {
+			Selector: DeviceSelector{{
+				Key: "device_type", Op: SelectorOpEqual, Value: "gateway",
+			}},
+			Match: true,
+		},
+		"ok, prefix": {
+			Selector: DeviceSelector{{
+				Key: "mac", Op: SelectorOpPrefix, Value: "00:11:22",
+			}},
+			Match: true,
+		},
+		"ok, multiple values": {
+			Selector: DeviceSelector{{
+				Key: "serials", Op: SelectorOpPrefix, Value: "B-",
+			}},
+			Match: true,
+		},
+		"ok, number": {
+			Selector: DeviceSelector{{
+				Key: "revision", Op: SelectorOpEqual, Value: "3",
+			}},
+			Match: true,
+		},
+		"ok, all rules match": {
+			Selector: DeviceSelector{{
+				Key: "device_type", Op: SelectorOpEqual, Value: "gateway",
+			}, {
+				Key: "mac", Op: SelectorOpPrefix, Value: "00:11",
+			}},
+			Match: true,
+		},
+		"no match, one rule does not match": {
+			Selector: DeviceSelector{{
+				Key: "device_type", Op: SelectorOpEqual, Value: "gateway",
+			}, {
+				Key: "mac", Op: SelectorOpPrefix, Value: "ff:ff",
+			}},
+		},
+		"no match, missing attribute": {
+			Selector: DeviceSelector{{
+				Key: "sku", Op: SelectorOpEqual, Value: "gateway",
+			}},
+		},
+		"no match, equal is not prefix": {
+			Selector: DeviceSelector{{
+				Key: "device_type", Op: SelectorOpEqual, Value: "gate",
+			}},
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.Match, tc.Selector.Match(identityData))
+		})
+	}
+}
+
+func TestDeviceSelectorOverlaps(t *testing.T) {
+	t.Parallel()
+	rule := func(key string, op SelectorOp, value string) SelectorRule {
+		return SelectorRule{Key: key, Op: op, Value: value}
+	}
+	testCases := map[string]struct {
+		Selector DeviceSelector
+		Other    DeviceSelector
+
+		Overlaps bool
+	}{
+		"overlap, empty selectors": {
+			Overlaps: true,
+		},
+		"overlap, empty selector matches all": {
+			Selector: DeviceSelector{rule("device_type", SelectorOpEqual, "gateway")},
+			Overlaps: true,
+		},
+		"overlap, different attributes": {
+			Selector: DeviceSelector{rule("device_type", SelectorOpEqual, "gateway")},
+			Other:    DeviceSelector{rule("mac", SelectorOpPrefix, "00:11")},
+			Overlaps: true,
+		},
+		"overlap, nested prefixes": {
+			Selector: DeviceSelector{rule("mac", SelectorOpPrefix, "00:11")},
+			Other:    DeviceSelector{rule("mac", SelectorOpPrefix, "00:11:22")},
+			Overlaps: true,
+		},
+		"overlap, value with prefix": {
+			Selector: DeviceSelector{rule("mac", SelectorOpPrefix, "00:11")},
+			Other:    DeviceSelector{rule("mac", SelectorOpEqual, "00:11:22:33:44:55")},
+			Overlaps: true,
+		},
+		"disjoint, different values": {
+			Selector: DeviceSelector{rule("device_type", SelectorOpEqual, "gateway")},
+			Other:    DeviceSelector{rule("device_type", SelectorOpEqual, "sensor")},
+		},
+		"disjoint, different prefixes": {
+			Selector: DeviceSelector{rule("mac", SelectorOpPrefix, "00:11")},
+			Other:    DeviceSelector{rule("mac", SelectorOpPrefix, "00:22")},
+		},
+		"disjoint, value without prefix": {
+			Selector: DeviceSelector{rule("mac", SelectorOpPrefix, "00:11")},
+			Other:    DeviceSelector{rule("mac", SelectorOpEqual, "00:22:33:44:55:66")},
+		},
+		"disjoint, one attribute differs": {
+			Selector: DeviceSelector{
+				rule("device_type", SelectorOpEqual, "gateway"),
+				rule("mac", SelectorOpPrefix, "00:11"),
+			},
+			Other: DeviceSelector{
+				rule("device_type", SelectorOpEqual, "gateway"),
+				rule("mac", SelectorOpPrefix, "00:22"),
+			},
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.Overlaps, tc.Selector.Overlaps(tc.Other))
+			assert.Equal(t, tc.Overlaps, tc.Other.Overlaps(tc.Selector))
+		})
+	}
+}
+
+func TestDeviceSelectorValidate(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		Selector DeviceSelector
+
+		Error string
+	}{
+		"ok": {
+			Selector: DeviceSelector{{
+				Key: "device_type", Op: SelectorOpEqual, Value: "gateway",
+			}},
+		},
+		"ok, empty": {},
+		"error, missing key": {
+			Selector: DeviceSelector{{
+				Op: SelectorOpPrefix, Value: "gateway",
+			}},
+			Error: "0: (key: cannot be blank.).",
+		},
+		"error, missing op": {
+			Selector: DeviceSelector{{
+				Key: "device_type", Value: "gateway",
+			}},
+			Error: "0: (op: cannot be blank.).",
+		},
+		"error, too many rules": {
+			Selector: func() DeviceSelector {
+				sel := make(DeviceSelector, maxSelectorRules+1)
+				for i := range sel {
+					sel[i] = SelectorRule{
+						Key:   "key",
+						Op:    SelectorOpEqual,
+						Value: strings.Repeat("a", i),
+					}
+				}
+				return sel
+			}(),
+			Error: "the length must be no more than 32",
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.Selector.Validate()
+			if tc.Error != "" {
+				assert.EqualError(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
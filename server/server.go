@@ -34,25 +34,42 @@ import (
 	"github.com/mendersoftware/iot-manager/client/iothub"
 	"github.com/mendersoftware/iot-manager/client/workflows"
 	dconfig "github.com/mendersoftware/iot-manager/config"
+	"github.com/mendersoftware/iot-manager/metrics"
 	"github.com/mendersoftware/iot-manager/store"
+	"github.com/mendersoftware/iot-manager/tracing"
 )
 
 // InitAndRun initializes the server and runs it
 func InitAndRun(conf config.Reader, dataStore store.DataStore) error {
 	ctx := context.Background()
-	httpClient := new(http.Client)
+	shutdownTracing, err := tracing.Setup(ctx,
+		conf.GetString(dconfig.SettingTracingOTLPEndpoint),
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(ctxWithTimeout)
+	}()
+	httpClient := tracing.InstrumentClient(new(http.Client))
 	wf := workflows.NewClient(
 		conf.GetString(dconfig.SettingWorkflowsURL),
-		workflows.NewOptions().SetClient(httpClient),
+		workflows.NewOptions().SetClient(
+			metrics.InstrumentClient(metrics.ProviderWorkflows, httpClient),
+		),
 	)
-	hub := iothub.NewClient(iothub.NewOptions().SetClient(httpClient))
+	hub := iothub.NewClient(iothub.NewOptions().SetClient(
+		metrics.InstrumentClient(metrics.ProviderIoTHub, httpClient),
+	))
 	core := iotcore.NewClient()
 
 	log.Setup(conf.GetBool(dconfig.SettingDebugLog))
 	l := log.FromContext(ctx)
 
 	da, err := devauth.NewClient(devauth.Config{
-		Client:         httpClient,
+		Client:         metrics.InstrumentClient(metrics.ProviderDeviceauth, httpClient),
 		DevauthAddress: conf.GetString(dconfig.SettingDeviceauthURL),
 	})
 	if err != nil {
@@ -61,7 +78,24 @@ func InitAndRun(conf config.Reader, dataStore store.DataStore) error {
 
 	azureIotManagerApp := app.New(dataStore, wf, da).WithIoTHub(hub).WithIoTCore(core)
 	azureIotManagerApp = azureIotManagerApp.
-		WithWebhooksTimeout(config.Config.GetUint(dconfig.SettingWebhooksTimeoutSeconds))
+		WithWebhooksTimeout(config.Config.GetUint(dconfig.SettingWebhooksTimeoutSeconds)).
+		WithWebhooksRetry(
+			config.Config.GetUint(dconfig.SettingWebhooksRetryMaxAttempts),
+			config.Config.GetUint(dconfig.SettingWebhooksRetryBackoffSeconds),
+			config.Config.GetUint(dconfig.SettingWebhooksRetryMaxBackoffSeconds),
+		).
+		WithWebhooksCircuitBreaker(
+			config.Config.GetUint(dconfig.SettingWebhooksCircuitBreakerFailures),
+			config.Config.GetUint(dconfig.SettingWebhooksCircuitBreakerFailureRate),
+			config.Config.GetUint(dconfig.SettingWebhooksCircuitBreakerWindow),
+			config.Config.GetUint(dconfig.SettingWebhooksCircuitBreakerCooldownSeconds),
+		).
+		WithAsyncWorkers(
+			config.Config.GetUint(dconfig.SettingAsyncWorkers),
+			config.Config.GetUint(dconfig.SettingAsyncQueueSize),
+			config.Config.GetUint(dconfig.SettingAsyncTenantQueueSize),
+			config.Config.GetUint(dconfig.SettingAsyncBatchSize),
+		)
 
 	router := api.NewRouter(azureIotManagerApp,
 		api.NewConfig().
@@ -83,11 +117,23 @@ func InitAndRun(conf config.Reader, dataStore store.DataStore) error {
 		}
 	}()
 
+	ctxWorker, cancelWorker := context.WithCancel(ctx)
+	defer cancelWorker()
+	go func() {
+		interval := time.Duration(
+			conf.GetInt(dconfig.SettingWebhooksRetryIntervalSeconds),
+		) * time.Second
+		if err := azureIotManagerApp.RunDeliveryWorker(ctxWorker, interval); err != nil {
+			l.Errorf("webhook delivery worker: %s", err.Error())
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, unix.SIGINT, unix.SIGTERM)
 	<-quit
 
 	l.Info("server shutdown")
+	cancelWorker()
 
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -95,6 +141,15 @@ func InitAndRun(conf config.Reader, dataStore store.DataStore) error {
 		l.Fatal("error when shutting down the server ", err)
 	}
 
+	drainTimeout := time.Duration(
+		conf.GetInt(dconfig.SettingAsyncDrainTimeoutSeconds),
+	) * time.Second
+	ctxDrain, cancelDrain := context.WithTimeout(ctx, drainTimeout)
+	defer cancelDrain()
+	if err := azureIotManagerApp.DrainTasks(ctxDrain); err != nil {
+		l.Errorf("pending device events not processed: %s", err.Error())
+	}
+
 	l.Info("server exiting")
 	return nil
 }
@@ -17,6 +17,7 @@ package store
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -35,6 +36,9 @@ type DataStore interface {
 	GetIntegrationById(context.Context, uuid.UUID) (*model.Integration, error)
 	CreateIntegration(context.Context, model.Integration) (*model.Integration, error)
 	GetDevice(ctx context.Context, deviceID string) (*model.Device, error)
+	// GetDevices returns the tenant's devices matching the filter sorted
+	// by device ID.
+	GetDevices(ctx context.Context, fltr model.DeviceFilter) ([]model.Device, error)
 	GetDeviceByIntegrationID(
 		ctx context.Context,
 		deviceID string,
@@ -47,6 +51,12 @@ type DataStore interface {
 		ctx context.Context,
 		integrationID uuid.UUID,
 	) (deviceCount int64, err error)
+	// RemoveDeviceIntegration removes the integration from the device.
+	RemoveDeviceIntegration(
+		ctx context.Context,
+		deviceID string,
+		integrationID uuid.UUID,
+	) error
 	// UsertDeviceIntegrations adds the list of integration IDs to the
 	// device and creates it if it does not exist.
 	UpsertDeviceIntegrations(
@@ -55,9 +65,52 @@ type DataStore interface {
 		integrationIDs []uuid.UUID,
 	) (newDevice *model.Device, err error)
 	DeleteDevice(ctx context.Context, deviceID string) error
+	// SetIntegrationCredentials replaces the credentials of the
+	// integration and increments the version. Webhook credentials resume
+	// the integration if it is suspended.
 	SetIntegrationCredentials(context.Context, uuid.UUID, model.Credentials) error
+	// UpdateIntegrationCredentials replaces the credentials of the
+	// integration if its version has not changed and increments the
+	// version, like SetIntegrationCredentials. It returns ErrObjectNotFound if the integration does not
+	// exist with the given version.
+	UpdateIntegrationCredentials(
+		ctx context.Context,
+		integrationID uuid.UUID,
+		version int64,
+		credentials model.Credentials,
+	) error
+	// UpdateIntegration updates the name, description, selector and events
+	// of the integration if its version has not changed and increments the
+	// version. It returns ErrObjectNotFound if the integration does not
+	// exist with the given version.
+	UpdateIntegration(context.Context, model.Integration) (*model.Integration, error)
 	RemoveIntegration(context.Context, uuid.UUID) error
 
+	// RecordIntegrationDelivery adds the outcome of a delivery to the
+	// circuit breaker of the integration, keeping the latest window
+	// outcomes, and returns the updated integration.
+	RecordIntegrationDelivery(
+		ctx context.Context,
+		integrationID uuid.UUID,
+		success bool,
+		window int,
+	) (*model.Integration, error)
+	// SuspendIntegration suspends the integration unless it is already
+	// suspended; the first probe is due at probeTS.
+	SuspendIntegration(ctx context.Context, integrationID uuid.UUID, probeTS time.Time) error
+	// ClaimIntegrationProbe postpones the probe of the suspended
+	// integration to next if it is due at now. It returns false if the
+	// integration is not suspended or the probe is not due.
+	ClaimIntegrationProbe(
+		ctx context.Context,
+		integrationID uuid.UUID,
+		now, next time.Time,
+	) (bool, error)
+	// ResumeIntegration sets the integration active and resets its circuit
+	// breaker. It returns ErrObjectNotFound if the integration does not
+	// exist.
+	ResumeIntegration(ctx context.Context, integrationID uuid.UUID) error
+
 	// GetAllDevices returns an iterator over ALL devices sorted by tenant ID.
 	GetAllDevices(ctx context.Context) (Iterator, error)
 
@@ -65,6 +118,49 @@ type DataStore interface {
 	GetEvents(ctx context.Context, fltr model.EventsFilter) ([]model.Event, error)
 	// SaveEvent saves the event in the database
 	SaveEvent(ctx context.Context, event model.Event) error
+	// ReserveEventSequence reserves n consecutive sequence numbers for the
+	// events of the tenant and returns the first one.
+	ReserveEventSequence(ctx context.Context, n int) (int64, error)
+	// GetEvent returns the event with the given ID
+	GetEvent(ctx context.Context, eventID uuid.UUID) (*model.Event, error)
+	// GetIntegrationHealth summarizes the deliveries to the integration
+	// of the events produced within the last week before now.
+	GetIntegrationHealth(
+		ctx context.Context,
+		integrationID uuid.UUID,
+		now time.Time,
+	) (*model.IntegrationHealth, error)
+	// UpdateEventDeliveryStatus replaces the outcome of the delivery to
+	// the status integration and appends the status attempts to the
+	// delivery history.
+	UpdateEventDeliveryStatus(
+		ctx context.Context,
+		eventID uuid.UUID,
+		status model.DeliveryStatus,
+	) error
+
+	// EnqueueDeliveries adds the deliveries to the outbox.
+	EnqueueDeliveries(ctx context.Context, deliveries []model.Delivery) error
+	// ClaimDelivery returns a delivery which is due (across all tenants)
+	// and postpones it by the lease duration so that no other worker
+	// picks it up in the meantime.
+	ClaimDelivery(ctx context.Context, lease time.Duration) (*model.Delivery, error)
+	// ClaimEventDelivery returns the delivery of the event to the
+	// integration, whether it is due or not, and postpones it by the
+	// lease duration. It returns ErrObjectLeased if an attempt of the
+	// delivery is in progress.
+	ClaimEventDelivery(
+		ctx context.Context,
+		eventID uuid.UUID,
+		integrationID uuid.UUID,
+		lease time.Duration,
+	) (*model.Delivery, error)
+	// RescheduleDelivery updates the attempts count and the time of the
+	// next attempt of the delivery, and releases its lease.
+	RescheduleDelivery(ctx context.Context, delivery model.Delivery) error
+	// DeleteDelivery removes the delivery from the outbox.
+	DeleteDelivery(ctx context.Context, deliveryID uuid.UUID) error
+
 	// DeleteTenantData removes all data belonging to a given tenant
 	DeleteTenantData(
 		ctx context.Context,
@@ -82,4 +178,5 @@ var (
 	ErrObjectNotFound = errors.New("store: object not found")
 
 	ErrObjectExists = errors.New("store: the object already exists")
+	ErrObjectLeased = errors.New("store: the object is leased by another process")
 )
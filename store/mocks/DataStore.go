@@ -24,6 +24,8 @@ import (
 
 	store "github.com/mendersoftware/iot-manager/store"
 
+	time "time"
+
 	uuid "github.com/google/uuid"
 )
 
@@ -32,6 +34,73 @@ type DataStore struct {
 	mock.Mock
 }
 
+// ClaimDelivery provides a mock function with given fields: ctx, lease
+func (_m *DataStore) ClaimDelivery(ctx context.Context, lease time.Duration) (*model.Delivery, error) {
+	ret := _m.Called(ctx, lease)
+
+	var r0 *model.Delivery
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration) *model.Delivery); ok {
+		r0 = rf(ctx, lease)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Delivery)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Duration) error); ok {
+		r1 = rf(ctx, lease)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ClaimEventDelivery provides a mock function with given fields: ctx, eventID, integrationID, lease
+func (_m *DataStore) ClaimEventDelivery(ctx context.Context, eventID uuid.UUID, integrationID uuid.UUID, lease time.Duration) (*model.Delivery, error) {
+	ret := _m.Called(ctx, eventID, integrationID, lease)
+
+	var r0 *model.Delivery
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, uuid.UUID, time.Duration) *model.Delivery); ok {
+		r0 = rf(ctx, eventID, integrationID, lease)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Delivery)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, uuid.UUID, time.Duration) error); ok {
+		r1 = rf(ctx, eventID, integrationID, lease)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ClaimIntegrationProbe provides a mock function with given fields: ctx, integrationID, now, next
+func (_m *DataStore) ClaimIntegrationProbe(ctx context.Context, integrationID uuid.UUID, now time.Time, next time.Time) (bool, error) {
+	ret := _m.Called(ctx, integrationID, now, next)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, time.Time, time.Time) bool); ok {
+		r0 = rf(ctx, integrationID, now, next)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, time.Time, time.Time) error); ok {
+		r1 = rf(ctx, integrationID, now, next)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Close provides a mock function with given fields:
 func (_m *DataStore) Close() error {
 	ret := _m.Called()
@@ -69,6 +138,20 @@ func (_m *DataStore) CreateIntegration(_a0 context.Context, _a1 model.Integratio
 	return r0, r1
 }
 
+// DeleteDelivery provides a mock function with given fields: ctx, deliveryID
+func (_m *DataStore) DeleteDelivery(ctx context.Context, deliveryID uuid.UUID) error {
+	ret := _m.Called(ctx, deliveryID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) error); ok {
+		r0 = rf(ctx, deliveryID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeleteDevice provides a mock function with given fields: ctx, deviceID
 func (_m *DataStore) DeleteDevice(ctx context.Context, deviceID string) error {
 	ret := _m.Called(ctx, deviceID)
@@ -122,6 +205,20 @@ func (_m *DataStore) DoDevicesExistByIntegrationID(_a0 context.Context, _a1 uuid
 	return r0, r1
 }
 
+// EnqueueDeliveries provides a mock function with given fields: ctx, deliveries
+func (_m *DataStore) EnqueueDeliveries(ctx context.Context, deliveries []model.Delivery) error {
+	ret := _m.Called(ctx, deliveries)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []model.Delivery) error); ok {
+		r0 = rf(ctx, deliveries)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetAllDevices provides a mock function with given fields: ctx
 func (_m *DataStore) GetAllDevices(ctx context.Context) (store.Iterator, error) {
 	ret := _m.Called(ctx)
@@ -191,6 +288,52 @@ func (_m *DataStore) GetDeviceByIntegrationID(ctx context.Context, deviceID stri
 	return r0, r1
 }
 
+// GetDevices provides a mock function with given fields: ctx, fltr
+func (_m *DataStore) GetDevices(ctx context.Context, fltr model.DeviceFilter) ([]model.Device, error) {
+	ret := _m.Called(ctx, fltr)
+
+	var r0 []model.Device
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceFilter) []model.Device); ok {
+		r0 = rf(ctx, fltr)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Device)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceFilter) error); ok {
+		r1 = rf(ctx, fltr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetEvent provides a mock function with given fields: ctx, eventID
+func (_m *DataStore) GetEvent(ctx context.Context, eventID uuid.UUID) (*model.Event, error) {
+	ret := _m.Called(ctx, eventID)
+
+	var r0 *model.Event
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *model.Event); ok {
+		r0 = rf(ctx, eventID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Event)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, eventID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetEvents provides a mock function with given fields: ctx, fltr
 func (_m *DataStore) GetEvents(ctx context.Context, fltr model.EventsFilter) ([]model.Event, error) {
 	ret := _m.Called(ctx, fltr)
@@ -237,6 +380,29 @@ func (_m *DataStore) GetIntegrationById(_a0 context.Context, _a1 uuid.UUID) (*mo
 	return r0, r1
 }
 
+// GetIntegrationHealth provides a mock function with given fields: ctx, integrationID, now
+func (_m *DataStore) GetIntegrationHealth(ctx context.Context, integrationID uuid.UUID, now time.Time) (*model.IntegrationHealth, error) {
+	ret := _m.Called(ctx, integrationID, now)
+
+	var r0 *model.IntegrationHealth
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, time.Time) *model.IntegrationHealth); ok {
+		r0 = rf(ctx, integrationID, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.IntegrationHealth)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, time.Time) error); ok {
+		r1 = rf(ctx, integrationID, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetIntegrations provides a mock function with given fields: _a0, _a1
 func (_m *DataStore) GetIntegrations(_a0 context.Context, _a1 model.IntegrationFilter) ([]model.Integration, error) {
 	ret := _m.Called(_a0, _a1)
@@ -274,6 +440,43 @@ func (_m *DataStore) Ping(ctx context.Context) error {
 	return r0
 }
 
+// RecordIntegrationDelivery provides a mock function with given fields: ctx, integrationID, success, window
+func (_m *DataStore) RecordIntegrationDelivery(ctx context.Context, integrationID uuid.UUID, success bool, window int) (*model.Integration, error) {
+	ret := _m.Called(ctx, integrationID, success, window)
+
+	var r0 *model.Integration
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, bool, int) *model.Integration); ok {
+		r0 = rf(ctx, integrationID, success, window)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Integration)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, bool, int) error); ok {
+		r1 = rf(ctx, integrationID, success, window)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveDeviceIntegration provides a mock function with given fields: ctx, deviceID, integrationID
+func (_m *DataStore) RemoveDeviceIntegration(ctx context.Context, deviceID string, integrationID uuid.UUID) error {
+	ret := _m.Called(ctx, deviceID, integrationID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, uuid.UUID) error); ok {
+		r0 = rf(ctx, deviceID, integrationID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RemoveDevicesFromIntegration provides a mock function with given fields: ctx, integrationID
 func (_m *DataStore) RemoveDevicesFromIntegration(ctx context.Context, integrationID uuid.UUID) (int64, error) {
 	ret := _m.Called(ctx, integrationID)
@@ -309,6 +512,55 @@ func (_m *DataStore) RemoveIntegration(_a0 context.Context, _a1 uuid.UUID) error
 	return r0
 }
 
+// RescheduleDelivery provides a mock function with given fields: ctx, delivery
+func (_m *DataStore) RescheduleDelivery(ctx context.Context, delivery model.Delivery) error {
+	ret := _m.Called(ctx, delivery)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.Delivery) error); ok {
+		r0 = rf(ctx, delivery)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReserveEventSequence provides a mock function with given fields: ctx, n
+func (_m *DataStore) ReserveEventSequence(ctx context.Context, n int) (int64, error) {
+	ret := _m.Called(ctx, n)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, int) int64); ok {
+		r0 = rf(ctx, n)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, n)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ResumeIntegration provides a mock function with given fields: ctx, integrationID
+func (_m *DataStore) ResumeIntegration(ctx context.Context, integrationID uuid.UUID) error {
+	ret := _m.Called(ctx, integrationID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) error); ok {
+		r0 = rf(ctx, integrationID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SaveEvent provides a mock function with given fields: ctx, event
 func (_m *DataStore) SaveEvent(ctx context.Context, event model.Event) error {
 	ret := _m.Called(ctx, event)
@@ -337,6 +589,71 @@ func (_m *DataStore) SetIntegrationCredentials(_a0 context.Context, _a1 uuid.UUI
 	return r0
 }
 
+// SuspendIntegration provides a mock function with given fields: ctx, integrationID, probeTS
+func (_m *DataStore) SuspendIntegration(ctx context.Context, integrationID uuid.UUID, probeTS time.Time) error {
+	ret := _m.Called(ctx, integrationID, probeTS)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, time.Time) error); ok {
+		r0 = rf(ctx, integrationID, probeTS)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateEventDeliveryStatus provides a mock function with given fields: ctx, eventID, status
+func (_m *DataStore) UpdateEventDeliveryStatus(ctx context.Context, eventID uuid.UUID, status model.DeliveryStatus) error {
+	ret := _m.Called(ctx, eventID, status)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, model.DeliveryStatus) error); ok {
+		r0 = rf(ctx, eventID, status)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateIntegration provides a mock function with given fields: _a0, _a1
+func (_m *DataStore) UpdateIntegration(_a0 context.Context, _a1 model.Integration) (*model.Integration, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *model.Integration
+	if rf, ok := ret.Get(0).(func(context.Context, model.Integration) *model.Integration); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Integration)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.Integration) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateIntegrationCredentials provides a mock function with given fields: ctx, integrationID, version, credentials
+func (_m *DataStore) UpdateIntegrationCredentials(ctx context.Context, integrationID uuid.UUID, version int64, credentials model.Credentials) error {
+	ret := _m.Called(ctx, integrationID, version, credentials)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, int64, model.Credentials) error); ok {
+		r0 = rf(ctx, integrationID, version, credentials)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // UpsertDeviceIntegrations provides a mock function with given fields: ctx, deviceID, integrationIDs
 func (_m *DataStore) UpsertDeviceIntegrations(ctx context.Context, deviceID string, integrationIDs []uuid.UUID) (*model.Device, error) {
 	ret := _m.Called(ctx, deviceID, integrationIDs)
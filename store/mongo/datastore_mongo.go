@@ -26,6 +26,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	mopts "go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 
 	"github.com/mendersoftware/go-lib-micro/config"
 	"github.com/mendersoftware/go-lib-micro/identity"
@@ -43,8 +44,20 @@ const (
 	KeyID             = "_id"
 	KeyIntegrationIDs = "integration_ids"
 	KeyProvider       = "provider"
+	KeyName           = "name"
 	KeyTenantID       = "tenant_id"
 	KeyCredentials    = "credentials"
+	KeyDescription    = "description"
+	KeySelector       = "selector"
+	KeyEvents         = "events"
+	KeyVersion        = "version"
+	KeyState          = "state"
+
+	KeyCircuitBreaker                    = "circuit_breaker"
+	KeyCircuitBreakerConsecutiveFailures = KeyCircuitBreaker + ".consecutive_failures"
+	KeyCircuitBreakerOutcomes            = KeyCircuitBreaker + ".outcomes"
+	KeyCircuitBreakerSuspendedTS         = KeyCircuitBreaker + ".suspended_ts"
+	KeyCircuitBreakerProbeTS             = KeyCircuitBreaker + ".probe_ts"
 
 	ConnectTimeoutSeconds = 10
 	defaultAutomigrate    = false
@@ -120,7 +133,9 @@ func NewClient(ctx context.Context, c config.Reader) (*mongo.Client, error) {
 		return nil, errors.Errorf("Invalid mongoURL %q: missing schema.",
 			mongoURL)
 	}
-	clientOptions.ApplyURI(mongoURL).SetRegistry(newRegistry())
+	clientOptions.ApplyURI(mongoURL).
+		SetRegistry(newRegistry()).
+		SetMonitor(otelmongo.NewMonitor())
 
 	username := c.GetString(dconfig.SettingDbUsername)
 	if username != "" {
@@ -222,6 +237,9 @@ func (db *DataStoreMongo) GetIntegrations(
 		SetSort(bson.D{{
 			Key:   KeyProvider,
 			Value: 1,
+		}, {
+			Key:   KeyName,
+			Value: 1,
 		}, {
 			Key:   KeyID,
 			Value: 1,
@@ -278,7 +296,10 @@ func (db *DataStoreMongo) GetIntegrationById(
 	}
 
 	if err := collIntegrations.FindOne(ctx,
-		bson.M{KeyTenantID: tenantId},
+		bson.D{
+			{Key: KeyID, Value: integrationId},
+			{Key: KeyTenantID, Value: tenantId},
+		},
 	).Decode(&integration); err != nil {
 		switch err {
 		case mongo.ErrNoDocuments:
@@ -294,14 +315,12 @@ func (db *DataStoreMongo) CreateIntegration(
 	ctx context.Context,
 	integration model.Integration,
 ) (*model.Integration, error) {
-	var tenantID string
-	if id := identity.FromContext(ctx); id != nil {
-		tenantID = id.Tenant
-	}
 	collIntegrations := db.Collection(CollNameIntegrations)
 
-	// Force a single integration per tenant by utilizing unique '_id' index
-	integration.ID = uuid.NewSHA1(uuid.NameSpaceOID, []byte(tenantID))
+	// Uniqueness of (tenant_id, provider, name) is enforced by the
+	// IndexNameIntegrationsUnique index.
+	integration.ID = uuid.New()
+	integration.Version = 0
 
 	_, err := collIntegrations.
 		InsertOne(ctx, mstore.WithTenantID(ctx, integration))
@@ -315,6 +334,25 @@ func (db *DataStoreMongo) CreateIntegration(
 	return &integration, err
 }
 
+// credentialsUpdate returns the update replacing the integration
+// credentials. New credentials of a webhook resume the integration if it
+// is suspended by the circuit breaker.
+func credentialsUpdate(credentials model.Credentials) bson.D {
+	set := bson.D{{Key: KeyCredentials, Value: credentials}}
+	update := bson.D{{
+		Key: "$inc", Value: bson.D{{Key: KeyVersion, Value: 1}},
+	}}
+	if credentials.Type == model.CredentialTypeHTTP {
+		set = append(set, bson.E{
+			Key: KeyState, Value: model.IntegrationStateActive,
+		})
+		update = append(update, bson.E{
+			Key: "$unset", Value: bson.D{{Key: KeyCircuitBreaker, Value: ""}},
+		})
+	}
+	return append(update, bson.E{Key: "$set", Value: set})
+}
+
 func (db *DataStoreMongo) SetIntegrationCredentials(
 	ctx context.Context,
 	integrationId uuid.UUID,
@@ -327,18 +365,9 @@ func (db *DataStoreMongo) SetIntegrationCredentials(
 		Value: integrationId,
 	}}
 
-	update := bson.M{
-		"$set": bson.D{
-			{
-				Key:   KeyCredentials,
-				Value: credentials,
-			},
-		},
-	}
-
 	result, err := collIntegrations.UpdateOne(ctx,
 		mstore.WithTenantID(ctx, fltr),
-		update,
+		credentialsUpdate(credentials),
 	)
 	if result.MatchedCount == 0 {
 		return store.ErrObjectNotFound
@@ -347,6 +376,79 @@ func (db *DataStoreMongo) SetIntegrationCredentials(
 	return errors.Wrap(err, "mongo: failed to set integration credentials")
 }
 
+// matchVersion returns the filter value matching the integration version.
+func matchVersion(version int64) interface{} {
+	if version == 0 {
+		// Integrations created before versioning have no version field.
+		return bson.D{{Key: "$in", Value: bson.A{0, nil}}}
+	}
+	return version
+}
+
+func (db *DataStoreMongo) UpdateIntegrationCredentials(
+	ctx context.Context,
+	integrationID uuid.UUID,
+	version int64,
+	credentials model.Credentials,
+) error {
+	collIntegrations := db.Collection(CollNameIntegrations)
+
+	fltr := bson.D{{
+		Key: KeyID, Value: integrationID,
+	}, {
+		Key: KeyVersion, Value: matchVersion(version),
+	}}
+	result, err := collIntegrations.UpdateOne(ctx,
+		mstore.WithTenantID(ctx, fltr),
+		credentialsUpdate(credentials),
+	)
+	if err != nil {
+		return errors.Wrap(err, "mongo: failed to update integration credentials")
+	} else if result.MatchedCount == 0 {
+		return store.ErrObjectNotFound
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) UpdateIntegration(
+	ctx context.Context,
+	integration model.Integration,
+) (*model.Integration, error) {
+	collIntegrations := db.Collection(CollNameIntegrations)
+
+	fltr := bson.D{{
+		Key: KeyID, Value: integration.ID,
+	}, {
+		Key: KeyVersion, Value: matchVersion(integration.Version),
+	}}
+	update := bson.D{{
+		Key: "$set", Value: bson.D{
+			{Key: KeyName, Value: integration.Name},
+			{Key: KeyDescription, Value: integration.Description},
+			{Key: KeySelector, Value: integration.Selector},
+			{Key: KeyEvents, Value: integration.Events},
+		},
+	}, {
+		Key: "$inc", Value: bson.D{{Key: KeyVersion, Value: 1}},
+	}}
+
+	result := new(model.Integration)
+	err := collIntegrations.FindOneAndUpdate(ctx,
+		mstore.WithTenantID(ctx, fltr),
+		update,
+		mopts.FindOneAndUpdate().SetReturnDocument(mopts.After),
+	).Decode(result)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		return nil, store.ErrObjectNotFound
+	case isDuplicateKeyError(err):
+		return nil, store.ErrObjectExists
+	case err != nil:
+		return nil, errors.Wrap(err, "mongo: failed to update integration")
+	}
+	return result, nil
+}
+
 func (db *DataStoreMongo) RemoveIntegration(ctx context.Context, integrationId uuid.UUID) error {
 	collIntegrations := db.client.Database(*db.DbName).Collection(CollNameIntegrations)
 	fltr := bson.D{{
@@ -448,6 +550,41 @@ func (db *DataStoreMongo) GetDevice(
 	return result, err
 }
 
+func (db *DataStoreMongo) GetDevices(
+	ctx context.Context,
+	fltr model.DeviceFilter,
+) ([]model.Device, error) {
+	var (
+		tenantID string
+		results  = []model.Device{}
+	)
+	if id := identity.FromContext(ctx); id != nil {
+		tenantID = id.Tenant
+	}
+	findOpts := mopts.Find().
+		SetSort(bson.D{{Key: KeyID, Value: 1}}).
+		SetSkip(fltr.Skip)
+	if fltr.Limit > 0 {
+		findOpts.SetLimit(fltr.Limit)
+	}
+	fltrDoc := bson.D{{Key: KeyTenantID, Value: tenantID}}
+	if fltr.IntegrationID != uuid.Nil {
+		fltrDoc = append(fltrDoc, bson.E{
+			Key: KeyIntegrationIDs, Value: fltr.IntegrationID,
+		})
+	}
+
+	collDevices := db.Collection(CollNameDevices)
+	cur, err := collDevices.Find(ctx, fltrDoc, findOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error executing devices collection request")
+	}
+	if err = cur.All(ctx, &results); err != nil {
+		return nil, errors.Wrap(err, "error retrieving devices collection results")
+	}
+	return results, nil
+}
+
 func (db *DataStoreMongo) DeleteDevice(ctx context.Context, deviceID string) error {
 	var tenantID string
 	if id := identity.FromContext(ctx); id != nil {
@@ -498,6 +635,39 @@ func (db *DataStoreMongo) RemoveDevicesFromIntegration(
 	return 0, errors.Wrap(err, "mongo: failed to remove device from integration")
 }
 
+func (db *DataStoreMongo) RemoveDeviceIntegration(
+	ctx context.Context,
+	deviceID string,
+	integrationID uuid.UUID,
+) error {
+	var tenantID string
+	if id := identity.FromContext(ctx); id != nil {
+		tenantID = id.Tenant
+	}
+	filter := bson.D{{
+		Key: KeyID, Value: deviceID,
+	}, {
+		Key: KeyTenantID, Value: tenantID,
+	}, {
+		Key: KeyIntegrationIDs, Value: integrationID,
+	}}
+	update := bson.D{{
+		Key: "$pull", Value: bson.D{{
+			Key: KeyIntegrationIDs, Value: integrationID,
+		}},
+	}}
+
+	collDevices := db.Collection(CollNameDevices)
+
+	res, err := collDevices.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.Wrap(err, "mongo: failed to remove integration from device")
+	} else if res.MatchedCount == 0 {
+		return store.ErrObjectNotFound
+	}
+	return nil
+}
+
 func (db *DataStoreMongo) UpsertDeviceIntegrations(
 	ctx context.Context,
 	deviceID string,
@@ -556,6 +726,9 @@ func (db *DataStoreMongo) DeleteTenantData(
 		return errors.New("tenant id is empty")
 	}
 
+	// Every collection, including the outbox of the webhook deliveries,
+	// holds the tenant ID of its documents: a delivery of a removed tenant
+	// must not be retried by the delivery worker.
 	collectionNames, err := db.ListCollectionNames(ctx)
 	if err != nil {
 		return err
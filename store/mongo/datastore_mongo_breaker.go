@@ -0,0 +1,155 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	mstore "github.com/mendersoftware/go-lib-micro/store/v2"
+
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+)
+
+func (db *DataStoreMongo) RecordIntegrationDelivery(
+	ctx context.Context,
+	integrationID uuid.UUID,
+	success bool,
+	window int,
+) (*model.Integration, error) {
+	collIntegrations := db.Collection(CollNameIntegrations)
+
+	update := bson.D{{
+		Key: "$push", Value: bson.D{{
+			Key: KeyCircuitBreakerOutcomes, Value: bson.D{
+				{Key: "$each", Value: bson.A{success}},
+				{Key: "$slice", Value: -window},
+			},
+		}},
+	}}
+	if success {
+		update = append(update, bson.E{
+			Key: "$set", Value: bson.D{
+				{Key: KeyCircuitBreakerConsecutiveFailures, Value: 0},
+			},
+		})
+	} else {
+		update = append(update, bson.E{
+			Key: "$inc", Value: bson.D{
+				{Key: KeyCircuitBreakerConsecutiveFailures, Value: 1},
+			},
+		})
+	}
+	result := new(model.Integration)
+	err := collIntegrations.FindOneAndUpdate(ctx,
+		mstore.WithTenantID(ctx, bson.D{{Key: KeyID, Value: integrationID}}),
+		update,
+		mopts.FindOneAndUpdate().SetReturnDocument(mopts.After),
+	).Decode(result)
+	if err == mongo.ErrNoDocuments {
+		return nil, store.ErrObjectNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "mongo: failed to record integration delivery")
+	}
+	return result, nil
+}
+
+func (db *DataStoreMongo) SuspendIntegration(
+	ctx context.Context,
+	integrationID uuid.UUID,
+	probeTS time.Time,
+) error {
+	collIntegrations := db.Collection(CollNameIntegrations)
+
+	fltr := bson.D{
+		{Key: KeyID, Value: integrationID},
+		{Key: KeyState, Value: bson.D{
+			{Key: "$ne", Value: model.IntegrationStateSuspended},
+		}},
+	}
+	update := bson.D{{
+		Key: "$set", Value: bson.D{
+			{Key: KeyState, Value: model.IntegrationStateSuspended},
+			{Key: KeyCircuitBreakerSuspendedTS, Value: time.Now()},
+			{Key: KeyCircuitBreakerProbeTS, Value: probeTS},
+		},
+	}}
+	_, err := collIntegrations.UpdateOne(ctx,
+		mstore.WithTenantID(ctx, fltr),
+		update,
+	)
+	return errors.Wrap(err, "mongo: failed to suspend integration")
+}
+
+func (db *DataStoreMongo) ClaimIntegrationProbe(
+	ctx context.Context,
+	integrationID uuid.UUID,
+	now, next time.Time,
+) (bool, error) {
+	collIntegrations := db.Collection(CollNameIntegrations)
+
+	fltr := bson.D{
+		{Key: KeyID, Value: integrationID},
+		{Key: KeyState, Value: model.IntegrationStateSuspended},
+		{Key: KeyCircuitBreakerProbeTS, Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{{
+		Key: "$set", Value: bson.D{
+			{Key: KeyCircuitBreakerProbeTS, Value: next},
+		},
+	}}
+	res, err := collIntegrations.UpdateOne(ctx,
+		mstore.WithTenantID(ctx, fltr),
+		update,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "mongo: failed to claim integration probe")
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (db *DataStoreMongo) ResumeIntegration(
+	ctx context.Context,
+	integrationID uuid.UUID,
+) error {
+	collIntegrations := db.Collection(CollNameIntegrations)
+
+	update := bson.D{{
+		Key: "$set", Value: bson.D{
+			{Key: KeyState, Value: model.IntegrationStateActive},
+		},
+	}, {
+		Key: "$unset", Value: bson.D{
+			{Key: KeyCircuitBreaker, Value: ""},
+		},
+	}}
+	res, err := collIntegrations.UpdateOne(ctx,
+		mstore.WithTenantID(ctx, bson.D{{Key: KeyID, Value: integrationID}}),
+		update,
+	)
+	if err != nil {
+		return errors.Wrap(err, "mongo: failed to resume integration")
+	} else if res.MatchedCount == 0 {
+		return store.ErrObjectNotFound
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	dbName := t.Name()
+	dbClient := db.Client()
+	defer dbClient.Database(dbName).Drop(context.Background())
+	ds := NewDataStoreWithClient(dbClient, NewConfig().SetDbName(dbName))
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "123456789012345678901234",
+	})
+	integration, err := ds.CreateIntegration(ctx, model.Integration{
+		Provider: model.ProviderWebhook,
+		State:    model.IntegrationStateActive,
+		Credentials: model.Credentials{
+			Type: model.CredentialTypeHTTP,
+			HTTP: &model.HTTPCredentials{
+				URL: "https://example.com",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = ds.RecordIntegrationDelivery(ctx, uuid.New(), true, 3)
+	assert.ErrorIs(t, err, store.ErrObjectNotFound)
+
+	var result *model.Integration
+	for _, success := range []bool{true, false, false, false} {
+		result, err = ds.RecordIntegrationDelivery(ctx, integration.ID, success, 3)
+		require.NoError(t, err)
+	}
+	if assert.NotNil(t, result.CircuitBreaker) {
+		assert.Equal(t, 3, result.CircuitBreaker.ConsecutiveFailures)
+		assert.Equal(t, []bool{false, false, false}, result.CircuitBreaker.Outcomes)
+	}
+	result, err = ds.RecordIntegrationDelivery(ctx, integration.ID, true, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.CircuitBreaker.ConsecutiveFailures)
+	assert.Equal(t, []bool{false, false, true}, result.CircuitBreaker.Outcomes)
+
+	now := time.Now().Truncate(time.Millisecond)
+	err = ds.SuspendIntegration(ctx, integration.ID, now.Add(time.Minute))
+	require.NoError(t, err)
+	result, err = ds.GetIntegrationById(ctx, integration.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.IntegrationStateSuspended, result.State)
+	if assert.NotNil(t, result.CircuitBreaker.ProbeTS) {
+		assert.True(t, now.Add(time.Minute).Equal(*result.CircuitBreaker.ProbeTS))
+	}
+
+	// The probe is not due yet
+	claimed, err := ds.ClaimIntegrationProbe(ctx, integration.ID, now, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	later := now.Add(2 * time.Minute)
+	claimed, err = ds.ClaimIntegrationProbe(ctx, integration.ID, later, later.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	// Only a single probe is claimed per cooldown
+	claimed, err = ds.ClaimIntegrationProbe(ctx, integration.ID, later, later.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	err = ds.ResumeIntegration(ctx, integration.ID)
+	require.NoError(t, err)
+	result, err = ds.GetIntegrationById(ctx, integration.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.IntegrationStateActive, result.State)
+	assert.Nil(t, result.CircuitBreaker)
+
+	err = ds.ResumeIntegration(ctx, uuid.New())
+	assert.ErrorIs(t, err, store.ErrObjectNotFound)
+
+	// Updating the credentials resumes the integration
+	err = ds.SuspendIntegration(ctx, integration.ID, now.Add(time.Minute))
+	require.NoError(t, err)
+	err = ds.SetIntegrationCredentials(ctx, integration.ID, integration.Credentials)
+	require.NoError(t, err)
+	result, err = ds.GetIntegrationById(ctx, integration.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.IntegrationStateActive, result.State)
+	assert.Nil(t, result.CircuitBreaker)
+}
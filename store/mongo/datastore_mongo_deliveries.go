@@ -0,0 +1,181 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+)
+
+const (
+	CollNameDeliveries = "deliveries"
+
+	KeyAttempts = "attempts"
+	KeyNextTs   = "next_ts"
+	KeyLeaseTs  = "lease_ts"
+)
+
+func (db *DataStoreMongo) EnqueueDeliveries(
+	ctx context.Context,
+	deliveries []model.Delivery,
+) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	var tenantID string
+	if id := identity.FromContext(ctx); id != nil {
+		tenantID = id.Tenant
+	}
+	docs := make([]interface{}, len(deliveries))
+	for i, delivery := range deliveries {
+		if delivery.ID == uuid.Nil {
+			delivery.ID = uuid.New()
+		}
+		delivery.TenantID = tenantID
+		docs[i] = delivery
+	}
+	collDeliveries := db.Collection(CollNameDeliveries)
+	_, err := collDeliveries.InsertMany(ctx, docs)
+	if err != nil {
+		return errors.Wrap(err, "mongo: failed to enqueue deliveries")
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) ClaimDelivery(
+	ctx context.Context,
+	lease time.Duration,
+) (*model.Delivery, error) {
+	var delivery = new(model.Delivery)
+	now := time.Now()
+
+	collDeliveries := db.Collection(CollNameDeliveries)
+	err := collDeliveries.FindOneAndUpdate(ctx,
+		bson.D{{Key: KeyNextTs, Value: bson.D{{Key: "$lte", Value: now}}}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: KeyNextTs, Value: now.Add(lease)},
+			{Key: KeyLeaseTs, Value: now.Add(lease)},
+		}}},
+		mopts.FindOneAndUpdate().
+			SetSort(bson.D{{Key: KeyNextTs, Value: 1}}).
+			SetReturnDocument(mopts.After),
+	).Decode(delivery)
+	if err != nil {
+		switch err {
+		case mongo.ErrNoDocuments:
+			return nil, store.ErrObjectNotFound
+		default:
+			return nil, errors.Wrap(err, "mongo: failed to claim delivery")
+		}
+	}
+	return delivery, nil
+}
+
+func (db *DataStoreMongo) ClaimEventDelivery(
+	ctx context.Context,
+	eventID uuid.UUID,
+	integrationID uuid.UUID,
+	lease time.Duration,
+) (*model.Delivery, error) {
+	var (
+		delivery = new(model.Delivery)
+		tenantID string
+	)
+	if id := identity.FromContext(ctx); id != nil {
+		tenantID = id.Tenant
+	}
+	now := time.Now()
+	fltr := bson.D{
+		{Key: KeyTenantID, Value: tenantID},
+		{Key: KeyEventID, Value: eventID},
+		{Key: KeyIntegrationID, Value: integrationID},
+	}
+
+	collDeliveries := db.Collection(CollNameDeliveries)
+	err := collDeliveries.FindOneAndUpdate(ctx,
+		append(fltr, bson.E{
+			Key:   KeyLeaseTs,
+			Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$gt", Value: now}}}},
+		}),
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: KeyNextTs, Value: now.Add(lease)},
+			{Key: KeyLeaseTs, Value: now.Add(lease)},
+		}}},
+		mopts.FindOneAndUpdate().
+			SetReturnDocument(mopts.After),
+	).Decode(delivery)
+	if err == mongo.ErrNoDocuments {
+		// Tell a missing delivery apart from an attempt in progress
+		var count int64
+		count, err = collDeliveries.CountDocuments(ctx, fltr)
+		if err == nil {
+			if count > 0 {
+				return nil, store.ErrObjectLeased
+			}
+			return nil, store.ErrObjectNotFound
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "mongo: failed to claim event delivery")
+	}
+	return delivery, nil
+}
+
+func (db *DataStoreMongo) RescheduleDelivery(
+	ctx context.Context,
+	delivery model.Delivery,
+) error {
+	collDeliveries := db.Collection(CollNameDeliveries)
+	res, err := collDeliveries.UpdateOne(ctx,
+		bson.D{{Key: KeyID, Value: delivery.ID}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: KeyAttempts, Value: delivery.Attempts},
+			{Key: KeyNextTs, Value: delivery.NextTS},
+		}}, {Key: "$unset", Value: bson.D{
+			{Key: KeyLeaseTs, Value: ""},
+		}}},
+	)
+	if err != nil {
+		return errors.Wrap(err, "mongo: failed to reschedule delivery")
+	} else if res.MatchedCount == 0 {
+		return store.ErrObjectNotFound
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteDelivery(
+	ctx context.Context,
+	deliveryID uuid.UUID,
+) error {
+	collDeliveries := db.Collection(CollNameDeliveries)
+	_, err := collDeliveries.DeleteOne(ctx,
+		bson.D{{Key: KeyID, Value: deliveryID}},
+	)
+	if err != nil {
+		return errors.Wrap(err, "mongo: failed to delete delivery")
+	}
+	return nil
+}
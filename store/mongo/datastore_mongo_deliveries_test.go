@@ -0,0 +1,135 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
+)
+
+func TestDeliveries(t *testing.T) {
+	t.Parallel()
+	const tenantID = "123456789012345678901234"
+	dbName := t.Name()
+	dbClient := db.Client()
+	defer dbClient.Database(dbName).Drop(context.Background())
+	ds := NewDataStoreWithClient(dbClient, NewConfig().SetDbName(dbName))
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenantID,
+	})
+	now := time.Now().Truncate(time.Millisecond)
+	due := model.Delivery{
+		ID:            uuid.New(),
+		EventID:       uuid.New(),
+		IntegrationID: uuid.New(),
+		Attempts:      1,
+		NextTS:        now.Add(-time.Minute),
+	}
+	notDue := model.Delivery{
+		ID:            uuid.New(),
+		EventID:       uuid.New(),
+		IntegrationID: uuid.New(),
+		Attempts:      1,
+		NextTS:        now.Add(time.Hour),
+	}
+	err := ds.EnqueueDeliveries(ctx, []model.Delivery{due, notDue})
+	require.NoError(t, err)
+
+	// The worker context does not carry any identity
+	delivery, err := ds.ClaimDelivery(context.Background(), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, due.ID, delivery.ID)
+	assert.Equal(t, tenantID, delivery.TenantID)
+	assert.Equal(t, due.EventID, delivery.EventID)
+	assert.Equal(t, due.IntegrationID, delivery.IntegrationID)
+	assert.True(t, delivery.NextTS.After(now), "delivery lease not set")
+
+	// The claimed delivery is leased
+	_, err = ds.ClaimDelivery(context.Background(), time.Minute)
+	assert.ErrorIs(t, err, store.ErrObjectNotFound)
+	_, err = ds.ClaimEventDelivery(ctx, due.EventID, due.IntegrationID, time.Minute)
+	assert.ErrorIs(t, err, store.ErrObjectLeased)
+
+	delivery.Attempts = 2
+	delivery.NextTS = now.Add(-time.Second)
+	err = ds.RescheduleDelivery(context.Background(), *delivery)
+	require.NoError(t, err)
+
+	delivery, err = ds.ClaimDelivery(context.Background(), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, due.ID, delivery.ID)
+	assert.Equal(t, 2, delivery.Attempts)
+
+	err = ds.DeleteDelivery(context.Background(), delivery.ID)
+	require.NoError(t, err)
+	err = ds.RescheduleDelivery(context.Background(), *delivery)
+	assert.ErrorIs(t, err, store.ErrObjectNotFound)
+
+	// Deliveries of an event are claimed even if they are not due
+	delivery, err = ds.ClaimEventDelivery(ctx,
+		notDue.EventID, notDue.IntegrationID, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, notDue.ID, delivery.ID)
+	assert.True(t, delivery.NextTS.Before(notDue.NextTS), "delivery lease not set")
+	_, err = ds.ClaimEventDelivery(ctx,
+		notDue.EventID, notDue.IntegrationID, time.Minute)
+	assert.ErrorIs(t, err, store.ErrObjectLeased,
+		"a redelivery in progress must not be claimed again")
+
+	// The first attempt holds the lease of a new delivery
+	leased := model.Delivery{
+		ID:            uuid.New(),
+		EventID:       uuid.New(),
+		IntegrationID: uuid.New(),
+		NextTS:        now.Add(time.Minute),
+		LeaseTS:       now.Add(time.Minute),
+	}
+	err = ds.EnqueueDeliveries(ctx, []model.Delivery{leased})
+	require.NoError(t, err)
+	_, err = ds.ClaimEventDelivery(ctx, leased.EventID, leased.IntegrationID, time.Minute)
+	assert.ErrorIs(t, err, store.ErrObjectLeased)
+	leased.Attempts = 1
+	leased.NextTS = now.Add(time.Hour)
+	err = ds.RescheduleDelivery(ctx, leased)
+	require.NoError(t, err)
+	delivery, err = ds.ClaimEventDelivery(ctx,
+		leased.EventID, leased.IntegrationID, time.Minute)
+	require.NoError(t, err, "the rescheduled delivery must be released")
+	assert.Equal(t, leased.ID, delivery.ID)
+
+	otherTenant := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "000000000000000000000000",
+	})
+	_, err = ds.ClaimEventDelivery(otherTenant,
+		notDue.EventID, notDue.IntegrationID, time.Minute)
+	assert.ErrorIs(t, err, store.ErrObjectNotFound)
+	_, err = ds.ClaimEventDelivery(ctx,
+		notDue.EventID, uuid.New(), time.Minute)
+	assert.ErrorIs(t, err, store.ErrObjectNotFound)
+
+	err = ds.EnqueueDeliveries(ctx, nil)
+	assert.NoError(t, err)
+}
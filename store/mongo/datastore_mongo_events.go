@@ -21,24 +21,38 @@ import (
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	mopts "go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/mendersoftware/go-lib-micro/identity"
 	mstore "github.com/mendersoftware/go-lib-micro/store/v2"
 
 	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
 )
 
 const (
-	CollNameLog = "log"
+	CollNameLog       = "log"
+	CollNameSequences = "sequences"
 
-	KeyEventTs       = "event_ts"
-	KeyEventExpireTs = "expire_ts"
+	KeyEventTs             = "event_ts"
+	KeyEventExpireTs       = "expire_ts"
+	KeyEventDeliveryStatus = "status"
+	KeyEventDeviceID       = "data.id"
+	KeyEventSequence       = "seq"
+	KeyType                = "type"
+	KeyIntegrationID       = "integration_id"
+	KeySuccess             = "success"
+	KeyPending             = "pending"
+	KeySkipped             = "skipped"
+	KeyDuration            = "duration_ms"
 )
 
 var (
 	eventExpiration int64
 
 	ErrFailedToGetEvents = errors.New("failed to get events")
+	ErrFailedToGetEvent  = errors.New("failed to get event")
 )
 
 func SetEventExpiration(exp int64) {
@@ -56,14 +70,17 @@ func (db *DataStoreMongo) GetEvents(
 
 	collEvents := db.Collection(CollNameLog)
 	findOpts := mopts.Find().
-		SetSort(bson.D{{Key: KeyEventTs, Value: -1}}).
+		SetSort(bson.D{
+			{Key: KeyEventTs, Value: -1},
+			{Key: KeyID, Value: -1},
+		}).
 		SetSkip(fltr.Skip)
 	if fltr.Limit > 0 {
 		findOpts.SetLimit(fltr.Limit)
 	}
 
 	cur, err := collEvents.Find(ctx,
-		mstore.WithTenantID(ctx, bson.D{}),
+		mstore.WithTenantID(ctx, eventsFilterQuery(fltr)),
 		findOpts,
 	)
 	if err != nil {
@@ -76,6 +93,67 @@ func (db *DataStoreMongo) GetEvents(
 	return results, nil
 }
 
+func eventsFilterQuery(fltr model.EventsFilter) bson.D {
+	query := bson.D{}
+	if fltr.Type != "" {
+		query = append(query, bson.E{Key: KeyType, Value: fltr.Type})
+	}
+	if fltr.DeviceID != "" {
+		query = append(query, bson.E{Key: KeyEventDeviceID, Value: fltr.DeviceID})
+	}
+	if fltr.SequenceAfter > 0 {
+		query = append(query, bson.E{
+			Key:   KeyEventSequence,
+			Value: bson.D{{Key: "$gt", Value: fltr.SequenceAfter}},
+		})
+	}
+	if fltr.IntegrationID != uuid.Nil {
+		elem := bson.D{{Key: KeyIntegrationID, Value: fltr.IntegrationID}}
+		if fltr.Success != nil {
+			elem = append(elem, bson.E{Key: KeySuccess, Value: *fltr.Success})
+		}
+		query = append(query, bson.E{
+			Key:   KeyEventDeliveryStatus,
+			Value: bson.D{{Key: "$elemMatch", Value: elem}},
+		})
+	} else if fltr.Success != nil {
+		if *fltr.Success {
+			// None of the deliveries failed
+			query = append(query, bson.E{
+				Key:   KeyEventDeliveryStatus + "." + KeySuccess,
+				Value: bson.D{{Key: "$ne", Value: false}},
+			})
+		} else {
+			query = append(query, bson.E{
+				Key:   KeyEventDeliveryStatus + "." + KeySuccess,
+				Value: false,
+			})
+		}
+	}
+	if !fltr.From.IsZero() || !fltr.To.IsZero() {
+		timeRange := bson.D{}
+		if !fltr.From.IsZero() {
+			timeRange = append(timeRange, bson.E{Key: "$gte", Value: fltr.From})
+		}
+		if !fltr.To.IsZero() {
+			timeRange = append(timeRange, bson.E{Key: "$lte", Value: fltr.To})
+		}
+		query = append(query, bson.E{Key: KeyEventTs, Value: timeRange})
+	}
+	if fltr.After != nil {
+		query = append(query, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: KeyEventTs, Value: bson.D{
+				{Key: "$lt", Value: fltr.After.EventTS},
+			}}},
+			bson.D{
+				{Key: KeyEventTs, Value: fltr.After.EventTS},
+				{Key: KeyID, Value: bson.D{{Key: "$lt", Value: fltr.After.ID}}},
+			},
+		}})
+	}
+	return query
+}
+
 func (db *DataStoreMongo) SaveEvent(
 	ctx context.Context,
 	event model.Event,
@@ -98,3 +176,240 @@ func (db *DataStoreMongo) SaveEvent(
 
 	return nil
 }
+
+// ReserveEventSequence increments the event counter of the tenant, which
+// is shared by all the instances of the service, by n.
+func (db *DataStoreMongo) ReserveEventSequence(
+	ctx context.Context,
+	n int,
+) (int64, error) {
+	var tenantID string
+	if id := identity.FromContext(ctx); id != nil {
+		tenantID = id.Tenant
+	}
+	var counter struct {
+		Sequence int64 `bson:"seq"`
+	}
+	collSequences := db.Collection(CollNameSequences)
+	err := collSequences.FindOneAndUpdate(ctx,
+		mstore.WithTenantID(ctx, bson.D{{Key: KeyID, Value: tenantID}}),
+		bson.D{{Key: "$inc", Value: bson.D{
+			{Key: KeyEventSequence, Value: int64(n)},
+		}}},
+		mopts.FindOneAndUpdate().
+			SetUpsert(true).
+			SetReturnDocument(mopts.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, errors.Wrap(err, "mongo: failed to reserve event sequence")
+	}
+	return counter.Sequence - int64(n) + 1, nil
+}
+
+func (db *DataStoreMongo) GetEvent(
+	ctx context.Context,
+	eventID uuid.UUID,
+) (*model.Event, error) {
+	var event = new(model.Event)
+
+	collEvents := db.Collection(CollNameLog)
+	err := collEvents.FindOne(ctx,
+		mstore.WithTenantID(ctx, bson.D{{Key: KeyID, Value: eventID}}),
+	).Decode(event)
+	if err != nil {
+		switch err {
+		case mongo.ErrNoDocuments:
+			return nil, store.ErrObjectNotFound
+		default:
+			return nil, errors.Wrap(err, ErrFailedToGetEvent.Error())
+		}
+	}
+	return event, nil
+}
+
+func (db *DataStoreMongo) UpdateEventDeliveryStatus(
+	ctx context.Context,
+	eventID uuid.UUID,
+	status model.DeliveryStatus,
+) error {
+	const (
+		keyStatusIntegrationID = KeyEventDeliveryStatus + "." + KeyIntegrationID
+		keyStatusMatched       = KeyEventDeliveryStatus + ".$."
+	)
+	collEvents := db.Collection(CollNameLog)
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: keyStatusMatched + KeySuccess, Value: status.Success},
+			{Key: keyStatusMatched + "err", Value: status.Error},
+			{Key: keyStatusMatched + "status", Value: status.StatusCode},
+			{Key: keyStatusMatched + KeyDuration, Value: status.Duration},
+			{Key: keyStatusMatched + KeyPending, Value: status.Pending},
+			{Key: keyStatusMatched + KeySkipped, Value: status.Skipped},
+		}},
+	}
+	if len(status.Attempts) > 0 {
+		update = append(update, bson.E{Key: "$push", Value: bson.D{
+			{Key: keyStatusMatched + "attempts", Value: bson.D{
+				{Key: "$each", Value: status.Attempts},
+			}},
+		}})
+	}
+	res, err := collEvents.UpdateOne(ctx,
+		mstore.WithTenantID(ctx, bson.D{
+			{Key: KeyID, Value: eventID},
+			{Key: keyStatusIntegrationID, Value: status.IntegrationID},
+		}),
+		update,
+	)
+	if err != nil {
+		return errors.Wrap(err, "mongo: failed to update event delivery status")
+	} else if res.MatchedCount == 0 {
+		return store.ErrObjectNotFound
+	}
+	return nil
+}
+
+// GetIntegrationHealth aggregates the deliveries to the integration of the
+// events produced within the last week before now. The time of a delivery
+// is the time of its latest attempt, or the time of the event if there are
+// no attempts recorded.
+func (db *DataStoreMongo) GetIntegrationHealth(
+	ctx context.Context,
+	integrationID uuid.UUID,
+	now time.Time,
+) (*model.IntegrationHealth, error) {
+	const (
+		keyStatusIntegrationID = KeyEventDeliveryStatus + "." + KeyIntegrationID
+		keyStatusSkipped       = KeyEventDeliveryStatus + "." + KeySkipped
+		keyStatusPending       = KeyEventDeliveryStatus + "." + KeyPending
+		keyTS                  = "ts"
+	)
+	since := func(window time.Duration) bson.D {
+		return bson.D{{Key: "$gte", Value: bson.A{"$" + keyTS, now.Add(-window)}}}
+	}
+	count := func(conds ...interface{}) bson.D {
+		return bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$and", Value: bson.A(conds)}}, 1, 0,
+		}}}}}
+	}
+	last := func(success bool) bson.A {
+		return bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: KeySuccess, Value: success}}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: keyTS, Value: -1}}}},
+			bson.D{{Key: "$limit", Value: 1}},
+		}
+	}
+	notSkipped := bson.D{{Key: "$ne", Value: true}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: mstore.WithTenantID(ctx, bson.D{
+			{Key: KeyEventTs, Value: bson.D{
+				{Key: "$gte", Value: now.Add(-model.HealthWindowWeek)},
+			}},
+			{Key: KeyEventDeliveryStatus, Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+				{Key: KeyIntegrationID, Value: integrationID},
+				{Key: KeySkipped, Value: notSkipped},
+			}}}},
+		})}},
+		{{Key: "$unwind", Value: "$" + KeyEventDeliveryStatus}},
+		{{Key: "$match", Value: bson.D{
+			{Key: keyStatusIntegrationID, Value: integrationID},
+			{Key: keyStatusSkipped, Value: notSkipped},
+			{Key: keyStatusPending, Value: bson.D{{Key: "$ne", Value: true}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: keyTS, Value: bson.D{{Key: "$ifNull", Value: bson.A{
+				bson.D{{Key: "$arrayElemAt", Value: bson.A{
+					"$" + KeyEventDeliveryStatus + ".attempts.ts", -1,
+				}}},
+				"$" + KeyEventTs,
+			}}}},
+			{Key: KeySuccess, Value: "$" + KeyEventDeliveryStatus + "." + KeySuccess},
+			{Key: "status", Value: "$" + KeyEventDeliveryStatus + ".status"},
+			{Key: "err", Value: "$" + KeyEventDeliveryStatus + ".err"},
+			{Key: KeyDuration, Value: "$" + KeyEventDeliveryStatus + "." + KeyDuration},
+		}}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "stats", Value: bson.A{
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: KeyID, Value: nil},
+					{Key: "total_hour", Value: count(since(model.HealthWindowHour))},
+					{Key: "succeeded_hour", Value: count(
+						since(model.HealthWindowHour), "$"+KeySuccess,
+					)},
+					{Key: "total_day", Value: count(since(model.HealthWindowDay))},
+					{Key: "succeeded_day", Value: count(
+						since(model.HealthWindowDay), "$"+KeySuccess,
+					)},
+					{Key: "total_week", Value: count(since(model.HealthWindowWeek))},
+					{Key: "succeeded_week", Value: count(
+						since(model.HealthWindowWeek), "$"+KeySuccess,
+					)},
+					{Key: "avg_duration", Value: bson.D{{Key: "$avg", Value: "$" + KeyDuration}}},
+				}}},
+			}},
+			{Key: "last_success", Value: last(true)},
+			{Key: "last_failure", Value: last(false)},
+			{Key: "status_codes", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "status", Value: bson.D{{Key: "$type", Value: "number"}}},
+				}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: KeyID, Value: "$status"},
+					{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+				}}},
+			}},
+		}}},
+	}
+	cur, err := db.Collection(CollNameLog).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, errors.Wrap(err, "mongo: failed to aggregate the integration health")
+	}
+	var results []struct {
+		Stats []struct {
+			TotalHour     int64    `bson:"total_hour"`
+			SucceededHour int64    `bson:"succeeded_hour"`
+			TotalDay      int64    `bson:"total_day"`
+			SucceededDay  int64    `bson:"succeeded_day"`
+			TotalWeek     int64    `bson:"total_week"`
+			SucceededWeek int64    `bson:"succeeded_week"`
+			AvgDuration   *float64 `bson:"avg_duration"`
+		} `bson:"stats"`
+		LastSuccess []model.DeliveryOutcome `bson:"last_success"`
+		LastFailure []model.DeliveryOutcome `bson:"last_failure"`
+		StatusCodes []struct {
+			Code  int   `bson:"_id"`
+			Count int64 `bson:"count"`
+		} `bson:"status_codes"`
+	}
+	if err = cur.All(ctx, &results); err != nil {
+		return nil, errors.Wrap(err, "mongo: failed to decode the integration health")
+	}
+	health := &model.IntegrationHealth{
+		LastHour:    model.NewDeliveryStats(0, 0),
+		LastDay:     model.NewDeliveryStats(0, 0),
+		LastWeek:    model.NewDeliveryStats(0, 0),
+		StatusCodes: map[int]int64{},
+	}
+	if len(results) == 0 {
+		return health, nil
+	}
+	result := results[0]
+	if len(result.Stats) > 0 {
+		stats := result.Stats[0]
+		health.LastHour = model.NewDeliveryStats(stats.TotalHour, stats.SucceededHour)
+		health.LastDay = model.NewDeliveryStats(stats.TotalDay, stats.SucceededDay)
+		health.LastWeek = model.NewDeliveryStats(stats.TotalWeek, stats.SucceededWeek)
+		health.AverageDuration = stats.AvgDuration
+	}
+	if len(result.LastSuccess) > 0 {
+		health.LastSuccess = &result.LastSuccess[0]
+	}
+	if len(result.LastFailure) > 0 {
+		health.LastFailure = &result.LastFailure[0]
+	}
+	for _, code := range result.StatusCodes {
+		health.StatusCodes[code.Code] = code.Count
+	}
+	return health, nil
+}
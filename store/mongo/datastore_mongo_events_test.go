@@ -15,8 +15,10 @@
 package mongo
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
@@ -24,10 +26,12 @@ import (
 	"github.com/mendersoftware/go-lib-micro/identity"
 	mstore "github.com/mendersoftware/go-lib-micro/store/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/mendersoftware/iot-manager/model"
+	"github.com/mendersoftware/iot-manager/store"
 )
 
 func TestGetEvents(t *testing.T) {
@@ -383,3 +387,382 @@ func TestSaveEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestGetEvent(t *testing.T) {
+	t.Parallel()
+	const tenantID = "123456789012345678901234"
+	dbName := t.Name()
+	dbClient := db.Client()
+	defer dbClient.Database(dbName).Drop(context.Background())
+	ds := NewDataStoreWithClient(dbClient, NewConfig().SetDbName(dbName))
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenantID,
+	})
+	event := model.Event{
+		WebhookEvent: model.WebhookEvent{
+			ID:   uuid.New(),
+			Type: model.EventTypeDeviceDecommissioned,
+			Data: model.DeviceEvent{
+				ID: "foo",
+			},
+		},
+	}
+	err := ds.SaveEvent(ctx, event)
+	require.NoError(t, err)
+
+	res, err := ds.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	assert.Equal(t, event.ID, res.ID)
+	assert.Equal(t, event.Type, res.Type)
+
+	_, err = ds.GetEvent(ctx, uuid.New())
+	assert.ErrorIs(t, err, store.ErrObjectNotFound)
+
+	// Other tenants cannot access the event
+	ctxOther := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "other",
+	})
+	_, err = ds.GetEvent(ctxOther, event.ID)
+	assert.ErrorIs(t, err, store.ErrObjectNotFound)
+}
+
+func TestReserveEventSequence(t *testing.T) {
+	t.Parallel()
+	dbName := t.Name()
+	dbClient := db.Client()
+	defer dbClient.Database(dbName).Drop(context.Background())
+	ds := NewDataStoreWithClient(dbClient, NewConfig().SetDbName(dbName))
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "123456789012345678901234",
+	})
+	seq, err := ds.ReserveEventSequence(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), seq)
+
+	seq, err = ds.ReserveEventSequence(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), seq)
+
+	seq, err = ds.ReserveEventSequence(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), seq)
+
+	// The tenants have their own counter
+	ctxOther := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "other",
+	})
+	seq, err = ds.ReserveEventSequence(ctxOther, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), seq)
+}
+
+func TestUpdateEventDeliveryStatus(t *testing.T) {
+	t.Parallel()
+	const tenantID = "123456789012345678901234"
+	dbName := t.Name()
+	dbClient := db.Client()
+	defer dbClient.Database(dbName).Drop(context.Background())
+	ds := NewDataStoreWithClient(dbClient, NewConfig().SetDbName(dbName))
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenantID,
+	})
+	statusCode := http.StatusServiceUnavailable
+	firstAttempt := model.DeliveryAttempt{
+		Error:      "503 Service Unavailable",
+		StatusCode: &statusCode,
+		Timestamp:  time.Now().Add(-time.Minute).Truncate(time.Millisecond).UTC(),
+	}
+	integrationID := uuid.New()
+	event := model.Event{
+		WebhookEvent: model.WebhookEvent{
+			ID:   uuid.New(),
+			Type: model.EventTypeDeviceDecommissioned,
+			Data: model.DeviceEvent{
+				ID: "foo",
+			},
+		},
+		DeliveryStatus: []model.DeliveryStatus{{
+			IntegrationID: uuid.New(),
+			Success:       true,
+		}, {
+			IntegrationID: integrationID,
+			Error:         firstAttempt.Error,
+			StatusCode:    firstAttempt.StatusCode,
+			Attempts:      []model.DeliveryAttempt{firstAttempt},
+		}},
+	}
+	err := ds.SaveEvent(ctx, event)
+	require.NoError(t, err)
+
+	secondAttempt := model.DeliveryAttempt{
+		Success:   true,
+		Timestamp: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+	err = ds.UpdateEventDeliveryStatus(ctx, event.ID, model.DeliveryStatus{
+		IntegrationID: integrationID,
+		Success:       true,
+		Attempts:      []model.DeliveryAttempt{secondAttempt},
+	})
+	require.NoError(t, err)
+
+	res, err := ds.GetEvent(ctx, event.ID)
+	require.NoError(t, err)
+	require.Len(t, res.DeliveryStatus, 2)
+	assert.Equal(t, event.DeliveryStatus[0], res.DeliveryStatus[0])
+	assert.Equal(t, model.DeliveryStatus{
+		IntegrationID: integrationID,
+		Success:       true,
+		Attempts:      []model.DeliveryAttempt{firstAttempt, secondAttempt},
+	}, res.DeliveryStatus[1])
+
+	err = ds.UpdateEventDeliveryStatus(ctx, event.ID, model.DeliveryStatus{
+		IntegrationID: uuid.New(),
+	})
+	assert.ErrorIs(t, err, store.ErrObjectNotFound)
+}
+
+func TestGetEventsFilter(t *testing.T) {
+	t.Parallel()
+	const tenantID = "123456789012345678901234"
+	dbName := t.Name()
+	dbClient := db.Client()
+	defer dbClient.Database(dbName).Drop(context.Background())
+	ds := NewDataStoreWithClient(dbClient, NewConfig().SetDbName(dbName))
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenantID,
+	})
+	integrationA := uuid.New()
+	integrationB := uuid.New()
+	now := time.Now().Truncate(time.Millisecond)
+	newEvent := func(
+		ts time.Time,
+		typ model.EventType,
+		deviceID string,
+		statuses ...model.DeliveryStatus,
+	) model.Event {
+		return model.Event{
+			WebhookEvent: model.WebhookEvent{
+				ID:      uuid.New(),
+				Type:    typ,
+				Data:    model.DeviceEvent{ID: deviceID},
+				EventTS: ts,
+			},
+			DeliveryStatus: statuses,
+		}
+	}
+	events := []model.Event{
+		newEvent(now, model.EventTypeDeviceProvisioned, "foo",
+			model.DeliveryStatus{IntegrationID: integrationA, Success: true},
+			model.DeliveryStatus{IntegrationID: integrationB, Success: false},
+		),
+		newEvent(now.Add(-time.Minute), model.EventTypeDeviceStatusChanged, "foo",
+			model.DeliveryStatus{IntegrationID: integrationA, Success: false},
+		),
+		newEvent(now.Add(-2*time.Minute), model.EventTypeDeviceProvisioned, "bar",
+			model.DeliveryStatus{IntegrationID: integrationB, Success: true},
+		),
+		// Same timestamp as the previous event
+		newEvent(now.Add(-2*time.Minute), model.EventTypeDeviceDecommissioned, "bar"),
+	}
+	for i := range events {
+		// The newer events have greater sequence numbers
+		events[i].Sequence = int64(len(events) - i)
+	}
+	_, err := dbClient.Database(dbName).
+		Collection(CollNameLog).
+		InsertMany(ctx, mstore.ArrayWithTenantID(ctx, castInterfaceSlice(events)))
+	require.NoError(t, err)
+
+	boolPtr := func(b bool) *bool { return &b }
+	idsOf := func(events []model.Event) []uuid.UUID {
+		ids := make([]uuid.UUID, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+		return ids
+	}
+	// Events with the same timestamp are sorted by descending ID
+	sameTS := []uuid.UUID{events[2].ID, events[3].ID}
+	if bytes.Compare(sameTS[0][:], sameTS[1][:]) < 0 {
+		sameTS[0], sameTS[1] = sameTS[1], sameTS[0]
+	}
+
+	testCases := []struct {
+		Name   string
+		Filter model.EventsFilter
+		IDs    []uuid.UUID
+	}{{
+		Name:   "type",
+		Filter: model.EventsFilter{Type: model.EventTypeDeviceProvisioned},
+		IDs:    []uuid.UUID{events[0].ID, events[2].ID},
+	}, {
+		Name:   "device ID",
+		Filter: model.EventsFilter{DeviceID: "foo"},
+		IDs:    []uuid.UUID{events[0].ID, events[1].ID},
+	}, {
+		Name: "device ID and sequence",
+		Filter: model.EventsFilter{
+			DeviceID:      "foo",
+			SequenceAfter: events[1].Sequence,
+		},
+		IDs: []uuid.UUID{events[0].ID},
+	}, {
+		Name:   "integration ID",
+		Filter: model.EventsFilter{IntegrationID: integrationB},
+		IDs:    []uuid.UUID{events[0].ID, events[2].ID},
+	}, {
+		Name: "integration ID and success",
+		Filter: model.EventsFilter{
+			IntegrationID: integrationA,
+			Success:       boolPtr(false),
+		},
+		IDs: []uuid.UUID{events[1].ID},
+	}, {
+		Name:   "failed",
+		Filter: model.EventsFilter{Success: boolPtr(false)},
+		IDs:    []uuid.UUID{events[0].ID, events[1].ID},
+	}, {
+		Name:   "succeeded",
+		Filter: model.EventsFilter{Success: boolPtr(true)},
+		IDs:    sameTS,
+	}, {
+		Name: "time range",
+		Filter: model.EventsFilter{
+			From: now.Add(-time.Minute),
+			To:   now.Add(-time.Second),
+		},
+		IDs: []uuid.UUID{events[1].ID},
+	}, {
+		Name: "cursor",
+		Filter: model.EventsFilter{
+			Limit: 2,
+			After: &model.EventsCursor{
+				EventTS: events[1].EventTS,
+				ID:      events[1].ID,
+			},
+		},
+		IDs: sameTS,
+	}, {
+		Name: "cursor with same timestamp",
+		Filter: model.EventsFilter{
+			After: &model.EventsCursor{
+				EventTS: now.Add(-2 * time.Minute),
+				ID:      sameTS[0],
+			},
+		},
+		IDs: sameTS[1:],
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			res, err := ds.GetEvents(ctx, tc.Filter)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.IDs, idsOf(res))
+			}
+		})
+	}
+}
+
+func TestGetIntegrationHealth(t *testing.T) {
+	t.Parallel()
+	const tenantID = "123456789012345678901234"
+	dbName := t.Name()
+	dbClient := db.Client()
+	defer dbClient.Database(dbName).Drop(context.Background())
+	ds := NewDataStoreWithClient(dbClient, NewConfig().SetDbName(dbName))
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenantID,
+	})
+	integrationID := uuid.New()
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	statusOK := http.StatusOK
+	statusUnavailable := http.StatusServiceUnavailable
+	duration := func(ms int64) *int64 { return &ms }
+	newEvent := func(ts time.Time, status model.DeliveryStatus) model.Event {
+		return model.Event{
+			WebhookEvent: model.WebhookEvent{
+				ID:      uuid.New(),
+				Type:    model.EventTypeDeviceProvisioned,
+				Data:    model.DeviceEvent{ID: "foo"},
+				EventTS: ts,
+			},
+			DeliveryStatus: []model.DeliveryStatus{status, {
+				IntegrationID: uuid.New(),
+				Success:       true,
+			}},
+		}
+	}
+	events := []model.Event{
+		newEvent(now.Add(-time.Minute), model.DeliveryStatus{
+			IntegrationID: integrationID,
+			Success:       true,
+			StatusCode:    &statusOK,
+			Duration:      duration(10),
+		}),
+		// Retried delivery: the latest attempt is the most recent failure
+		newEvent(now.Add(-2*time.Hour), model.DeliveryStatus{
+			IntegrationID: integrationID,
+			Error:         "503 Service Unavailable",
+			StatusCode:    &statusUnavailable,
+			Duration:      duration(20),
+			Attempts: []model.DeliveryAttempt{{
+				Timestamp: now.Add(-2 * time.Hour),
+			}, {
+				Timestamp: now.Add(-30 * time.Minute),
+			}},
+		}),
+		newEvent(now.Add(-48*time.Hour), model.DeliveryStatus{
+			IntegrationID: integrationID,
+			Success:       true,
+			StatusCode:    &statusOK,
+			Duration:      duration(30),
+		}),
+		newEvent(now.Add(-time.Minute), model.DeliveryStatus{
+			IntegrationID: integrationID,
+			Success:       true,
+			Skipped:       true,
+		}),
+		// Older than a week
+		newEvent(now.Add(-8*24*time.Hour), model.DeliveryStatus{
+			IntegrationID: integrationID,
+			Error:         "connection refused",
+		}),
+	}
+	_, err := dbClient.Database(dbName).
+		Collection(CollNameLog).
+		InsertMany(ctx, mstore.ArrayWithTenantID(ctx, castInterfaceSlice(events)))
+	require.NoError(t, err)
+
+	health, err := ds.GetIntegrationHealth(ctx, integrationID, now)
+	require.NoError(t, err)
+	averageDuration := 20.0
+	assert.Equal(t, &model.IntegrationHealth{
+		LastHour: model.NewDeliveryStats(2, 1),
+		LastDay:  model.NewDeliveryStats(2, 1),
+		LastWeek: model.NewDeliveryStats(3, 2),
+		LastSuccess: &model.DeliveryOutcome{
+			EventID:    events[0].ID,
+			Timestamp:  events[0].EventTS,
+			StatusCode: &statusOK,
+		},
+		LastFailure: &model.DeliveryOutcome{
+			EventID:    events[1].ID,
+			Timestamp:  now.Add(-30 * time.Minute),
+			StatusCode: &statusUnavailable,
+			Error:      "503 Service Unavailable",
+		},
+		StatusCodes:     map[int]int64{statusOK: 2, statusUnavailable: 1},
+		AverageDuration: &averageDuration,
+	}, health)
+
+	health, err = ds.GetIntegrationHealth(ctx, uuid.New(), now)
+	require.NoError(t, err)
+	assert.Equal(t, model.NewDeliveryStats(0, 0), health.LastWeek)
+	assert.Nil(t, health.LastSuccess)
+	assert.Empty(t, health.StatusCodes)
+}
@@ -66,8 +66,8 @@ func TestCreateIntegration(t *testing.T) {
 			Tenant: "1234567890",
 		}),
 		Integration: model.Integration{
-			ID:       uuid.NewSHA1(uuid.NameSpaceOID, []byte("1234567890")),
 			Provider: model.ProviderIoTHub,
+			Name:     "hub",
 			Credentials: model.Credentials{
 				Type: "connection_string",
 				ConnectionString: &model.ConnectionString{
@@ -82,7 +82,6 @@ func TestCreateIntegration(t *testing.T) {
 
 		CTX: context.Background(),
 		Integration: model.Integration{
-			ID:       uuid.NewSHA1(uuid.NameSpaceOID, []byte("")),
 			Provider: model.ProviderIoTHub,
 			Credentials: model.Credentials{
 				Type: "connection_string",
@@ -122,7 +121,7 @@ func TestCreateIntegration(t *testing.T) {
 		t.Run(tc.Name, func(t *testing.T) {
 			t.Parallel()
 			defer dbClient.Database(dbName).Drop(context.Background())
-			_, err := ds.CreateIntegration(tc.CTX, tc.Integration)
+			created, err := ds.CreateIntegration(tc.CTX, tc.Integration)
 			if tc.Error != nil {
 				if assert.Error(t, err) {
 					assert.Regexp(t, tc.Error.Error(), err.Error())
@@ -154,7 +153,11 @@ func TestCreateIntegration(t *testing.T) {
 
 				var integration model.Integration
 				bson.UnmarshalWithRegistry(newRegistry(), doc, &integration)
-				assert.Equal(t, tc.Integration, integration)
+				assert.NotEqual(t, uuid.Nil, integration.ID)
+				assert.Equal(t, *created, integration)
+				expected := tc.Integration
+				expected.ID = integration.ID
+				assert.Equal(t, expected, integration)
 			}
 		})
 	}
@@ -503,6 +506,119 @@ func TestGetDevice(t *testing.T) {
 	}
 }
 
+func TestGetDevices(t *testing.T) {
+	t.Parallel()
+	dbClient := db.Client()
+	const tenantID = "123456789012345678901234"
+	integrationA := uuid.NewSHA1(uuid.NameSpaceOID, []byte("A"))
+	integrationB := uuid.NewSHA1(uuid.NameSpaceOID, []byte("B"))
+	devices := []model.Device{{
+		ID:             "1",
+		IntegrationIDs: []uuid.UUID{integrationA},
+	}, {
+		ID:             "2",
+		IntegrationIDs: []uuid.UUID{integrationA, integrationB},
+	}, {
+		ID:             "3",
+		IntegrationIDs: []uuid.UUID{integrationB},
+	}}
+	testCases := []struct {
+		Name string
+
+		CTX    context.Context
+		Filter model.DeviceFilter
+
+		Devices []model.Device
+		Error   error
+	}{
+		{
+			Name: "ok, all devices",
+			CTX: identity.WithContext(context.Background(), &identity.Identity{
+				Tenant: tenantID,
+			}),
+
+			Devices: devices,
+		},
+		{
+			Name: "ok, paginated",
+			CTX: identity.WithContext(context.Background(), &identity.Identity{
+				Tenant: tenantID,
+			}),
+			Filter: model.DeviceFilter{
+				Skip:  1,
+				Limit: 1,
+			},
+
+			Devices: devices[1:2],
+		},
+		{
+			Name: "ok, by integration",
+			CTX: identity.WithContext(context.Background(), &identity.Identity{
+				Tenant: tenantID,
+			}),
+			Filter: model.DeviceFilter{
+				IntegrationID: integrationB,
+			},
+
+			Devices: devices[1:],
+		},
+		{
+			Name: "ok, other tenant",
+			CTX: identity.WithContext(context.Background(), &identity.Identity{
+				Tenant: "111111111111111111111111",
+			}),
+
+			Devices: []model.Device{},
+		},
+		{
+			Name: "error, context canceled",
+			CTX: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			}(),
+			Error: context.Canceled,
+		},
+	}
+	for i := range testCases {
+		dbName := fmt.Sprintf("%s-%d", t.Name(), i)
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			defer dbClient.Database(dbName).Drop(context.Background())
+			collDevices := dbClient.
+				Database(dbName).
+				Collection(CollNameDevices)
+
+			ctx := identity.WithContext(context.Background(), &identity.Identity{
+				Tenant: tenantID,
+			})
+			docs := make([]interface{}, len(devices))
+			for i := range devices {
+				docs[i] = mstore.WithTenantID(ctx, devices[i])
+			}
+			_, err := collDevices.InsertMany(ctx, docs)
+			assert.NoError(t, err)
+
+			db := NewDataStoreWithClient(dbClient, NewConfig().
+				SetDbName(dbName))
+			result, err := db.GetDevices(tc.CTX, tc.Filter)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t,
+						tc.Error.Error(),
+						err.Error(),
+						"error did not match expected expression",
+					)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Devices, result)
+			}
+		})
+	}
+}
+
 func TestGetIntegrationById(t *testing.T) {
 	t.Parallel()
 	dbClient := db.Client()
@@ -532,6 +648,16 @@ func TestGetIntegrationById(t *testing.T) {
 			}),
 			Error: store.ErrObjectNotFound,
 		},
+		{
+			Name: "not found, other integration exists",
+			CTX: identity.WithContext(context.Background(), &identity.Identity{
+				Tenant: tenantID,
+			}),
+			Integration: &model.Integration{
+				ID: uuid.New(),
+			},
+			Error: store.ErrObjectNotFound,
+		},
 		{
 			Name: "error, context deadline exceeded",
 			CTX: func() context.Context {
@@ -675,6 +801,201 @@ func TestSetIntegrationCredentials(t *testing.T) {
 	}
 }
 
+func TestUpdateIntegration(t *testing.T) {
+	t.Parallel()
+	dbClient := db.Client()
+	const tenantID = "123456789012345678901234"
+	integrationID := uuid.New()
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenantID,
+	})
+	integration := model.Integration{
+		ID:       integrationID,
+		Provider: model.ProviderIoTHub,
+		Name:     "hub",
+		Credentials: model.Credentials{
+			Type: model.CredentialTypeSAS,
+			ConnectionString: &model.ConnectionString{
+				HostName: "test.azure-devices.net",
+				Name:     "test-policy",
+				Key:      crypto.String("secret"),
+			},
+		},
+		Version: 2,
+	}
+	testCases := []struct {
+		Name string
+
+		Document    interface{}
+		Integration model.Integration
+
+		Version int64
+		Error   error
+	}{{
+		Name: "ok",
+
+		Document: integration,
+		Integration: func() model.Integration {
+			itg := integration
+			itg.Name = "gateways"
+			itg.Description = "Azure IoT Hub for gateways"
+			return itg
+		}(),
+		Version: 3,
+	}, {
+		Name: "ok, integration without version",
+
+		Document: bson.D{
+			{Key: KeyID, Value: integrationID},
+			{Key: KeyProvider, Value: model.ProviderIoTHub},
+		},
+		Integration: func() model.Integration {
+			itg := integration
+			itg.Name = "gateways"
+			itg.Version = 0
+			return itg
+		}(),
+		Version: 1,
+	}, {
+		Name: "error, version mismatch",
+
+		Document: integration,
+		Integration: func() model.Integration {
+			itg := integration
+			itg.Version = 1
+			return itg
+		}(),
+		Error: store.ErrObjectNotFound,
+	}, {
+		Name: "error, integration not found",
+
+		Integration: integration,
+		Error:       store.ErrObjectNotFound,
+	}}
+	for i := range testCases {
+		dbName := fmt.Sprintf("%s-%d", t.Name(), i)
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			defer dbClient.Database(dbName).Drop(context.Background())
+			collIntegrations := dbClient.Database(dbName).Collection(CollNameIntegrations)
+
+			if tc.Document != nil {
+				_, err := collIntegrations.InsertOne(ctx,
+					mstore.WithTenantID(ctx, tc.Document),
+				)
+				assert.NoError(t, err)
+			}
+
+			db := NewDataStoreWithClient(dbClient, NewConfig().SetDbName(dbName))
+			result, err := db.UpdateIntegration(ctx, tc.Integration)
+			if tc.Error != nil {
+				if assert.Error(t, err) {
+					assert.Regexp(t,
+						tc.Error.Error(),
+						err.Error(),
+						"error did not match expected expression",
+					)
+				}
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.Version, result.Version)
+				assert.Equal(t, tc.Integration.Name, result.Name)
+				assert.Equal(t, tc.Integration.Description, result.Description)
+			}
+		})
+	}
+}
+
+func TestUpdateIntegrationCredentials(t *testing.T) {
+	t.Parallel()
+	dbClient := db.Client()
+	const tenantID = "123456789012345678901234"
+	integrationID := uuid.New()
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenantID,
+	})
+	secret := model.HexSecret("secret")
+	integration := model.Integration{
+		ID:       integrationID,
+		Provider: model.ProviderWebhook,
+		Credentials: model.Credentials{
+			Type: model.CredentialTypeHTTP,
+			HTTP: &model.HTTPCredentials{
+				URL: "https://example.com",
+			},
+		},
+		Version: 2,
+	}
+	credentials := model.Credentials{
+		Type: model.CredentialTypeHTTP,
+		HTTP: &model.HTTPCredentials{
+			URL:    "https://example.com",
+			Secret: &secret,
+		},
+	}
+	testCases := []struct {
+		Name string
+
+		Document interface{}
+		Version  int64
+
+		Error error
+	}{{
+		Name: "ok",
+
+		Document: integration,
+		Version:  2,
+	}, {
+		Name: "ok, integration without version",
+
+		Document: bson.D{
+			{Key: KeyID, Value: integrationID},
+			{Key: KeyProvider, Value: model.ProviderWebhook},
+		},
+		Version: 0,
+	}, {
+		Name: "error, version mismatch",
+
+		Document: integration,
+		Version:  1,
+		Error:    store.ErrObjectNotFound,
+	}, {
+		Name: "error, integration not found",
+
+		Version: 2,
+		Error:   store.ErrObjectNotFound,
+	}}
+	for i := range testCases {
+		dbName := fmt.Sprintf("%s-%d", t.Name(), i)
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			defer dbClient.Database(dbName).Drop(context.Background())
+			collIntegrations := dbClient.Database(dbName).Collection(CollNameIntegrations)
+
+			if tc.Document != nil {
+				_, err := collIntegrations.InsertOne(ctx,
+					mstore.WithTenantID(ctx, tc.Document),
+				)
+				assert.NoError(t, err)
+			}
+
+			db := NewDataStoreWithClient(dbClient, NewConfig().SetDbName(dbName))
+			err := db.UpdateIntegrationCredentials(ctx,
+				integrationID, tc.Version, credentials)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else if assert.NoError(t, err) {
+				result, err := db.GetIntegrationById(ctx, integrationID)
+				if assert.NoError(t, err) {
+					assert.Equal(t, tc.Version+1, result.Version)
+					assert.Equal(t, credentials, result.Credentials)
+				}
+			}
+		})
+	}
+}
+
 func TestRemoveIntegration(t *testing.T) {
 	t.Parallel()
 	dbClient := db.Client()
@@ -941,6 +1262,50 @@ func TestGetAndDeleteDevice(t *testing.T) {
 
 }
 
+func TestRemoveDeviceIntegration(t *testing.T) {
+	t.Parallel()
+	dbName := t.Name()
+	ds := NewDataStoreWithClient(
+		db.Client(),
+		NewConfig().SetDbName(dbName),
+	)
+
+	ctxEmpty := context.Background()
+	ctxTenant := identity.WithContext(ctxEmpty, &identity.Identity{
+		Tenant: "123456789012345678901234",
+	})
+	database := db.Client().Database(dbName)
+	defer database.Drop(ctxEmpty)
+	devices := testSetDevices()
+	insertDevices(ctxEmpty, database, devices[:5])
+	insertDevices(ctxTenant, database, devices[5:])
+
+	deviceID := devices[0].ID
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("2"))
+
+	// The device belongs to another tenant
+	err := ds.RemoveDeviceIntegration(ctxTenant, deviceID, integrationID)
+	assert.EqualError(t, err, store.ErrObjectNotFound.Error())
+
+	err = ds.RemoveDeviceIntegration(ctxEmpty, deviceID, integrationID)
+	assert.NoError(t, err)
+	dev, err := ds.GetDevice(ctxEmpty, deviceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{
+		uuid.NewSHA1(uuid.NameSpaceOID, []byte("1")),
+		uuid.NewSHA1(uuid.NameSpaceOID, []byte("3")),
+	}, dev.IntegrationIDs)
+
+	// The device is no longer connected to the integration
+	err = ds.RemoveDeviceIntegration(ctxEmpty, deviceID, integrationID)
+	assert.EqualError(t, err, store.ErrObjectNotFound.Error())
+
+	ctxCancelled, cancel := context.WithCancel(ctxEmpty)
+	cancel()
+	err = ds.RemoveDeviceIntegration(ctxCancelled, deviceID, integrationID)
+	assert.Error(t, err)
+}
+
 func TestGetDeviceByIntegrationID(tp *testing.T) {
 	tp.Parallel()
 	testCases := []struct {
@@ -1210,6 +1575,8 @@ func TestDeleteTenantData(t *testing.T) {
 				database.Collection(CollNameLog),
 				database.Collection(CollNameDevices),
 				database.Collection(CollNameIntegrations),
+				database.Collection(CollNameDeliveries),
+				database.Collection(CollNameSequences),
 			}
 			ctx := context.Background()
 
@@ -0,0 +1,70 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+)
+
+const (
+	IndexNameIntegrationsUnique = KeyTenantID + "_" + KeyProvider + "_" + KeyName
+)
+
+type migration_1_2_0 struct {
+	client *mongo.Client
+	db     string
+}
+
+// Up sets an empty name on existing integrations and creates a unique index
+// on (tenant_id, provider, name) allowing multiple integrations per tenant.
+func (m *migration_1_2_0) Up(from migrate.Version) error {
+	ctx := context.Background()
+	collIntegrations := m.client.
+		Database(m.db).
+		Collection(CollNameIntegrations)
+
+	_, err := collIntegrations.UpdateMany(ctx,
+		bson.D{{Key: KeyName, Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: KeyName, Value: ""}}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	itgModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: KeyTenantID, Value: 1},
+			{Key: KeyProvider, Value: 1},
+			{Key: KeyName, Value: 1},
+		},
+		Options: mopts.Index().
+			SetName(IndexNameIntegrationsUnique).
+			SetUnique(true),
+	}
+	_, err = collIntegrations.
+		Indexes().
+		CreateOne(ctx, itgModel)
+	return err
+}
+
+func (m *migration_1_2_0) Version() migrate.Version {
+	return migrate.MakeVersion(1, 2, 0)
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+)
+
+func TestMigration_1_2_0(t *testing.T) {
+	ctx := context.Background()
+	client := db.Client()
+	collIntegrations := client.Database(DbName).
+		Collection(CollNameIntegrations)
+	integrationID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("tenant"))
+	_, err := collIntegrations.InsertOne(ctx, bson.D{
+		{Key: KeyID, Value: integrationID},
+		{Key: KeyTenantID, Value: "tenant"},
+		{Key: KeyProvider, Value: "iot-hub"},
+	})
+	require.NoError(t, err)
+
+	m := &migration_1_2_0{
+		client: client,
+		db:     DbName,
+	}
+	from := migrate.MakeVersion(0, 0, 0)
+
+	err = m.Up(from)
+	require.NoError(t, err)
+
+	var doc bson.M
+	err = collIntegrations.FindOne(ctx,
+		bson.D{{Key: KeyID, Value: integrationID}},
+	).Decode(&doc)
+	require.NoError(t, err)
+	assert.Equal(t, "", doc[KeyName], "migration did not set integration name")
+
+	specs, err := collIntegrations.
+		Indexes().
+		ListSpecifications(ctx)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var foundIndex bool
+	for _, spec := range specs {
+		if spec == nil {
+			continue
+		}
+		if spec.Name == IndexNameIntegrationsUnique {
+			foundIndex = true
+			assert.True(t, spec.Unique != nil && *spec.Unique,
+				"unique property not set")
+			var keys bson.D
+			_ = bson.Unmarshal(spec.KeysDocument, &keys)
+			assert.Equal(t, bson.D{
+				{Key: KeyTenantID, Value: int32(1)},
+				{Key: KeyProvider, Value: int32(1)},
+				{Key: KeyName, Value: int32(1)},
+			}, keys, "unexpected index keys")
+			break
+		}
+	}
+	assert.True(t, foundIndex, "Failed to find index created by migration 1.2.0")
+
+	// Inserting another integration with the same provider and name fails
+	_, err = collIntegrations.InsertOne(ctx, bson.D{
+		{Key: KeyID, Value: uuid.New()},
+		{Key: KeyTenantID, Value: "tenant"},
+		{Key: KeyProvider, Value: "iot-hub"},
+		{Key: KeyName, Value: ""},
+	})
+	assert.True(t, isDuplicateKeyError(err), "expected duplicate key error")
+	assert.Equal(t, "1.2.0", m.Version().String())
+}
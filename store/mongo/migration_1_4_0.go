@@ -0,0 +1,80 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+)
+
+const (
+	IndexNameEventsCursor = KeyTenantID + "_" + KeyEventTs + "_" + KeyID
+	IndexNameEventsType   = KeyTenantID + "_" + KeyType + "_" + KeyEventTs + "_" + KeyID
+	IndexNameEventsDevice = KeyTenantID + "_" + KeyEventDeviceID + "_" +
+		KeyEventTs + "_" + KeyID
+	IndexNameEventsIntegration = KeyTenantID + "_" + KeyEventDeliveryStatus + "." +
+		KeyIntegrationID + "_" + KeyEventTs + "_" + KeyID
+	IndexNameEventsSuccess = KeyTenantID + "_" + KeyEventDeliveryStatus + "." +
+		KeySuccess + "_" + KeyEventTs + "_" + KeyID
+)
+
+type migration_1_4_0 struct {
+	client *mongo.Client
+	db     string
+}
+
+// Up creates the indexes for filtering events and paging through the
+// results sorted by (event_ts, _id).
+func (m *migration_1_4_0) Up(from migrate.Version) error {
+	ctx := context.Background()
+	newModel := func(name string, key string) mongo.IndexModel {
+		keys := bson.D{{Key: KeyTenantID, Value: 1}}
+		if key != "" {
+			keys = append(keys, bson.E{Key: key, Value: 1})
+		}
+		keys = append(keys,
+			bson.E{Key: KeyEventTs, Value: -1},
+			bson.E{Key: KeyID, Value: -1},
+		)
+		return mongo.IndexModel{
+			Keys:    keys,
+			Options: mopts.Index().SetName(name),
+		}
+	}
+	idxEvents := m.client.
+		Database(m.db).
+		Collection(CollNameLog).
+		Indexes()
+
+	_, err := idxEvents.CreateMany(ctx, []mongo.IndexModel{
+		newModel(IndexNameEventsCursor, ""),
+		newModel(IndexNameEventsType, KeyType),
+		newModel(IndexNameEventsDevice, KeyEventDeviceID),
+		newModel(IndexNameEventsIntegration,
+			KeyEventDeliveryStatus+"."+KeyIntegrationID),
+		newModel(IndexNameEventsSuccess,
+			KeyEventDeliveryStatus+"."+KeySuccess),
+	})
+	return err
+}
+
+func (m *migration_1_4_0) Version() migrate.Version {
+	return migrate.MakeVersion(1, 4, 0)
+}
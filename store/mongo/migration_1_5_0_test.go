@@ -0,0 +1,73 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+
+	"github.com/mendersoftware/iot-manager/model"
+)
+
+func TestMigration_1_5_0(t *testing.T) {
+	ctx := context.Background()
+	client := db.Client()
+	dbName := t.Name()
+	defer client.Database(dbName).Drop(ctx)
+	m := &migration_1_5_0{
+		client: client,
+		db:     dbName,
+	}
+	from := migrate.MakeVersion(0, 0, 0)
+
+	webhookID := uuid.New()
+	hubID := uuid.New()
+	collIntegrations := client.Database(dbName).Collection(CollNameIntegrations)
+	_, err := collIntegrations.InsertMany(ctx, []interface{}{
+		bson.D{
+			{Key: KeyID, Value: webhookID},
+			{Key: KeyProvider, Value: model.ProviderWebhook},
+		},
+		bson.D{
+			{Key: KeyID, Value: hubID},
+			{Key: KeyProvider, Value: model.ProviderIoTHub},
+		},
+	})
+	require.NoError(t, err)
+
+	err = m.Up(from)
+	require.NoError(t, err)
+
+	var integration model.Integration
+	err = collIntegrations.FindOne(ctx, bson.D{{Key: KeyID, Value: webhookID}}).
+		Decode(&integration)
+	require.NoError(t, err)
+	assert.Equal(t, model.IntegrationStateActive, integration.State)
+
+	integration = model.Integration{}
+	err = collIntegrations.FindOne(ctx, bson.D{{Key: KeyID, Value: hubID}}).
+		Decode(&integration)
+	require.NoError(t, err)
+	assert.Empty(t, integration.State)
+
+	assert.Equal(t, "1.5.0", m.Version().String())
+}
@@ -26,7 +26,7 @@ import (
 
 const (
 	// DbVersion is the current schema version
-	DbVersion = "1.1.1"
+	DbVersion = "1.6.0"
 
 	// DbName is the database name
 	DbName = "iot_manager"
@@ -66,6 +66,26 @@ func Migrate(ctx context.Context,
 			client: client,
 			db:     db,
 		},
+		&migration_1_2_0{
+			client: client,
+			db:     db,
+		},
+		&migration_1_3_0{
+			client: client,
+			db:     db,
+		},
+		&migration_1_4_0{
+			client: client,
+			db:     db,
+		},
+		&migration_1_5_0{
+			client: client,
+			db:     db,
+		},
+		&migration_1_6_0{
+			client: client,
+			db:     db,
+		},
 	}
 
 	err = m.Apply(ctx, *ver, migrations)
@@ -0,0 +1,132 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package tracing sets up the OpenTelemetry tracing of the service.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ServiceName is the name of the service reported in the spans.
+	ServiceName = "iot-manager"
+
+	tracerName = "github.com/mendersoftware/iot-manager"
+)
+
+// Setup installs the W3C trace context propagator and, if the endpoint is
+// not empty, a tracer provider exporting the spans over OTLP/HTTP to the
+// endpoint URL. Without an endpoint the spans are not recorded, but the
+// trace context of the incoming requests is still propagated to the
+// outgoing requests. The returned function flushes the pending spans.
+func Setup(ctx context.Context, endpoint string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, errors.Wrap(err, "tracing: failed to create the OTLP exporter")
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "tracing: failed to create the resource")
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a span for every request handled by the router,
+// continuing the trace context of the request.
+func Middleware() gin.HandlerFunc {
+	return otelgin.Middleware(ServiceName)
+}
+
+// NewTransport wraps the transport starting a span for every request and
+// injecting the trace context into the request headers. A nil transport
+// defaults to http.DefaultTransport.
+func NewTransport(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(transport)
+}
+
+// InstrumentClient returns a copy of the client with the transport
+// instrumented for tracing.
+func InstrumentClient(client *http.Client) *http.Client {
+	if client == nil {
+		client = new(http.Client)
+	}
+	instrumented := *client
+	instrumented.Transport = NewTransport(client.Transport)
+	return &instrumented
+}
+
+// InstrumentExternalClient returns a copy of the client with the transport
+// instrumented for tracing, for requests to third-party receivers such as
+// webhooks: only the trace context is injected into the request headers,
+// the baggage of the incoming requests is not forwarded.
+func InstrumentExternalClient(client *http.Client) *http.Client {
+	if client == nil {
+		client = new(http.Client)
+	}
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	instrumented := *client
+	instrumented.Transport = otelhttp.NewTransport(transport,
+		otelhttp.WithPropagators(propagation.TraceContext{}),
+	)
+	return &instrumented
+}
+
+// StartLinkedSpan starts a span in a new trace for work outliving the
+// request in origin, e.g. a goroutine spawned by the request handler. The
+// span is linked to the span of the originating request.
+func StartLinkedSpan(
+	ctx context.Context,
+	origin context.Context,
+	name string,
+) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(origin)),
+	)
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// withSpanRecorder installs a tracer provider recording the spans for the
+// duration of the test.
+func withSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return recorder
+}
+
+func TestSetup(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(prev)
+
+	shutdown, err := Setup(context.Background(), "")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+	assert.Contains(t, otel.GetTextMapPropagator().Fields(), "traceparent")
+	assert.Equal(t, prev, otel.GetTracerProvider(),
+		"the tracer provider must not be set without an endpoint")
+
+	shutdown, err = Setup(context.Background(), "http://localhost:4318")
+	require.NoError(t, err)
+	assert.IsType(t, &sdktrace.TracerProvider{}, otel.GetTracerProvider())
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := withSpanRecorder(t)
+	_, err := Setup(context.Background(), "")
+	require.NoError(t, err)
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/devices/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	const traceID = "0af7651916cd43dd8448eb211c80319c"
+	req, _ := http.NewRequest(http.MethodGet, "/devices/1", nil)
+	req.Header.Set("Traceparent", "00-"+traceID+"-b7ad6b7169203331-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "/devices/:id", spans[0].Name())
+		assert.Equal(t, traceID, spans[0].SpanContext().TraceID().String())
+	}
+}
+
+func TestInstrumentClient(t *testing.T) {
+	withSpanRecorder(t)
+	_, err := Setup(context.Background(), "")
+	require.NoError(t, err)
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := new(http.Client)
+	instrumented := InstrumentClient(client)
+	assert.Nil(t, client.Transport, "the client must not be modified")
+
+	ctx, span := otel.Tracer(tracerName).Start(context.Background(), "test")
+	defer span.End()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL, nil)
+	rsp, err := instrumented.Do(req)
+	require.NoError(t, err)
+	rsp.Body.Close()
+
+	assert.Contains(t, traceparent, span.SpanContext().TraceID().String())
+}
+
+func TestInstrumentExternalClient(t *testing.T) {
+	withSpanRecorder(t)
+	_, err := Setup(context.Background(), "")
+	require.NoError(t, err)
+
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	member, _ := baggage.NewMember("user", "secret")
+	bag, _ := baggage.New(member)
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "test")
+	defer span.End()
+
+	for _, tc := range []struct {
+		client  *http.Client
+		baggage bool
+	}{
+		{client: InstrumentClient(nil), baggage: true},
+		{client: InstrumentExternalClient(nil), baggage: false},
+	} {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL, nil)
+		rsp, err := tc.client.Do(req)
+		require.NoError(t, err)
+		rsp.Body.Close()
+
+		assert.Contains(t, header.Get("Traceparent"), span.SpanContext().TraceID().String())
+		if tc.baggage {
+			assert.Equal(t, "user=secret", header.Get("Baggage"))
+		} else {
+			assert.Empty(t, header.Get("Baggage"),
+				"the baggage must not be forwarded to external receivers")
+		}
+	}
+}
+
+func TestStartLinkedSpan(t *testing.T) {
+	recorder := withSpanRecorder(t)
+
+	origin, originSpan := otel.Tracer(tracerName).Start(context.Background(), "request")
+	originSpan.End()
+
+	_, span := StartLinkedSpan(context.Background(), origin, "task")
+	span.End()
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		task := spans[1]
+		assert.Equal(t, "task", task.Name())
+		assert.False(t, task.Parent().IsValid(), "the task must start a new trace")
+		assert.NotEqual(t, originSpan.SpanContext().TraceID(), task.SpanContext().TraceID())
+		if assert.Len(t, task.Links(), 1) {
+			assert.Equal(t, originSpan.SpanContext(), task.Links()[0].SpanContext)
+		}
+	}
+}